@@ -2,74 +2,228 @@ package main
 
 import (
 	"context"
-	// "fmt"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
 	"Aoiler/services"
+
+	"github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
+// eventPrefix namespaces the Wails events emitted for queries, e.g. "aoiler:token"
+const eventPrefix = "aoiler:"
+
 type App struct {
 	ctx            context.Context
 	serviceManager *services.ServiceManager
-	fileSearch     *services.FileSearchService
+	// socket serves queries from scripts and keybinds while the window is open
+	socket *socketServer
+
+	mu            sync.Mutex
+	activeSession string
+	// running holds the cancel function of every query still in progress
+	running map[string]context.CancelFunc
 }
 
 type QueryRequest struct {
 	Query string `json:"query"`
+	// RequestID is optional; the frontend can pick one so it is ready to
+	// receive events before ProcessQuery returns
+	RequestID string `json:"requestId,omitempty"`
+	// SessionID continues a specific conversation. Queries from the window
+	// default to the active one; socket queries start a new one.
+	SessionID string `json:"sessionId,omitempty"`
 }
 
 type QueryResponse struct {
-	Success bool        `json:"success"`
-	Service string      `json:"service"`
-	Result  interface{} `json:"result"`
-	Error   string      `json:"error,omitempty"`
+	RequestID string      `json:"requestId"`
+	Pending   bool        `json:"pending,omitempty"`
+	Success   bool        `json:"success"`
+	Service   string      `json:"service"`
+	Result    interface{} `json:"result"`
+	Error     string      `json:"error,omitempty"`
+	Cancelled bool        `json:"cancelled,omitempty"`
 }
 
 // NewApp creates a new App application struct
 func NewApp() *App {
 	return &App{
 		serviceManager: services.NewServiceManager(),
-		fileSearch:     services.NewFileSearchService(),
+		running:        make(map[string]context.CancelFunc),
 	}
 }
+
 // startup is called when the app starts
 func (a *App) startup(ctx context.Context) {
 	a.ctx = ctx
 	// a.services = services.NewServiceManager()
+
+	// Pick up edits to aoiler.toml without a restart
+	if err := a.serviceManager.Config().Watch(); err != nil {
+		runtime.LogWarningf(ctx, "config reload disabled: %v", err)
+	}
+
+	// A running daemon keeps the socket; queries from scripts then go there
+	socket, err := listenSocket(a, socketPath())
+	if err != nil {
+		runtime.LogWarningf(ctx, "query socket disabled: %v", err)
+		return
+	}
+	a.socket = socket
+	go socket.serve()
 }
 
-// ProcessQuery handles the main query processing
-func (a *App) ProcessQuery(req QueryRequest) QueryResponse {
-	intent := a.serviceManager.ClassifyIntent(req.Query)
-	result, err := a.serviceManager.RouteToService(intent, req.Query)
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	if a.socket != nil {
+		a.socket.Close()
+	}
+	a.serviceManager.Close()
+}
 
+// ProcessQuery starts the query in the background. It returns the request
+// ID right away; output arrives as "aoiler:token" events followed by a final
+// "aoiler:done" or "aoiler:error" event carrying the complete QueryResponse,
+// or "aoiler:cancelled" after CancelQuery. The final event names the service
+// that ran, or "disambiguate" with the services to choose from. A "/name" or
+// "@name" prefix forces a service.
+func (a *App) ProcessQuery(req QueryRequest) QueryResponse {
+	resp, err := a.startQuery(req, a.emit, true)
 	if err != nil {
-		return QueryResponse{
-			Success: false,
-			Service: intent.ServiceName,
-			Error:   err.Error(),
-		}
+		return QueryResponse{RequestID: req.RequestID, Success: false, Error: err.Error()}
+	}
+	return resp
+}
+
+// startQuery runs a query in the background, sending its events to sink.
+// Only queries from the window continue and update the active session.
+func (a *App) startQuery(req QueryRequest, sink services.EventSink, fromWindow bool) (QueryResponse, error) {
+	requestID := req.RequestID
+	if requestID == "" {
+		requestID = services.NewRequestID()
+	}
+
+	ctx, cancel := context.WithCancel(services.WithRequest(a.ctx, requestID, sink))
+	a.mu.Lock()
+	if _, exists := a.running[requestID]; exists {
+		a.mu.Unlock()
+		cancel()
+		return QueryResponse{}, fmt.Errorf("a query with id %s is already running", requestID)
+	}
+	a.running[requestID] = cancel
+	a.mu.Unlock()
+
+	sessionID := req.SessionID
+	if sessionID == "" && fromWindow {
+		sessionID = a.currentSession()
 	}
+	go a.runQuery(ctx, requestID, req.Query, sessionID, fromWindow)
 
 	return QueryResponse{
-		Success: true,
-		Service: intent.ServiceName,
-		Result:  result,
+		RequestID: requestID,
+		Pending:   true,
+		Success:   true,
+	}, nil
+}
+
+// runQuery resolves and executes the query and reports the outcome as an
+// event. A query that fits several services equally well is answered with
+// the options instead.
+func (a *App) runQuery(ctx context.Context, requestID, query, sessionID string, fromWindow bool) {
+	defer a.finishQuery(requestID)
+
+	// Ranking asks hyprctl and the application list, so it is done once
+	candidates := a.serviceManager.RankIntents(query)
+	if choice, ok := a.serviceManager.Disambiguate(query, candidates); ok {
+		services.Emit(ctx, services.EventDone, QueryResponse{
+			RequestID: requestID,
+			Success:   true,
+			Service:   services.DisambiguateService,
+			Result:    choice,
+		})
+		return
 	}
+
+	intent := a.serviceManager.ResolveIntent(ctx, query, candidates)
+	intent.SessionID = sessionID
+
+	result, err := a.serviceManager.RouteToService(ctx, intent)
+
+	// Follow-up questions in the window continue the conversation the LLM
+	// just answered in
+	if llmResult, ok := result.(services.LLMResult); ok && llmResult.SessionID != "" && fromWindow {
+		a.setCurrentSession(llmResult.SessionID)
+	}
+
+	if errors.Is(err, services.ErrCancelled) {
+		services.Emit(ctx, services.EventCancelled, QueryResponse{
+			RequestID: requestID,
+			Success:   false,
+			Service:   intent.ServiceName,
+			Result:    result,
+			Error:     err.Error(),
+			Cancelled: true,
+		})
+		return
+	}
+
+	if err != nil {
+		services.Emit(ctx, services.EventError, QueryResponse{
+			RequestID: requestID,
+			Success:   false,
+			Service:   intent.ServiceName,
+			Error:     err.Error(),
+		})
+		return
+	}
+
+	services.Emit(ctx, services.EventDone, QueryResponse{
+		RequestID: requestID,
+		Success:   true,
+		Service:   intent.ServiceName,
+		Result:    result,
+	})
 }
 
-// GetAvailableServices returns list of available services
-func (a *App) GetAvailableServices() []ServiceInfo {
-	return []ServiceInfo{
-		{Name: "filesearch", Description: "Find files and directories"},
-		{Name: "organizer", Description: "Organize files with kondo"},
-		{Name: "linter", Description: "Lint and format code files"},
-		{Name: "ocr", Description: "Extract text from screen area"},
-		{Name: "converter", Description: "Convert media files with ffmpeg"},
-		{Name: "llm", Description: "Query LLM for assistance"},
+// CancelQuery stops a running query. The external processes it started are
+// terminated and the query reports an "aoiler:cancelled" event.
+func (a *App) CancelQuery(requestID string) error {
+	a.mu.Lock()
+	cancel, ok := a.running[requestID]
+	a.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no running query with id %s", requestID)
+	}
+	cancel()
+	return nil
+}
+
+// finishQuery forgets a query once it has reported its outcome
+func (a *App) finishQuery(requestID string) {
+	a.mu.Lock()
+	cancel, ok := a.running[requestID]
+	delete(a.running, requestID)
+	a.mu.Unlock()
+	if ok {
+		cancel()
 	}
 }
 
+// emit forwards a service event to the frontend
+func (a *App) emit(event services.Event) {
+	runtime.EventsEmit(a.ctx, eventPrefix+event.Type, event)
+}
+
+// GetAvailableServices returns list of available services
+func (a *App) GetAvailableServices() []services.ServiceInfo {
+	return a.serviceManager.Services()
+}
+
 func (a *App) GetPathSuggestions(input string) services.AutoCompleteResult {
-	result, err := a.fileSearch.GetPathSuggestions(input, false)
+	result, err := a.serviceManager.GetPathSuggestions(input)
 	if err != nil {
 		return services.AutoCompleteResult{
 			Suggestions: []string{},
@@ -78,7 +232,175 @@ func (a *App) GetPathSuggestions(input string) services.AutoCompleteResult {
 	}
 	return result
 }
-type ServiceInfo struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
+
+// GetConfig returns the contents of aoiler.toml, with defaults for missing values
+func (a *App) GetConfig() services.Config {
+	return a.serviceManager.Config().Get()
+}
+
+// SaveConfig writes aoiler.toml and applies it right away
+func (a *App) SaveConfig(cfg services.Config) error {
+	return a.serviceManager.Config().Save(cfg)
+}
+
+// GetConfigPath returns the location of aoiler.toml
+func (a *App) GetConfigPath() string {
+	return a.serviceManager.Config().Path()
+}
+
+// GetLLMProviders returns the configured providers in priority order
+func (a *App) GetLLMProviders() []string {
+	return a.serviceManager.LLM().GetAvailableProviders()
+}
+
+// GetCurrentLLMProvider returns the provider answering LLM queries
+func (a *App) GetCurrentLLMProvider() string {
+	return a.serviceManager.LLM().GetCurrentProvider()
+}
+
+// SetLLMProvider switches provider until the config is next reloaded
+func (a *App) SetLLMProvider(provider string) error {
+	return a.serviceManager.LLM().SetProvider(services.LLMProvider(provider))
+}
+
+// ListModels returns the models offered by a provider's server
+func (a *App) ListModels(provider string) ([]string, error) {
+	return a.serviceManager.LLM().ListModels(a.ctx, services.LLMProvider(provider))
+}
+
+// GetLinterTools returns the formatters and linters in the order they are
+// tried, with whether each one is installed
+func (a *App) GetLinterTools() []services.LinterToolStatus {
+	return a.serviceManager.Linter().Tools()
+}
+
+// ApplyFormat writes the formatting shown by a preview
+func (a *App) ApplyFormat(previewID string) (services.LinterResult, error) {
+	return a.serviceManager.Linter().ApplyFormat(previewID)
+}
+
+// RevertFormat restores a file to its content before formatting was applied
+func (a *App) RevertFormat(backupID string) (services.LinterResult, error) {
+	return a.serviceManager.Linter().RevertFormat(backupID)
+}
+
+// GetOCRLanguages returns the languages tesseract can read
+func (a *App) GetOCRLanguages() ([]string, error) {
+	return a.serviceManager.OCR().Languages(a.ctx)
+}
+
+// SearchOCRHistory returns the captures matching a query such as "invoices
+// yesterday"; an empty query lists them all
+func (a *App) SearchOCRHistory(query string) ([]services.OCRCapture, error) {
+	return a.serviceManager.OCRHistory().Search(services.ParseOCRHistoryQuery(query, time.Now()))
+}
+
+// PinOCRCapture pins or unpins a capture in the OCR history
+func (a *App) PinOCRCapture(id string, pinned bool) error {
+	return a.serviceManager.OCRHistory().Pin(id, pinned)
+}
+
+// DeleteOCRCapture removes a capture from the OCR history
+func (a *App) DeleteOCRCapture(id string) error {
+	return a.serviceManager.OCRHistory().Delete(id)
+}
+
+// CopyOCRCapture copies the text of a capture to the clipboard again
+func (a *App) CopyOCRCapture(id string) error {
+	return a.serviceManager.OCRHistory().Copy(a.ctx, id)
+}
+
+// GetOCRThumbnail returns the thumbnail of a capture as a data URL
+func (a *App) GetOCRThumbnail(id string) (string, error) {
+	return a.serviceManager.OCRHistory().Thumbnail(id)
+}
+
+// LaunchApp starts an application, or one of its desktop actions
+func (a *App) LaunchApp(id, action string) error {
+	_, _, err := a.serviceManager.Launcher().Launch(a.ctx, id, action)
+	return err
+}
+
+// ConfirmToolCall allows or declines a tool call the LLM wants to make
+func (a *App) ConfirmToolCall(id string, approved bool) error {
+	return a.serviceManager.Toolbox().Confirm(id, approved)
+}
+
+// ExecuteOrganize carries out a dry-run organize plan
+func (a *App) ExecuteOrganize(planID string) (services.OrganizerResult, error) {
+	return a.serviceManager.Organizer().Execute(a.ctx, planID)
+}
+
+// UndoOrganize moves the files of the last executed organize back
+func (a *App) UndoOrganize() (services.OrganizerResult, error) {
+	return a.serviceManager.Organizer().Undo(a.ctx)
+}
+
+// ListSessions returns the saved conversations, most recent first
+func (a *App) ListSessions() ([]services.SessionSummary, error) {
+	return a.serviceManager.Sessions().List()
+}
+
+// ResumeSession makes the session the target of follow-up questions and
+// returns its full history
+func (a *App) ResumeSession(id string) (*services.ChatSession, error) {
+	session, err := a.serviceManager.Sessions().Load(id)
+	if err != nil {
+		return nil, err
+	}
+	a.setCurrentSession(session.ID)
+	return session, nil
+}
+
+// NewSession starts a fresh conversation with the next LLM query
+func (a *App) NewSession() {
+	a.setCurrentSession("")
+}
+
+// CurrentSession returns the ID of the active conversation, if any
+func (a *App) CurrentSession() string {
+	return a.currentSession()
+}
+
+// RenameSession changes the title of a conversation
+func (a *App) RenameSession(id, title string) error {
+	return a.serviceManager.Sessions().Rename(id, title)
+}
+
+// DeleteSession removes a conversation
+func (a *App) DeleteSession(id string) error {
+	if err := a.serviceManager.Sessions().Delete(id); err != nil {
+		return err
+	}
+	if a.currentSession() == id {
+		a.setCurrentSession("")
+	}
+	return nil
+}
+
+// ExportSession renders a conversation as Markdown. When path is set the
+// document is also written there.
+func (a *App) ExportSession(id, path string) (string, error) {
+	markdown, err := a.serviceManager.Sessions().ExportMarkdown(id)
+	if err != nil {
+		return "", err
+	}
+	if path != "" {
+		if err := os.WriteFile(path, []byte(markdown), 0644); err != nil {
+			return "", fmt.Errorf("failed to write export: %w", err)
+		}
+	}
+	return markdown, nil
+}
+
+func (a *App) currentSession() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.activeSession
+}
+
+func (a *App) setCurrentSession(id string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.activeSession = id
 }
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"Aoiler/services"
+)
+
+// socketReply is a line received from the socket
+type socketReply struct {
+	RequestID string          `json:"requestId"`
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// socketClient talks to a running daemon or window
+type socketClient struct {
+	conn    net.Conn
+	mu      sync.Mutex
+	encoder *json.Encoder
+	replies *bufio.Scanner
+}
+
+func dialSocket() (*socketClient, error) {
+	path := socketPath()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("nothing is serving %s; start Aoiler or run \"aoiler daemon\": %w", path, err)
+	}
+	replies := bufio.NewScanner(conn)
+	replies.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &socketClient{conn: conn, encoder: json.NewEncoder(conn), replies: replies}, nil
+}
+
+func (c *socketClient) send(req socketRequest) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.encoder.Encode(req)
+}
+
+// next returns the next reply, or io.EOF once the server hangs up
+func (c *socketClient) next() (socketReply, error) {
+	var reply socketReply
+	if !c.replies.Scan() {
+		if err := c.replies.Err(); err != nil {
+			return reply, err
+		}
+		return reply, io.EOF
+	}
+	if err := json.Unmarshal(c.replies.Bytes(), &reply); err != nil {
+		return reply, fmt.Errorf("invalid reply: %w", err)
+	}
+	return reply, nil
+}
+
+// runQueryCommand implements "aoiler query": it sends a query to the socket
+// and prints the result. LLM answers are printed as they stream in.
+func runQueryCommand(args []string) int {
+	flags := flag.NewFlagSet("query", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the final response as JSON")
+	session := flags.String("session", "", "LLM session to continue")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: aoiler query [--json] [--session ID] \"query\"")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+	query := strings.TrimSpace(strings.Join(flags.Args(), " "))
+	if query == "" {
+		flags.Usage()
+		return 2
+	}
+
+	client, err := dialSocket()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		return 1
+	}
+	defer client.conn.Close()
+
+	requestID := services.NewRequestID()
+	if err := client.send(socketRequest{Op: opQuery, Query: query, RequestID: requestID, SessionID: *session}); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		return 1
+	}
+
+	// Ctrl-C cancels the query rather than leaving it running
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupts)
+	go func() {
+		for range interrupts {
+			client.send(socketRequest{Op: opCancel, RequestID: requestID})
+		}
+	}()
+
+	stdin := bufio.NewReader(os.Stdin)
+	streamed := false
+	for {
+		reply, err := client.next()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "aoiler: connection lost before the query finished: %v\n", err)
+			return 1
+		}
+		if reply.RequestID != requestID {
+			continue
+		}
+
+		switch reply.Type {
+		case services.EventToken:
+			if !*asJSON {
+				var token string
+				json.Unmarshal(reply.Data, &token)
+				fmt.Print(token)
+				streamed = true
+			}
+
+		case services.EventConfirm:
+			var confirmation services.ToolConfirmation
+			json.Unmarshal(reply.Data, &confirmation)
+			approved := askConfirmation(stdin, confirmation)
+			client.send(socketRequest{Op: opConfirm, RequestID: requestID, ID: confirmation.ID, Approved: approved})
+
+		case replyRejected:
+			var message string
+			json.Unmarshal(reply.Data, &message)
+			fmt.Fprintf(os.Stderr, "aoiler: %s\n", message)
+			return 1
+
+		case services.EventDone, services.EventError, services.EventCancelled:
+			var resp QueryResponse
+			if err := json.Unmarshal(reply.Data, &resp); err != nil {
+				fmt.Fprintf(os.Stderr, "aoiler: invalid reply: %v\n", err)
+				return 1
+			}
+			if *asJSON {
+				out, _ := json.MarshalIndent(resp, "", "  ")
+				fmt.Println(string(out))
+			} else {
+				printResponse(resp, streamed)
+			}
+
+			switch reply.Type {
+			case services.EventDone:
+				return 0
+			case services.EventCancelled:
+				return 130
+			}
+			return 1
+		}
+	}
+}
+
+// runServicesCommand implements "aoiler services"
+func runServicesCommand(args []string) int {
+	flags := flag.NewFlagSet("services", flag.ContinueOnError)
+	asJSON := flags.Bool("json", false, "print the services as JSON")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	client, err := dialSocket()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		return 1
+	}
+	defer client.conn.Close()
+
+	if err := client.send(socketRequest{Op: opServices}); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		return 1
+	}
+	for {
+		reply, err := client.next()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+			return 1
+		}
+		if reply.Type != replyServices {
+			continue
+		}
+
+		var infos []services.ServiceInfo
+		if err := json.Unmarshal(reply.Data, &infos); err != nil {
+			fmt.Fprintf(os.Stderr, "aoiler: invalid reply: %v\n", err)
+			return 1
+		}
+		if *asJSON {
+			out, _ := json.MarshalIndent(infos, "", "  ")
+			fmt.Println(string(out))
+			return 0
+		}
+		for _, info := range infos {
+			fmt.Printf("%-12s %s\n", info.Name, info.Description)
+		}
+		return 0
+	}
+}
+
+// askConfirmation asks on the terminal whether a tool call may run. Without
+// a terminal there is nobody to ask, so the call is declined.
+func askConfirmation(stdin *bufio.Reader, confirmation services.ToolConfirmation) bool {
+	if info, err := os.Stdin.Stat(); err != nil || info.Mode()&os.ModeCharDevice == 0 {
+		fmt.Fprintf(os.Stderr, "aoiler: declined %s %q, which changes files\n", confirmation.Tool, confirmation.Query)
+		return false
+	}
+	fmt.Fprintf(os.Stderr, "Allow %s %q, which changes files? [y/N] ", confirmation.Tool, confirmation.Query)
+	answer, _ := stdin.ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// printResponse prints the outcome of a query as text. streamed says whether
+// the LLM's answer was already printed token by token.
+func printResponse(resp QueryResponse, streamed bool) {
+	if resp.Cancelled {
+		fmt.Fprintln(os.Stderr, "\ncancelled")
+		return
+	}
+	if !resp.Success {
+		fmt.Fprintf(os.Stderr, "aoiler: %s\n", resp.Error)
+		return
+	}
+
+	if streamed {
+		// End the line of the streamed answer
+		fmt.Println()
+	}
+	result, _ := resp.Result.(map[string]interface{})
+	if text := formatResult(resp.Service, result, streamed); text != "" {
+		fmt.Println(text)
+	}
+}
+
+// formatResult renders the result of a service for the terminal
+func formatResult(service string, result map[string]interface{}, streamed bool) string {
+	var lines []string
+	switch service {
+	case "llm":
+		if streamed {
+			return ""
+		}
+		return stringField(result, "response")
+
+	case "filesearch":
+		for _, match := range listField(result, "results") {
+			lines = append(lines, stringField(match, "path"))
+		}
+		if len(lines) == 0 {
+			return "No match"
+		}
+
+	case "ocr":
+		if captures, ok := result["captures"]; ok && captures != nil {
+			for _, capture := range listField(result, "captures") {
+				lines = append(lines, fmt.Sprintf("[%s] %s", stringField(capture, "createdAt"), stringField(capture, "text")))
+			}
+			if len(lines) == 0 {
+				return "No captures match"
+			}
+			break
+		}
+		return stringField(result, "text")
+
+	case "organizer":
+		for _, move := range listField(result, "moves") {
+			lines = append(lines, fmt.Sprintf("%s -> %s", stringField(move, "from"), stringField(move, "to")))
+		}
+		lines = append(lines, stringField(result, "output"))
+
+	case "linter":
+		for _, d := range listField(result, "diagnostics") {
+			lines = append(lines, fmt.Sprintf("%s:%v: %s", stringField(d, "file"), d["line"], stringField(d, "message")))
+		}
+		if diff := stringField(result, "diff"); diff != "" {
+			lines = append(lines, diff)
+		}
+		if len(lines) == 0 {
+			lines = append(lines, firstNonEmpty(stringField(result, "output"), stringField(result, "filePath")))
+		}
+
+	case "converter":
+		for _, item := range listField(result, "items") {
+			lines = append(lines, fmt.Sprintf("%s %s", stringField(item, "status"), stringField(item, "input")))
+		}
+		if output := stringField(result, "outputPath"); output != "" {
+			lines = append(lines, output)
+		}
+
+	case "launcher":
+		if launched, ok := result["launched"].(map[string]interface{}); ok {
+			name := stringField(launched, "name")
+			if action := stringField(launched, "actionName"); action != "" {
+				name += ": " + action
+			}
+			lines = append(lines, "Launched "+name)
+		}
+
+	case services.DisambiguateService:
+		lines = append(lines, "Which did you mean?")
+		for _, option := range listField(result, "options") {
+			lines = append(lines, fmt.Sprintf("  %s  %s", stringField(option, "query"), stringField(option, "description")))
+		}
+
+	case "calculator":
+		lines = append(lines, stringField(result, "result"))
+		alternatives, _ := result["alternatives"].([]interface{})
+		for _, alternative := range alternatives {
+			lines = append(lines, fmt.Sprint(alternative))
+		}
+
+	default:
+		if output := firstNonEmpty(stringField(result, "output"), stringField(result, "response"), stringField(result, "text")); output != "" {
+			return output
+		}
+		out, _ := json.MarshalIndent(result, "", "  ")
+		return string(out)
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+func stringField(m map[string]interface{}, key string) string {
+	s, _ := m[key].(string)
+	return s
+}
+
+func listField(m map[string]interface{}, key string) []map[string]interface{} {
+	items, _ := m[key].([]interface{})
+	var list []map[string]interface{}
+	for _, item := range items {
+		if entry, ok := item.(map[string]interface{}); ok {
+			list = append(list, entry)
+		}
+	}
+	return list
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+
+	"Aoiler/services"
+)
+
+// Operations a socket client can request
+const (
+	opQuery    = "query"
+	opCancel   = "cancel"
+	opServices = "services"
+	opConfirm  = "confirm"
+)
+
+// Reply types besides the query events of the services package
+const (
+	replyAccepted = "accepted"
+	replyServices = "services"
+	replyOK       = "ok"
+	replyRejected = "rejected"
+)
+
+// socketRequest is one line sent to the socket
+type socketRequest struct {
+	Op        string `json:"op"`
+	Query     string `json:"query,omitempty"`
+	RequestID string `json:"requestId,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	// ID and Approved answer a tool call confirmation
+	ID       string `json:"id,omitempty"`
+	Approved bool   `json:"approved,omitempty"`
+}
+
+// socketServer answers JSON-lines requests on a Unix socket. Every line
+// sent back is a services.Event: query events as the window receives them,
+// plus the reply types above.
+type socketServer struct {
+	app      *App
+	listener net.Listener
+	path     string
+}
+
+// socketPath returns where the query socket lives
+func socketPath() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "aoiler.sock")
+	}
+	return filepath.Join(os.TempDir(), fmt.Sprintf("aoiler-%d.sock", os.Getuid()))
+}
+
+// listenSocket takes over the socket at path unless another Aoiler is
+// already serving it
+func listenSocket(app *App, path string) (*socketServer, error) {
+	if conn, err := net.Dial("unix", path); err == nil {
+		conn.Close()
+		return nil, fmt.Errorf("another Aoiler is serving %s", path)
+	}
+	// Nobody answers, so a file left there is from a crashed instance
+	os.Remove(path)
+
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create socket directory: %w", err)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", path, err)
+	}
+	if err := os.Chmod(path, 0600); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("failed to restrict %s: %w", path, err)
+	}
+	return &socketServer{app: app, listener: listener, path: path}, nil
+}
+
+// serve accepts connections until the server is closed
+func (s *socketServer) serve() {
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !errors.Is(err, net.ErrClosed) {
+				fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+			}
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+// Close stops accepting connections and removes the socket
+func (s *socketServer) Close() error {
+	return s.listener.Close()
+}
+
+// handle serves one client. Queries it started are cancelled when it
+// disconnects, so killing a script stops its work too.
+func (s *socketServer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	var mu sync.Mutex
+	encoder := json.NewEncoder(conn)
+	send := func(event services.Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		encoder.Encode(event)
+	}
+
+	var started []string
+	defer func() {
+		for _, id := range started {
+			// Queries that already finished are no longer running
+			s.app.CancelQuery(id)
+		}
+	}()
+
+	scanner := bufio.NewScanner(conn)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var req socketRequest
+		if err := json.Unmarshal([]byte(line), &req); err != nil {
+			send(services.Event{Type: replyRejected, Data: fmt.Sprintf("invalid request: %v", err)})
+			continue
+		}
+
+		switch req.Op {
+		case opQuery:
+			if strings.TrimSpace(req.Query) == "" {
+				send(services.Event{RequestID: req.RequestID, Type: replyRejected, Data: "empty query"})
+				continue
+			}
+			resp, err := s.app.startQuery(QueryRequest{
+				Query:     req.Query,
+				RequestID: req.RequestID,
+				SessionID: req.SessionID,
+			}, send, false)
+			if err != nil {
+				send(services.Event{RequestID: req.RequestID, Type: replyRejected, Data: err.Error()})
+				continue
+			}
+			started = append(started, resp.RequestID)
+			send(services.Event{RequestID: resp.RequestID, Type: replyAccepted, Data: resp})
+
+		case opCancel:
+			s.reply(send, req.RequestID, s.app.CancelQuery(req.RequestID))
+
+		case opConfirm:
+			s.reply(send, req.RequestID, s.app.ConfirmToolCall(req.ID, req.Approved))
+
+		case opServices:
+			send(services.Event{Type: replyServices, Data: s.app.GetAvailableServices()})
+
+		default:
+			send(services.Event{RequestID: req.RequestID, Type: replyRejected, Data: fmt.Sprintf("unknown op: %q", req.Op)})
+		}
+	}
+}
+
+// reply reports the outcome of a request that has no result
+func (s *socketServer) reply(send services.EventSink, requestID string, err error) {
+	if err != nil {
+		send(services.Event{RequestID: requestID, Type: replyRejected, Data: err.Error()})
+		return
+	}
+	send(services.Event{RequestID: requestID, Type: replyOK})
+}
+
+// runDaemon serves the socket without a window until it is interrupted
+func runDaemon() int {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	app := NewApp()
+	app.ctx = ctx
+	if err := app.serviceManager.Config().Watch(); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: config reload disabled: %v\n", err)
+	}
+
+	server, err := listenSocket(app, socketPath())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		app.serviceManager.Close()
+		return 1
+	}
+	app.socket = server
+	fmt.Fprintf(os.Stderr, "aoiler: listening on %s\n", server.path)
+
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	server.serve()
+
+	app.shutdown(ctx)
+	return 0
+}
@@ -1,6 +1,10 @@
 import { useState, useRef, useEffect } from 'react';
-import { Send, Loader2, Sparkles } from 'lucide-react';
-import { ProcessQuery, GetPathSuggestions } from '../wailsjs/go/main/App';
+import { Send, Loader2, Sparkles, Square } from 'lucide-react';
+import {
+  ProcessQuery, CancelQuery, GetPathSuggestions, ApplyFormat, RevertFormat, ExecuteOrganize, UndoOrganize,
+  PinOCRCapture, DeleteOCRCapture, CopyOCRCapture, GetOCRThumbnail, ConfirmToolCall, LaunchApp,
+} from '../wailsjs/go/main/App';
+import { EventsOn } from '../wailsjs/runtime/runtime';
 
 interface Message {
   id: string;
@@ -9,14 +13,62 @@ interface Message {
   service?: string;
   result?: any;
   error?: string;
+  progress?: ConvertProgress;
+  toolCalls?: ToolCall[];
+  confirm?: ToolConfirmation;
   timestamp: Date;
 }
 
+interface ToolCall {
+  id: string;
+  name: string;
+  query: string;
+  params?: Record<string, string>;
+  status: 'waiting' | 'running' | 'done' | 'declined' | 'failed';
+  output?: string;
+  error?: string;
+}
+
+interface ToolConfirmation {
+  id: string;
+  tool: string;
+  query: string;
+  params?: Record<string, string>;
+}
+
+interface ConvertProgress {
+  input: string;
+  percent: number;
+  outTime: number;
+  duration: number;
+  eta: number;
+  speed: number;
+  fps: number;
+  batch?: BatchProgress;
+}
+
+interface BatchProgress {
+  total: number;
+  done: number;
+  failed: number;
+  skipped: number;
+  percent: number;
+}
+
 interface QueryResponse {
+  requestId: string;
+  pending?: boolean;
   success: boolean;
   service: string;
   result: any;
   error?: string;
+  cancelled?: boolean;
+}
+
+interface QueryEvent {
+  requestId: string;
+  type: string;
+  data: any;
 }
 
 interface AutoCompleteResult {
@@ -24,10 +76,44 @@ interface AutoCompleteResult {
   isPath: boolean;
 }
 
+const formatDuration = (seconds: number) => {
+  const total = Math.max(0, Math.round(seconds));
+  const h = Math.floor(total / 3600);
+  const m = Math.floor((total % 3600) / 60);
+  const s = String(total % 60).padStart(2, '0');
+  return h > 0 ? `${h}:${String(m).padStart(2, '0')}:${s}` : `${m}:${s}`;
+};
+
+const formatSize = (bytes: number) => {
+  const units = ['B', 'KB', 'MB', 'GB', 'TB'];
+  let size = bytes;
+  let unit = 0;
+  while (size >= 1024 && unit < units.length - 1) {
+    size /= 1024;
+    unit++;
+  }
+  return unit === 0 ? `${size} B` : `${size.toFixed(1)} ${units[unit]}`;
+};
+
+// OCRThumbnail loads the thumbnail of a capture from the OCR history
+function OCRThumbnail({ id }: { id: string }) {
+  const [src, setSrc] = useState<string | null>(null);
+
+  useEffect(() => {
+    GetOCRThumbnail(id).then(setSrc).catch(() => setSrc(null));
+  }, [id]);
+
+  if (!src) {
+    return null;
+  }
+  return <img src={src} alt="" className="rounded max-h-20 max-w-[8rem] object-contain flex-shrink-0" />;
+}
+
 function App() {
   const [messages, setMessages] = useState<Message[]>([]);
   const [input, setInput] = useState('');
   const [loading, setLoading] = useState(false);
+  const [activeRequest, setActiveRequest] = useState<string | null>(null);
   const [suggestions, setSuggestions] = useState<string[]>([]);
   const [showSuggestions, setShowSuggestions] = useState(false);
   const [selectedIndex, setSelectedIndex] = useState(0);
@@ -37,10 +123,14 @@ function App() {
 
   const exampleQueries = [
     'Where is my waybar layout file?',
+    'Find pdfs modified last week',
     'Organize ~/Downloads by category',
     'Format main.py',
+    'Preview formatting of ~/.config/hypr/hyprland.conf',
     'Extract text from screen',
     'Convert video.mp4 to webm',
+    'Make a gif from clip.mp4 from 0:30 to 0:35',
+    'Convert all .mov in ~/Videos to mp4',
   ];
 
   useEffect(() => {
@@ -51,6 +141,52 @@ function App() {
     setSelectedIndex(0);
   }, [suggestions]);
 
+  useEffect(() => {
+    const offToken = EventsOn('aoiler:token', (event: QueryEvent) => {
+      setMessages(prev => prev.map(msg =>
+        msg.id === event.requestId ? { ...msg, content: msg.content + event.data } : msg
+      ));
+    });
+    const offProgress = EventsOn('aoiler:progress', (event: QueryEvent) => {
+      setMessages(prev => prev.map(msg =>
+        msg.id === event.requestId ? { ...msg, progress: event.data } : msg
+      ));
+    });
+    // Tool calls the LLM makes are listed as they run; those with side
+    // effects wait for the user to allow them
+    const offTool = EventsOn('aoiler:tool', (event: QueryEvent) => {
+      const call: ToolCall = event.data;
+      setMessages(prev => prev.map(msg => {
+        if (msg.id !== event.requestId) {
+          return msg;
+        }
+        const calls = msg.toolCalls ?? [];
+        const toolCalls = calls.some(c => c.id === call.id)
+          ? calls.map(c => c.id === call.id ? call : c)
+          : [...calls, call];
+        return { ...msg, toolCalls, confirm: call.status === 'waiting' ? msg.confirm : undefined };
+      }));
+    });
+    const offConfirm = EventsOn('aoiler:confirm', (event: QueryEvent) => {
+      setMessages(prev => prev.map(msg =>
+        msg.id === event.requestId ? { ...msg, confirm: event.data } : msg
+      ));
+    });
+    const offDone = EventsOn('aoiler:done', (event: QueryEvent) => finishQuery(event.data));
+    const offError = EventsOn('aoiler:error', (event: QueryEvent) => finishQuery(event.data));
+    const offCancelled = EventsOn('aoiler:cancelled', (event: QueryEvent) => finishQuery(event.data));
+
+    return () => {
+      offToken();
+      offProgress();
+      offTool();
+      offConfirm();
+      offDone();
+      offError();
+      offCancelled();
+    };
+  }, []);
+
   useEffect(() => {
     const getAutoComplete = async () => {
       if (input.length === 0) {
@@ -80,63 +216,295 @@ function App() {
     return () => clearTimeout(debounce);
   }, [input]);
 
-  const handleSubmit = async () => {
-    if (!input.trim() || loading) return;
+  const describeResponse = (response: QueryResponse) => {
+    if (!response.success) {
+      return response.error || 'An error occurred while processing your request.';
+    }
+
+    if (response.service === 'filesearch') {
+      const count = response.result?.results?.length ?? 0;
+      return response.result?.found
+        ? count === 1 ? `Found 1 match.` : `Found ${count} matches, best first.`
+        : `Could not find the file.`;
+    } else if (response.service === 'organizer') {
+      const count = response.result?.moves?.length ?? 0;
+      if (response.result?.undone) {
+        return `Restored ${count} file${count === 1 ? '' : 's'}.`;
+      }
+      if (response.result?.executed) {
+        return `Moved ${count} file${count === 1 ? '' : 's'}.`;
+      }
+      return count === 0
+        ? `Nothing to organize.`
+        : `This would move ${count} file${count === 1 ? '' : 's'}. Confirm to go ahead.`;
+    } else if (response.service === 'linter') {
+      if (response.result?.mode === 'lint') {
+        const count = response.result.diagnostics?.length ?? 0;
+        return count === 0 ? `No problems found.` : `Found ${count} problem${count === 1 ? '' : 's'}.`;
+      }
+      if (!response.result?.changed && response.result?.fixed !== false) {
+        return `File is already formatted.`;
+      }
+      if (response.result?.mode === 'preview') {
+        return `Formatting would make these changes.`;
+      }
+      if (response.result?.mode === 'revert') {
+        return `Formatting has been reverted.`;
+      }
+      return response.result?.fixed
+        ? `File has been formatted successfully.`
+        : `Could not format the file.`;
+    } else if (response.service === 'ocr' && response.result?.captures) {
+      const count = response.result.captures.length;
+      return count === 0
+        ? `No OCR captures match.`
+        : `Found ${count} OCR capture${count === 1 ? '' : 's'}, pinned first.`;
+    } else if (response.service === 'ocr') {
+      return response.result?.copied
+        ? `Text extracted and copied to the clipboard.`
+        : `Text extracted from image.`;
+    } else if (response.service === 'converter') {
+      return `File conversion completed.`;
+    } else if (response.service === 'launcher') {
+      const launched = response.result?.launched;
+      return `Launched ${launched?.name}${launched?.actionName ? `: ${launched.actionName}` : ''}.`;
+    } else if (response.service === 'calculator') {
+      return `${response.result?.expression} = ${response.result?.result}`;
+    } else if (response.service === 'disambiguate') {
+      return `This could go to several services. Which did you mean?`;
+    } else if (response.service === 'media') {
+      return response.result?.output || 'Done.';
+    } else if (response.service === 'windows') {
+      return response.result?.output || 'Done.';
+    } else if (response.service === 'llm') {
+      return response.result?.response || 'LLM response received.';
+    }
+    return `Request processed.`;
+  };
+
+  const finishQuery = (response: QueryResponse) => {
+    setMessages(prev => prev.map(msg =>
+      msg.id === response.requestId
+        ? {
+            ...msg,
+            // Keep whatever was streamed before the query was stopped
+            content: response.cancelled
+              ? (msg.content ? msg.content + '\n\n[cancelled]' : 'Cancelled.')
+              : describeResponse(response),
+            service: response.service,
+            result: response.success ? response.result : null,
+            error: response.error,
+            progress: undefined,
+            confirm: undefined,
+          }
+        : msg
+    ));
+    setLoading(false);
+    setActiveRequest(null);
+  };
+
+  // Applies a formatting preview or reverts applied formatting in place of
+  // the message that showed it
+  const handleFormatAction = async (messageId: string, action: 'apply' | 'revert', id: string) => {
+    try {
+      const result = action === 'apply' ? await ApplyFormat(id) : await RevertFormat(id);
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId
+          ? { ...msg, result, content: action === 'apply' ? 'Formatting applied.' : 'Formatting has been reverted.' }
+          : msg
+      ));
+    } catch (err) {
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId ? { ...msg, content: String(err) } : msg
+      ));
+    }
+  };
+
+  // Executes an organize plan or undoes the last executed one in place of
+  // the message that showed it
+  const handleOrganizeAction = async (messageId: string, action: 'execute' | 'undo', planId?: string) => {
+    try {
+      const result = action === 'execute' ? await ExecuteOrganize(planId!) : await UndoOrganize();
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId
+          ? { ...msg, result, content: describeResponse({ requestId: messageId, service: 'organizer', success: true, result }) }
+          : msg
+      ));
+    } catch (err) {
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId ? { ...msg, content: String(err) } : msg
+      ));
+    }
+  };
+
+  // Copies, pins or deletes a capture listed in an OCR history message
+  const handleCaptureAction = async (messageId: string, action: 'copy' | 'pin' | 'delete', capture: any) => {
+    try {
+      if (action === 'copy') {
+        await CopyOCRCapture(capture.id);
+        return;
+      }
+      if (action === 'pin') {
+        await PinOCRCapture(capture.id, !capture.pinned);
+      } else {
+        await DeleteOCRCapture(capture.id);
+      }
+      setMessages(prev => prev.map(msg => {
+        if (msg.id !== messageId) {
+          return msg;
+        }
+        const captures = action === 'delete'
+          ? msg.result.captures.filter((c: any) => c.id !== capture.id)
+          : msg.result.captures.map((c: any) => c.id === capture.id ? { ...c, pinned: !c.pinned } : c);
+        return { ...msg, result: { ...msg.result, captures } };
+      }));
+    } catch (err) {
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId ? { ...msg, content: String(err) } : msg
+      ));
+    }
+  };
+
+  // Launches another of the applications listed in a launcher message
+  const handleLaunch = async (messageId: string, app: any) => {
+    try {
+      await LaunchApp(app.id, app.action ?? '');
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId
+          ? { ...msg, content: `Launched ${app.name}${app.actionName ? `: ${app.actionName}` : ''}.`, result: { ...msg.result, launched: app } }
+          : msg
+      ));
+    } catch (err) {
+      setMessages(prev => prev.map(msg =>
+        msg.id === messageId ? { ...msg, content: String(err) } : msg
+      ));
+    }
+  };
+
+  // Allows or declines a tool call the LLM asked to make
+  const handleConfirm = async (messageId: string, id: string, approved: boolean) => {
+    setMessages(prev => prev.map(msg =>
+      msg.id === messageId ? { ...msg, confirm: undefined } : msg
+    ));
+    try {
+      await ConfirmToolCall(id, approved);
+    } catch (err) {
+      // The request was cancelled or the confirmation timed out
+      console.error('Confirm error:', err);
+    }
+  };
+
+  const renderToolCalls = (msg: Message) => {
+    const calls: ToolCall[] = msg.toolCalls ?? msg.result?.toolCalls ?? [];
+    if (calls.length === 0 && !msg.confirm) {
+      return null;
+    }
+    const statusColors: Record<string, string> = {
+      waiting: 'text-yellow-400',
+      running: 'text-blue-400',
+      done: 'text-green-400',
+      declined: 'text-gray-500',
+      failed: 'text-red-400',
+    };
+    const describeCall = (name: string, query: string, params?: Record<string, string>) =>
+      [name, query, ...Object.entries(params ?? {}).map(([k, v]) => `${k}=${v}`)].filter(Boolean).join(' · ');
+
+    return (
+      <div className="mt-2 space-y-1">
+        {calls.map(call => (
+          <p key={call.id} className="text-xs text-gray-400 break-words font-mono">
+            <span className={statusColors[call.status]}>{call.status}</span>{' '}
+            {describeCall(call.name, call.query, call.params)}
+            {call.error && <span className="text-red-400">{` (${call.error})`}</span>}
+          </p>
+        ))}
+        {msg.confirm && (
+          <div className="p-2 rounded border border-yellow-900/50" style={{ backgroundColor: '#0F1416' }}>
+            <p className="text-xs text-yellow-300 mb-2 break-words">
+              {`Allow ${describeCall(msg.confirm.tool, msg.confirm.query, msg.confirm.params)}?`}
+            </p>
+            <div className="flex gap-2">
+              <button
+                onClick={() => handleConfirm(msg.id, msg.confirm!.id, true)}
+                className="px-3 py-1 text-xs rounded-lg border border-green-900/50 text-green-300 hover:bg-green-900/30 transition-colors"
+              >
+                Allow
+              </button>
+              <button
+                onClick={() => handleConfirm(msg.id, msg.confirm!.id, false)}
+                className="px-3 py-1 text-xs rounded-lg border border-red-900/50 text-red-300 hover:bg-red-900/30 transition-colors"
+              >
+                Deny
+              </button>
+            </div>
+          </div>
+        )}
+      </div>
+    );
+  };
+
+  const renderDiff = (diff: string) => (
+    <pre className="text-xs mt-2 p-2 rounded overflow-x-auto max-h-80" style={{ backgroundColor: '#0F1416' }}>
+      {diff.split('\n').map((line, i) => (
+        <div
+          key={i}
+          className={
+            line.startsWith('+') ? 'text-green-400' :
+            line.startsWith('-') ? 'text-red-400' :
+            line.startsWith('@@') ? 'text-purple-300' : 'text-gray-400'
+          }
+        >
+          {line || ' '}
+        </div>
+      ))}
+    </pre>
+  );
+
+  const handleCancel = async () => {
+    if (!activeRequest) return;
+    try {
+      await CancelQuery(activeRequest);
+    } catch (err) {
+      // The query finished before the cancel arrived
+      console.error('Cancel error:', err);
+    }
+  };
+
+  // Sends the input, or a query picked from a disambiguation card
+  const handleSubmit = async (query: string = input) => {
+    if (!query.trim() || loading) return;
 
     const userMessage: Message = {
       id: Date.now().toString(),
       type: 'user',
-      content: input,
+      content: query,
       timestamp: new Date(),
     };
 
     setMessages(prev => [...prev, userMessage]);
-    const currentInput = input;
-    setInput('');
+    const currentInput = query;
+    if (query === input) setInput('');
     setLoading(true);
     setShowSuggestions(false);
     setSuggestions([]);
 
+    // The assistant message is created up front so streamed tokens have a
+    // place to land; its id doubles as the request ID.
+    const requestId = (Date.now() + 1).toString();
+    const assistantMessage: Message = {
+      id: requestId,
+      type: 'assistant',
+      content: '',
+      timestamp: new Date(),
+    };
+    setMessages(prev => [...prev, assistantMessage]);
+    setActiveRequest(requestId);
+
     try {
-      const response: QueryResponse = await ProcessQuery({ query: currentInput });
-
-      let assistantContent = '';
-
-      if (response.success) {
-        if (response.service === 'filesearch') {
-          assistantContent = response.result?.found
-            ? `Found the file you're looking for.`
-            : `Could not find the file.`;
-        } else if (response.service === 'organizer') {
-          assistantContent = `Files have been organized.`;
-        } else if (response.service === 'linter') {
-          assistantContent = response.result?.fixed
-            ? `File has been formatted successfully.`
-            : `Could not format the file.`;
-        } else if (response.service === 'ocr') {
-          assistantContent = `Text extracted from image.`;
-        } else if (response.service === 'converter') {
-          assistantContent = `File conversion completed.`;
-        } else if (response.service === 'llm') {
-          assistantContent = response.result?.response || 'LLM response received.';
-        } else {
-          assistantContent = `Request processed.`;
-        }
-      } else {
-        assistantContent = response.error || 'An error occurred while processing your request.';
+      const response: QueryResponse = await ProcessQuery({ query: currentInput, requestId });
+      if (!response.pending && response.error) {
+        throw new Error(response.error);
       }
-
-      const assistantMessage: Message = {
-        id: (Date.now() + 1).toString(),
-        type: 'assistant',
-        content: assistantContent,
-        service: response.service,
-        result: response.success ? response.result : null,
-        error: response.error,
-        timestamp: new Date(),
-      };
-
-      setMessages(prev => [...prev, assistantMessage]);
     } catch (err) {
       const errorMessage: Message = {
         id: (Date.now() + 1).toString(),
@@ -145,9 +513,9 @@ function App() {
         error: String(err),
         timestamp: new Date(),
       };
-      setMessages(prev => [...prev, errorMessage]);
-    } finally {
+      setMessages(prev => [...prev.filter(msg => msg.id !== requestId), errorMessage]);
       setLoading(false);
+      setActiveRequest(null);
     }
   };
 
@@ -212,7 +580,43 @@ function App() {
     inputRef.current?.focus();
   };
 
+  const renderBatchProgress = (progress: ConvertProgress, batch: BatchProgress) => (
+    <div className="mt-2">
+      <div className="h-1.5 rounded-full overflow-hidden" style={{ backgroundColor: '#0F1416' }}>
+        <div className="h-full bg-cyan-500 transition-all" style={{ width: `${batch.percent}%` }} />
+      </div>
+      <p className="text-xs text-gray-500 mt-1 break-all">
+        {`${batch.done}/${batch.total} files · ${batch.percent.toFixed(0)}%`}
+        {batch.failed > 0 && ` · ${batch.failed} failed`}
+        {batch.skipped > 0 && ` · ${batch.skipped} skipped`}
+        {progress.input && ` · ${progress.input.split('/').pop()}`}
+      </p>
+    </div>
+  );
+
+  const renderProgress = (progress: ConvertProgress) => (
+    <div className="mt-2">
+      <div className="h-1.5 rounded-full overflow-hidden" style={{ backgroundColor: '#0F1416' }}>
+        <div
+          className={`h-full bg-cyan-500 transition-all ${progress.percent < 0 ? 'animate-pulse w-full' : ''}`}
+          style={progress.percent >= 0 ? { width: `${progress.percent}%` } : undefined}
+        />
+      </div>
+      <p className="text-xs text-gray-500 mt-1">
+        {progress.percent >= 0
+          ? `${progress.percent.toFixed(0)}% · ETA ${formatDuration(progress.eta)}`
+          : `${formatDuration(progress.outTime)} converted`}
+        {progress.speed > 0 && ` · ${progress.speed.toFixed(1)}x`}
+      </p>
+    </div>
+  );
+
   const renderResult = (msg: Message) => {
+    if (msg.progress) {
+      return msg.progress.batch
+        ? renderBatchProgress(msg.progress, msg.progress.batch)
+        : renderProgress(msg.progress);
+    }
     if (!msg.result || msg.error) {
       if (msg.error) {
         return (
@@ -229,11 +633,18 @@ function App() {
       if (msg.result.found) {
         return (
           <div className="mt-2 p-3 rounded-lg border border-green-900/30" style={{ backgroundColor: '#141B1E' }}>
-            <p className="font-medium text-green-400 text-sm mb-2">File Found</p>
-            <p className="text-sm text-gray-300 break-all mb-1">
-              <span className="text-gray-500">Path:</span> {msg.result.path}
-            </p>
-            <p className="text-sm text-gray-500">Type: {msg.result.type}</p>
+            <p className="font-medium text-green-400 text-sm mb-2">Files Found</p>
+            {msg.result.filters?.length > 0 && (
+              <p className="text-xs text-gray-500 mb-2">{msg.result.filters.join(' · ')}</p>
+            )}
+            {msg.result.results.map((match: any) => (
+              <div key={match.path} className="mb-2 last:mb-0">
+                <p className="text-sm text-gray-300 break-all">{match.path}</p>
+                <p className="text-xs text-gray-500">
+                  {match.type === 'directory' ? 'Folder' : formatSize(match.size)} · modified {new Date(match.modTime).toLocaleString()}
+                </p>
+              </div>
+            ))}
           </div>
         );
       } else {
@@ -246,10 +657,52 @@ function App() {
     }
 
     if (msg.service === 'organizer') {
+      const shorten = (path: string) => path.startsWith(msg.result.path + '/')
+        ? path.slice(msg.result.path.length + 1)
+        : path;
       return (
         <div className="mt-2 p-3 rounded-lg border border-blue-900/30" style={{ backgroundColor: '#141B1E' }}>
-          <p className="font-medium text-blue-400 text-sm mb-2">Organization Complete</p>
-          <pre className="text-sm text-gray-300 whitespace-pre-wrap break-words">{msg.result.output}</pre>
+          <p className="font-medium text-blue-400 text-sm mb-2">
+            {msg.result.undone ? 'Organize Undone'
+              : msg.result.executed ? 'Organization Complete'
+              : 'Organize Plan'}
+            {msg.result.mode && <span className="text-xs text-gray-500 ml-2">{msg.result.mode}</span>}
+          </p>
+          <p className="text-sm text-gray-300 break-all mb-1">
+            <span className="text-gray-500">Folder:</span> {msg.result.path}
+          </p>
+          {msg.result.moves?.length > 0 && (
+            <div className="mt-2 space-y-1 max-h-80 overflow-y-auto">
+              {msg.result.moves.map((move: any, i: number) => (
+                <p key={i} className="text-xs text-gray-300 break-all font-mono">
+                  {shorten(move.from)}
+                  <span className="text-blue-300">{' → '}</span>
+                  {shorten(move.to)}
+                  {move.reason && <span className="text-gray-500">{`  (${move.reason})`}</span>}
+                </p>
+              ))}
+            </div>
+          )}
+          {msg.result.failed?.length > 0 && (
+            <div className="mt-2 space-y-1">
+              {msg.result.failed.map((failure: string, i: number) => (
+                <p key={i} className="text-xs text-red-400 break-words">{failure}</p>
+              ))}
+            </div>
+          )}
+          {msg.result.skipped > 0 && (
+            <p className="text-xs text-gray-500 mt-2">{`${msg.result.skipped} file${msg.result.skipped === 1 ? '' : 's'} left in place`}</p>
+          )}
+          {(msg.result.planId || msg.result.journalId) && (
+            <button
+              onClick={() => msg.result.planId
+                ? handleOrganizeAction(msg.id, 'execute', msg.result.planId)
+                : handleOrganizeAction(msg.id, 'undo')}
+              className="mt-2 px-3 py-1 text-xs rounded-lg border border-blue-900/50 text-blue-300 hover:bg-blue-900/30 transition-colors"
+            >
+              {msg.result.planId ? 'Confirm' : 'Undo'}
+            </button>
+          )}
         </div>
       );
     }
@@ -258,22 +711,87 @@ function App() {
       return (
         <div className="mt-2 p-3 rounded-lg border border-purple-900/30" style={{ backgroundColor: '#141B1E' }}>
           <p className="font-medium text-purple-400 text-sm mb-2">
-            {msg.result.fixed ? 'Formatting Complete' : 'Formatting Failed'}
+            {msg.result.mode === 'lint' ? 'Lint Results'
+              : msg.result.mode === 'preview' ? 'Formatting Preview'
+              : msg.result.mode === 'revert' ? 'Formatting Reverted'
+              : msg.result.fixed ? 'Formatting Complete' : 'Formatting Failed'}
+            {msg.result.tool && <span className="text-xs text-gray-500 ml-2">{msg.result.tool}</span>}
           </p>
           <p className="text-sm text-gray-300 break-all mb-1">
             <span className="text-gray-500">File:</span> {msg.result.filePath}
           </p>
-          {msg.result.output && (
+          {msg.result.diagnostics?.length > 0 && (
+            <div className="mt-2 space-y-1">
+              {msg.result.diagnostics.map((d: any, i: number) => (
+                <p key={i} className="text-xs text-gray-300 break-words font-mono">
+                  <span className="text-purple-300">{`${d.file.split('/').pop()}:${d.line}${d.column ? `:${d.column}` : ''}`}</span>
+                  {` ${d.message}`}
+                </p>
+              ))}
+            </div>
+          )}
+          {msg.result.diff && renderDiff(msg.result.diff)}
+          {(msg.result.previewId || msg.result.backupId) && (
+            <button
+              onClick={() => msg.result.previewId
+                ? handleFormatAction(msg.id, 'apply', msg.result.previewId)
+                : handleFormatAction(msg.id, 'revert', msg.result.backupId)}
+              className="mt-2 px-3 py-1 text-xs rounded-lg border border-purple-900/50 text-purple-300 hover:bg-purple-900/30 transition-colors"
+            >
+              {msg.result.previewId ? 'Apply' : 'Revert'}
+            </button>
+          )}
+          {msg.result.output && !msg.result.diagnostics?.length && (
             <pre className="text-sm text-gray-300 mt-2 whitespace-pre-wrap break-words">{msg.result.output}</pre>
           )}
         </div>
       );
     }
 
+    if (msg.service === 'ocr' && msg.result.captures) {
+      const actionClass = 'px-2 py-0.5 text-xs rounded border border-indigo-900/50 text-indigo-300 hover:bg-indigo-900/30 transition-colors';
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-indigo-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <p className="font-medium text-indigo-400 text-sm mb-1">OCR History</p>
+          {msg.result.filters?.length > 0 && (
+            <p className="text-xs text-gray-500 mb-2">{msg.result.filters.join(' · ')}</p>
+          )}
+          <div className="space-y-2 max-h-96 overflow-y-auto">
+            {msg.result.captures.map((capture: any) => (
+              <div key={capture.id} className="flex gap-2 p-2 rounded" style={{ backgroundColor: '#0F1416' }}>
+                {capture.hasThumbnail && <OCRThumbnail id={capture.id} />}
+                <div className="min-w-0 flex-1">
+                  <p className="text-xs text-gray-500 mb-1">
+                    {capture.pinned && <span className="text-indigo-300 mr-1">pinned ·</span>}
+                    {`${new Date(capture.createdAt).toLocaleString()} · ${capture.source === 'screen' ? 'screen' : capture.source.split('/').pop()} · ${capture.language}`}
+                  </p>
+                  <pre className="text-sm text-gray-300 whitespace-pre-wrap break-words max-h-24 overflow-hidden">{capture.text}</pre>
+                  <div className="flex gap-2 mt-1">
+                    <button onClick={() => handleCaptureAction(msg.id, 'copy', capture)} className={actionClass}>Copy</button>
+                    <button onClick={() => handleCaptureAction(msg.id, 'pin', capture)} className={actionClass}>
+                      {capture.pinned ? 'Unpin' : 'Pin'}
+                    </button>
+                    <button onClick={() => handleCaptureAction(msg.id, 'delete', capture)} className={actionClass}>Delete</button>
+                  </div>
+                </div>
+              </div>
+            ))}
+          </div>
+        </div>
+      );
+    }
+
     if (msg.service === 'ocr') {
       return (
         <div className="mt-2 p-3 rounded-lg border border-indigo-900/30" style={{ backgroundColor: '#141B1E' }}>
-          <p className="font-medium text-indigo-400 text-sm mb-2">Extracted Text</p>
+          <p className="font-medium text-indigo-400 text-sm mb-2">
+            Extracted Text
+            {msg.result.language && (
+              <span className="text-xs text-gray-500 ml-2">
+                {`${msg.result.language}${msg.result.psm ? ` · psm ${msg.result.psm}` : ''}${msg.result.copied ? ' · copied' : ''}`}
+              </span>
+            )}
+          </p>
           <div className="p-2 rounded" style={{ backgroundColor: '#0F1416' }}>
             <pre className="text-sm text-gray-300 whitespace-pre-wrap break-words">{msg.result.text}</pre>
           </div>
@@ -281,6 +799,33 @@ function App() {
       );
     }
 
+    if (msg.service === 'converter' && msg.result.items) {
+      const statusColors: Record<string, string> = {
+        converted: 'text-green-400',
+        failed: 'text-red-400',
+        skipped: 'text-gray-500',
+      };
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-cyan-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <p className="font-medium text-cyan-400 text-sm mb-1">Batch Conversion Complete</p>
+          <p className="text-xs text-gray-500 mb-2">
+            {`${msg.result.converted} converted · ${msg.result.failed} failed · ${msg.result.skipped} skipped`}
+            {` · ${msg.result.workers} workers · took ${formatDuration(msg.result.elapsed)}`}
+          </p>
+          <div className="space-y-1 max-h-64 overflow-y-auto">
+            {msg.result.items.map((item: any) => (
+              <p key={item.input} className="text-xs text-gray-300 break-all">
+                <span className={statusColors[item.status]}>{item.status}</span>{' '}
+                {item.input}
+                {item.output && ` → ${item.output.split('/').pop()}`}
+                {item.reason && <span className="text-gray-500">{` (${item.reason})`}</span>}
+              </p>
+            ))}
+          </div>
+        </div>
+      );
+    }
+
     if (msg.service === 'converter') {
       return (
         <div className="mt-2 p-3 rounded-lg border border-cyan-900/30" style={{ backgroundColor: '#141B1E' }}>
@@ -288,6 +833,138 @@ function App() {
           <p className="text-sm text-gray-300 break-all">
             <span className="text-gray-500">Output:</span> {msg.result.outputPath}
           </p>
+          <p className="text-xs text-gray-500 mt-1">
+            {formatSize(msg.result.outputSize)}
+            {msg.result.options?.preset && ` · ${msg.result.options.preset}`}
+            {msg.result.duration > 0 && ` · ${formatDuration(msg.result.duration)} of media`}
+            {` · took ${formatDuration(msg.result.elapsed)}`}
+          </p>
+        </div>
+      );
+    }
+
+    if (msg.service === 'launcher') {
+      const launched = msg.result.launched;
+      const actionClass = 'px-2 py-0.5 text-xs rounded border border-emerald-900/50 text-emerald-300 hover:bg-emerald-900/30 transition-colors';
+      const isLaunched = (app: any) => app.id === launched?.id && (app.action ?? '') === (launched?.action ?? '');
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-emerald-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <p className="font-medium text-emerald-400 text-sm mb-2">Applications</p>
+          <div className="space-y-1 max-h-64 overflow-y-auto">
+            {msg.result.matches.map((app: any) => (
+              <div key={`${app.id}#${app.action ?? ''}`} className="flex items-center justify-between gap-2 p-2 rounded" style={{ backgroundColor: '#0F1416' }}>
+                <div className="min-w-0">
+                  <p className={`text-sm truncate ${isLaunched(app) ? 'text-emerald-300' : 'text-gray-300'}`}>
+                    {app.name}
+                    {app.actionName && <span className="text-gray-500">{` · ${app.actionName}`}</span>}
+                  </p>
+                  {app.comment && <p className="text-xs text-gray-500 truncate">{app.comment}</p>}
+                </div>
+                <button onClick={() => handleLaunch(msg.id, app)} className={actionClass}>
+                  {isLaunched(app) ? 'Again' : 'Launch'}
+                </button>
+              </div>
+            ))}
+          </div>
+        </div>
+      );
+    }
+
+    if (msg.service === 'calculator') {
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-amber-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <p className="text-xs text-gray-500 mb-1">{msg.result.expression}</p>
+          <p className="text-xl font-medium text-amber-400 break-all select-all">{msg.result.result}</p>
+          {msg.result.alternatives?.length > 0 && (
+            <p className="text-xs text-gray-500 mt-1">{msg.result.alternatives.join(' · ')}</p>
+          )}
+        </div>
+      );
+    }
+
+    if (msg.service === 'disambiguate') {
+      const actionClass = 'px-2 py-0.5 text-xs rounded border border-indigo-900/50 text-indigo-300 hover:bg-indigo-900/30 transition-colors';
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-indigo-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <div className="space-y-1">
+            {msg.result.options.map((option: any) => (
+              <div key={option.service} className="flex items-center justify-between gap-2 p-2 rounded" style={{ backgroundColor: '#0F1416' }}>
+                <div className="min-w-0">
+                  <p className="text-sm text-gray-300">{option.service}</p>
+                  <p className="text-xs text-gray-500 truncate">{option.description}</p>
+                </div>
+                <button onClick={() => handleSubmit(option.query)} disabled={loading} className={actionClass}>
+                  Use
+                </button>
+              </div>
+            ))}
+          </div>
+          <p className="text-xs text-gray-600 mt-2">Start a query with /name or @name to pick the service yourself.</p>
+        </div>
+      );
+    }
+
+    if (msg.service === 'media') {
+      const level = msg.result.audio
+        ? { label: msg.result.control === 'mic' ? 'Microphone' : 'Volume', percent: msg.result.audio.volume, detail: msg.result.audio.device, muted: msg.result.audio.muted }
+        : msg.result.brightness
+          ? { label: 'Brightness', percent: msg.result.brightness.percent, detail: msg.result.brightness.device, muted: false }
+          : null;
+      const player = msg.result.player;
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-violet-900/30" style={{ backgroundColor: '#141B1E' }}>
+          {level && (
+            <>
+              <div className="flex items-center justify-between mb-1">
+                <p className="font-medium text-violet-400 text-sm">{level.label}</p>
+                <p className="text-sm text-gray-300">{level.muted ? `Muted · ${level.percent}%` : `${level.percent}%`}</p>
+              </div>
+              <div className="h-1.5 rounded" style={{ backgroundColor: '#0F1416' }}>
+                <div
+                  className={`h-1.5 rounded ${level.muted ? 'bg-gray-600' : 'bg-violet-500'}`}
+                  style={{ width: `${Math.min(level.percent, 100)}%` }}
+                />
+              </div>
+              {level.detail && <p className="text-xs text-gray-500 mt-1 truncate">{level.detail}</p>}
+            </>
+          )}
+          {player && (
+            <>
+              <div className="flex items-center justify-between mb-1">
+                <p className="font-medium text-violet-400 text-sm">{player.status}</p>
+                <span className="text-xs text-gray-500">{player.player}</span>
+              </div>
+              <p className="text-sm text-gray-300 truncate">{player.title || 'Unknown track'}</p>
+              {(player.artist || player.album) && (
+                <p className="text-xs text-gray-500 truncate">{[player.artist, player.album].filter(Boolean).join(' · ')}</p>
+              )}
+              {player.length > 0 && (
+                <p className="text-xs text-gray-600 mt-1">{`${formatDuration(player.position)} / ${formatDuration(player.length)}`}</p>
+              )}
+            </>
+          )}
+        </div>
+      );
+    }
+
+    if (msg.service === 'windows' && msg.result.windows?.length > 0) {
+      return (
+        <div className="mt-2 p-3 rounded-lg border border-sky-900/30" style={{ backgroundColor: '#141B1E' }}>
+          <p className="font-medium text-sky-400 text-sm mb-2">Windows</p>
+          <div className="space-y-1 max-h-64 overflow-y-auto">
+            {msg.result.windows.map((client: any) => (
+              <div key={client.address} className="p-2 rounded" style={{ backgroundColor: '#0F1416' }}>
+                <p className="text-sm text-gray-300 truncate">
+                  {client.class || client.initialClass}
+                  <span className="text-gray-500">{` · workspace ${client.workspace?.name ?? client.workspace?.id}`}</span>
+                </p>
+                {client.title && <p className="text-xs text-gray-500 truncate">{client.title}</p>}
+              </div>
+            ))}
+          </div>
+          {msg.result.dispatches?.length > 0 && (
+            <p className="text-xs text-gray-600 mt-2 font-mono break-all">{msg.result.dispatches.join(' ; ')}</p>
+          )}
         </div>
       );
     }
@@ -366,6 +1043,7 @@ function App() {
                   <p className="text-sm text-gray-100 whitespace-pre-wrap break-words">
                     {msg.content}
                   </p>
+                  {msg.type === 'assistant' && renderToolCalls(msg)}
                   {msg.type === 'assistant' && renderResult(msg)}
                 </div>
               </div>
@@ -432,13 +1110,14 @@ function App() {
                 }}
               />
               <button
-                onClick={handleSubmit}
-                disabled={loading || !input.trim()}
+                onClick={loading ? handleCancel : () => handleSubmit()}
+                disabled={!loading && !input.trim()}
+                title={loading ? 'Stop' : 'Send'}
                 className="p-3 rounded-lg transition-all disabled:opacity-40 disabled:cursor-not-allowed flex-shrink-0"
                 style={{ backgroundColor: '#1E3A5F' }}
               >
                 {loading ? (
-                  <Loader2 className="animate-spin text-gray-100" size={18} />
+                  <Square size={18} className="text-gray-100" />
                 ) : (
                   <Send size={18} className="text-gray-100" />
                 )}
@@ -3,6 +3,7 @@ package main
 import (
 	"embed"
 	"log"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -14,6 +15,18 @@ import (
 var assets embed.FS
 
 func main() {
+	// Scripts and keybinds reach the services through the socket
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "daemon":
+			os.Exit(runDaemon())
+		case "query":
+			os.Exit(runQueryCommand(os.Args[2:]))
+		case "services":
+			os.Exit(runServicesCommand(os.Args[2:]))
+		}
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 
@@ -27,6 +40,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 15, G: 23, B: 42, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
@@ -0,0 +1,255 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// maxToolRounds bounds how often the model can call tools before answering
+const maxToolRounds = 8
+
+// conversation is what is sent to a provider: the chat so far, the tool
+// calls made while answering its last message, and the tools on offer
+type conversation struct {
+	messages []ChatMessage
+	steps    []toolStep
+	tools    []Tool
+}
+
+// toolStep is one round of tool calls and their results
+type toolStep struct {
+	text    string
+	calls   []ToolCall
+	results []ToolCallRecord
+}
+
+// streamedCall collects a tool call whose arguments arrive in pieces
+type streamedCall struct {
+	id        string
+	name      string
+	arguments strings.Builder
+}
+
+// SetToolbox offers the services in toolbox to providers that support
+// tool calling
+func (llm *LLMService) SetToolbox(toolbox *Toolbox) {
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+	llm.toolbox = toolbox
+}
+
+// completeWithTools answers the conversation, letting the model run tools
+// and feeding their results back until it replies without calling any
+func (llm *LLMService) completeWithTools(ctx context.Context, messages []ChatMessage) (LLMResult, error) {
+	p := llm.settings()
+	llm.mu.RLock()
+	toolbox := llm.toolbox
+	llm.mu.RUnlock()
+
+	if toolbox == nil || !p.useTools || !supportsTools(p.provider) {
+		return llm.complete(ctx, messages)
+	}
+
+	conv := conversation{messages: messages, tools: toolbox.Tools()}
+	var records []ToolCallRecord
+	var texts []string
+
+	for range maxToolRounds {
+		result, err := llm.send(ctx, p, conv)
+		if result.Response != "" {
+			texts = append(texts, result.Response)
+		}
+		if err != nil || !result.Success || len(result.calls) == 0 {
+			if result.Success {
+				result.Response = strings.Join(texts, "\n\n")
+			}
+			result.ToolCalls = records
+			return result, err
+		}
+
+		step := toolStep{text: result.Response, calls: result.calls}
+		for _, call := range result.calls {
+			record := toolbox.Run(ctx, call)
+			records = append(records, record)
+			step.results = append(step.results, record)
+		}
+		if ctx.Err() != nil {
+			return LLMResult{Success: false, ToolCalls: records}, ctx.Err()
+		}
+		conv.steps = append(conv.steps, step)
+	}
+
+	return LLMResult{
+		Response:  fmt.Sprintf("Stopped after %d rounds of tool calls without an answer", maxToolRounds),
+		Success:   false,
+		Provider:  string(p.provider),
+		ToolCalls: records,
+	}, nil
+}
+
+// supportsTools reports whether the provider's API takes tool definitions
+func supportsTools(provider LLMProvider) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderClaude, ProviderGemini:
+		return true
+	}
+	return false
+}
+
+// finishStreamedCalls parses the arguments of streamed tool calls
+func finishStreamedCalls(calls []*streamedCall) ([]ToolCall, error) {
+	var toolCalls []ToolCall
+	for _, call := range calls {
+		args := make(map[string]interface{})
+		if raw := strings.TrimSpace(call.arguments.String()); raw != "" {
+			if err := json.Unmarshal([]byte(raw), &args); err != nil {
+				return nil, fmt.Errorf("failed to parse arguments of tool call %s: %w", call.name, err)
+			}
+		}
+		toolCalls = append(toolCalls, ToolCall{ID: call.id, Name: call.name, Arguments: args})
+	}
+	return toolCalls, nil
+}
+
+// arguments returns the call's arguments, never nil so they encode as an object
+func (c ToolCall) arguments() map[string]interface{} {
+	if c.Arguments == nil {
+		return map[string]interface{}{}
+	}
+	return c.Arguments
+}
+
+func toOpenAITools(tools []Tool) []OpenAITool {
+	var converted []OpenAITool
+	for _, tool := range tools {
+		converted = append(converted, OpenAITool{
+			Type: "function",
+			Function: OpenAIFunction{
+				Name:        tool.Name,
+				Description: tool.Description,
+				Parameters:  tool.schema(false),
+			},
+		})
+	}
+	return converted
+}
+
+// toOpenAIConversation adds the tool calls of conv to its messages: each
+// assistant turn that called tools is followed by one "tool" message per call
+func toOpenAIConversation(systemPrompt string, conv conversation) []OpenAIMessage {
+	converted := toOpenAIMessages(systemPrompt, conv.messages)
+	for _, step := range conv.steps {
+		assistant := OpenAIMessage{Role: RoleAssistant, Content: step.text}
+		for _, call := range step.calls {
+			arguments, _ := json.Marshal(call.arguments())
+			toolCall := OpenAIToolCall{ID: call.ID, Type: "function"}
+			toolCall.Function.Name = call.Name
+			toolCall.Function.Arguments = string(arguments)
+			assistant.ToolCalls = append(assistant.ToolCalls, toolCall)
+		}
+		converted = append(converted, assistant)
+		for _, result := range step.results {
+			converted = append(converted, OpenAIMessage{
+				Role:       "tool",
+				Content:    result.content(),
+				ToolCallID: result.ID,
+			})
+		}
+	}
+	return converted
+}
+
+func toClaudeTools(tools []Tool) []ClaudeTool {
+	var converted []ClaudeTool
+	for _, tool := range tools {
+		converted = append(converted, ClaudeTool{
+			Name:        tool.Name,
+			Description: tool.Description,
+			InputSchema: tool.schema(false),
+		})
+	}
+	return converted
+}
+
+// toClaudeConversation adds the tool calls of conv to its messages as
+// tool_use blocks, answered by tool_result blocks in a user message
+func toClaudeConversation(conv conversation) []ClaudeMessage {
+	converted := toClaudeMessages(conv.messages)
+	for _, step := range conv.steps {
+		var uses, results []ClaudeContentBlock
+		if step.text != "" {
+			uses = append(uses, ClaudeContentBlock{Type: "text", Text: step.text})
+		}
+		for _, call := range step.calls {
+			uses = append(uses, ClaudeContentBlock{
+				Type:  "tool_use",
+				ID:    call.ID,
+				Name:  call.Name,
+				Input: call.arguments(),
+			})
+		}
+		for _, result := range step.results {
+			results = append(results, ClaudeContentBlock{
+				Type:      "tool_result",
+				ToolUseID: result.ID,
+				Content:   result.content(),
+				IsError:   result.Status == ToolFailed,
+			})
+		}
+		converted = append(converted,
+			ClaudeMessage{Role: RoleAssistant, Content: uses},
+			ClaudeMessage{Role: RoleUser, Content: results},
+		)
+	}
+	return converted
+}
+
+func toGeminiTools(tools []Tool) []GeminiTool {
+	if len(tools) == 0 {
+		return nil
+	}
+	var declarations []GeminiFunctionDeclaration
+	for _, tool := range tools {
+		declarations = append(declarations, GeminiFunctionDeclaration{
+			Name:        tool.Name,
+			Description: tool.Description,
+			Parameters:  tool.schema(true),
+		})
+	}
+	return []GeminiTool{{FunctionDeclarations: declarations}}
+}
+
+// toGeminiConversation adds the tool calls of conv to its contents as
+// functionCall parts, answered by functionResponse parts
+func toGeminiConversation(conv conversation) []GeminiContent {
+	converted := toGeminiContents(conv.messages)
+	for _, step := range conv.steps {
+		var calls, responses []GeminiPart
+		if step.text != "" {
+			calls = append(calls, GeminiPart{Text: step.text})
+		}
+		for _, call := range step.calls {
+			calls = append(calls, GeminiPart{FunctionCall: &GeminiFunctionCall{
+				Name: call.Name,
+				Args: call.arguments(),
+			}})
+		}
+		for _, result := range step.results {
+			key := "content"
+			if result.Status == ToolFailed {
+				key = "error"
+			}
+			responses = append(responses, GeminiPart{FunctionResponse: &GeminiFunctionResponse{
+				Name:     result.Name,
+				Response: map[string]interface{}{key: result.content()},
+			}})
+		}
+		converted = append(converted,
+			GeminiContent{Role: "model", Parts: calls},
+			GeminiContent{Role: RoleUser, Parts: responses},
+		)
+	}
+	return converted
+}
@@ -0,0 +1,452 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// calcFunctions are the functions expressions can call
+var calcFunctions = map[string]func(float64) float64{
+	"sqrt":  math.Sqrt,
+	"cbrt":  math.Cbrt,
+	"abs":   math.Abs,
+	"round": math.Round,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"exp":   math.Exp,
+	"ln":    math.Log,
+	"log":   math.Log10,
+	"log2":  math.Log2,
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+}
+
+var calcConstants = map[string]float64{
+	"pi":  math.Pi,
+	"π":   math.Pi,
+	"e":   math.E,
+	"tau": 2 * math.Pi,
+}
+
+// calcWordOperators lets expressions be written out, e.g. "5 times 3"
+var calcWordOperators = map[string]string{
+	"plus":    "+",
+	"minus":   "-",
+	"times":   "*",
+	"x":       "*",
+	"mod":     "mod",
+	"of":      "of",
+	"over":    "/",
+	"divided": "/",
+}
+
+// isoDatePattern keeps "2026-12-25" from being read as a subtraction
+var isoDatePattern = regexp.MustCompile(`\d{4}-\d{1,2}-\d{1,2}`)
+
+type calcToken struct {
+	kind  byte // 'n' number, 'i' identifier, or the operator character
+	text  string
+	value float64
+	// base is 16, 8 or 2 for literals such as 0x1F
+	base int
+}
+
+// calcValue is an intermediate result. A percentage added to or
+// subtracted from a value scales it, as on a desk calculator.
+type calcValue struct {
+	v       float64
+	percent bool
+}
+
+type calcParser struct {
+	tokens []calcToken
+	pos    int
+	// ops counts the operations applied, so a bare number can be told apart
+	// from a calculation
+	ops int
+}
+
+// evalExpression evaluates an arithmetic expression. It returns the value,
+// the number of operations in it and the base of its only literal, if the
+// expression is a single 0x, 0o or 0b literal.
+func evalExpression(expr string) (float64, int, int, error) {
+	if isoDatePattern.MatchString(expr) {
+		return 0, 0, 0, fmt.Errorf("looks like a date")
+	}
+	tokens, err := tokenizeExpression(expr)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if len(tokens) == 0 {
+		return 0, 0, 0, fmt.Errorf("empty expression")
+	}
+
+	p := &calcParser{tokens: tokens}
+	value, err := p.parseSum()
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	if p.pos < len(p.tokens) {
+		return 0, 0, 0, fmt.Errorf("unexpected %q", p.tokens[p.pos].text)
+	}
+	if math.IsNaN(value.v) || math.IsInf(value.v, 0) {
+		return 0, 0, 0, fmt.Errorf("result is not a number")
+	}
+
+	base := 0
+	if len(tokens) == 1 {
+		base = tokens[0].base
+	}
+	return value.v, p.ops, base, nil
+}
+
+func tokenizeExpression(expr string) ([]calcToken, error) {
+	var tokens []calcToken
+	runes := []rune(strings.TrimSpace(expr))
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+
+		case unicode.IsDigit(r) || (r == '.' && i+1 < len(runes) && unicode.IsDigit(runes[i+1])):
+			token, n, err := scanNumber(runes[i:])
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token)
+			i += n
+
+		case unicode.IsLetter(r):
+			start := i
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i])) {
+				i++
+			}
+			word := strings.ToLower(string(runes[start:i]))
+			if op, ok := calcWordOperators[word]; ok {
+				if word == "divided" {
+					// "divided by"
+					j := i
+					for j < len(runes) && unicode.IsSpace(runes[j]) {
+						j++
+					}
+					if strings.HasPrefix(strings.ToLower(string(runes[j:])), "by") {
+						i = j + 2
+					}
+				}
+				tokens = append(tokens, calcToken{kind: op[0], text: op})
+				continue
+			}
+			tokens = append(tokens, calcToken{kind: 'i', text: word})
+
+		default:
+			op := r
+			switch r {
+			case '×', '·':
+				op = '*'
+			case '÷':
+				op = '/'
+			case '−':
+				op = '-'
+			}
+			if op == '*' && i+1 < len(runes) && runes[i+1] == '*' {
+				op = '^'
+				i++
+			}
+			if !strings.ContainsRune("+-*/%^()!", op) {
+				return nil, fmt.Errorf("unexpected %q", string(r))
+			}
+			tokens = append(tokens, calcToken{kind: byte(op), text: string(op)})
+			i++
+		}
+	}
+	return tokens, nil
+}
+
+// scanNumber reads a number literal: decimal (with "1,000" separators and
+// exponents) or 0x, 0o and 0b integers
+func scanNumber(runes []rune) (calcToken, int, error) {
+	if len(runes) > 2 && runes[0] == '0' {
+		base := map[rune]int{'x': 16, 'X': 16, 'o': 8, 'O': 8, 'b': 2, 'B': 2}[runes[1]]
+		if base != 0 {
+			n := 2
+			for n < len(runes) && isDigitInBase(runes[n], base) {
+				n++
+			}
+			if n > 2 {
+				text := string(runes[:n])
+				value, err := strconv.ParseUint(text[2:], base, 64)
+				if err != nil {
+					return calcToken{}, 0, fmt.Errorf("invalid number %s", text)
+				}
+				return calcToken{kind: 'n', text: text, value: float64(value), base: base}, n, nil
+			}
+		}
+	}
+
+	var digits strings.Builder
+	n := 0
+scan:
+	for n < len(runes) {
+		r := runes[n]
+		switch {
+		case unicode.IsDigit(r) || r == '.':
+			digits.WriteRune(r)
+			n++
+		case r == ',' && isThousandsGroup(runes[n+1:]):
+			n++
+		case (r == 'e' || r == 'E') && isExponent(runes[n+1:]):
+			digits.WriteRune(r)
+			digits.WriteRune(runes[n+1])
+			n += 2
+		default:
+			break scan
+		}
+	}
+	text := digits.String()
+	value, err := strconv.ParseFloat(text, 64)
+	if err != nil {
+		return calcToken{}, 0, fmt.Errorf("invalid number %s", text)
+	}
+	return calcToken{kind: 'n', text: text, value: value}, n, nil
+}
+
+// isThousandsGroup reports whether runes start with exactly three digits
+func isThousandsGroup(runes []rune) bool {
+	if len(runes) < 3 {
+		return false
+	}
+	for _, r := range runes[:3] {
+		if !unicode.IsDigit(r) {
+			return false
+		}
+	}
+	return len(runes) == 3 || !unicode.IsDigit(runes[3])
+}
+
+// isExponent reports whether runes continue an exponent such as e3 or e-3
+func isExponent(runes []rune) bool {
+	if len(runes) > 1 && (runes[0] == '-' || runes[0] == '+') {
+		runes = runes[1:]
+	}
+	return len(runes) > 0 && unicode.IsDigit(runes[0])
+}
+
+func isDigitInBase(r rune, base int) bool {
+	switch base {
+	case 2:
+		return r == '0' || r == '1'
+	case 8:
+		return r >= '0' && r <= '7'
+	}
+	return unicode.Is(unicode.ASCII_Hex_Digit, r)
+}
+
+func (p *calcParser) peek() (calcToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return calcToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// parseSum parses terms joined by + and -
+func (p *calcParser) parseSum() (calcValue, error) {
+	left, err := p.parseProduct()
+	if err != nil {
+		return left, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok || (token.kind != '+' && token.kind != '-') {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseProduct()
+		if err != nil {
+			return left, err
+		}
+		p.ops++
+
+		delta := right.v
+		if right.percent && !left.percent {
+			// 240 + 15% is 240 plus 15% of 240
+			delta = left.v * right.v
+		}
+		if token.kind == '+' {
+			left = calcValue{v: left.v + delta}
+		} else {
+			left = calcValue{v: left.v - delta}
+		}
+	}
+}
+
+// parseProduct parses factors joined by *, /, mod and "of"
+func (p *calcParser) parseProduct() (calcValue, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return left, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok {
+			return left, nil
+		}
+		op := token.kind
+		if op == '%' {
+			// A % that survived parsePostfix is a modulo
+			op = 'm'
+		}
+		if op != '*' && op != '/' && op != 'm' && op != 'o' {
+			return left, nil
+		}
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return left, err
+		}
+		p.ops++
+
+		switch op {
+		case '*', 'o':
+			left = calcValue{v: left.v * right.v}
+		case '/':
+			if right.v == 0 {
+				return left, fmt.Errorf("division by zero")
+			}
+			left = calcValue{v: left.v / right.v}
+		case 'm':
+			if right.v == 0 {
+				return left, fmt.Errorf("division by zero")
+			}
+			left = calcValue{v: math.Mod(left.v, right.v)}
+		}
+	}
+}
+
+func (p *calcParser) parseUnary() (calcValue, error) {
+	if token, ok := p.peek(); ok && (token.kind == '-' || token.kind == '+') {
+		p.pos++
+		value, err := p.parseUnary()
+		if token.kind == '-' {
+			value.v = -value.v
+		}
+		return value, err
+	}
+	return p.parsePower()
+}
+
+// parsePower parses exponentiation, which binds right to left
+func (p *calcParser) parsePower() (calcValue, error) {
+	base, err := p.parsePostfix()
+	if err != nil {
+		return base, err
+	}
+	if token, ok := p.peek(); ok && token.kind == '^' {
+		p.pos++
+		exponent, err := p.parseUnary()
+		if err != nil {
+			return base, err
+		}
+		p.ops++
+		return calcValue{v: math.Pow(base.v, exponent.v)}, nil
+	}
+	return base, nil
+}
+
+// parsePostfix parses percentages and factorials. A % followed by an
+// operand is a modulo and is left for parseProduct.
+func (p *calcParser) parsePostfix() (calcValue, error) {
+	value, err := p.parsePrimary()
+	if err != nil {
+		return value, err
+	}
+	for {
+		token, ok := p.peek()
+		if !ok {
+			return value, nil
+		}
+		switch token.kind {
+		case '%':
+			if p.pos+1 < len(p.tokens) && startsOperand(p.tokens[p.pos+1]) {
+				return value, nil
+			}
+			p.pos++
+			p.ops++
+			value = calcValue{v: value.v / 100, percent: true}
+		case '!':
+			p.pos++
+			p.ops++
+			if value.v < 0 || value.v != math.Trunc(value.v) || value.v > 170 {
+				return value, fmt.Errorf("factorial needs a whole number up to 170")
+			}
+			result := 1.0
+			for i := 2.0; i <= value.v; i++ {
+				result *= i
+			}
+			value = calcValue{v: result}
+		default:
+			return value, nil
+		}
+	}
+}
+
+func startsOperand(token calcToken) bool {
+	return token.kind == 'n' || token.kind == '(' || token.kind == 'i'
+}
+
+func (p *calcParser) parsePrimary() (calcValue, error) {
+	token, ok := p.peek()
+	if !ok {
+		return calcValue{}, fmt.Errorf("expression ends too early")
+	}
+	p.pos++
+
+	switch token.kind {
+	case 'n':
+		return calcValue{v: token.value}, nil
+
+	case '(':
+		value, err := p.parseSum()
+		if err != nil {
+			return value, err
+		}
+		if closing, ok := p.peek(); !ok || closing.kind != ')' {
+			return value, fmt.Errorf("missing )")
+		}
+		p.pos++
+		return value, nil
+
+	case 'i':
+		if constant, ok := calcConstants[token.text]; ok {
+			return calcValue{v: constant}, nil
+		}
+		if fn, ok := calcFunctions[token.text]; ok {
+			// sqrt(16) and sqrt 16 both work
+			arg, err := p.parsePower()
+			if err != nil {
+				return arg, err
+			}
+			p.ops++
+			return calcValue{v: fn(arg.v)}, nil
+		}
+		return calcValue{}, fmt.Errorf("unknown name %q", token.text)
+	}
+	return calcValue{}, fmt.Errorf("unexpected %q", token.text)
+}
+
+// formatNumber prints a result without float noise, e.g. 0.1+0.2 as 0.3
+func formatNumber(v float64) string {
+	if v == math.Trunc(v) && math.Abs(v) < 1e15 {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return strconv.FormatFloat(v, 'g', 12, 64)
+}
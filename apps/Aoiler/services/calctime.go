@@ -0,0 +1,500 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	// Embed the tz database so zones resolve without system zoneinfo
+	_ "time/tzdata"
+)
+
+// zoneAbbreviations maps common abbreviations to a zone observing them,
+// so "EST" follows New York through daylight saving time
+var zoneAbbreviations = map[string]string{
+	"utc": "UTC", "gmt": "UTC", "z": "UTC",
+	"est": "America/New_York", "edt": "America/New_York", "et": "America/New_York",
+	"cst": "America/Chicago", "cdt": "America/Chicago", "ct": "America/Chicago",
+	"mst": "America/Denver", "mdt": "America/Denver", "mt": "America/Denver",
+	"pst": "America/Los_Angeles", "pdt": "America/Los_Angeles", "pt": "America/Los_Angeles",
+	"bst": "Europe/London", "cet": "Europe/Paris", "cest": "Europe/Paris",
+	"eet": "Europe/Athens", "eest": "Europe/Athens", "msk": "Europe/Moscow",
+	"ist": "Asia/Kolkata", "sgt": "Asia/Singapore", "hkt": "Asia/Hong_Kong",
+	"jst": "Asia/Tokyo", "kst": "Asia/Seoul",
+	"aest": "Australia/Sydney", "aedt": "Australia/Sydney", "nzst": "Pacific/Auckland",
+}
+
+// zoneCities covers places that are not named in the tz database
+var zoneCities = map[string]string{
+	"new york city": "America/New_York", "nyc": "America/New_York", "boston": "America/New_York",
+	"washington": "America/New_York", "miami": "America/New_York", "atlanta": "America/New_York",
+	"san francisco": "America/Los_Angeles", "sf": "America/Los_Angeles", "seattle": "America/Los_Angeles",
+	"la": "America/Los_Angeles", "portland": "America/Los_Angeles", "las vegas": "America/Los_Angeles",
+	"dallas": "America/Chicago", "houston": "America/Chicago", "austin": "America/Chicago",
+	"san diego": "America/Los_Angeles", "montreal": "America/Toronto", "ottawa": "America/Toronto",
+	"beijing": "Asia/Shanghai", "china": "Asia/Shanghai", "shenzhen": "Asia/Shanghai",
+	"delhi": "Asia/Kolkata", "new delhi": "Asia/Kolkata", "mumbai": "Asia/Kolkata",
+	"bangalore": "Asia/Kolkata", "bengaluru": "Asia/Kolkata", "india": "Asia/Kolkata",
+	"japan": "Asia/Tokyo", "osaka": "Asia/Tokyo", "korea": "Asia/Seoul",
+	"munich": "Europe/Berlin", "hamburg": "Europe/Berlin", "frankfurt": "Europe/Berlin", "germany": "Europe/Berlin",
+	"france": "Europe/Paris", "uk": "Europe/London", "england": "Europe/London", "manchester": "Europe/London",
+	"spain": "Europe/Madrid", "barcelona": "Europe/Madrid", "italy": "Europe/Rome", "milan": "Europe/Rome",
+	"netherlands": "Europe/Amsterdam", "geneva": "Europe/Zurich", "st petersburg": "Europe/Moscow",
+	"sao paulo": "America/Sao_Paulo", "rio de janeiro": "America/Sao_Paulo", "brazil": "America/Sao_Paulo",
+	"melbourne": "Australia/Melbourne", "canberra": "Australia/Sydney", "wellington": "Pacific/Auckland",
+	"dubai": "Asia/Dubai", "abu dhabi": "Asia/Dubai", "tel aviv": "Asia/Jerusalem",
+}
+
+// zoneRegions are tried in turn for a bare city name, e.g. Tokyo as Asia/Tokyo
+var zoneRegions = []string{"Europe", "America", "Asia", "Africa", "Australia", "Pacific", "Atlantic", "Indian", "America/Argentina"}
+
+// zoneCache remembers resolved names, including misses, since classifying
+// while typing looks the same names up again and again
+var zoneCache sync.Map
+
+type resolvedZone struct {
+	location *time.Location
+	label    string
+}
+
+var utcOffsetPattern = regexp.MustCompile(`^(?:utc|gmt)\s*([+-])\s*(\d{1,2})(?::?(\d{2}))?$`)
+
+// lookupZone resolves a city, zone name, abbreviation or UTC offset. The
+// label is how the zone is shown in results.
+func lookupZone(name string) (*time.Location, string, bool) {
+	key := strings.ToLower(strings.Join(strings.Fields(strings.Trim(name, " ?.,")), " "))
+	if key == "" || key == "here" || key == "local" {
+		return time.Local, "local time", true
+	}
+	if cached, ok := zoneCache.Load(key); ok {
+		zone := cached.(*resolvedZone)
+		return zone.location, zone.label, zone.location != nil
+	}
+
+	zone := &resolvedZone{label: titleWords(key, " ")}
+	if m := utcOffsetPattern.FindStringSubmatch(key); m != nil {
+		hours, _ := strconv.Atoi(m[2])
+		minutes, _ := strconv.Atoi(m[3])
+		offset := hours*3600 + minutes*60
+		if m[1] == "-" {
+			offset = -offset
+		}
+		zone.label = strings.ToUpper(key)
+		zone.location = time.FixedZone(zone.label, offset)
+	} else if tz, ok := zoneAbbreviations[key]; ok {
+		zone.label = strings.ToUpper(key)
+		zone.location, _ = time.LoadLocation(tz)
+	} else if tz, ok := zoneCities[key]; ok {
+		zone.location, _ = time.LoadLocation(tz)
+	} else if strings.Contains(key, "/") {
+		// A tz database name such as America/New_York
+		if location, err := time.LoadLocation(titleWords(key, "_")); err == nil {
+			zone.location, zone.label = location, location.String()
+		}
+	} else if len(key) > 2 {
+		city := titleWords(key, "_")
+		for _, region := range zoneRegions {
+			if location, err := time.LoadLocation(region + "/" + city); err == nil {
+				zone.location = location
+				break
+			}
+		}
+	}
+
+	zoneCache.Store(key, zone)
+	return zone.location, zone.label, zone.location != nil
+}
+
+// titleWords capitalizes every word, also after a slash, and joins them
+// with sep: "los angeles" becomes "Los_Angeles"
+func titleWords(s, sep string) string {
+	words := strings.Fields(s)
+	for i, word := range words {
+		parts := strings.Split(word, "/")
+		for j, part := range parts {
+			if part != "" {
+				parts[j] = strings.ToUpper(part[:1]) + part[1:]
+			}
+		}
+		words[i] = strings.Join(parts, "/")
+	}
+	return strings.Join(words, sep)
+}
+
+var (
+	// timeInZonePattern matches "time in Tokyo" and "what time is it in Tokyo"
+	timeInZonePattern = regexp.MustCompile(`(?i)^(?:what(?:'s| is) the |what |current |local )?time(?: is it)?(?: now)? in (.+)$`)
+	// clockPattern matches the time at the start of "3pm Tokyo in Berlin"
+	clockPattern = regexp.MustCompile(`(?i)^(?:(\d{1,2})(?::(\d{2}))?\s*(am|pm)|(\d{1,2}):(\d{2})|(now|noon|midnight))\b\s*(.*)$`)
+)
+
+// convertTimeZone answers "3pm Tokyo in Berlin", "15:30 in UTC" or
+// "time in Sydney"
+func convertTimeZone(query string, now time.Time) (CalculatorResult, error) {
+	if m := timeInZonePattern.FindStringSubmatch(query); m != nil {
+		location, label, ok := lookupZone(m[1])
+		if !ok {
+			return CalculatorResult{}, fmt.Errorf("unknown time zone %q", m[1])
+		}
+		return CalculatorResult{
+			Kind:       CalcTime,
+			Expression: "now in " + label,
+			Result:     formatZoneTime(now.In(location), label),
+		}, nil
+	}
+
+	for _, split := range splitConversions(query) {
+		m := clockPattern.FindStringSubmatch(split[0])
+		if m == nil {
+			continue
+		}
+		source, sourceLabel, ok := lookupZone(m[7])
+		if !ok {
+			continue
+		}
+		target, targetLabel, ok := lookupZone(split[1])
+		if !ok {
+			continue
+		}
+
+		start, err := clockTime(m, now.In(source))
+		if err != nil {
+			return CalculatorResult{}, err
+		}
+		return CalculatorResult{
+			Kind:       CalcTime,
+			Expression: formatZoneTime(start, sourceLabel),
+			Result:     formatZoneTime(start.In(target), targetLabel),
+		}, nil
+	}
+	return CalculatorResult{}, fmt.Errorf("not a time zone conversion")
+}
+
+// clockTime builds the time matched by clockPattern on the day of now
+func clockTime(m []string, now time.Time) (time.Time, error) {
+	var hour, minute int
+	switch {
+	case m[6] != "":
+		switch strings.ToLower(m[6]) {
+		case "now":
+			return now, nil
+		case "noon":
+			hour = 12
+		}
+	case m[3] != "":
+		hour, _ = strconv.Atoi(m[1])
+		minute, _ = strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 {
+			return time.Time{}, fmt.Errorf("invalid time %s%s", m[1], m[3])
+		}
+		hour %= 12
+		if strings.EqualFold(m[3], "pm") {
+			hour += 12
+		}
+	default:
+		hour, _ = strconv.Atoi(m[4])
+		minute, _ = strconv.Atoi(m[5])
+	}
+	if hour > 23 || minute > 59 {
+		return time.Time{}, fmt.Errorf("invalid time %02d:%02d", hour, minute)
+	}
+	return time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location()), nil
+}
+
+func formatZoneTime(t time.Time, label string) string {
+	return fmt.Sprintf("%s %s (%s)", t.Format("Mon 15:04"), label, t.Format("MST"))
+}
+
+// dateLayouts are the date formats accepted besides today, tomorrow and so on
+var dateLayouts = []string{
+	"2006-01-02 15:04", "2006-01-02", "2006/01/02",
+	"Jan 2 2006", "Jan 2, 2006", "January 2 2006", "January 2, 2006",
+	"2 Jan 2006", "2 January 2006",
+}
+
+// yearlessLayouts are resolved to the next occurrence of the date
+var yearlessLayouts = []string{"Jan 2", "January 2", "2 Jan", "2 January"}
+
+// parseDate reads a date. dayOnly reports whether it has no time of day.
+func parseDate(s string, now time.Time) (t time.Time, dayOnly bool, ok bool) {
+	s = strings.Join(strings.Fields(s), " ")
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	switch strings.ToLower(s) {
+	case "now":
+		return now, false, true
+	case "today":
+		return today, true, true
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), true, true
+	case "yesterday":
+		return today.AddDate(0, 0, -1), true, true
+	case "christmas":
+		s = "Dec 25"
+	case "new year", "new years", "new year's day":
+		s = "Jan 1"
+	}
+
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, titleWords(s, " "), now.Location()); err == nil {
+			return t, !strings.Contains(layout, ":"), true
+		}
+	}
+	for _, layout := range yearlessLayouts {
+		if t, err := time.ParseInLocation(layout, titleWords(s, " "), now.Location()); err == nil {
+			t = t.AddDate(now.Year()-t.Year(), 0, 0)
+			if t.Before(today) {
+				t = t.AddDate(1, 0, 0)
+			}
+			return t, true, true
+		}
+	}
+	return time.Time{}, false, false
+}
+
+// dateSpan is a calendar duration such as "1 month 2 days"
+type dateSpan struct {
+	years, months, days int
+	clock               time.Duration
+}
+
+func (d dateSpan) addTo(t time.Time, sign int) time.Time {
+	return t.AddDate(sign*d.years, sign*d.months, sign*d.days).Add(time.Duration(sign) * d.clock)
+}
+
+var (
+	spanTermPattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?|an?\s)\s*([a-z]+)$`)
+	// spanAmountPattern is an amount written apart from its unit
+	spanAmountPattern = regexp.MustCompile(`(?i)^(\d+(?:\.\d+)?|an?)$`)
+)
+
+// parseSpan reads "3 weeks", "1 year 2 months" or "2h 30min"
+func parseSpan(s string) (dateSpan, bool) {
+	var span dateSpan
+	words := strings.Fields(strings.NewReplacer(",", " ", " and ", " ").Replace(s))
+	if len(words) == 0 {
+		return span, false
+	}
+	for i := 0; i < len(words); i++ {
+		term := words[i]
+		if spanAmountPattern.MatchString(term) && i+1 < len(words) {
+			i++
+			term += " " + words[i]
+		}
+		m := spanTermPattern.FindStringSubmatch(term)
+		if m == nil {
+			return span, false
+		}
+		amount := 1.0
+		if !strings.HasPrefix(strings.ToLower(m[1]), "a") {
+			amount, _ = strconv.ParseFloat(m[1], 64)
+		}
+		whole := amount == math.Trunc(amount)
+
+		unit := strings.ToLower(m[2])
+		if unit == "ms" {
+			return span, false
+		}
+		switch strings.TrimSuffix(unit, "s") {
+		case "y", "yr", "year":
+			if !whole {
+				return span, false
+			}
+			span.years += int(amount)
+		case "mo", "month":
+			if !whole {
+				return span, false
+			}
+			span.months += int(amount)
+		case "w", "wk", "week":
+			amount *= 7
+			fallthrough
+		case "d", "day":
+			if whole {
+				span.days += int(amount)
+			} else {
+				span.clock += time.Duration(amount * float64(24*time.Hour))
+			}
+		case "h", "hr", "hour":
+			span.clock += time.Duration(amount * float64(time.Hour))
+		case "m", "min", "minute":
+			span.clock += time.Duration(amount * float64(time.Minute))
+		case "", "sec", "second":
+			span.clock += time.Duration(amount * float64(time.Second))
+		default:
+			return span, false
+		}
+	}
+	return span, true
+}
+
+var (
+	// dateOperator joins "today + 90 days" or "2026-03-01 minus 2 weeks"
+	dateOperator = regexp.MustCompile(`(?i)\s*(\+|-|\bplus\b|\bminus\b)\s*`)
+	// spanFromPattern matches "90 days from today" and "2 weeks before christmas"
+	spanFromPattern = regexp.MustCompile(`(?i)^(.+?)\s+(from|after|before)\s+(.+)$`)
+	spanAgoPattern  = regexp.MustCompile(`(?i)^(?:in\s+(.+)|(.+?)\s+(ago|from now))$`)
+	// untilPattern matches "days until christmas" and "how long since 2020-03-01"
+	untilPattern   = regexp.MustCompile(`(?i)^(?:how many |how long )?(?:(days|weeks|time)\s+)?(?:is it\s+)?(until|till|to|since)\s+(.+)$`)
+	betweenPattern = regexp.MustCompile(`(?i)^(?:days|weeks|time)\s+between\s+(.+?)\s+and\s+(.+)$`)
+)
+
+// calculateDate answers date arithmetic: adding spans to dates, the time
+// between two dates and what day a date falls on
+func calculateDate(query string, now time.Time) (CalculatorResult, error) {
+	if m := betweenPattern.FindStringSubmatch(query); m != nil {
+		from, _, ok1 := parseDate(m[1], now)
+		to, _, ok2 := parseDate(m[2], now)
+		if ok1 && ok2 {
+			return dateDifference(query, from, to), nil
+		}
+	}
+
+	if m := untilPattern.FindStringSubmatch(query); m != nil {
+		if target, dayOnly, ok := parseDate(m[3], now); ok {
+			from := now
+			if dayOnly {
+				from, _, _ = parseDate("today", now)
+			}
+			if strings.EqualFold(m[2], "since") {
+				return dateDifference(query, target, from), nil
+			}
+			return dateDifference(query, from, target), nil
+		}
+	}
+
+	if m := spanAgoPattern.FindStringSubmatch(query); m != nil {
+		spanText, sign := m[1], 1
+		if spanText == "" {
+			spanText = m[2]
+			if strings.EqualFold(m[3], "ago") {
+				sign = -1
+			}
+		}
+		if span, ok := parseSpan(spanText); ok {
+			return dateResult(query, span.addTo(now, sign), false), nil
+		}
+	}
+
+	if m := spanFromPattern.FindStringSubmatch(query); m != nil {
+		span, ok := parseSpan(m[1])
+		base, dayOnly, ok2 := parseDate(m[3], now)
+		if ok && ok2 {
+			sign := 1
+			if strings.EqualFold(m[2], "before") {
+				sign = -1
+			}
+			return dateResult(query, span.addTo(base, sign), dayOnly && span.clock == 0), nil
+		}
+	}
+
+	// Dates contain dashes themselves, so try every operator as the split
+	for _, loc := range dateOperator.FindAllStringSubmatchIndex(query, -1) {
+		base, dayOnly, ok := parseDate(query[:loc[0]], now)
+		if !ok {
+			continue
+		}
+		operator, rest := query[loc[2]:loc[3]], query[loc[1]:]
+		sign := 1
+		if operator == "-" || strings.EqualFold(operator, "minus") {
+			sign = -1
+		}
+		if span, ok := parseSpan(rest); ok {
+			return dateResult(query, span.addTo(base, sign), dayOnly && span.clock == 0), nil
+		}
+		if other, _, ok := parseDate(rest, now); ok && sign < 0 {
+			return dateDifference(query, other, base), nil
+		}
+	}
+
+	if t, dayOnly, ok := parseDate(query, now); ok {
+		result := dateResult(query, t, dayOnly)
+		if dayOnly {
+			today, _, _ := parseDate("today", now)
+			if days := calendarDays(today, t); days != 0 {
+				result.Alternatives = []string{relativeDays(days)}
+			}
+		}
+		return result, nil
+	}
+	return CalculatorResult{}, fmt.Errorf("not a date calculation")
+}
+
+func dateResult(query string, t time.Time, dayOnly bool) CalculatorResult {
+	layout := "Mon, 2 Jan 2006 15:04"
+	if dayOnly {
+		layout = "Mon, 2 Jan 2006"
+	}
+	return CalculatorResult{Kind: CalcDate, Expression: query, Result: t.Format(layout)}
+}
+
+// dateDifference reports the time from one date to another in days, with
+// weeks and hours as alternatives
+func dateDifference(query string, from, to time.Time) CalculatorResult {
+	days := calendarDays(from, to)
+	value := float64(days)
+	result := CalculatorResult{Kind: CalcDate, Expression: query, Value: &value}
+
+	if !isMidnight(from) || !isMidnight(to) {
+		// A time of day is involved, e.g. counting from now
+		elapsed := to.Sub(from)
+		value = elapsed.Hours() / 24
+		result.Result = formatDays(value)
+		result.Alternatives = []string{fmt.Sprintf("%s hours", formatNumber(math.Round(elapsed.Hours()*10)/10))}
+		return result
+	}
+
+	result.Result = formatDays(value)
+	if abs := max(days, -days); abs >= 7 {
+		weeks, rest := abs/7, abs%7
+		alternative := plural(weeks, "week")
+		if rest > 0 {
+			alternative += " and " + plural(rest, "day")
+		}
+		result.Alternatives = []string{alternative}
+	}
+	return result
+}
+
+func isMidnight(t time.Time) bool {
+	return t.Hour() == 0 && t.Minute() == 0 && t.Second() == 0
+}
+
+// calendarDays counts midnights between two dates, unaffected by DST
+func calendarDays(from, to time.Time) int {
+	a := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)
+	b := time.Date(to.Year(), to.Month(), to.Day(), 0, 0, 0, 0, time.UTC)
+	return int(b.Sub(a).Hours() / 24)
+}
+
+func formatDays(days float64) string {
+	if days == math.Trunc(days) {
+		if math.Abs(days) == 1 {
+			return formatNumber(days) + " day"
+		}
+		return formatNumber(days) + " days"
+	}
+	return fmt.Sprintf("%.1f days", days)
+}
+
+func plural(n int, word string) string {
+	if n == 1 {
+		return "1 " + word
+	}
+	return fmt.Sprintf("%d %ss", n, word)
+}
+
+func relativeDays(days int) string {
+	switch {
+	case days == 1:
+		return "tomorrow"
+	case days == -1:
+		return "yesterday"
+	case days > 0:
+		return fmt.Sprintf("in %d days", days)
+	}
+	return fmt.Sprintf("%d days ago", -days)
+}
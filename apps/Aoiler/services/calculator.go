@@ -0,0 +1,107 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Kinds of calculator results
+const (
+	CalcMath = "math"
+	CalcUnit = "unit"
+	CalcSize = "size"
+	CalcBase = "base"
+	CalcTime = "time"
+	CalcDate = "date"
+)
+
+// CalculatorResult is the answer to a calculation or conversion
+type CalculatorResult struct {
+	Kind string `json:"kind"`
+	// Expression is the input as the calculator understood it
+	Expression string `json:"expression"`
+	Result     string `json:"result"`
+	// Value is the numeric result, when there is one
+	Value *float64 `json:"value,omitempty"`
+	// Alternatives are the result in other forms, e.g. other bases
+	Alternatives []string `json:"alternatives,omitempty"`
+	Success      bool     `json:"success"`
+}
+
+// CalculatorService evaluates math, unit, base, data size, time zone and
+// date queries offline. It recognizes them by their shape rather than by
+// keywords, so "15% of 240" never waits for the LLM.
+type CalculatorService struct{}
+
+func NewCalculatorService() *CalculatorService {
+	return &CalculatorService{}
+}
+
+func (cs *CalculatorService) Name() string { return "calculator" }
+func (cs *CalculatorService) Description() string {
+	return "Calculate and convert units, bases, data sizes and time zones"
+}
+
+// Keywords is empty: "calculate" alone says nothing about whether the rest
+// of the query can be calculated, so MatchesQuery does the routing
+func (cs *CalculatorService) Keywords() []string { return nil }
+
+// MatchesQuery reports whether the whole query is something the calculator
+// can answer
+func (cs *CalculatorService) MatchesQuery(query string) bool {
+	_, err := Calculate(query, time.Now())
+	return err == nil
+}
+
+func (cs *CalculatorService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	result, err := Calculate(intent.Query, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("could not calculate %q: %w", intent.Query, err)
+	}
+	return result, nil
+}
+
+// calcPrefix is filler around the actual calculation
+var calcPrefix = regexp.MustCompile(`(?i)^(?:what(?:'s| is)|how much is|calculate|calc|convert|=)\s+`)
+
+// Calculate answers query, trying time zones, dates, bases and units before
+// plain arithmetic. A bare number is not a calculation and is rejected, so
+// it still reaches the other services.
+func Calculate(query string, now time.Time) (CalculatorResult, error) {
+	query = strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), "?"))
+	query = strings.TrimSpace(calcPrefix.ReplaceAllString(query, ""))
+	if query == "" {
+		return CalculatorResult{}, fmt.Errorf("nothing to calculate")
+	}
+
+	attempts := []func() (CalculatorResult, error){
+		func() (CalculatorResult, error) { return convertTimeZone(query, now) },
+		func() (CalculatorResult, error) { return calculateDate(query, now) },
+		func() (CalculatorResult, error) { return convertBase(query) },
+		func() (CalculatorResult, error) { return convertUnits(query) },
+	}
+	for _, attempt := range attempts {
+		if result, err := attempt(); err == nil {
+			result.Success = true
+			return result, nil
+		}
+	}
+
+	value, ops, _, err := evalExpression(query)
+	if err != nil {
+		return CalculatorResult{}, err
+	}
+	if ops == 0 {
+		return CalculatorResult{}, fmt.Errorf("nothing to calculate")
+	}
+	return CalculatorResult{
+		Kind:       CalcMath,
+		Expression: query,
+		Result:     formatNumber(value),
+		Value:      &value,
+		Success:    true,
+	}, nil
+}
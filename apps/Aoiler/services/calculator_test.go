@@ -0,0 +1,140 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// calcNow is a Friday in March, when US clocks are already on summer time
+// and European ones are not yet
+var calcNow = time.Date(2024, 3, 15, 14, 30, 0, 0, time.UTC)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		query  string
+		kind   string
+		result string
+	}{
+		{"2+3*4", CalcMath, "14"},
+		{"(2+3)*4", CalcMath, "20"},
+		{"2^10", CalcMath, "1024"},
+		{"-3^2", CalcMath, "-9"},
+		{"5!", CalcMath, "120"},
+		{"sqrt(16)", CalcMath, "4"},
+		{"10 / 4", CalcMath, "2.5"},
+		{"1,000 * 3", CalcMath, "3000"},
+		{"1e3 + 1", CalcMath, "1001"},
+		{"15% of 240", CalcMath, "36"},
+		{"240 + 15%", CalcMath, "276"},
+		{"what is 7 * 6?", CalcMath, "42"},
+		{"= 1/3", CalcMath, "0.333333333333"},
+
+		{"10 km to miles", CalcUnit, "6.21371192237 miles"},
+		{"5 ft to m", CalcUnit, "1.524 m"},
+		{"100 f in c", CalcUnit, "37.7777777778 c"},
+		{"3 hours to minutes", CalcUnit, "180 minutes"},
+		{"1.5 GB to MB", CalcSize, "1500 MB"},
+		{"1 gib in mb", CalcSize, "1073.741824 mb"},
+
+		{"0xff to decimal", CalcBase, "255"},
+		{"255 in hex", CalcBase, "0xFF"},
+		{"255 to binary", CalcBase, "0b11111111"},
+		{"0b1010 in decimal", CalcBase, "10"},
+
+		{"3pm utc in tokyo", CalcTime, "Sat 00:00 Tokyo (JST)"},
+		{"time in london", CalcTime, "Fri 14:30 London (GMT)"},
+		{"10:00 pst to est", CalcTime, "Fri 13:00 EST (EDT)"},
+
+		{"today + 10 days", CalcDate, "Mon, 25 Mar 2024"},
+		{"2024-01-01 + 2 weeks", CalcDate, "Mon, 15 Jan 2024"},
+		{"days until 2024-12-25", CalcDate, "285 days"},
+		{"days between 2024-01-01 and 2024-03-01", CalcDate, "60 days"},
+	}
+	for _, tt := range tests {
+		got, err := Calculate(tt.query, calcNow)
+		if err != nil {
+			t.Errorf("Calculate(%q) failed: %v", tt.query, err)
+			continue
+		}
+		if got.Kind != tt.kind || got.Result != tt.result || !got.Success {
+			t.Errorf("Calculate(%q) = %s %q, want %s %q", tt.query, got.Kind, got.Result, tt.kind, tt.result)
+		}
+	}
+}
+
+func TestCalculateRejects(t *testing.T) {
+	// None of these may be answered, or they would never reach the other services
+	for _, query := range []string{"", "42", "hello", "2 +", "1/0", "10 kg to cm", "open firefox"} {
+		if got, err := Calculate(query, calcNow); err == nil {
+			t.Errorf("Calculate(%q) = %q, want an error", query, got.Result)
+		}
+	}
+}
+
+func TestParseSpan(t *testing.T) {
+	tests := []struct {
+		span string
+		want dateSpan
+		ok   bool
+	}{
+		{"3 days", dateSpan{days: 3}, true},
+		{"2 weeks", dateSpan{days: 14}, true},
+		{"1 month", dateSpan{months: 1}, true},
+		{"1 year 2 months", dateSpan{years: 1, months: 2}, true},
+		{"10 fortnights", dateSpan{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := parseSpan(tt.span)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("parseSpan(%q) = %+v, %v, want %+v, %v", tt.span, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		date    string
+		want    time.Time
+		dayOnly bool
+	}{
+		{"today", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), true},
+		{"tomorrow", time.Date(2024, 3, 16, 0, 0, 0, 0, time.UTC), true},
+		{"now", calcNow, false},
+		{"2024-01-01", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), true},
+		{"christmas", time.Date(2024, 12, 25, 0, 0, 0, 0, time.UTC), true},
+		// A date without a year that has passed is next year's
+		{"jan 2", time.Date(2025, 1, 2, 0, 0, 0, 0, time.UTC), true},
+	}
+	for _, tt := range tests {
+		got, dayOnly, ok := parseDate(tt.date, calcNow)
+		if !ok || !got.Equal(tt.want) || dayOnly != tt.dayOnly {
+			t.Errorf("parseDate(%q) = %s, %v, %v, want %s, %v", tt.date, got, dayOnly, ok, tt.want, tt.dayOnly)
+		}
+	}
+	if _, _, ok := parseDate("someday", calcNow); ok {
+		t.Error(`parseDate("someday") succeeded`)
+	}
+}
+
+func TestLookupUnit(t *testing.T) {
+	tests := []struct {
+		name      string
+		dimension string
+		factor    float64
+	}{
+		{"km", "length", 1000},
+		{"miles", "length", 1609.344},
+		{"Celsius", "temperature", 1},
+		{"degrees celsius", "temperature", 1},
+		{"gib", "data", 1 << 30},
+	}
+	for _, tt := range tests {
+		unit, ok := lookupUnit(tt.name)
+		if !ok || unit.dimension != tt.dimension || unit.factor != tt.factor {
+			t.Errorf("lookupUnit(%q) = %+v, %v, want %s with factor %g", tt.name, unit, ok, tt.dimension, tt.factor)
+		}
+	}
+	if _, ok := lookupUnit("foo"); ok {
+		t.Error(`lookupUnit("foo") succeeded`)
+	}
+}
@@ -0,0 +1,266 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// calcUnit converts a unit to the base unit of its dimension:
+// base = value*factor + offset. Only temperatures have an offset.
+type calcUnit struct {
+	dimension string
+	factor    float64
+	offset    float64
+}
+
+// dimensionData is the dimension of data sizes, whose base unit is the byte
+const dimensionData = "data"
+
+// calcUnitTable lists each unit with its spellings. Names are matched as
+// written first, so "Mb" (megabit) and "MB" (megabyte) stay apart, and then
+// case-insensitively, where the earlier entry wins.
+var calcUnitTable = []struct {
+	dimension string
+	factor    float64
+	offset    float64
+	names     []string
+}{
+	{"length", 1, 0, []string{"m", "meter", "meters", "metre", "metres"}},
+	{"length", 1000, 0, []string{"km", "kilometer", "kilometers", "kilometre", "kilometres"}},
+	{"length", 0.01, 0, []string{"cm", "centimeter", "centimeters", "centimetre", "centimetres"}},
+	{"length", 0.001, 0, []string{"mm", "millimeter", "millimeters", "millimetre", "millimetres"}},
+	{"length", 1e-6, 0, []string{"µm", "um", "micrometer", "micrometers", "micron", "microns"}},
+	{"length", 1e-9, 0, []string{"nm", "nanometer", "nanometers"}},
+	{"length", 1609.344, 0, []string{"mi", "mile", "miles"}},
+	{"length", 0.9144, 0, []string{"yd", "yard", "yards"}},
+	{"length", 0.3048, 0, []string{"ft", "foot", "feet"}},
+	{"length", 0.0254, 0, []string{"in", "inch", "inches"}},
+	{"length", 1852, 0, []string{"nmi", "nautical mile", "nautical miles"}},
+	{"length", 9.4607304725808e15, 0, []string{"ly", "light year", "light years", "lightyear", "lightyears"}},
+	{"length", 1.495978707e11, 0, []string{"au"}},
+
+	{"mass", 1, 0, []string{"kg", "kilogram", "kilograms", "kilo", "kilos"}},
+	{"mass", 1e-3, 0, []string{"g", "gram", "grams"}},
+	{"mass", 1e-6, 0, []string{"mg", "milligram", "milligrams"}},
+	{"mass", 1000, 0, []string{"t", "tonne", "tonnes"}},
+	{"mass", 0.45359237, 0, []string{"lb", "lbs", "pound", "pounds"}},
+	{"mass", 0.028349523125, 0, []string{"oz", "ounce", "ounces"}},
+	{"mass", 6.35029318, 0, []string{"st", "stone", "stones"}},
+
+	{"volume", 1e-3, 0, []string{"l", "L", "liter", "liters", "litre", "litres"}},
+	{"volume", 1e-6, 0, []string{"ml", "mL", "milliliter", "milliliters", "millilitre", "millilitres"}},
+	{"volume", 1e-5, 0, []string{"cl", "centiliter", "centiliters"}},
+	{"volume", 1e-4, 0, []string{"dl", "deciliter", "deciliters"}},
+	{"volume", 1, 0, []string{"m3", "m³", "cubic meter", "cubic meters"}},
+	{"volume", 3.785411784e-3, 0, []string{"gal", "gallon", "gallons"}},
+	{"volume", 9.46352946e-4, 0, []string{"qt", "quart", "quarts"}},
+	{"volume", 4.73176473e-4, 0, []string{"pt", "pint", "pints"}},
+	{"volume", 2.365882365e-4, 0, []string{"cup", "cups"}},
+	{"volume", 2.95735295625e-5, 0, []string{"fl oz", "floz", "fluid ounce", "fluid ounces"}},
+	{"volume", 1.478676478125e-5, 0, []string{"tbsp", "tablespoon", "tablespoons"}},
+	{"volume", 4.92892159375e-6, 0, []string{"tsp", "teaspoon", "teaspoons"}},
+
+	{"area", 1, 0, []string{"m2", "m²", "sq m", "square meter", "square meters"}},
+	{"area", 1e6, 0, []string{"km2", "km²", "sq km", "square kilometer", "square kilometers"}},
+	{"area", 1e-4, 0, []string{"cm2", "cm²", "sq cm"}},
+	{"area", 1e4, 0, []string{"ha", "hectare", "hectares"}},
+	{"area", 4046.8564224, 0, []string{"acre", "acres"}},
+	{"area", 0.09290304, 0, []string{"ft2", "ft²", "sq ft", "sqft", "square foot", "square feet"}},
+	{"area", 2589988.110336, 0, []string{"mi2", "mi²", "sq mi", "square mile", "square miles"}},
+
+	{"time", 1, 0, []string{"s", "sec", "secs", "second", "seconds"}},
+	{"time", 1e-3, 0, []string{"ms", "millisecond", "milliseconds"}},
+	{"time", 1e-6, 0, []string{"µs", "us", "microsecond", "microseconds"}},
+	{"time", 1e-9, 0, []string{"ns", "nanosecond", "nanoseconds"}},
+	{"time", 60, 0, []string{"min", "mins", "minute", "minutes"}},
+	{"time", 3600, 0, []string{"h", "hr", "hrs", "hour", "hours"}},
+	{"time", 86400, 0, []string{"d", "day", "days"}},
+	{"time", 604800, 0, []string{"wk", "week", "weeks"}},
+	// Average Gregorian month and year
+	{"time", 2629746, 0, []string{"month", "months"}},
+	{"time", 31556952, 0, []string{"yr", "yrs", "year", "years"}},
+
+	{"speed", 1, 0, []string{"m/s", "mps"}},
+	{"speed", 1 / 3.6, 0, []string{"km/h", "kmh", "kph"}},
+	{"speed", 0.44704, 0, []string{"mph"}},
+	{"speed", 1852.0 / 3600, 0, []string{"kn", "kt", "knot", "knots"}},
+	{"speed", 0.3048, 0, []string{"ft/s", "fps"}},
+
+	{"temperature", 1, 0, []string{"K", "kelvin"}},
+	{"temperature", 1, 273.15, []string{"C", "°C", "celsius", "degc"}},
+	{"temperature", 5.0 / 9, 459.67 * 5 / 9, []string{"F", "°F", "fahrenheit", "degf"}},
+
+	{dimensionData, 1, 0, []string{"B", "byte", "bytes"}},
+	{dimensionData, 1e3, 0, []string{"KB", "kB", "kilobyte", "kilobytes"}},
+	{dimensionData, 1e6, 0, []string{"MB", "megabyte", "megabytes"}},
+	{dimensionData, 1e9, 0, []string{"GB", "gigabyte", "gigabytes"}},
+	{dimensionData, 1e12, 0, []string{"TB", "terabyte", "terabytes"}},
+	{dimensionData, 1e15, 0, []string{"PB", "petabyte", "petabytes"}},
+	{dimensionData, 1 << 10, 0, []string{"KiB", "kibibyte", "kibibytes"}},
+	{dimensionData, 1 << 20, 0, []string{"MiB", "mebibyte", "mebibytes"}},
+	{dimensionData, 1 << 30, 0, []string{"GiB", "gibibyte", "gibibytes"}},
+	{dimensionData, 1 << 40, 0, []string{"TiB", "tebibyte", "tebibytes"}},
+	{dimensionData, 1 << 50, 0, []string{"PiB", "pebibyte", "pebibytes"}},
+	{dimensionData, 0.125, 0, []string{"bit", "bits"}},
+	{dimensionData, 125, 0, []string{"Kb", "kbit", "kilobit", "kilobits"}},
+	{dimensionData, 125e3, 0, []string{"Mb", "Mbit", "megabit", "megabits"}},
+	{dimensionData, 125e6, 0, []string{"Gb", "Gbit", "gigabit", "gigabits"}},
+	{dimensionData, 125e9, 0, []string{"Tb", "Tbit", "terabit", "terabits"}},
+}
+
+var calcUnits, calcUnitsFolded = buildUnitIndex()
+
+func buildUnitIndex() (map[string]calcUnit, map[string]calcUnit) {
+	exact := make(map[string]calcUnit)
+	folded := make(map[string]calcUnit)
+	for _, entry := range calcUnitTable {
+		unit := calcUnit{dimension: entry.dimension, factor: entry.factor, offset: entry.offset}
+		for _, name := range entry.names {
+			exact[name] = unit
+			if _, taken := folded[strings.ToLower(name)]; !taken {
+				folded[strings.ToLower(name)] = unit
+			}
+		}
+	}
+	return exact, folded
+}
+
+func lookupUnit(name string) (calcUnit, bool) {
+	name = strings.Join(strings.Fields(name), " ")
+	if unit, ok := calcUnits[name]; ok {
+		return unit, true
+	}
+	name = strings.ToLower(strings.TrimPrefix(name, "degrees "))
+	unit, ok := calcUnitsFolded[name]
+	return unit, ok
+}
+
+// quantityPattern splits "512 MiB" or "5km" into an expression ending in a
+// digit or parenthesis and a unit that does not start with one
+var quantityPattern = regexp.MustCompile(`^(.*[\d.)])\s*([^\d\s.()+\-*/^].*)$`)
+
+// conversionSeparator joins the two sides of a conversion. It is matched
+// as a whole word without the surrounding spaces, so that the matches of
+// "5 in in cm" do not overlap.
+var conversionSeparator = regexp.MustCompile(`(?i)\b(?:to|in|into|as)\b`)
+
+// splitConversions returns every way query splits into "<left> to <right>"
+func splitConversions(query string) [][2]string {
+	var splits [][2]string
+	for _, loc := range conversionSeparator.FindAllStringIndex(query, -1) {
+		left, right := strings.TrimSpace(query[:loc[0]]), strings.TrimSpace(query[loc[1]:])
+		if left != "" && right != "" {
+			splits = append(splits, [2]string{left, right})
+		}
+	}
+	return splits
+}
+
+// convertUnits answers "<quantity> <unit> to <unit>", e.g. "512 MiB in GB".
+// Every to/in/as is tried as the separator, so "5 in in cm" works.
+func convertUnits(query string) (CalculatorResult, error) {
+	for _, split := range splitConversions(query) {
+		left, right := split[0], split[1]
+		target, ok := lookupUnit(right)
+		if !ok {
+			continue
+		}
+		match := quantityPattern.FindStringSubmatch(left)
+		if match == nil {
+			continue
+		}
+		source, ok := lookupUnit(match[2])
+		if !ok {
+			continue
+		}
+		if source.dimension != target.dimension {
+			return CalculatorResult{}, fmt.Errorf("cannot convert %s to %s", source.dimension, target.dimension)
+		}
+		value, _, _, err := evalExpression(match[1])
+		if err != nil {
+			return CalculatorResult{}, err
+		}
+
+		converted := (value*source.factor + source.offset - target.offset) / target.factor
+		kind := CalcUnit
+		if source.dimension == dimensionData {
+			kind = CalcSize
+		}
+		return CalculatorResult{
+			Kind:       kind,
+			Expression: fmt.Sprintf("%s %s", formatNumber(value), strings.TrimSpace(match[2])),
+			Result:     fmt.Sprintf("%s %s", formatNumber(converted), right),
+			Value:      &converted,
+		}, nil
+	}
+	return CalculatorResult{}, fmt.Errorf("not a unit conversion")
+}
+
+// baseNames maps the target of a base conversion to its radix
+var baseNames = map[string]int{
+	"hex": 16, "hexadecimal": 16,
+	"dec": 10, "decimal": 10,
+	"oct": 8, "octal": 8,
+	"bin": 2, "binary": 2,
+}
+
+// convertBase answers "0x1F to decimal" or "255 in binary". A lone 0x, 0o
+// or 0b literal is shown in every base.
+func convertBase(query string) (CalculatorResult, error) {
+	expr, base := query, 0
+	if splits := splitConversions(query); len(splits) > 0 {
+		last := splits[len(splits)-1]
+		if radix, ok := baseNames[strings.ToLower(last[1])]; ok {
+			expr, base = last[0], radix
+		}
+	}
+
+	value, _, literalBase, err := evalExpression(expr)
+	if err != nil {
+		return CalculatorResult{}, err
+	}
+	if base == 0 {
+		if literalBase == 0 {
+			return CalculatorResult{}, fmt.Errorf("not a base conversion")
+		}
+		base = 10
+	}
+	if value != math.Trunc(value) || math.Abs(value) >= 1<<63 {
+		return CalculatorResult{}, fmt.Errorf("only whole numbers can be shown in another base")
+	}
+
+	n := int64(value)
+	var alternatives []string
+	for _, radix := range []int{10, 16, 8, 2} {
+		if radix != base {
+			alternatives = append(alternatives, formatInBase(n, radix))
+		}
+	}
+	return CalculatorResult{
+		Kind:         CalcBase,
+		Expression:   expr,
+		Result:       formatInBase(n, base),
+		Value:        &value,
+		Alternatives: alternatives,
+	}, nil
+}
+
+func formatInBase(n int64, base int) string {
+	sign := ""
+	if n < 0 {
+		sign, n = "-", -n
+	}
+	digits := strings.ToUpper(strconv.FormatInt(n, base))
+	switch base {
+	case 16:
+		return sign + "0x" + digits
+	case 8:
+		return sign + "0o" + digits
+	case 2:
+		return sign + "0b" + digits
+	}
+	return sign + digits
+}
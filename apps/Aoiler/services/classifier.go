@@ -0,0 +1,462 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Parameter keys shared by the classifier and the services
+const (
+	ParamQuery  = "query"
+	ParamPath   = "path"
+	ParamPaths  = "paths" // several paths, one per line
+	ParamFormat = "format"
+	ParamMode   = "mode"
+	ParamTerms  = "terms"
+)
+
+// confidentIntent is the keyword confidence at or above which the LLM
+// classifier is skipped
+const confidentIntent = 0.75
+
+// classifierTimeout bounds the LLM classification round trip
+const classifierTimeout = 15 * time.Second
+
+const (
+	// slotBonus is added for each extracted parameter the service declares
+	slotBonus = 0.05
+	// ambiguityMargin is how close the best two candidates may score before
+	// the user is asked to choose
+	ambiguityMargin = 0.04
+)
+
+// DisambiguateService names the result of a query that matched several
+// services equally well
+const DisambiguateService = "disambiguate"
+
+// IntentOption is one of the services offered for an ambiguous query
+type IntentOption struct {
+	Service     string  `json:"service"`
+	Description string  `json:"description"`
+	Confidence  float64 `json:"confidence"`
+	// Query is the query with the prefix that forces this service
+	Query string `json:"query"`
+}
+
+// DisambiguationResult asks the user which service a query is meant for
+type DisambiguationResult struct {
+	Query   string         `json:"query"`
+	Options []IntentOption `json:"options"`
+	Success bool           `json:"success"`
+}
+
+// slotExtractors pull generic parameters out of the raw query for the
+// keyword fast path
+var slotExtractors = map[string]func(string) string{
+	ParamPath:   extractPath,
+	ParamFormat: extractFormat,
+}
+
+// ClassifyIntent is the keyword fast path: the best of RankIntents. It never
+// blocks on the network, so it is also used for live suggestions while typing.
+func (sm *ServiceManager) ClassifyIntent(query string) Intent {
+	return sm.RankIntents(query)[0]
+}
+
+// RankIntents scores the services that could handle the query, best first.
+// A service prefix ("/convert ...", "@llm ...") forces that service, and
+// services that match the query by its shape (QueryMatcher) are certain;
+// otherwise every service with a matching keyword is scored on its own.
+// Ties keep registration order. The fallback always comes last.
+func (sm *ServiceManager) RankIntents(query string) []Intent {
+	if intent, ok := sm.forcedIntent(query); ok {
+		return []Intent{intent}
+	}
+
+	fallback := Intent{
+		ServiceName: sm.registry.Fallback(),
+		Query:       query,
+		Confidence:  0.5,
+		Params:      map[string]string{ParamQuery: query},
+	}
+
+	for _, service := range sm.registry.Services() {
+		if matcher, ok := service.(QueryMatcher); ok && matcher.MatchesQuery(query) {
+			certain := Intent{
+				ServiceName: service.Name(),
+				Query:       query,
+				Confidence:  1,
+				Params:      map[string]string{ParamQuery: query},
+			}
+			return []Intent{certain, fallback}
+		}
+	}
+
+	lowerQuery := strings.ToLower(query)
+	slots := extractSlots(query)
+	var candidates []Intent
+	for _, service := range sm.registry.Services() {
+		if service.Name() == fallback.ServiceName {
+			continue
+		}
+		confidence, ok := sm.keywordConfidence(service, lowerQuery, slots)
+		if !ok {
+			continue
+		}
+		candidates = append(candidates, Intent{
+			ServiceName: service.Name(),
+			Query:       query,
+			Confidence:  confidence,
+			Params:      serviceParams(service, query, slots),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].Confidence > candidates[j].Confidence
+	})
+	return append(candidates, fallback)
+}
+
+// keywordConfidence scores how well a service's keywords and the rest of the
+// query agree, or reports false when no keyword matches
+func (sm *ServiceManager) keywordConfidence(service Service, lowerQuery string, slots map[string]string) (float64, bool) {
+	confidence, matched := 0.0, false
+	for _, keyword := range service.Keywords() {
+		if !strings.Contains(lowerQuery, keyword) {
+			continue
+		}
+		matched = true
+		if containsWord(lowerQuery, keyword) {
+			confidence = max(confidence, 0.9)
+		} else {
+			// e.g. "sort" inside "resort"
+			confidence = max(confidence, 0.4)
+		}
+	}
+	if !matched {
+		return 0, false
+	}
+
+	if path := slots[ParamPath]; path != "" && !strings.HasSuffix(path, "/") {
+		if filter, ok := service.(PathFilter); ok && filepath.Ext(path) != "" && !filter.AcceptsPath(path) {
+			confidence = min(confidence, 0.5)
+		}
+	}
+	for slot := range slots {
+		if slot == ParamPath {
+			continue
+		}
+		if takesParam(service, slot) {
+			// e.g. a target format in a query that matched the converter
+			confidence = min(confidence+slotBonus, 0.99)
+		} else if sm.anyServiceTakes(slot) {
+			// e.g. a target format in a query that matched the linter
+			confidence = min(confidence, 0.5)
+		}
+	}
+	return confidence, true
+}
+
+// serviceParams keeps the extracted slots the service declares
+func serviceParams(service Service, query string, slots map[string]string) map[string]string {
+	params := map[string]string{ParamQuery: query}
+	for slot, value := range slots {
+		if takesParam(service, slot) {
+			params[slot] = value
+		}
+	}
+	return params
+}
+
+// servicePrefix matches a leading "/name" or "@name" that picks the service
+var servicePrefix = regexp.MustCompile(`^[/@]([A-Za-z][A-Za-z-]*)(?:\s+|$)`)
+
+// forcedIntent handles "/convert video.mp4 to webm" and "@llm ...": the
+// service gets the rest of the query with certainty. A prefix that names no
+// service is left alone, since "/etc/hosts" is a path.
+func (sm *ServiceManager) forcedIntent(query string) (Intent, bool) {
+	query = strings.TrimSpace(query)
+	m := servicePrefix.FindStringSubmatch(query)
+	if m == nil {
+		return Intent{}, false
+	}
+	service, ok := sm.serviceByPrefix(strings.ToLower(m[1]))
+	if !ok {
+		return Intent{}, false
+	}
+	rest := strings.TrimSpace(query[len(m[0]):])
+	return Intent{
+		ServiceName: service.Name(),
+		Query:       rest,
+		Confidence:  1,
+		Params:      serviceParams(service, rest, extractSlots(rest)),
+	}, true
+}
+
+// serviceByPrefix finds the service a prefix names: by its name, by the
+// start of exactly one name ("/calc", "/convert"), or by a keyword ("/find")
+func (sm *ServiceManager) serviceByPrefix(word string) (Service, bool) {
+	if service, ok := sm.registry.Get(word); ok {
+		return service, true
+	}
+
+	var byName []Service
+	for _, service := range sm.registry.Services() {
+		if len(word) >= 2 && strings.HasPrefix(service.Name(), word) {
+			byName = append(byName, service)
+		}
+	}
+	if len(byName) == 1 {
+		return byName[0], true
+	}
+
+	for _, service := range sm.registry.Services() {
+		for _, keyword := range service.Keywords() {
+			if keyword == word {
+				return service, true
+			}
+		}
+	}
+	return nil, false
+}
+
+// Disambiguate reports the services to offer when the best two candidates
+// for the query, as ranked by RankIntents, score too close to pick one. The
+// fallback is always offered last, so the question can also go to the LLM
+// as it is.
+func (sm *ServiceManager) Disambiguate(query string, candidates []Intent) (DisambiguationResult, bool) {
+	if len(candidates) < 3 || candidates[0].Confidence >= 1 ||
+		candidates[0].Confidence-candidates[1].Confidence > ambiguityMargin {
+		return DisambiguationResult{}, false
+	}
+
+	top := candidates[0].Confidence
+	result := DisambiguationResult{Query: query, Success: true}
+	for i, candidate := range candidates {
+		isFallback := i == len(candidates)-1
+		if !isFallback && top-candidate.Confidence > ambiguityMargin {
+			continue
+		}
+		option := IntentOption{
+			Service:    candidate.ServiceName,
+			Confidence: candidate.Confidence,
+			Query:      "/" + candidate.ServiceName + " " + query,
+		}
+		if service, ok := sm.registry.Get(candidate.ServiceName); ok {
+			option.Description = service.Description()
+		}
+		result.Options = append(result.Options, option)
+	}
+	return result, true
+}
+
+// ResolveIntent takes the best of the candidates RankIntents found for the
+// query and asks the LLM when it is uncertain. Queries that match no keyword
+// and mention no path go straight to the fallback, so plain chat does not
+// pay for an extra round trip.
+func (sm *ServiceManager) ResolveIntent(ctx context.Context, query string, candidates []Intent) Intent {
+	intent := candidates[0]
+	if intent.Confidence >= confidentIntent || !sm.llm.Available() {
+		return intent
+	}
+	if intent.ServiceName == sm.registry.Fallback() && extractPath(query) == "" {
+		return intent
+	}
+
+	llmIntent, err := sm.classifyWithLLM(ctx, query)
+	if err != nil {
+		return intent
+	}
+	return llmIntent
+}
+
+// LLMIntent is the JSON the LLM classifier answers with
+type LLMIntent struct {
+	Service    string                 `json:"service"`
+	Confidence float64                `json:"confidence"`
+	Params     map[string]interface{} `json:"params"`
+}
+
+// classifyWithLLM asks the configured LLM to pick a service and fill its parameters
+func (sm *ServiceManager) classifyWithLLM(ctx context.Context, query string) (Intent, error) {
+	// Detach from the request's event sink so the JSON is not streamed to the UI
+	ctx = WithRequest(ctx, RequestID(ctx), nil)
+	ctx, cancel := context.WithTimeout(ctx, classifierTimeout)
+	defer cancel()
+
+	result, err := sm.llm.Query(ctx, sm.classifierPrompt(query))
+	if err != nil {
+		return Intent{}, err
+	}
+	if !result.Success {
+		return Intent{}, fmt.Errorf("classifier failed: %s", result.Response)
+	}
+
+	var parsed LLMIntent
+	if err := json.Unmarshal([]byte(extractJSONObject(result.Response)), &parsed); err != nil {
+		return Intent{}, fmt.Errorf("failed to parse classifier response: %w", err)
+	}
+
+	service, ok := sm.registry.Get(parsed.Service)
+	if !ok {
+		return Intent{}, fmt.Errorf("classifier picked unknown service: %s", parsed.Service)
+	}
+
+	params := map[string]string{ParamQuery: query}
+	for key, value := range parsed.Params {
+		switch v := value.(type) {
+		case string:
+			if v != "" {
+				params[key] = v
+			}
+		case []interface{}:
+			var items []string
+			for _, item := range v {
+				if s, ok := item.(string); ok && s != "" {
+					items = append(items, s)
+				}
+			}
+			if len(items) > 0 {
+				params[key] = strings.Join(items, "\n")
+			}
+		case float64, bool:
+			params[key] = fmt.Sprint(v)
+		}
+	}
+	// A single-entry list is just a path
+	if params[ParamPath] == "" && params[ParamPaths] != "" {
+		params[ParamPath] = strings.SplitN(params[ParamPaths], "\n", 2)[0]
+	}
+
+	confidence := parsed.Confidence
+	if confidence <= 0 || confidence > 1 {
+		confidence = confidentIntent
+	}
+
+	return Intent{
+		ServiceName: service.Name(),
+		Query:       query,
+		Confidence:  confidence,
+		Params:      params,
+	}, nil
+}
+
+// classifierPrompt describes every registered service and its parameters
+func (sm *ServiceManager) classifierPrompt(query string) string {
+	var b strings.Builder
+	b.WriteString("You route requests for Aoiler, a Linux desktop assistant. ")
+	b.WriteString("Pick the service that should handle the request and extract its parameters.\n\nServices:\n")
+
+	for _, service := range sm.registry.Services() {
+		fmt.Fprintf(&b, "- %s: %s", service.Name(), service.Description())
+		if service.Name() == sm.registry.Fallback() {
+			b.WriteString(" (general questions and anything else)")
+		}
+		if describer, ok := service.(ParamDescriber); ok {
+			params := describer.Params()
+			names := make([]string, 0, len(params))
+			for name := range params {
+				names = append(names, name)
+			}
+			sort.Strings(names)
+
+			var parts []string
+			for _, name := range names {
+				parts = append(parts, fmt.Sprintf("%s (%s)", name, params[name]))
+			}
+			fmt.Fprintf(&b, ". Params: %s", strings.Join(parts, ", "))
+		}
+		b.WriteString("\n")
+	}
+
+	b.WriteString("\nReply with JSON only, no prose: ")
+	b.WriteString(`{"service": "<name>", "confidence": <0 to 1>, "params": {"<param>": "<value>"}}. `)
+	b.WriteString(`Use a list for "paths" when several files are named. Omit parameters the request does not mention.`)
+	fmt.Fprintf(&b, "\n\nRequest: %s", query)
+	return b.String()
+}
+
+// anyServiceTakes reports whether some registered service declares the parameter
+func (sm *ServiceManager) anyServiceTakes(param string) bool {
+	for _, service := range sm.registry.Services() {
+		if takesParam(service, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// takesParam reports whether the service declares the parameter
+func takesParam(service Service, param string) bool {
+	describer, ok := service.(ParamDescriber)
+	if !ok {
+		return false
+	}
+	_, ok = describer.Params()[param]
+	return ok
+}
+
+// extractSlots runs the generic extractors over the query
+func extractSlots(query string) map[string]string {
+	slots := make(map[string]string)
+	for name, extract := range slotExtractors {
+		if value := extract(query); value != "" {
+			slots[name] = value
+		}
+	}
+	return slots
+}
+
+// containsWord reports whether keyword occurs in text starting at a word
+// boundary, so "sort" matches "sort" and "sorting" but not "resort"
+func containsWord(text, keyword string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], keyword)
+		if idx < 0 {
+			return false
+		}
+		idx += offset
+		if idx == 0 || !isWordChar(text[idx-1]) {
+			return true
+		}
+		offset = idx + 1
+	}
+}
+
+// containsWholeWord reports whether keyword occurs in text as whole words,
+// so "restore" does not match "restored"
+func containsWholeWord(text, keyword string) bool {
+	for offset := 0; ; {
+		idx := strings.Index(text[offset:], keyword)
+		if idx < 0 {
+			return false
+		}
+		idx += offset
+		end := idx + len(keyword)
+		if (idx == 0 || !isWordChar(text[idx-1])) && (end == len(text) || !isWordChar(text[end])) {
+			return true
+		}
+		offset = idx + 1
+	}
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// extractJSONObject returns the outermost {...} in text, which drops the
+// code fences and prose models like to wrap JSON in
+func extractJSONObject(text string) string {
+	start := strings.Index(text, "{")
+	end := strings.LastIndex(text, "}")
+	if start < 0 || end < start {
+		return text
+	}
+	return text[start : end+1]
+}
@@ -0,0 +1,170 @@
+package services
+
+import (
+	"context"
+	"math"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// stubService is a service with fixed keywords and parameters
+type stubService struct {
+	name     string
+	keywords []string
+	params   map[string]string
+}
+
+func (s *stubService) Name() string                                        { return s.name }
+func (s *stubService) Description() string                                 { return s.name + " things" }
+func (s *stubService) Keywords() []string                                  { return s.keywords }
+func (s *stubService) Params() map[string]string                           { return s.params }
+func (s *stubService) Handle(context.Context, Intent) (interface{}, error) { return nil, nil }
+
+// stubMediaService only accepts video files
+type stubMediaService struct{ stubService }
+
+func (s *stubMediaService) AcceptsPath(path string) bool { return filepath.Ext(path) == ".mp4" }
+
+// stubCalculator recognizes "2+2"
+type stubCalculator struct{ stubService }
+
+func (s *stubCalculator) MatchesQuery(query string) bool { return query == "2+2" }
+
+// newStubManager registers the stub services in a fresh registry with llm
+// as the fallback
+func newStubManager(t *testing.T) *ServiceManager {
+	t.Helper()
+	sm := &ServiceManager{registry: NewRegistry()}
+	for _, service := range []Service{
+		&stubService{name: "organizer", keywords: []string{"sort", "organize"}},
+		&stubService{name: "linter", keywords: []string{"lint", "format"}},
+		&stubMediaService{stubService{name: "converter", keywords: []string{"convert"}, params: map[string]string{ParamFormat: "target"}}},
+		&stubCalculator{stubService{name: "calculator"}},
+		&stubService{name: "llm", keywords: []string{"ask"}},
+	} {
+		if err := sm.registry.Register(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := sm.registry.SetFallback("llm"); err != nil {
+		t.Fatal(err)
+	}
+	return sm
+}
+
+// ranking is the service and confidence of each intent
+type ranking struct {
+	service    string
+	confidence float64
+}
+
+// rankingOf rounds the confidences, which bonuses leave slightly off
+func rankingOf(intents []Intent) []ranking {
+	var r []ranking
+	for _, intent := range intents {
+		r = append(r, ranking{intent.ServiceName, math.Round(intent.Confidence*100) / 100})
+	}
+	return r
+}
+
+func TestRankIntents(t *testing.T) {
+	sm := newStubManager(t)
+	tests := []struct {
+		query string
+		want  []ranking
+	}{
+		{"sort my downloads", []ranking{{"organizer", 0.9}, {"llm", 0.5}}},
+		{"what is a resort", []ranking{{"organizer", 0.4}, {"llm", 0.5}}},
+		{"tell me a joke", []ranking{{"llm", 0.5}}},
+		// Both keywords match as words; ties keep registration order
+		{"sort and lint", []ranking{{"organizer", 0.9}, {"linter", 0.9}, {"llm", 0.5}}},
+		// A target format backs the converter and doubts the linter
+		{"convert and format notes to mp4", []ranking{{"converter", 0.95}, {"linter", 0.5}, {"llm", 0.5}}},
+		// A file the service cannot handle caps its confidence
+		{"convert photo.png", []ranking{{"converter", 0.5}, {"llm", 0.5}}},
+		{"convert clip.mp4", []ranking{{"converter", 0.9}, {"llm", 0.5}}},
+		{"2+2", []ranking{{"calculator", 1}, {"llm", 0.5}}},
+	}
+	for _, tt := range tests {
+		got := rankingOf(sm.RankIntents(tt.query))
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("RankIntents(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestRankIntentsPrefix(t *testing.T) {
+	sm := newStubManager(t)
+	tests := []struct {
+		query   string
+		service string
+		rest    string
+	}{
+		{"/converter clip.mov to mp4", "converter", "clip.mov to mp4"},
+		{"/conv clip.mov to mp4", "converter", "clip.mov to mp4"},
+		{"@llm sort my downloads", "llm", "sort my downloads"},
+		{"/lint", "linter", ""},
+		{"/Calc 2+3", "calculator", "2+3"},
+	}
+	for _, tt := range tests {
+		intents := sm.RankIntents(tt.query)
+		if len(intents) != 1 || intents[0].ServiceName != tt.service || intents[0].Query != tt.rest || intents[0].Confidence != 1 {
+			t.Errorf("RankIntents(%q) = %+v, want only %s with %q", tt.query, intents, tt.service, tt.rest)
+		}
+	}
+	if got := sm.RankIntents("/conv clip.mov to mp4")[0].Params[ParamFormat]; got != "mp4" {
+		t.Errorf("forced converter format = %q, want mp4", got)
+	}
+
+	// A path or an unknown or ambiguous prefix forces nothing
+	for _, query := range []string{"/etc/hosts", "/nothing here", "/c clip.mov"} {
+		if intents := sm.RankIntents(query); len(intents) == 1 && intents[0].Confidence == 1 {
+			t.Errorf("RankIntents(%q) forced %s", query, intents[0].ServiceName)
+		}
+	}
+}
+
+func TestDisambiguate(t *testing.T) {
+	sm := newStubManager(t)
+
+	got, ok := sm.Disambiguate("sort and lint", sm.RankIntents("sort and lint"))
+	if !ok {
+		t.Fatal(`Disambiguate("sort and lint") found no ambiguity`)
+	}
+	want := []IntentOption{
+		{Service: "organizer", Description: "organizer things", Confidence: 0.9, Query: "/organizer sort and lint"},
+		{Service: "linter", Description: "linter things", Confidence: 0.9, Query: "/linter sort and lint"},
+		{Service: "llm", Description: "llm things", Confidence: 0.5, Query: "/llm sort and lint"},
+	}
+	if !reflect.DeepEqual(got.Options, want) || got.Query != "sort and lint" || !got.Success {
+		t.Errorf("Disambiguate = %+v, want options %+v", got, want)
+	}
+
+	// Clear winners, certain matches and forced services are not questioned
+	for _, query := range []string{"sort my downloads", "convert and format notes to mp4", "2+2", "/lint sort and lint", "tell me a joke"} {
+		if got, ok := sm.Disambiguate(query, sm.RankIntents(query)); ok {
+			t.Errorf("Disambiguate(%q) = %+v, want no question", query, got)
+		}
+	}
+}
+
+func TestRankIntentsBuiltin(t *testing.T) {
+	sm := newTestManager(t)
+	tests := []struct {
+		query   string
+		service string
+	}{
+		{"15% of 240", "calculator"},
+		{"volume 40", "media"},
+		{"/calc 2+2", "calculator"},
+		{"/find invoice", "filesearch"},
+		{"@llm volume 40", "llm"},
+		{"tell me a joke", "llm"},
+	}
+	for _, tt := range tests {
+		if got := sm.ClassifyIntent(tt.query).ServiceName; got != tt.service {
+			t.Errorf("ClassifyIntent(%q) = %s, want %s", tt.query, got, tt.service)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/fsnotify/fsnotify"
+)
+
+// Config is the content of ~/.config/hecate/aoiler.toml
+type Config struct {
+	LLM      LLMConfig      `toml:"llm" json:"llm"`
+	Services ServicesConfig `toml:"services" json:"services"`
+}
+
+// LLMConfig controls provider selection and generation settings
+type LLMConfig struct {
+	// Priority lists providers in the order they are tried when picking the
+	// active one; providers that are not configured are skipped
+	Priority     []string                  `toml:"priority" json:"priority"`
+	MaxTokens    int                       `toml:"max_tokens" json:"maxTokens"`
+	Temperature  *float64                  `toml:"temperature,omitempty" json:"temperature,omitempty"`
+	SystemPrompt string                    `toml:"system_prompt" json:"systemPrompt"`
+	Timeout      int                       `toml:"timeout_seconds" json:"timeoutSeconds"`
+	Providers    map[string]ProviderConfig `toml:"providers" json:"providers"`
+	// Tools lets providers that support tool calling use Aoiler's services
+	Tools bool `toml:"tools" json:"tools"`
+}
+
+// ProviderConfig holds the per-provider settings. Environment variables
+// take precedence over the values in the file.
+type ProviderConfig struct {
+	APIKey  string `toml:"api_key,omitempty" json:"apiKey,omitempty"`
+	Model   string `toml:"model,omitempty" json:"model,omitempty"`
+	BaseURL string `toml:"base_url,omitempty" json:"baseUrl,omitempty"`
+}
+
+// ServicesConfig holds the options of the built-in services
+type ServicesConfig struct {
+	FileSearch FileSearchConfig `toml:"filesearch" json:"filesearch"`
+	Organizer  OrganizerConfig  `toml:"organizer" json:"organizer"`
+	OCR        OCRConfig        `toml:"ocr" json:"ocr"`
+	Converter  ConverterConfig  `toml:"converter" json:"converter"`
+	Linter     LinterConfig     `toml:"linter" json:"linter"`
+	Launcher   LauncherConfig   `toml:"launcher" json:"launcher"`
+}
+
+type FileSearchConfig struct {
+	Roots []string `toml:"roots" json:"roots"`
+	// Excludes are skipped while indexing: names such as "node_modules", or
+	// full paths when the pattern contains a slash
+	Excludes []string `toml:"excludes" json:"excludes"`
+	// MaxResults caps the number of ranked results returned
+	MaxResults int `toml:"max_results" json:"maxResults"`
+}
+
+type OrganizerConfig struct {
+	DefaultMode string `toml:"default_mode" json:"defaultMode"`
+	// Rules are tried before the mode
+	Rules []OrganizeRule `toml:"rules" json:"rules"`
+}
+
+type OCRConfig struct {
+	// Language is a tesseract language code, or several joined with "+"
+	Language string `toml:"language" json:"language"`
+	// PSM is the tesseract page segmentation mode; 0 leaves it to tesseract
+	PSM int `toml:"psm" json:"psm"`
+	// Preprocess cleans up images before they are read
+	Preprocess bool `toml:"preprocess" json:"preprocess"`
+	// Clipboard copies the text with wl-copy
+	Clipboard bool `toml:"clipboard" json:"clipboard"`
+	// History keeps every capture so it can be searched later
+	History bool `toml:"history" json:"history"`
+}
+
+type ConverterConfig struct {
+	// OutputTemplate names converted files; {dir}, {name}, {ext} and
+	// {preset} are replaced with the input's directory and name, the
+	// target extension and the preset
+	OutputTemplate string `toml:"output_template" json:"outputTemplate"`
+}
+
+type LinterConfig struct {
+	// Tools are added to the built-in formatters and linters, or replace
+	// the one with the same name
+	Tools []LinterTool `toml:"tools" json:"tools"`
+
+	// fileTools come from linters.toml next to aoiler.toml
+	fileTools []LinterTool
+}
+
+type LauncherConfig struct {
+	// Terminal runs applications that ask for one; empty uses the term
+	// preference from hecate.toml, then $TERMINAL
+	Terminal string `toml:"terminal" json:"terminal"`
+	// MaxResults caps the number of matching applications listed
+	MaxResults int `toml:"max_results" json:"maxResults"`
+}
+
+// Configurable is implemented by services that read options from the config.
+// ApplyConfig is called at startup and again whenever the file changes.
+type Configurable interface {
+	ApplyConfig(cfg Config)
+}
+
+// DefaultConfig returns the settings used when aoiler.toml does not exist
+func DefaultConfig() Config {
+	return Config{
+		LLM: LLMConfig{
+			Priority:  []string{"openai", "claude", "gemini", "local", "ollama"},
+			MaxTokens: 4096,
+			Timeout:   60,
+			Tools:     true,
+			Providers: map[string]ProviderConfig{
+				"openai": {Model: defaultModels[ProviderOpenAI]},
+				"claude": {Model: defaultModels[ProviderClaude]},
+				"gemini": {Model: defaultModels[ProviderGemini]},
+			},
+		},
+		Services: ServicesConfig{
+			FileSearch: FileSearchConfig{
+				Roots: []string{"~"},
+				Excludes: []string{
+					".git", "node_modules", "__pycache__", ".venv", ".cache",
+					"~/.local/share/Trash", "~/.cargo/registry", "~/.rustup", "~/go/pkg",
+				},
+				MaxResults: 10,
+			},
+			Organizer: OrganizerConfig{DefaultMode: "category"},
+			OCR:       OCRConfig{Language: "eng", PSM: 3, Preprocess: true, History: true},
+			Converter: ConverterConfig{OutputTemplate: "{dir}/{name}.{ext}"},
+			Launcher:  LauncherConfig{MaxResults: 8},
+		},
+	}
+}
+
+// ConfigStore loads aoiler.toml and notifies listeners when it changes
+type ConfigStore struct {
+	mu        sync.RWMutex
+	path      string
+	config    Config
+	listeners []func(Config)
+	watcher   *fsnotify.Watcher
+}
+
+// lintersFile holds extra formatter and linter definitions next to aoiler.toml
+const lintersFile = "linters.toml"
+
+// NewConfigStore creates a store for ~/.config/hecate/aoiler.toml
+func NewConfigStore() *ConfigStore {
+	homeDir, _ := os.UserHomeDir()
+	return &ConfigStore{
+		path:   filepath.Join(homeDir, ".config", "hecate", "aoiler.toml"),
+		config: DefaultConfig(),
+	}
+}
+
+// Path returns the location of the config file
+func (c *ConfigStore) Path() string {
+	return c.path
+}
+
+// Get returns the current config as read from the file
+func (c *ConfigStore) Get() Config {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.config
+}
+
+// OnChange registers fn to be called with the new config after every reload or save
+func (c *ConfigStore) OnChange(fn func(Config)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.listeners = append(c.listeners, fn)
+}
+
+// Load reads and validates the config file. A missing file is not an
+// error: the defaults are used instead. Values absent from the file keep
+// their defaults. When the file is invalid the current config is kept.
+func (c *ConfigStore) Load() error {
+	cfg := DefaultConfig()
+
+	data, err := os.ReadFile(c.path)
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	if err == nil {
+		if _, err := toml.Decode(string(data), &cfg); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", c.path, err)
+		}
+	}
+	if err := c.loadLinters(&cfg); err != nil {
+		return err
+	}
+	if err := cfg.Validate(); err != nil {
+		return fmt.Errorf("invalid %s: %w", c.path, err)
+	}
+
+	c.set(cfg)
+	return nil
+}
+
+// loadLinters reads the tools defined in linters.toml, if it exists
+func (c *ConfigStore) loadLinters(cfg *Config) error {
+	path := filepath.Join(filepath.Dir(c.path), lintersFile)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+
+	var file struct {
+		Tools []LinterTool `toml:"tools"`
+	}
+	if _, err := toml.Decode(string(data), &file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := validateLinterTools(file.Tools); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	cfg.Services.Linter.fileTools = file.Tools
+	return nil
+}
+
+// Save validates cfg, writes it to the config file and applies it
+func (c *ConfigStore) Save(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("# Aoiler configuration\n# Environment variables such as OPENAI_API_KEY override the keys below.\n\n")
+	encoder := toml.NewEncoder(&buf)
+	encoder.Indent = ""
+	if err := encoder.Encode(cfg); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+
+	if err := writeFileAtomic(c.path, buf.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write config: %w", err)
+	}
+
+	// linters.toml is not part of what the caller saved
+	cfg.Services.Linter.fileTools = c.Get().Services.Linter.fileTools
+	c.set(cfg)
+	return nil
+}
+
+// Watch reloads the config whenever the file is written. Editors often
+// replace the file instead of writing it in place, so the directory is
+// watched rather than the file itself.
+func (c *ConfigStore) Watch() error {
+	dir := filepath.Dir(c.path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create config watcher: %w", err)
+	}
+	if err := watcher.Add(dir); err != nil {
+		watcher.Close()
+		return fmt.Errorf("failed to watch %s: %w", dir, err)
+	}
+
+	c.mu.Lock()
+	c.watcher = watcher
+	c.mu.Unlock()
+
+	go func() {
+		// Editors emit several events per save; wait for them to settle
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if name := filepath.Clean(event.Name); name == c.path || filepath.Base(name) == lintersFile {
+					reload = time.After(200 * time.Millisecond)
+				}
+			case <-reload:
+				reload = nil
+				if err := c.Load(); err != nil {
+					fmt.Fprintf(os.Stderr, "aoiler: %v, keeping the previous config\n", err)
+				}
+			case _, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// Close stops watching the config file
+func (c *ConfigStore) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.watcher == nil {
+		return nil
+	}
+	err := c.watcher.Close()
+	c.watcher = nil
+	return err
+}
+
+func (c *ConfigStore) set(cfg Config) {
+	c.mu.Lock()
+	c.config = cfg
+	listeners := append([]func(Config){}, c.listeners...)
+	c.mu.Unlock()
+
+	for _, fn := range listeners {
+		fn(cfg)
+	}
+}
+
+// Validate checks the config for values the services cannot work with
+func (cfg Config) Validate() error {
+	for _, name := range cfg.LLM.Priority {
+		switch LLMProvider(name) {
+		case ProviderOpenAI, ProviderClaude, ProviderGemini, ProviderLocal, ProviderOllama:
+		default:
+			return fmt.Errorf("unknown provider in priority: %s", name)
+		}
+	}
+	for name := range cfg.LLM.Providers {
+		switch LLMProvider(name) {
+		case ProviderOpenAI, ProviderClaude, ProviderGemini, ProviderLocal, ProviderOllama:
+		default:
+			return fmt.Errorf("unknown provider section: %s", name)
+		}
+	}
+	if cfg.LLM.MaxTokens < 0 {
+		return fmt.Errorf("max_tokens cannot be negative")
+	}
+	if cfg.LLM.Temperature != nil && (*cfg.LLM.Temperature < 0 || *cfg.LLM.Temperature > 2) {
+		return fmt.Errorf("temperature must be between 0 and 2")
+	}
+	if cfg.LLM.Timeout < 0 {
+		return fmt.Errorf("timeout_seconds cannot be negative")
+	}
+	if cfg.Services.FileSearch.MaxResults < 0 {
+		return fmt.Errorf("filesearch max_results cannot be negative")
+	}
+	for _, pattern := range cfg.Services.FileSearch.Excludes {
+		if _, err := filepath.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid filesearch exclude %q: %w", pattern, err)
+		}
+	}
+	if err := validateLinterTools(cfg.Services.Linter.Tools); err != nil {
+		return err
+	}
+	switch cfg.Services.Organizer.DefaultMode {
+	case "", OrganizeByCategory, OrganizeByDate, OrganizeBySize, OrganizeByFilename:
+	default:
+		return fmt.Errorf("organizer default_mode must be category, date, size or filename")
+	}
+	if _, err := compileOrganizeRules(cfg.Services.Organizer.Rules); err != nil {
+		return err
+	}
+	if cfg.Services.OCR.PSM < 0 || cfg.Services.OCR.PSM > 13 {
+		return fmt.Errorf("ocr psm must be between 0 and 13")
+	}
+	return nil
+}
+
+// validateLinterTools checks that every tool can be matched and run
+func validateLinterTools(tools []LinterTool) error {
+	for _, tool := range tools {
+		if tool.Name == "" {
+			return fmt.Errorf("linter tool without a name")
+		}
+		if tool.Disabled {
+			continue
+		}
+		if len(tool.Patterns) == 0 {
+			return fmt.Errorf("linter tool %s has no patterns", tool.Name)
+		}
+		for _, pattern := range tool.Patterns {
+			if _, err := filepath.Match(pattern, ""); err != nil {
+				return fmt.Errorf("invalid pattern %q for linter tool %s: %w", pattern, tool.Name, err)
+			}
+		}
+		if len(tool.Format) == 0 && len(tool.Lint) == 0 {
+			return fmt.Errorf("linter tool %s needs a format or lint command", tool.Name)
+		}
+	}
+	return nil
+}
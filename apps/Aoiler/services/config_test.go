@@ -0,0 +1,55 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigStoreLoad(t *testing.T) {
+	store := &ConfigStore{path: filepath.Join(t.TempDir(), "aoiler.toml"), config: DefaultConfig()}
+	var applied int
+	store.OnChange(func(Config) { applied++ })
+
+	write := func(content string) {
+		t.Helper()
+		if err := os.WriteFile(store.path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write("[llm]\nmax_tokens = 512\n")
+	if err := store.Load(); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := store.Get().LLM.MaxTokens; got != 512 {
+		t.Fatalf("max_tokens = %d, want 512", got)
+	}
+
+	tests := []struct {
+		name    string
+		content string
+		want    string
+	}{
+		{"unknown provider", "[llm]\npriority = [\"nope\"]\n", "unknown provider"},
+		{"temperature", "[llm]\ntemperature = 5.0\n", "temperature"},
+		{"organizer mode", "[services.organizer]\ndefault_mode = \"colour\"\n", "default_mode"},
+		{"syntax", "[llm\n", "failed to parse"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			write(tt.content)
+			err := store.Load()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Load error = %v, want one mentioning %q", err, tt.want)
+			}
+			if got := store.Get().LLM.MaxTokens; got != 512 {
+				t.Errorf("max_tokens = %d after a failed load, want the previous 512", got)
+			}
+		})
+	}
+	if applied != 1 {
+		t.Errorf("listeners called %d times, want only for the valid load", applied)
+	}
+}
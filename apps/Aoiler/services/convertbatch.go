@@ -0,0 +1,340 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Outcomes of a file in a batch conversion
+const (
+	BatchConverted = "converted"
+	BatchFailed    = "failed"
+	BatchSkipped   = "skipped"
+)
+
+// BatchItem is the outcome of one file of a batch conversion
+type BatchItem struct {
+	Input  string `json:"input"`
+	Output string `json:"output,omitempty"`
+	// Status is one of BatchConverted, BatchFailed or BatchSkipped
+	Status     string `json:"status"`
+	Reason     string `json:"reason,omitempty"`
+	OutputSize int64  `json:"outputSize,omitempty"`
+}
+
+// BatchResult summarises the conversion of a folder or glob
+type BatchResult struct {
+	Source    string         `json:"source"`
+	Items     []BatchItem    `json:"items"`
+	Converted int            `json:"converted"`
+	Failed    int            `json:"failed"`
+	Skipped   int            `json:"skipped"`
+	Workers   int            `json:"workers"`
+	Elapsed   float64        `json:"elapsed"`
+	Options   ConvertOptions `json:"options"`
+}
+
+// BatchProgress is attached to the progress events of a batch conversion
+type BatchProgress struct {
+	Total   int `json:"total"`
+	Done    int `json:"done"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+	// Percent covers the whole batch, including files still converting
+	Percent float64 `json:"percent"`
+}
+
+// isBatchInput reports whether input names several files: a glob or a folder
+func isBatchInput(input string) bool {
+	if input == "" {
+		return false
+	}
+	if strings.ContainsAny(input, "*?[") {
+		return true
+	}
+	info, err := os.Stat(expandHome(input))
+	return err == nil && info.IsDir()
+}
+
+// ConvertBatch converts every media file matched by input, a folder or a
+// glob, running up to one ffmpeg per CPU. Cancelling ctx stops all of them
+// and returns what was converted so far along with the error.
+func (cs *ConverterService) ConvertBatch(ctx context.Context, input, query string, opts ConvertOptions) (BatchResult, error) {
+	start := time.Now()
+	if opts.Output != "" && !strings.Contains(opts.Output, "{name}") && !isDirPath(opts.Output) {
+		return BatchResult{}, fmt.Errorf("output must be a folder or a template with {name} when converting several files")
+	}
+
+	files, err := cs.batchFiles(input, query, opts.Format)
+	if err != nil {
+		return BatchResult{}, err
+	}
+	if len(files) == 0 {
+		return BatchResult{}, fmt.Errorf("no media files found in %s", input)
+	}
+
+	result := BatchResult{Source: input, Items: make([]BatchItem, len(files)), Options: opts}
+	itemOpts := make([]ConvertOptions, len(files))
+	reserved := make(map[string]bool)
+	template := cs.template()
+	var pending []int
+
+	for i, file := range files {
+		item := &result.Items[i]
+		item.Input = file
+		if reason := cs.planItem(file, template, opts, reserved, &itemOpts[i], item); reason != "" {
+			item.Status = BatchSkipped
+			item.Reason = reason
+			continue
+		}
+		pending = append(pending, i)
+	}
+
+	progress := &batchProgress{ctx: ctx, running: make(map[string]float64)}
+	progress.state.Total = len(files)
+	progress.state.Skipped = len(files) - len(pending)
+	progress.state.Done = progress.state.Skipped
+	progress.emit(ConvertProgress{Percent: -1})
+
+	result.Workers = min(runtime.NumCPU(), len(pending))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for range result.Workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				item := &result.Items[i]
+				converted, err := cs.convert(ctx, item.Input, item.Output, itemOpts[i], progress.update)
+				if err != nil && ctx.Err() != nil {
+					item.Status = BatchSkipped
+					item.Reason = "cancelled"
+				} else if err != nil {
+					item.Status = BatchFailed
+					item.Reason = err.Error()
+				} else {
+					item.Status = BatchConverted
+					item.OutputSize = converted.OutputSize
+				}
+				progress.finish(item)
+			}
+		}()
+	}
+
+feed:
+	for _, i := range pending {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := range result.Items {
+		item := &result.Items[i]
+		if item.Status == "" {
+			// Never started because the batch was cancelled
+			item.Status = BatchSkipped
+			item.Reason = "cancelled"
+		}
+		switch item.Status {
+		case BatchConverted:
+			result.Converted++
+		case BatchFailed:
+			result.Failed++
+		case BatchSkipped:
+			result.Skipped++
+		}
+	}
+	result.Elapsed = time.Since(start).Seconds()
+	// A cancelled batch still reports the files it converted
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// planItem settles the options and output of one file, or returns why the
+// file is skipped
+func (cs *ConverterService) planItem(file, template string, opts ConvertOptions, reserved map[string]bool, fileOpts *ConvertOptions, item *BatchItem) string {
+	if !cs.AcceptsPath(file) {
+		return "not a media file"
+	}
+
+	*fileOpts = opts
+	if err := fileOpts.resolveFormat(file); err != nil {
+		return err.Error()
+	}
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(file)), ".")
+	if ext == fileOpts.Format && fileOpts.Preset == "" && !fileOpts.changesContent() {
+		return "already " + ext
+	}
+
+	// Existing outputs are kept so a batch can be re-run after a failure
+	output := fileOpts.targetPath(file, template)
+	if reserved[output] {
+		return "another file in the batch is converted to " + output
+	}
+	if _, err := os.Stat(output); err == nil && !fileOpts.Overwrite {
+		return "output exists: " + output
+	}
+	reserved[output] = true
+	item.Output = output
+	return ""
+}
+
+// batchFiles lists the files a folder or glob names. In a folder, only the
+// types named in the query are taken ("all .mov in ~/Videos"), or every
+// media file when none are; subfolders are searched when the query asks.
+func (cs *ConverterService) batchFiles(input, query, format string) ([]string, error) {
+	pattern := expandHome(input)
+	var files []string
+
+	if strings.ContainsAny(pattern, "*?[") {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %w", input, err)
+		}
+		for _, match := range matches {
+			if info, err := os.Stat(match); err == nil && info.Mode().IsRegular() {
+				files = append(files, match)
+			}
+		}
+		return files, nil
+	}
+
+	lowerQuery := strings.ToLower(query)
+	recursive := containsWord(lowerQuery, "recursive") || containsWord(lowerQuery, "subfolder") ||
+		containsWord(lowerQuery, "subdirector")
+	extensions := sourceExtensions(query, input, format)
+
+	err := filepath.WalkDir(pattern, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if path != pattern && (!recursive || strings.HasPrefix(d.Name(), ".")) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || !cs.AcceptsPath(path) {
+			return nil
+		}
+		if len(extensions) > 0 && !hasExtension(path, extensions) {
+			return nil
+		}
+		files = append(files, path)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", input, err)
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+// sourceExtensions returns the file types a batch query is about, leaving
+// out the target format and the input folder
+func sourceExtensions(query, input, format string) []string {
+	lowerQuery := strings.ToLower(query)
+	if input != "" {
+		lowerQuery = strings.Replace(lowerQuery, strings.ToLower(input), " ", 1)
+	}
+	// "extract audio from all videos" is about videos
+	for _, p := range presetPhrases {
+		if p.preset == PresetAudio {
+			lowerQuery = strings.ReplaceAll(lowerQuery, p.phrase, " ")
+		}
+	}
+
+	words := strings.Fields(lowerQuery)
+	var kept []string
+	for i := 0; i < len(words); i++ {
+		switch words[i] {
+		case "to", "into", "as":
+			if i+1 < len(words) && strings.Trim(words[i+1], ".,") == format {
+				i++
+				continue
+			}
+		}
+		kept = append(kept, words[i])
+	}
+	return ParseFileQuery(strings.Join(kept, " "), time.Now()).Extensions
+}
+
+func hasExtension(path string, extensions []string) bool {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+	for _, e := range extensions {
+		if e == ext {
+			return true
+		}
+	}
+	return false
+}
+
+// isDirPath reports whether path is meant as a folder
+func isDirPath(path string) bool {
+	if strings.HasSuffix(path, "/") {
+		return true
+	}
+	info, err := os.Stat(expandHome(path))
+	return err == nil && info.IsDir()
+}
+
+// batchProgress combines the progress of the files being converted into
+// events for the whole batch
+type batchProgress struct {
+	ctx   context.Context
+	mu    sync.Mutex
+	state BatchProgress
+	// running holds the percentage of each file being converted
+	running map[string]float64
+}
+
+func (b *batchProgress) update(p ConvertProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.running[p.Input] = max(0, p.Percent)
+	b.emitLocked(p)
+}
+
+func (b *batchProgress) finish(item *BatchItem) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.running, item.Input)
+	b.state.Done++
+	if item.Status == BatchFailed {
+		b.state.Failed++
+	}
+	b.emitLocked(ConvertProgress{Input: item.Input, Percent: 100})
+}
+
+func (b *batchProgress) emit(p ConvertProgress) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.emitLocked(p)
+}
+
+func (b *batchProgress) emitLocked(p ConvertProgress) {
+	done := float64(b.state.Done)
+	for _, percent := range b.running {
+		done += percent / 100
+	}
+	if b.state.Total > 0 {
+		b.state.Percent = min(100, 100*done/float64(b.state.Total))
+	}
+	state := b.state
+	p.Batch = &state
+	Emit(b.ctx, EventProgress, p)
+}
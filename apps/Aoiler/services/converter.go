@@ -0,0 +1,211 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConverterService handles file conversion with ffmpeg
+type ConverterService struct {
+	mu             sync.RWMutex
+	outputTemplate string
+}
+
+func NewConverterService() *ConverterService {
+	return &ConverterService{
+		outputTemplate: DefaultConfig().Services.Converter.OutputTemplate,
+	}
+}
+
+// ApplyConfig sets the template used to name output files
+func (cs *ConverterService) ApplyConfig(cfg Config) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	cs.outputTemplate = cfg.Services.Converter.OutputTemplate
+}
+
+func (cs *ConverterService) Name() string        { return "converter" }
+func (cs *ConverterService) Description() string { return "Convert media files with ffmpeg" }
+
+func (cs *ConverterService) Keywords() []string {
+	return []string{"convert", "transcode", "change format", "encode"}
+}
+
+func (cs *ConverterService) Params() map[string]string {
+	return map[string]string{
+		ParamPath:   "media file, folder or glob such as ~/Videos/*.mov to convert",
+		ParamFormat: "target file extension, e.g. mp4 or mp3",
+		"preset":    "one of web-optimized, small, lossless, gif-from-clip, audio-only",
+		"start":     "trim start, e.g. 0:30",
+		"end":       "trim end, e.g. 1:10",
+		"scale":     "output size, e.g. 720p, 1280x720 or 50%",
+		"fps":       "output frame rate",
+		"codec":     "video codec, e.g. h264, h265, vp9 or av1",
+		"output":    "output path or template using {dir}, {name}, {ext} and {preset}",
+		"overwrite": `"true" to replace an existing output file`,
+	}
+}
+
+// HasSideEffects reports true: every conversion writes an output file
+func (cs *ConverterService) HasSideEffects(intent Intent) bool { return true }
+
+func (cs *ConverterService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	input := intent.Params[ParamPath]
+	opts := ParseConvertOptions(intent.Query, input)
+	opts.applyParams(intent.Params)
+	if isBatchInput(input) {
+		return cs.ConvertBatch(ctx, input, intent.Query, opts)
+	}
+	return cs.Convert(ctx, input, opts)
+}
+
+// AcceptsPath reports whether the file is a media file ffmpeg can convert
+func (cs *ConverterService) AcceptsPath(path string) bool {
+	mediaExts := map[string]bool{
+		".mp4": true, ".webm": true, ".avi": true, ".mkv": true, ".mov": true,
+		".mp3": true, ".wav": true, ".flac": true, ".ogg": true, ".m4a": true, ".opus": true,
+		".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
+	}
+	return mediaExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// Convert converts inputPath as described by opts, reporting progress as
+// events on ctx
+func (cs *ConverterService) Convert(ctx context.Context, inputPath string, opts ConvertOptions) (ConverterResult, error) {
+	if inputPath == "" {
+		return ConverterResult{}, fmt.Errorf("no input file found")
+	}
+	inputPath = expandHome(inputPath)
+	if _, err := os.Stat(inputPath); err != nil {
+		return ConverterResult{}, fmt.Errorf("input file not found: %s", inputPath)
+	}
+	if err := opts.resolveFormat(inputPath); err != nil {
+		return ConverterResult{}, err
+	}
+
+	outputPath := opts.outputPath(inputPath, cs.template())
+	return cs.convert(ctx, inputPath, outputPath, opts, func(p ConvertProgress) {
+		Emit(ctx, EventProgress, p)
+	})
+}
+
+// convert runs a single conversion whose format and output are settled
+func (cs *ConverterService) convert(ctx context.Context, inputPath, outputPath string, opts ConvertOptions, onProgress func(ConvertProgress)) (ConverterResult, error) {
+	_, statErr := os.Stat(outputPath)
+	outputExisted := statErr == nil
+
+	// Without a duration the progress events carry no percentage
+	duration, _ := probeDuration(ctx, inputPath)
+	if opts.End > 0 && (duration == 0 || opts.End < duration) {
+		duration = opts.End
+	}
+	duration = max(0, duration-opts.Start)
+
+	start := time.Now()
+	err := runFFmpeg(ctx, opts.ffmpegArgs(inputPath, outputPath), inputPath, duration, onProgress)
+	if ctx.Err() != nil || err != nil {
+		// Don't leave a truncated file behind
+		if !outputExisted {
+			os.Remove(outputPath)
+		}
+		if ctx.Err() != nil {
+			return ConverterResult{Success: false}, ctx.Err()
+		}
+		return ConverterResult{Success: false}, err
+	}
+
+	result := ConverterResult{
+		OutputPath: outputPath,
+		Success:    true,
+		Duration:   duration,
+		Elapsed:    time.Since(start).Seconds(),
+		Options:    opts,
+	}
+	if info, err := os.Stat(outputPath); err == nil {
+		result.OutputSize = info.Size()
+	}
+	return result, nil
+}
+
+func (cs *ConverterService) template() string {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+	return cs.outputTemplate
+}
+
+// resolveFormat settles the target format from the options, the preset or,
+// when only trimming or resizing, the input itself
+func (o *ConvertOptions) resolveFormat(inputPath string) error {
+	o.Format = strings.TrimPrefix(strings.ToLower(o.Format), ".")
+	if o.Format == "" {
+		o.Format = presetFormats[o.Preset]
+	}
+	if o.Format == "" && o.changesContent() {
+		// Trimming or resizing keeps the container
+		o.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(inputPath)), ".")
+	}
+	if o.Format == "" {
+		return fmt.Errorf("no target format specified")
+	}
+	return nil
+}
+
+// changesContent reports whether the options alter the media itself, so a
+// conversion makes sense without a new format
+func (o ConvertOptions) changesContent() bool {
+	return o.Start > 0 || o.End > 0 || o.Width > 0 || o.Height > 0 || o.ScalePercent > 0 ||
+		o.FPS > 0 || o.VideoCodec != "" || o.AudioCodec != ""
+}
+
+// applyParams overrides the parsed options with the parameters the
+// classifier extracted
+func (o *ConvertOptions) applyParams(params map[string]string) {
+	if format := params[ParamFormat]; format != "" {
+		o.Format = format
+	}
+	if preset := params["preset"]; presetFormats[preset] != "" {
+		o.Preset = preset
+	}
+	if start, ok := parseTimestamp(params["start"]); ok {
+		o.Start = start
+	}
+	if end, ok := parseTimestamp(params["end"]); ok {
+		o.End = end
+	}
+	if scale := params["scale"]; scale != "" {
+		parsed := ParseConvertOptions(scale, "")
+		o.Width, o.Height, o.ScalePercent = parsed.Width, parsed.Height, parsed.ScalePercent
+	}
+	if fps, err := strconv.ParseFloat(params["fps"], 64); err == nil && fps > 0 {
+		o.FPS = fps
+	}
+	if codec := videoCodecs[strings.ToLower(params["codec"])]; codec != "" {
+		o.VideoCodec = codec
+	}
+	if output := params["output"]; output != "" {
+		o.Output = output
+	}
+	if params["overwrite"] == "true" {
+		o.Overwrite = true
+	}
+}
+
+// GetPathSuggestions for converter - shows media files
+func (cs *ConverterService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
+	fs := NewFileSearchService()
+	result, err := fs.GetPathSuggestions(input, true)
+
+	if err != nil {
+		return result, err
+	}
+
+	// Filter to only show media files
+	result.Suggestions = filterSuggestions(result.Suggestions, cs)
+	return result, nil
+}
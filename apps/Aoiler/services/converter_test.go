@@ -0,0 +1,72 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// failingFFmpeg is an ffmpeg that writes part of its output, the last
+// argument, and then fails
+const failingFFmpeg = `for last; do :; done
+printf partial > "$last"
+echo "Conversion failed!" >&2
+exit 1
+`
+
+func TestConvertRemovesFailedOutput(t *testing.T) {
+	fakeCommand(t, "ffmpeg", failingFFmpeg)
+	fakeCommand(t, "ffprobe", "exit 1\n")
+	dir := t.TempDir()
+	input := filepath.Join(dir, "clip.mov")
+	os.WriteFile(input, []byte("video"), 0644)
+
+	cs := NewConverterService()
+	output := filepath.Join(dir, "clip.mp4")
+	if _, err := cs.convert(context.Background(), input, output, ConvertOptions{Format: "mp4"}, func(ConvertProgress) {}); err == nil {
+		t.Fatal("convert succeeded with a failing ffmpeg")
+	}
+	if _, err := os.Stat(output); !os.IsNotExist(err) {
+		t.Errorf("truncated output left behind: %v", err)
+	}
+
+	// A file that was there before is not the conversion's to remove
+	os.WriteFile(output, []byte("earlier"), 0644)
+	cs.convert(context.Background(), input, output, ConvertOptions{Format: "mp4", Overwrite: true}, func(ConvertProgress) {})
+	if _, err := os.Stat(output); err != nil {
+		t.Errorf("existing output was removed: %v", err)
+	}
+}
+
+func TestConvertBatchCancelled(t *testing.T) {
+	// b.mov converts until it is stopped; the rest finish right away
+	fakeCommand(t, "ffmpeg", `for last; do :; done
+printf done > "$last"
+case "$*" in *b.mov*) exec sleep 30;; esac
+`)
+	fakeCommand(t, "ffprobe", "exit 1\n")
+	dir := t.TempDir()
+	for _, name := range []string{"a.mov", "b.mov"} {
+		os.WriteFile(filepath.Join(dir, name), []byte("video"), 0644)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	result, err := NewConverterService().ConvertBatch(ctx, dir, "convert to mp4", ConvertOptions{Format: "mp4"})
+	if err != context.DeadlineExceeded {
+		t.Fatalf("ConvertBatch error = %v, want the context's", err)
+	}
+	if result.Converted != 1 || result.Skipped != 1 || len(result.Items) != 2 {
+		t.Fatalf("ConvertBatch = %+v, want 1 converted and 1 skipped", result)
+	}
+	for _, item := range result.Items {
+		if filepath.Base(item.Input) == "b.mov" && (item.Status != BatchSkipped || item.Reason != "cancelled") {
+			t.Errorf("b.mov = %+v, want skipped as cancelled", item)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "b.mp4")); !os.IsNotExist(err) {
+		t.Errorf("partial b.mp4 left behind: %v", err)
+	}
+}
@@ -0,0 +1,511 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Conversion presets
+const (
+	PresetWeb      = "web-optimized"
+	PresetSmall    = "small"
+	PresetLossless = "lossless"
+	PresetGIF      = "gif-from-clip"
+	PresetAudio    = "audio-only"
+)
+
+// ConvertOptions are the structured settings of a conversion, parsed from
+// the query or filled in by the classifier
+type ConvertOptions struct {
+	// Format is the target extension without the dot
+	Format string `json:"format,omitempty"`
+	Preset string `json:"preset,omitempty"`
+	// Start and End trim the input, in seconds; End 0 means the end of the input
+	Start float64 `json:"start,omitempty"`
+	End   float64 `json:"end,omitempty"`
+	// Width and Height scale the video; 0 keeps the aspect ratio for that side
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// ScalePercent scales both sides, e.g. 50 for half size
+	ScalePercent int     `json:"scalePercent,omitempty"`
+	FPS          float64 `json:"fps,omitempty"`
+	VideoCodec   string  `json:"videoCodec,omitempty"`
+	AudioCodec   string  `json:"audioCodec,omitempty"`
+	// Output is an output path or template such as "{dir}/{name}-small.{ext}"
+	Output    string `json:"output,omitempty"`
+	Overwrite bool   `json:"overwrite,omitempty"`
+}
+
+// presetFormats is the format a preset produces when none is named
+var presetFormats = map[string]string{
+	PresetWeb:      "mp4",
+	PresetSmall:    "mp4",
+	PresetLossless: "mkv",
+	PresetGIF:      "gif",
+	PresetAudio:    "mp3",
+}
+
+// presetPhrases map the wording of a query to a preset
+var presetPhrases = []struct {
+	phrase string
+	preset string
+}{
+	{"audio only", PresetAudio},
+	{"audio-only", PresetAudio},
+	{"only audio", PresetAudio},
+	{"only the audio", PresetAudio},
+	{"just the audio", PresetAudio},
+	{"extract audio", PresetAudio},
+	{"extract the audio", PresetAudio},
+	{"web-optimized", PresetWeb},
+	{"web optimized", PresetWeb},
+	{"for the web", PresetWeb},
+	{"for web", PresetWeb},
+	{"lossless", PresetLossless},
+	{"smaller", PresetSmall},
+	{"small", PresetSmall},
+	{"compress", PresetSmall},
+	{"gif", PresetGIF},
+}
+
+// videoCodecs maps codec names people use to ffmpeg encoders
+var videoCodecs = map[string]string{
+	"h264": "libx264", "x264": "libx264", "avc": "libx264",
+	"h265": "libx265", "x265": "libx265", "hevc": "libx265",
+	"vp9": "libvpx-vp9", "av1": "libsvtav1", "prores": "prores_ks",
+}
+
+// audioCodecs maps audio codec names to ffmpeg encoders
+var audioCodecs = map[string]string{
+	"aac": "aac", "opus": "libopus", "mp3": "libmp3lame", "flac": "flac", "vorbis": "libvorbis",
+}
+
+// audioExts are inputs without a video stream
+var audioExts = map[string]bool{
+	".mp3": true, ".wav": true, ".flac": true, ".ogg": true, ".m4a": true, ".opus": true, ".aac": true,
+}
+
+// ParseConvertOptions reads presets, trim ranges, scaling, frame rate, codecs
+// and the output path from a query such as "convert clip.mkv to a small mp4
+// from 0:30 to 1:10 at 720p". input is the path of the file being converted,
+// so it is not mistaken for the output.
+func ParseConvertOptions(query, input string) ConvertOptions {
+	opts := ConvertOptions{Format: extractFormat(query)}
+	// inputWord is how the query spells the input, e.g. "./clip.gif"
+	inputWord := input
+
+	words := strings.Fields(query)
+	lower := strings.Fields(strings.ToLower(query))
+	at := func(i int) string {
+		if i >= 0 && i < len(lower) {
+			return strings.Trim(lower[i], ",;")
+		}
+		return ""
+	}
+
+	for i := 0; i < len(lower); i++ {
+		word := at(i)
+
+		switch {
+		case word == "from" || word == "between" || word == "starting" || word == "start":
+			// "from 0:30 to 1:10", "between 1:00 and 2:00", "starting at 5s"
+			j := i + 1
+			if at(j) == "at" {
+				j++
+			}
+			start, used := parseTimestampWords(lower[min(j, len(lower)):])
+			if used == 0 {
+				continue
+			}
+			// A bare number after "from" or "between" is more likely a year
+			// or a count than a time, as in "the recording from 2023"
+			_, err := strconv.ParseFloat(at(j), 64)
+			if (word == "from" || word == "between") && used == 1 && err == nil {
+				continue
+			}
+			opts.Start = start
+			j += used
+			if at(j) == "to" || at(j) == "and" || at(j) == "until" {
+				if end, used := parseTimestampWords(lower[min(j+1, len(lower)):]); used > 0 {
+					opts.End = end
+					j += 1 + used
+				}
+			}
+			i = j - 1
+
+		case word == "until" || word == "till" || (word == "up" && at(i+1) == "to"):
+			j := i + 1
+			if word == "up" {
+				j++
+			}
+			if end, used := parseTimestampWords(lower[min(j, len(lower)):]); used > 0 {
+				opts.End = end
+				i = j + used - 1
+			}
+
+		case word == "first":
+			// "the first 10 seconds"
+			if end, used := parseTimestampWords(lower[min(i+1, len(lower)):]); used > 0 {
+				opts.Start, opts.End = 0, end
+				i += used
+			}
+
+		case strings.HasSuffix(word, "p") && isDigits(strings.TrimSuffix(word, "p")):
+			// "720p"
+			opts.Height, _ = strconv.Atoi(strings.TrimSuffix(word, "p"))
+
+		case strings.Contains(word, "x") && isResolution(word):
+			w, h, _ := strings.Cut(word, "x")
+			opts.Width, _ = strconv.Atoi(w)
+			opts.Height, _ = strconv.Atoi(h)
+
+		case strings.HasSuffix(word, "%") && isDigits(strings.TrimSuffix(word, "%")):
+			opts.ScalePercent, _ = strconv.Atoi(strings.TrimSuffix(word, "%"))
+
+		case word == "half" && (at(i+1) == "size" || at(i+1) == "resolution"):
+			opts.ScalePercent = 50
+
+		case strings.HasSuffix(word, "fps") && word != "fps":
+			opts.FPS, _ = strconv.ParseFloat(strings.TrimSuffix(word, "fps"), 64)
+
+		case word == "fps":
+			// "30 fps" or "fps 30"
+			if fps, err := strconv.ParseFloat(at(i-1), 64); err == nil {
+				opts.FPS = fps
+			} else if fps, err := strconv.ParseFloat(at(i+1), 64); err == nil {
+				opts.FPS = fps
+				i++
+			}
+
+		case videoCodecs[word] != "":
+			opts.VideoCodec = videoCodecs[word]
+
+		case audioCodecs[word] != "" && at(i+1) == "audio":
+			opts.AudioCodec = audioCodecs[word]
+
+		case word == "overwrite" || word == "overwriting" || (word == "replace" && at(i+1) == "existing"):
+			opts.Overwrite = true
+
+		default:
+			if input != "" && sameFile(expandHome(words[i]), expandHome(input)) {
+				inputWord = words[i]
+			} else if isOutputPath(words[i], input) {
+				opts.Output = words[i]
+			}
+		}
+	}
+
+	// File names must not pick a preset, e.g. "clip.gif" as the input
+	lowerQuery := strings.ToLower(query)
+	for _, path := range []string{inputWord, opts.Output} {
+		if path != "" {
+			lowerQuery = strings.Replace(lowerQuery, strings.ToLower(path), " ", 1)
+		}
+	}
+	for _, p := range presetPhrases {
+		if containsWord(lowerQuery, p.phrase) {
+			opts.Preset = p.preset
+			break
+		}
+	}
+
+	// "convert to small.mp4" names the output, not just the format
+	if opts.Output != "" && opts.Format == "" {
+		opts.Format = strings.TrimPrefix(strings.ToLower(filepath.Ext(opts.Output)), ".")
+	}
+	return opts
+}
+
+// isOutputPath reports whether a query word names the output file: a path or
+// template that is not the input, however either is spelled
+func isOutputPath(word, input string) bool {
+	if input != "" && sameFile(expandHome(word), expandHome(input)) {
+		return false
+	}
+	if strings.Contains(word, "{") {
+		return true
+	}
+	ext := filepath.Ext(word)
+	if len(ext) < 2 || !isLetter(ext[1]) {
+		return false
+	}
+	return strings.Contains(word, "/") || len(strings.TrimSuffix(word, ext)) > 0
+}
+
+// parseTimestampWords parses "1:10", "90s", "1m30s" or "30 seconds" at the
+// start of words and returns the time in seconds and the number of words used
+func parseTimestampWords(words []string) (float64, int) {
+	if len(words) == 0 {
+		return 0, 0
+	}
+	word := strings.Trim(words[0], ",;")
+
+	if len(words) > 1 {
+		if value, err := strconv.ParseFloat(word, 64); err == nil {
+			switch strings.Trim(words[1], ",;") {
+			case "s", "sec", "secs", "second", "seconds":
+				return value, 2
+			case "m", "min", "mins", "minute", "minutes":
+				return value * 60, 2
+			case "h", "hour", "hours":
+				return value * 3600, 2
+			}
+		}
+	}
+
+	if seconds, ok := parseTimestamp(word); ok {
+		return seconds, 1
+	}
+	return 0, 0
+}
+
+// parseTimestamp parses "1:02:03.5", "0:30", "90s", "1m30s" and "2min"
+func parseTimestamp(s string) (float64, bool) {
+	if strings.Contains(s, ":") {
+		parts := strings.Split(s, ":")
+		if len(parts) > 3 {
+			return 0, false
+		}
+		var seconds float64
+		for _, part := range parts {
+			value, err := strconv.ParseFloat(part, 64)
+			if err != nil || value < 0 {
+				return 0, false
+			}
+			seconds = seconds*60 + value
+		}
+		return seconds, true
+	}
+
+	if value, err := strconv.ParseFloat(s, 64); err == nil && value >= 0 {
+		return value, true
+	}
+	s = strings.TrimSuffix(strings.TrimSuffix(s, "ins"), "in")
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return d.Seconds(), true
+	}
+	return 0, false
+}
+
+// ffmpegArgs builds the ffmpeg arguments converting input to output
+func (o ConvertOptions) ffmpegArgs(input, output string) []string {
+	args := []string{"-n"}
+	if o.Overwrite {
+		args = []string{"-y"}
+	}
+	if o.Start > 0 {
+		args = append(args, "-ss", formatSeconds(o.Start))
+	}
+	args = append(args, "-i", input)
+	if o.End > o.Start {
+		args = append(args, "-t", formatSeconds(o.End-o.Start))
+	}
+
+	audioInput := audioExts[strings.ToLower(filepath.Ext(input))]
+	var filters []string
+	if scale := o.scaleFilter(); scale != "" {
+		filters = append(filters, scale)
+	}
+
+	switch o.Preset {
+	case PresetGIF:
+		// A palette generated from the clip keeps GIF colours faithful
+		fps := o.FPS
+		if fps == 0 {
+			fps = 12
+		}
+		scale := o.scaleFilter()
+		if scale == "" {
+			scale = "scale=480:-1:flags=lanczos"
+		}
+		chain := fmt.Sprintf("fps=%s,%s", formatSeconds(fps), scale)
+		return append(args, "-filter_complex",
+			chain+",split[a][b];[a]palettegen[p];[b][p]paletteuse", "-loop", "0", output)
+
+	case PresetAudio:
+		args = append(args, "-vn")
+		if o.AudioCodec == "" {
+			args = append(args, audioArgsFor(o.Format)...)
+		}
+
+	case PresetWeb:
+		args = append(args, "-c:v", "libx264", "-preset", "medium", "-crf", "23",
+			"-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "128k", "-movflags", "+faststart")
+
+	case PresetSmall:
+		if audioInput {
+			args = append(args, "-b:a", "96k")
+			break
+		}
+		if len(filters) == 0 {
+			filters = append(filters, "scale=-2:'min(720,ih)'")
+		}
+		args = append(args, "-c:v", "libx264", "-preset", "slow", "-crf", "28",
+			"-pix_fmt", "yuv420p", "-c:a", "aac", "-b:a", "96k")
+
+	case PresetLossless:
+		if o.Format == "wav" {
+			args = append(args, "-c:a", "pcm_s16le")
+		} else if audioInput || o.Format == "flac" {
+			args = append(args, "-c:a", "flac")
+		} else {
+			args = append(args, "-c:v", "ffv1", "-level", "3", "-c:a", "flac")
+		}
+	}
+
+	if o.VideoCodec != "" {
+		args = append(args, "-c:v", o.VideoCodec)
+	}
+	if o.AudioCodec != "" {
+		args = append(args, "-c:a", o.AudioCodec)
+	}
+	if o.FPS > 0 {
+		args = append(args, "-r", formatSeconds(o.FPS))
+	}
+	if len(filters) > 0 {
+		args = append(args, "-vf", strings.Join(filters, ","))
+	}
+	return append(args, output)
+}
+
+// scaleFilter returns the ffmpeg scale filter for the requested size, or ""
+func (o ConvertOptions) scaleFilter() string {
+	switch {
+	case o.ScalePercent > 0:
+		factor := float64(o.ScalePercent) / 100
+		return fmt.Sprintf("scale=trunc(iw*%g/2)*2:trunc(ih*%g/2)*2", factor, factor)
+	case o.Width > 0 && o.Height > 0:
+		return fmt.Sprintf("scale=%d:%d", o.Width, o.Height)
+	case o.Width > 0:
+		return fmt.Sprintf("scale=%d:-2", o.Width)
+	case o.Height > 0:
+		return fmt.Sprintf("scale=-2:%d", o.Height)
+	}
+	return ""
+}
+
+// audioArgsFor picks an encoder for audio-only output
+func audioArgsFor(format string) []string {
+	switch format {
+	case "flac":
+		return []string{"-c:a", "flac"}
+	case "wav":
+		return []string{"-c:a", "pcm_s16le"}
+	case "opus", "ogg":
+		return []string{"-c:a", "libopus", "-b:a", "128k"}
+	case "m4a", "aac":
+		return []string{"-c:a", "aac", "-b:a", "192k"}
+	default:
+		return []string{"-c:a", "libmp3lame", "-q:a", "2"}
+	}
+}
+
+// outputPath expands the output template for input. The input file is never
+// overwritten, and existing files only when Overwrite is set; otherwise a
+// numbered name is chosen.
+func (o ConvertOptions) outputPath(input, template string) string {
+	output := o.targetPath(input, template)
+	if o.Overwrite {
+		return output
+	}
+	return uniquePath(output)
+}
+
+// targetPath is the output path the template names for input, before any
+// existing file is avoided
+func (o ConvertOptions) targetPath(input, template string) string {
+	if o.Output != "" {
+		template = o.Output
+	}
+	if template == "" {
+		template = "{dir}/{name}.{ext}"
+	}
+	template = expandHome(template)
+
+	// A bare directory receives a file named after the input
+	if strings.HasSuffix(template, "/") {
+		template += "{name}.{ext}"
+	} else if info, err := os.Stat(template); err == nil && info.IsDir() {
+		template = filepath.Join(template, "{name}.{ext}")
+	}
+
+	name := strings.TrimSuffix(filepath.Base(input), filepath.Ext(input))
+	preset := o.Preset
+	if preset == "" {
+		preset = "converted"
+	}
+	output := strings.NewReplacer(
+		"{dir}", filepath.Dir(input),
+		"{name}", name,
+		"{ext}", o.Format,
+		"{preset}", preset,
+	).Replace(template)
+	if filepath.Ext(output) == "" {
+		output += "." + o.Format
+	}
+	output = filepath.Clean(output)
+
+	if sameFile(output, input) {
+		ext := filepath.Ext(output)
+		output = strings.TrimSuffix(output, ext) + "-" + preset + ext
+	}
+	return output
+}
+
+// uniquePath returns path, or path with a number appended when it exists
+func uniquePath(path string) string {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return path
+	}
+	ext := filepath.Ext(path)
+	base := strings.TrimSuffix(path, ext)
+	for i := 1; ; i++ {
+		candidate := fmt.Sprintf("%s-%d%s", base, i, ext)
+		if _, err := os.Stat(candidate); os.IsNotExist(err) {
+			return candidate
+		}
+	}
+}
+
+// sameFile reports whether two paths refer to the same file
+func sameFile(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	if errA == nil && errB == nil && absA == absB {
+		return true
+	}
+	infoA, errA := os.Stat(a)
+	infoB, errB := os.Stat(b)
+	return errA == nil && errB == nil && os.SameFile(infoA, infoB)
+}
+
+// formatSeconds formats seconds for ffmpeg without a trailing ".000000"
+func formatSeconds(seconds float64) string {
+	return strconv.FormatFloat(seconds, 'f', -1, 64)
+}
+
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+// isResolution reports whether s looks like "1280x720"
+func isResolution(s string) bool {
+	w, h, ok := strings.Cut(s, "x")
+	return ok && isDigits(w) && isDigits(h)
+}
@@ -0,0 +1,68 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseConvertOptions(t *testing.T) {
+	tests := []struct {
+		query string
+		input string
+		want  ConvertOptions
+	}{
+		{"convert clip.mkv to mp4", "clip.mkv", ConvertOptions{Format: "mp4"}},
+		{"convert clip.mkv to a small mp4 from 0:30 to 1:10 at 720p", "clip.mkv",
+			ConvertOptions{Format: "mp4", Preset: PresetSmall, Start: 30, End: 70, Height: 720}},
+		{"convert video.mov to webm between 1:00 and 2:00", "video.mov", ConvertOptions{Format: "webm", Start: 60, End: 120}},
+		{"trim talk.mp4 to the first 10 seconds", "talk.mp4", ConvertOptions{End: 10}},
+		{"convert talk.mp4 until 1m30s", "talk.mp4", ConvertOptions{End: 90}},
+		{"convert talk.mp4 from 90s to 2 min", "talk.mp4", ConvertOptions{Start: 90, End: 120}},
+		{"convert talk.mp4 from 30 seconds", "talk.mp4", ConvertOptions{Start: 30}},
+		{"convert talk.mp4 starting at 5", "talk.mp4", ConvertOptions{Start: 5}},
+		// Bare numbers after "from" or "between" are not trim times
+		{"convert the recording from 2023 to mp4", "", ConvertOptions{Format: "mp4"}},
+		{"convert clips between 2 and 5 to webm", "", ConvertOptions{Format: "webm"}},
+		{"convert a.mov to mp4 at 1280x720 30 fps", "a.mov", ConvertOptions{Format: "mp4", Width: 1280, Height: 720, FPS: 30}},
+		{"convert a.mov to mp4 at half size 24fps", "a.mov", ConvertOptions{Format: "mp4", ScalePercent: 50, FPS: 24}},
+		{"convert a.mov to mkv with hevc and opus audio", "a.mov", ConvertOptions{Format: "mkv", VideoCodec: "libx265", AudioCodec: "libopus"}},
+		{"convert a.mov to out/b.mp4 overwriting", "a.mov", ConvertOptions{Format: "mp4", Output: "out/b.mp4", Overwrite: true}},
+		{"convert a.mov to {dir}/{name}-web.mp4 for the web", "a.mov", ConvertOptions{Format: "mp4", Preset: PresetWeb, Output: "{dir}/{name}-web.mp4"}},
+		{"extract the audio of song.webm", "song.webm", ConvertOptions{Preset: PresetAudio}},
+		// The input names neither the output nor a preset, however it is spelled
+		{"convert ./clip.gif to mp4", "clip.gif", ConvertOptions{Format: "mp4"}},
+		{"convert clip.gif to mp4", "./clip.gif", ConvertOptions{Format: "mp4"}},
+	}
+	for _, tt := range tests {
+		if got := ParseConvertOptions(tt.query, tt.input); got != tt.want {
+			t.Errorf("ParseConvertOptions(%q) = %+v, want %+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestIsOutputPath(t *testing.T) {
+	home, _ := os.UserHomeDir()
+	cwd, _ := os.Getwd()
+	tests := []struct {
+		word, input string
+		want        bool
+	}{
+		{"out.mp4", "clip.mkv", true},
+		{"~/Videos/out.webm", "clip.mkv", true},
+		{"{dir}/{name}-small.{ext}", "clip.mkv", true},
+		{"clip.mp4", "clip.mp4", false},
+		{"./clip.mp4", "clip.mp4", false},
+		{"clip.mp4", filepath.Join(cwd, "clip.mp4"), false},
+		{"~/x.mkv", filepath.Join(home, "x.mkv"), false},
+		{"dir/../x.mkv", "x.mkv", false},
+		{"mp4", "clip.mkv", false},
+		{".mp4", "clip.mkv", false},
+		{"1.5", "clip.mkv", false},
+	}
+	for _, tt := range tests {
+		if got := isOutputPath(tt.word, tt.input); got != tt.want {
+			t.Errorf("isOutputPath(%q, %q) = %v, want %v", tt.word, tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,396 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// DesktopEntry is an application described by a .desktop file
+type DesktopEntry struct {
+	// ID is the desktop file ID, e.g. org.gnome.Nautilus.desktop
+	ID          string          `json:"id"`
+	Name        string          `json:"name"`
+	GenericName string          `json:"genericName,omitempty"`
+	Comment     string          `json:"comment,omitempty"`
+	Icon        string          `json:"icon,omitempty"`
+	Keywords    []string        `json:"keywords,omitempty"`
+	Actions     []DesktopAction `json:"actions,omitempty"`
+	Path        string          `json:"path"`
+
+	exec     string
+	terminal bool
+	workDir  string
+	// names are every spelling of the name worth matching: localized and not
+	names []string
+}
+
+// DesktopAction is an additional way to start an application, such as
+// "New Private Window"
+type DesktopAction struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Icon string `json:"icon,omitempty"`
+
+	exec string
+}
+
+// applicationDirs returns the directories holding .desktop files, most
+// important first: ~/.local/share/applications, then XDG_DATA_DIRS
+func applicationDirs() []string {
+	dataHome := os.Getenv("XDG_DATA_HOME")
+	if dataHome == "" {
+		homeDir, _ := os.UserHomeDir()
+		dataHome = filepath.Join(homeDir, ".local", "share")
+	}
+	dataDirs := os.Getenv("XDG_DATA_DIRS")
+	if dataDirs == "" {
+		dataDirs = "/usr/local/share:/usr/share"
+	}
+
+	dirs := []string{filepath.Join(dataHome, "applications")}
+	for _, dir := range filepath.SplitList(dataDirs) {
+		if dir != "" {
+			dirs = append(dirs, filepath.Join(dir, "applications"))
+		}
+	}
+	return dirs
+}
+
+// loadDesktopEntries reads the applications in dirs. A desktop file ID found
+// in an earlier directory shadows the same ID in later ones, so a Hidden
+// entry in ~/.local/share/applications removes a system application.
+// Entries that are hidden, not shown on this desktop or whose TryExec is
+// missing are left out.
+func loadDesktopEntries(dirs []string, locales []string) []DesktopEntry {
+	seen := make(map[string]bool)
+	var entries []DesktopEntry
+	desktops := strings.Split(os.Getenv("XDG_CURRENT_DESKTOP"), ":")
+
+	for _, dir := range dirs {
+		filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || !strings.HasSuffix(path, ".desktop") {
+				return nil
+			}
+			rel, _ := filepath.Rel(dir, path)
+			id := strings.ReplaceAll(rel, string(filepath.Separator), "-")
+			if seen[id] {
+				return nil
+			}
+			seen[id] = true
+
+			entry, visible, err := parseDesktopFile(path, locales, desktops)
+			if err != nil || !visible {
+				return nil
+			}
+			entry.ID = id
+			entries = append(entries, entry)
+			return nil
+		})
+	}
+	return entries
+}
+
+// desktopGroups holds the keys of each [group] of a .desktop file
+type desktopGroups map[string]map[string]string
+
+// parseDesktopFile reads an application entry. visible is false for
+// entries that exist but should not be offered.
+func parseDesktopFile(path string, locales, desktops []string) (DesktopEntry, bool, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return DesktopEntry{}, false, err
+	}
+	defer file.Close()
+
+	groups := make(desktopGroups)
+	var current map[string]string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			name := line[1 : len(line)-1]
+			if groups[name] == nil {
+				groups[name] = make(map[string]string)
+			}
+			current = groups[name]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if ok && current != nil {
+			current[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return DesktopEntry{}, false, err
+	}
+
+	main := groups["Desktop Entry"]
+	if main == nil {
+		return DesktopEntry{}, false, fmt.Errorf("%s has no [Desktop Entry] group", path)
+	}
+	if main["Type"] != "Application" || main["Hidden"] == "true" || main["NoDisplay"] == "true" {
+		return DesktopEntry{}, false, nil
+	}
+	if !shownOn(main, desktops) {
+		return DesktopEntry{}, false, nil
+	}
+	if tryExec := unescapeDesktopValue(main["TryExec"]); tryExec != "" {
+		if _, err := exec.LookPath(tryExec); err != nil {
+			return DesktopEntry{}, false, nil
+		}
+	}
+
+	entry := DesktopEntry{
+		Name:        localizedValue(main, "Name", locales),
+		GenericName: localizedValue(main, "GenericName", locales),
+		Comment:     localizedValue(main, "Comment", locales),
+		Icon:        unescapeDesktopValue(main["Icon"]),
+		Keywords:    desktopList(localizedValue(main, "Keywords", locales)),
+		Path:        path,
+		exec:        unescapeDesktopValue(main["Exec"]),
+		terminal:    main["Terminal"] == "true",
+		workDir:     unescapeDesktopValue(main["Path"]),
+	}
+	if entry.Name == "" || entry.exec == "" {
+		return DesktopEntry{}, false, nil
+	}
+	entry.names = []string{entry.Name}
+	if name := unescapeDesktopValue(main["Name"]); name != entry.Name {
+		entry.names = append(entry.names, name)
+	}
+
+	for _, id := range desktopList(main["Actions"]) {
+		group := groups["Desktop Action "+id]
+		if group == nil || group["Exec"] == "" {
+			continue
+		}
+		entry.Actions = append(entry.Actions, DesktopAction{
+			ID:   id,
+			Name: localizedValue(group, "Name", locales),
+			Icon: unescapeDesktopValue(group["Icon"]),
+			exec: unescapeDesktopValue(group["Exec"]),
+		})
+	}
+	return entry, true, nil
+}
+
+// shownOn applies OnlyShowIn and NotShowIn to the current desktops
+func shownOn(group map[string]string, desktops []string) bool {
+	if only := desktopList(group["OnlyShowIn"]); len(only) > 0 {
+		for _, desktop := range only {
+			if containsFold(desktops, desktop) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, desktop := range desktopList(group["NotShowIn"]) {
+		if containsFold(desktops, desktop) {
+			return false
+		}
+	}
+	return true
+}
+
+func containsFold(list []string, s string) bool {
+	for _, item := range list {
+		if strings.EqualFold(item, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// desktopLocales returns the locale keys to try for localized values, most
+// specific first: de_DE.UTF-8@euro gives de_DE@euro, de_DE, de@euro and de
+func desktopLocales() []string {
+	locale := firstNonEmpty(os.Getenv("LC_ALL"), os.Getenv("LC_MESSAGES"), os.Getenv("LANG"))
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+
+	locale, modifier, _ := strings.Cut(locale, "@")
+	locale, _, _ = strings.Cut(locale, ".")
+	lang, country, _ := strings.Cut(locale, "_")
+	if modifier != "" {
+		modifier = "@" + modifier
+	}
+
+	var locales []string
+	if country != "" {
+		if modifier != "" {
+			locales = append(locales, lang+"_"+country+modifier)
+		}
+		locales = append(locales, lang+"_"+country)
+	}
+	if modifier != "" {
+		locales = append(locales, lang+modifier)
+	}
+	return append(locales, lang)
+}
+
+// localizedValue returns key in the first of locales that has it, or the
+// unlocalized value
+func localizedValue(group map[string]string, key string, locales []string) string {
+	for _, locale := range locales {
+		if value, ok := group[key+"["+locale+"]"]; ok {
+			return unescapeDesktopValue(value)
+		}
+	}
+	return unescapeDesktopValue(group[key])
+}
+
+// unescapeDesktopValue resolves \s, \n, \t, \r and \\ in a value
+func unescapeDesktopValue(value string) string {
+	if !strings.Contains(value, `\`) {
+		return value
+	}
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' || i+1 == len(value) {
+			b.WriteByte(value[i])
+			continue
+		}
+		i++
+		switch value[i] {
+		case 's':
+			b.WriteByte(' ')
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case '\\':
+			b.WriteByte('\\')
+		default:
+			// \; is kept for desktopList to split on
+			b.WriteByte('\\')
+			b.WriteByte(value[i])
+		}
+	}
+	return b.String()
+}
+
+// desktopList splits a ;-separated list, where \; is a literal semicolon
+func desktopList(value string) []string {
+	var items []string
+	var item strings.Builder
+	for i := 0; i < len(value); i++ {
+		switch {
+		case value[i] == '\\' && i+1 < len(value) && value[i+1] == ';':
+			item.WriteByte(';')
+			i++
+		case value[i] == ';':
+			if s := strings.TrimSpace(item.String()); s != "" {
+				items = append(items, s)
+			}
+			item.Reset()
+		default:
+			item.WriteByte(value[i])
+		}
+	}
+	if s := strings.TrimSpace(item.String()); s != "" {
+		items = append(items, s)
+	}
+	return items
+}
+
+// execArgs splits an Exec value into arguments and expands its field codes.
+// No files or URLs are passed, so %f, %F, %u and %U are dropped; %i becomes
+// "--icon <icon>", %c the name and %k the path of the .desktop file.
+func (e DesktopEntry) execArgs(execLine, icon string) ([]string, error) {
+	words, err := splitExec(execLine)
+	if err != nil {
+		return nil, err
+	}
+
+	var args []string
+	for _, word := range words {
+		switch word {
+		case "%f", "%F", "%u", "%U", "%d", "%D", "%n", "%N", "%v", "%m":
+			continue
+		case "%i":
+			if icon != "" {
+				args = append(args, "--icon", icon)
+			}
+			continue
+		}
+
+		var arg strings.Builder
+		for i := 0; i < len(word); i++ {
+			if word[i] != '%' || i+1 == len(word) {
+				arg.WriteByte(word[i])
+				continue
+			}
+			i++
+			switch word[i] {
+			case '%':
+				arg.WriteByte('%')
+			case 'c':
+				arg.WriteString(e.Name)
+			case 'k':
+				arg.WriteString(e.Path)
+			}
+			// Other codes inside a word expand to nothing
+		}
+		args = append(args, arg.String())
+	}
+	if len(args) == 0 {
+		return nil, fmt.Errorf("%s has an empty Exec", e.ID)
+	}
+	return args, nil
+}
+
+// splitExec splits an Exec value on spaces. Arguments may be double quoted,
+// and inside quotes \", \`, \$ and \\ stand for the character itself.
+func splitExec(execLine string) ([]string, error) {
+	var words []string
+	var word strings.Builder
+	inWord, quoted := false, false
+
+	for i := 0; i < len(execLine); i++ {
+		c := execLine[i]
+		switch {
+		case quoted && c == '\\' && i+1 < len(execLine) && strings.IndexByte("\"`$\\", execLine[i+1]) >= 0:
+			i++
+			word.WriteByte(execLine[i])
+		case c == '"':
+			quoted = !quoted
+			inWord = true
+		case !quoted && (c == ' ' || c == '\t'):
+			if inWord {
+				words = append(words, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteByte(c)
+			inWord = true
+		}
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in Exec: %s", execLine)
+	}
+	if inWord {
+		words = append(words, word.String())
+	}
+	return words, nil
+}
+
+// shellQuote quotes s for /bin/sh, which runs hyprctl exec commands
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=:,+@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
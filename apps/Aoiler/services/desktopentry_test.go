@@ -0,0 +1,146 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSplitExec(t *testing.T) {
+	tests := []struct {
+		exec string
+		want []string
+	}{
+		{"firefox %u", []string{"firefox", "%u"}},
+		{"  code   --new-window  ", []string{"code", "--new-window"}},
+		{`"/opt/My App/app" --flag`, []string{"/opt/My App/app", "--flag"}},
+		{"sh -c \"echo \\\"hi\\\" \\$HOME \\\\ \\` done\"", []string{"sh", "-c", "echo \"hi\" $HOME \\ ` done"}},
+		{`a""b ""`, []string{"ab", ""}},
+		{"env\tFOO=1 app", []string{"env", "FOO=1", "app"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got, err := splitExec(tt.exec)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitExec(%q) = %q, %v, want %q", tt.exec, got, err, tt.want)
+		}
+	}
+	if _, err := splitExec(`app "unterminated`); err == nil {
+		t.Error("splitExec accepted an unterminated quote")
+	}
+}
+
+func TestExecArgs(t *testing.T) {
+	entry := DesktopEntry{ID: "app.desktop", Name: "My App", Path: "/usr/share/applications/app.desktop"}
+	tests := []struct {
+		exec string
+		icon string
+		want []string
+	}{
+		{"app %U", "", []string{"app"}},
+		{"app %f --x", "", []string{"app", "--x"}},
+		{"app %i", "app-icon", []string{"app", "--icon", "app-icon"}},
+		{"app %i", "", []string{"app"}},
+		{"app --title=%c --desktop=%k", "", []string{"app", "--title=My App", "--desktop=/usr/share/applications/app.desktop"}},
+		{"app 100%% --url=%u", "", []string{"app", "100%", "--url="}},
+		{`"/opt/My App/app" %F`, "", []string{"/opt/My App/app"}},
+	}
+	for _, tt := range tests {
+		got, err := entry.execArgs(tt.exec, tt.icon)
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("execArgs(%q) = %q, %v, want %q", tt.exec, got, err, tt.want)
+		}
+	}
+	if _, err := entry.execArgs("%U %F", ""); err == nil {
+		t.Error("execArgs accepted an Exec of only field codes")
+	}
+}
+
+func TestDesktopList(t *testing.T) {
+	tests := []struct {
+		value string
+		want  []string
+	}{
+		{"Network;WebBrowser;", []string{"Network", "WebBrowser"}},
+		{"browser; web ;internet", []string{"browser", "web", "internet"}},
+		{`a\;b;c`, []string{"a;b", "c"}},
+		{";;", nil},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		if got := desktopList(tt.value); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("desktopList(%q) = %q, want %q", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestParseDesktopFile(t *testing.T) {
+	write := func(content string) string {
+		t.Helper()
+		path := filepath.Join(t.TempDir(), "app.desktop")
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		return path
+	}
+
+	path := write(`[Desktop Entry]
+Type=Application
+Name=Files
+Name[de]=Dateien
+Keywords=folder;manager;
+Exec=nautilus --new-window %U
+Icon=org.gnome.Nautilus
+Actions=new-window;missing;
+
+[Desktop Action new-window]
+Name=New Window
+Exec=nautilus --new-window
+`)
+	entry, visible, err := parseDesktopFile(path, []string{"de_DE", "de"}, []string{"Hyprland"})
+	if err != nil || !visible {
+		t.Fatalf("parseDesktopFile = %v, %v", visible, err)
+	}
+	if entry.Name != "Dateien" || !reflect.DeepEqual(entry.names, []string{"Dateien", "Files"}) {
+		t.Errorf("Name = %q, names = %q, want the German name first", entry.Name, entry.names)
+	}
+	if !reflect.DeepEqual(entry.Keywords, []string{"folder", "manager"}) || entry.exec != "nautilus --new-window %U" {
+		t.Errorf("entry = %+v", entry)
+	}
+	if len(entry.Actions) != 1 || entry.Actions[0].ID != "new-window" {
+		t.Errorf("Actions = %+v, want only new-window", entry.Actions)
+	}
+
+	for _, hidden := range []string{
+		"[Desktop Entry]\nType=Application\nName=A\nExec=a\nNoDisplay=true\n",
+		"[Desktop Entry]\nType=Link\nName=A\nURL=https://example.com\n",
+		"[Desktop Entry]\nType=Application\nName=A\nExec=a\nOnlyShowIn=GNOME;KDE;\n",
+		"[Desktop Entry]\nType=Application\nName=A\nExec=a\nNotShowIn=Hyprland;\n",
+		"[Desktop Entry]\nType=Application\nName=A\nExec=a\nTryExec=aoiler-no-such-binary\n",
+	} {
+		if _, visible, err := parseDesktopFile(write(hidden), nil, []string{"Hyprland"}); visible || err != nil {
+			t.Errorf("entry shown (err %v):\n%s", err, hidden)
+		}
+	}
+}
+
+func TestDesktopLocales(t *testing.T) {
+	tests := []struct {
+		lang string
+		want []string
+	}{
+		{"de_DE.UTF-8@euro", []string{"de_DE@euro", "de_DE", "de@euro", "de"}},
+		{"en_GB.UTF-8", []string{"en_GB", "en"}},
+		{"fr", []string{"fr"}},
+		{"C", nil},
+	}
+	for _, tt := range tests {
+		t.Setenv("LC_ALL", "")
+		t.Setenv("LC_MESSAGES", "")
+		t.Setenv("LANG", tt.lang)
+		if got := desktopLocales(); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("desktopLocales() with LANG=%s = %q, want %q", tt.lang, got, tt.want)
+		}
+	}
+}
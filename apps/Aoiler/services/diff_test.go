@@ -0,0 +1,129 @@
+package services
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after string
+		want          string
+	}{
+		{"identical", "a\nb\n", "a\nb\n", ""},
+		{"empty", "", "", ""},
+		{"changed line", "a\nb\nc\n", "a\nB\nc\n",
+			"--- a/f\n+++ b/f\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"added to empty", "", "a\n",
+			"--- a/f\n+++ b/f\n@@ -0,0 +1 @@\n+a\n"},
+		{"removed all", "a\n", "",
+			"--- a/f\n+++ b/f\n@@ -1 +0,0 @@\n-a\n"},
+		{"missing final newline", "a\nb", "a\nb\n",
+			"--- a/f\n+++ b/f\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n"},
+		{"separate hunks", "1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n", "x\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\ny\n",
+			"--- a/f\n+++ b/f\n@@ -1,4 +1,4 @@\n-1\n+x\n 2\n 3\n 4\n@@ -9,4 +9,4 @@\n 9\n 10\n 11\n-12\n+y\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("f", []byte(tt.before), []byte(tt.after)); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// applyOps rebuilds both sides of an edit script
+func applyOps(ops []diffOp) (before, after []string) {
+	for _, op := range ops {
+		if op.kind != '+' {
+			before = append(before, op.line)
+		}
+		if op.kind != '-' {
+			after = append(after, op.line)
+		}
+	}
+	return before, after
+}
+
+func editCount(ops []diffOp) int {
+	count := 0
+	for _, op := range ops {
+		if op.kind != ' ' {
+			count++
+		}
+	}
+	return count
+}
+
+// lcsEdits is the length of the shortest edit script by dynamic programming
+func lcsEdits(a, b []string) int {
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+	return len(a) + len(b) - 2*lcs[0][0]
+}
+
+func TestDiffLinesShortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	randomLines := func() []string {
+		lines := make([]string, rng.Intn(12))
+		for i := range lines {
+			lines[i] = string(rune('a' + rng.Intn(4)))
+		}
+		return lines
+	}
+	for i := 0; i < 2000; i++ {
+		a, b := randomLines(), randomLines()
+		ops := diffLines(a, b)
+		gotA, gotB := applyOps(ops)
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) does not rebuild its inputs: %v", a, b, ops)
+		}
+		if got, want := editCount(ops), lcsEdits(a, b); got != want {
+			t.Fatalf("diffLines(%q, %q) has %d edits, want %d", a, b, got, want)
+		}
+	}
+}
+
+func TestDiffLinesLargeRewrite(t *testing.T) {
+	// A minified file formatted onto many lines shares almost nothing with it
+	before := []string{"{" + strings.Repeat(`"k":1,`, 20000) + "}\n"}
+	after := make([]string, 0, 20002)
+	after = append(after, "{\n")
+	for i := 0; i < 20000; i++ {
+		after = append(after, fmt.Sprintf("  \"k%d\": 1,\n", i))
+	}
+	after = append(after, "}\n")
+
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+	allocated := stats.TotalAlloc
+
+	ops := diffLines(before, after)
+
+	runtime.ReadMemStats(&stats)
+	if used := stats.TotalAlloc - allocated; used > 64<<20 {
+		t.Errorf("diffLines allocated %d MB", used>>20)
+	}
+	if got := editCount(ops); got != len(before)+len(after) {
+		t.Errorf("edits = %d, want %d", got, len(before)+len(after))
+	}
+	gotBefore, gotAfter := applyOps(ops)
+	if len(gotBefore) != len(before) || len(gotAfter) != len(after) {
+		t.Errorf("rebuilt %d and %d lines, want %d and %d", len(gotBefore), len(gotAfter), len(before), len(after))
+	}
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Event types emitted while a query runs
+const (
+	EventToken     = "token"
+	EventDone      = "done"
+	EventError     = "error"
+	EventCancelled = "cancelled"
+	EventProgress  = "progress"
+)
+
+// Event is an incremental update tied to a single query
+type Event struct {
+	RequestID string      `json:"requestId"`
+	Type      string      `json:"type"`
+	Data      interface{} `json:"data,omitempty"`
+}
+
+// EventSink receives the events of a query. The Wails app forwards them as
+// runtime events, but any consumer can be plugged in.
+type EventSink func(Event)
+
+type requestKey struct{}
+
+type requestScope struct {
+	id   string
+	sink EventSink
+}
+
+// WithRequest attaches a request ID and event sink to ctx so services can
+// report incremental output for that request
+func WithRequest(ctx context.Context, requestID string, sink EventSink) context.Context {
+	return context.WithValue(ctx, requestKey{}, requestScope{id: requestID, sink: sink})
+}
+
+// RequestID returns the request ID attached to ctx, if any
+func RequestID(ctx context.Context) string {
+	scope, _ := ctx.Value(requestKey{}).(requestScope)
+	return scope.id
+}
+
+// Emit sends an event for the request attached to ctx. It is a no-op when
+// the caller did not ask for events.
+func Emit(ctx context.Context, eventType string, data interface{}) {
+	scope, ok := ctx.Value(requestKey{}).(requestScope)
+	if !ok || scope.sink == nil {
+		return
+	}
+	scope.sink(Event{
+		RequestID: scope.id,
+		Type:      eventType,
+		Data:      data,
+	})
+}
+
+// hasEventSink reports whether anyone receives the events of ctx, and so
+// could answer a question
+func hasEventSink(ctx context.Context) bool {
+	scope, ok := ctx.Value(requestKey{}).(requestScope)
+	return ok && scope.sink != nil
+}
+
+// NewRequestID generates a random identifier for a query
+func NewRequestID() string {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return fmt.Sprintf("req-%d", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(buf)
+}
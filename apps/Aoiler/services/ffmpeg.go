@@ -0,0 +1,141 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConvertProgress is the payload of the "progress" events sent while ffmpeg runs
+type ConvertProgress struct {
+	Input string `json:"input"`
+	// Percent is 0-100, or -1 when the input duration is unknown
+	Percent float64 `json:"percent"`
+	// OutTime, Duration and ETA are in seconds
+	OutTime  float64 `json:"outTime"`
+	Duration float64 `json:"duration"`
+	ETA      float64 `json:"eta"`
+	Speed    float64 `json:"speed"`
+	FPS      float64 `json:"fps"`
+	// Batch is set when the file is part of a batch conversion
+	Batch *BatchProgress `json:"batch,omitempty"`
+}
+
+// probeDuration returns the duration of a media file in seconds using ffprobe
+func probeDuration(ctx context.Context, path string) (float64, error) {
+	cmd := commandContext(ctx, "ffprobe", "-v", "error",
+		"-show_entries", "format=duration",
+		"-of", "default=noprint_wrappers=1:nokey=1", path)
+	output, err := cmd.Output()
+	if err != nil {
+		return 0, fmt.Errorf("ffprobe failed: %w", err)
+	}
+
+	duration, err := strconv.ParseFloat(strings.TrimSpace(string(output)), 64)
+	if err != nil {
+		// Still images and some streams have no duration
+		return 0, fmt.Errorf("no duration for %s", path)
+	}
+	return duration, nil
+}
+
+// runFFmpeg runs ffmpeg with args and calls onProgress with each progress
+// report. duration is the expected output length in seconds, 0 if unknown.
+func runFFmpeg(ctx context.Context, args []string, input string, duration float64, onProgress func(ConvertProgress)) error {
+	args = append([]string{"-hide_banner", "-nostdin", "-nostats", "-progress", "pipe:1"}, args...)
+	cmd := commandContext(ctx, "ffmpeg", args...)
+
+	var stderr tailBuffer
+	cmd.Stderr = &stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start ffmpeg: %w", err)
+	}
+
+	start := time.Now()
+	progress := ConvertProgress{Input: input, Duration: duration, Percent: -1}
+
+	// -progress writes blocks of key=value lines, each ending with
+	// progress=continue or progress=end
+	scanner := bufio.NewScanner(stdout)
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+
+		switch key {
+		case "out_time_us":
+			if us, err := strconv.ParseFloat(value, 64); err == nil && us >= 0 {
+				progress.OutTime = us / 1e6
+			}
+		case "speed":
+			progress.Speed, _ = strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64)
+		case "fps":
+			progress.FPS, _ = strconv.ParseFloat(value, 64)
+		case "progress":
+			if duration > 0 {
+				progress.Percent = min(100, 100*progress.OutTime/duration)
+				progress.ETA = estimateETA(progress, time.Since(start))
+			}
+			if value == "end" && duration > 0 {
+				progress.Percent = 100
+				progress.ETA = 0
+			}
+			if onProgress != nil {
+				onProgress(progress)
+			}
+		}
+	}
+
+	if err := cmd.Wait(); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("conversion failed: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
+}
+
+// estimateETA predicts the remaining seconds from ffmpeg's reported speed,
+// or from the progress so far when ffmpeg does not report one
+func estimateETA(p ConvertProgress, elapsed time.Duration) float64 {
+	remaining := p.Duration - p.OutTime
+	if remaining <= 0 {
+		return 0
+	}
+	if p.Speed > 0 {
+		return remaining / p.Speed
+	}
+	if p.OutTime > 0 {
+		return elapsed.Seconds() * remaining / p.OutTime
+	}
+	return 0
+}
+
+// tailBuffer keeps the last few kilobytes written to it, which is where
+// ffmpeg puts the reason it failed
+type tailBuffer struct {
+	buf bytes.Buffer
+}
+
+const tailBufferSize = 4096
+
+func (t *tailBuffer) Write(p []byte) (int, error) {
+	t.buf.Write(p)
+	if extra := t.buf.Len() - tailBufferSize; extra > 0 {
+		t.buf.Next(extra)
+	}
+	return len(p), nil
+}
+
+func (t *tailBuffer) String() string {
+	return t.buf.String()
+}
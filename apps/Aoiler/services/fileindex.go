@@ -0,0 +1,498 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// indexVersion is bumped whenever the on-disk format of the index changes
+const indexVersion = 1
+
+// indexSaveInterval is how often live updates are written back to disk
+const indexSaveInterval = 5 * time.Minute
+
+// IndexEntry is a file or directory known to the index
+type IndexEntry struct {
+	Path    string
+	IsDir   bool
+	Size    int64
+	ModTime time.Time
+
+	lowerPath string
+	// gen is the build that last saw the entry; older entries are swept
+	gen uint64
+}
+
+// lowerName returns the lower-cased base name of the entry
+func (e *IndexEntry) lowerName() string {
+	return e.lowerPath[strings.LastIndexByte(e.lowerPath, '/')+1:]
+}
+
+// indexFile is the on-disk form of the index
+type indexFile struct {
+	Version  int
+	Roots    []string
+	Excludes []string
+	Entries  []IndexEntry
+}
+
+// FileIndex is a filename index over a set of root directories. It is built
+// in the background, kept current with inotify and cached on disk so a
+// restart can answer queries before the rebuild finishes.
+type FileIndex struct {
+	path string
+
+	mu       sync.RWMutex
+	roots    []string
+	excludes []string
+	entries  map[string]*IndexEntry
+	gen      uint64
+	building bool
+	dirty    bool
+	cancel   context.CancelFunc
+	done     chan struct{}
+
+	// watchLimit is set once inotify runs out of watches
+	watchLimit atomic.Bool
+}
+
+// NewFileIndex creates an empty index cached in ~/.local/share/aoiler
+func NewFileIndex() *FileIndex {
+	return &FileIndex{
+		path:    filepath.Join(dataDir(), "fileindex.gob"),
+		entries: make(map[string]*IndexEntry),
+	}
+}
+
+// Configure sets the indexed roots and exclude patterns and (re)starts the
+// background indexer when they changed. Patterns without a slash match file
+// and directory names (e.g. "node_modules", "*.pyc"); patterns with a slash
+// match a full path (e.g. "~/.local/share/Trash").
+func (idx *FileIndex) Configure(roots, excludes []string) {
+	roots = normalizeRoots(roots)
+	excludes = normalizeExcludes(excludes)
+
+	idx.mu.RLock()
+	unchanged := idx.cancel != nil && slices.Equal(roots, idx.roots) && slices.Equal(excludes, idx.excludes)
+	idx.mu.RUnlock()
+	if unchanged {
+		return
+	}
+
+	idx.stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	idx.mu.Lock()
+	idx.roots = roots
+	idx.excludes = excludes
+	idx.cancel = cancel
+	idx.done = done
+	idx.mu.Unlock()
+
+	go idx.run(ctx, done)
+}
+
+// Close stops the indexer and writes pending changes to disk
+func (idx *FileIndex) Close() error {
+	idx.stop()
+	return nil
+}
+
+// Building reports whether a full scan is in progress
+func (idx *FileIndex) Building() bool {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	return idx.building
+}
+
+// Each calls fn for every indexed entry until fn returns false. The entry
+// must not be retained or modified.
+func (idx *FileIndex) Each(fn func(e *IndexEntry) bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	for _, entry := range idx.entries {
+		if !fn(entry) {
+			return
+		}
+	}
+}
+
+func (idx *FileIndex) stop() {
+	idx.mu.Lock()
+	cancel, done := idx.cancel, idx.done
+	idx.cancel, idx.done = nil, nil
+	idx.mu.Unlock()
+
+	if cancel != nil {
+		cancel()
+		<-done
+	}
+}
+
+// run loads the cached index, rescans the roots and then applies inotify
+// events until ctx is cancelled
+func (idx *FileIndex) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	idx.mu.RLock()
+	empty := len(idx.entries) == 0
+	idx.mu.RUnlock()
+	if empty {
+		if err := idx.load(); err != nil && !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "aoiler: ignoring file index cache: %v\n", err)
+		}
+	}
+
+	var events chan fsnotify.Event
+	var watchErrors chan error
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: file index will not update live: %v\n", err)
+	} else {
+		defer watcher.Close()
+		events, watchErrors = watcher.Events, watcher.Errors
+	}
+
+	rebuild := func() chan struct{} {
+		built := make(chan struct{})
+		go func() {
+			defer close(built)
+			idx.build(ctx, watcher)
+		}()
+		return built
+	}
+	built := rebuild()
+
+	save := time.NewTicker(indexSaveInterval)
+	defer save.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if built != nil {
+				<-built
+			}
+			idx.saveIfDirty()
+			return
+		case <-built:
+			built = nil
+			idx.saveIfDirty()
+		case event, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			idx.handleEvent(ctx, watcher, event)
+		case err, ok := <-watchErrors:
+			if !ok {
+				watchErrors = nil
+				continue
+			}
+			// Events were dropped; only a rescan can tell what changed
+			if errors.Is(err, fsnotify.ErrEventOverflow) && built == nil {
+				built = rebuild()
+			}
+		case <-save.C:
+			idx.saveIfDirty()
+		}
+	}
+}
+
+// build walks every root and drops the entries the walk did not see
+func (idx *FileIndex) build(ctx context.Context, watcher *fsnotify.Watcher) {
+	idx.mu.Lock()
+	idx.gen++
+	gen := idx.gen
+	roots := idx.roots
+	idx.building = true
+	idx.mu.Unlock()
+
+	for _, root := range roots {
+		idx.walk(ctx, watcher, root)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.building = false
+	if ctx.Err() != nil {
+		return
+	}
+	for path, entry := range idx.entries {
+		if entry.gen != gen {
+			delete(idx.entries, path)
+			idx.dirty = true
+		}
+	}
+}
+
+// walk adds dir and everything below it, watching each directory
+func (idx *FileIndex) walk(ctx context.Context, watcher *fsnotify.Watcher, dir string) {
+	idx.mu.RLock()
+	excludes := idx.excludes
+	idx.mu.RUnlock()
+
+	filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			// Unreadable directories are skipped, not fatal
+			return nil
+		}
+		if path != dir && isExcluded(excludes, path) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		idx.put(path, info)
+		if d.IsDir() {
+			idx.watch(watcher, path)
+		}
+		return nil
+	})
+}
+
+// watch adds an inotify watch for dir. Once the kernel limit is reached the
+// rest of the tree is still indexed, just not kept current until the next scan.
+func (idx *FileIndex) watch(watcher *fsnotify.Watcher, dir string) {
+	if watcher == nil || idx.watchLimit.Load() {
+		return
+	}
+	if err := watcher.Add(dir); errors.Is(err, syscall.ENOSPC) {
+		idx.watchLimit.Store(true)
+		fmt.Fprintln(os.Stderr, "aoiler: inotify watch limit reached, raise fs.inotify.max_user_watches to keep the whole file index current")
+	}
+}
+
+// handleEvent applies a single inotify event to the index
+func (idx *FileIndex) handleEvent(ctx context.Context, watcher *fsnotify.Watcher, event fsnotify.Event) {
+	path := filepath.Clean(event.Name)
+
+	if event.Has(fsnotify.Remove) || event.Has(fsnotify.Rename) {
+		// A rename also produces a Create for the new name, which is walked
+		// and watched again from scratch
+		if idx.remove(path) && event.Has(fsnotify.Rename) && watcher != nil {
+			watcher.Remove(path)
+		}
+		return
+	}
+
+	idx.mu.RLock()
+	excludes := idx.excludes
+	root := rootOf(idx.roots, path)
+	idx.mu.RUnlock()
+	if root == "" || isExcludedBelow(excludes, root, path) {
+		return
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil {
+		return
+	}
+	if info.IsDir() && event.Has(fsnotify.Create) {
+		// Directories moved into a root arrive with their content
+		idx.walk(ctx, watcher, path)
+		return
+	}
+	idx.put(path, info)
+}
+
+func (idx *FileIndex) put(path string, info fs.FileInfo) {
+	entry := &IndexEntry{
+		Path:      path,
+		IsDir:     info.IsDir(),
+		Size:      info.Size(),
+		ModTime:   info.ModTime(),
+		lowerPath: strings.ToLower(path),
+	}
+
+	idx.mu.Lock()
+	entry.gen = idx.gen
+	idx.entries[path] = entry
+	idx.dirty = true
+	idx.mu.Unlock()
+}
+
+// remove drops path and, when it is a directory, everything below it. It
+// reports whether path was an indexed directory.
+func (idx *FileIndex) remove(path string) bool {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	entry, ok := idx.entries[path]
+	if !ok {
+		return false
+	}
+	delete(idx.entries, path)
+	idx.dirty = true
+
+	if entry.IsDir {
+		prefix := path + string(filepath.Separator)
+		for child := range idx.entries {
+			if strings.HasPrefix(child, prefix) {
+				delete(idx.entries, child)
+			}
+		}
+	}
+	return entry.IsDir
+}
+
+// load fills the index from the disk cache when it was built for the same
+// roots and excludes
+func (idx *FileIndex) load() error {
+	data, err := os.ReadFile(idx.path)
+	if err != nil {
+		return err
+	}
+
+	var file indexFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", idx.path, err)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	if file.Version != indexVersion || !slices.Equal(file.Roots, idx.roots) || !slices.Equal(file.Excludes, idx.excludes) {
+		return nil
+	}
+	for i := range file.Entries {
+		entry := &file.Entries[i]
+		entry.lowerPath = strings.ToLower(entry.Path)
+		entry.gen = idx.gen
+		idx.entries[entry.Path] = entry
+	}
+	return nil
+}
+
+// saveIfDirty writes the index to disk when it changed since the last save
+func (idx *FileIndex) saveIfDirty() {
+	idx.mu.Lock()
+	if !idx.dirty {
+		idx.mu.Unlock()
+		return
+	}
+	file := indexFile{
+		Version:  indexVersion,
+		Roots:    idx.roots,
+		Excludes: idx.excludes,
+		Entries:  make([]IndexEntry, 0, len(idx.entries)),
+	}
+	for _, entry := range idx.entries {
+		file.Entries = append(file.Entries, *entry)
+	}
+	idx.dirty = false
+	idx.mu.Unlock()
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(file); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: failed to encode file index: %v\n", err)
+		return
+	}
+	if err := writeFileAtomic(idx.path, buf.Bytes(), 0600); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: failed to save file index: %v\n", err)
+	}
+}
+
+// normalizeRoots expands and cleans the roots and drops those nested inside
+// another root, which would otherwise be indexed twice
+func normalizeRoots(roots []string) []string {
+	var cleaned []string
+	for _, root := range roots {
+		if root = strings.TrimSpace(root); root != "" {
+			cleaned = append(cleaned, filepath.Clean(expandHome(root)))
+		}
+	}
+	sort.Strings(cleaned)
+
+	var result []string
+	for _, root := range cleaned {
+		if len(result) > 0 && within(root, result[len(result)-1]) {
+			continue
+		}
+		result = append(result, root)
+	}
+	return result
+}
+
+// normalizeExcludes expands ~ in full-path patterns
+func normalizeExcludes(excludes []string) []string {
+	var result []string
+	for _, pattern := range excludes {
+		if pattern = strings.TrimSpace(pattern); pattern == "" {
+			continue
+		}
+		if strings.Contains(pattern, "/") {
+			pattern = filepath.Clean(expandHome(pattern))
+		}
+		result = append(result, pattern)
+	}
+	return result
+}
+
+// isExcluded reports whether path itself matches an exclude pattern
+func isExcluded(excludes []string, path string) bool {
+	name := filepath.Base(path)
+	for _, pattern := range excludes {
+		if strings.Contains(pattern, "/") {
+			if path == pattern {
+				return true
+			}
+		} else if ok, _ := filepath.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isExcludedBelow reports whether path or any directory between root and
+// path matches an exclude pattern
+func isExcludedBelow(excludes []string, root, path string) bool {
+	for path != root && within(path, root) {
+		if isExcluded(excludes, path) {
+			return true
+		}
+		path = filepath.Dir(path)
+	}
+	return false
+}
+
+// rootOf returns the root that contains path, or "" if none does
+func rootOf(roots []string, path string) string {
+	for _, root := range roots {
+		if within(path, root) {
+			return root
+		}
+	}
+	return ""
+}
+
+// within reports whether path is dir or lies below it
+func within(path, dir string) bool {
+	if path == dir {
+		return true
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
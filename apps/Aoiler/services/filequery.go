@@ -0,0 +1,363 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FileQuery is a file search split into name terms and filters
+type FileQuery struct {
+	Terms []string
+	// Extensions limits results to these extensions, without the dot
+	Extensions []string
+	// Kind is "file", "directory" or empty for both
+	Kind           string
+	ModifiedAfter  time.Time
+	ModifiedBefore time.Time
+	// MinSize and MaxSize are in bytes; zero means no limit
+	MinSize int64
+	MaxSize int64
+	// Filters describes the recognised filters for display
+	Filters []string
+}
+
+// fileTypeGroups maps the words people use for kinds of files to extensions
+var fileTypeGroups = map[string][]string{
+	"image":       {"png", "jpg", "jpeg", "gif", "webp", "bmp", "svg", "heic", "tiff"},
+	"picture":     {"png", "jpg", "jpeg", "gif", "webp", "bmp", "heic"},
+	"photo":       {"jpg", "jpeg", "png", "heic", "webp"},
+	"screenshot":  {"png", "jpg", "jpeg"},
+	"video":       {"mp4", "mkv", "webm", "avi", "mov"},
+	"movie":       {"mp4", "mkv", "webm", "avi", "mov"},
+	"audio":       {"mp3", "flac", "wav", "ogg", "m4a", "opus"},
+	"music":       {"mp3", "flac", "wav", "ogg", "m4a", "opus"},
+	"song":        {"mp3", "flac", "wav", "ogg", "m4a", "opus"},
+	"document":    {"pdf", "doc", "docx", "odt", "txt", "md", "rtf"},
+	"spreadsheet": {"xls", "xlsx", "ods", "csv"},
+	"archive":     {"zip", "tar", "gz", "xz", "zst", "7z", "rar"},
+	"ebook":       {"epub", "pdf", "mobi"},
+}
+
+// knownExtensions are extensions that are recognised as filters when named
+// on their own, e.g. "find pdfs" or "find .iso"
+var knownExtensions = map[string]bool{
+	"pdf": true, "png": true, "jpg": true, "jpeg": true, "gif": true, "svg": true, "webp": true,
+	"mp4": true, "mkv": true, "webm": true, "mov": true, "avi": true,
+	"mp3": true, "flac": true, "wav": true, "ogg": true, "m4a": true, "opus": true,
+	"zip": true, "iso": true, "epub": true, "csv": true, "docx": true, "xlsx": true,
+	"json": true, "toml": true, "yaml": true, "yml": true, "md": true, "txt": true,
+}
+
+// fileQueryStopWords carry no information about the file being looked for
+var fileQueryStopWords = map[string]bool{
+	"where": true, "is": true, "are": true, "my": true, "the": true, "a": true, "an": true,
+	"find": true, "search": true, "for": true, "file": true, "files": true, "locate": true,
+	"look": true, "show": true, "me": true, "all": true, "any": true, "list": true,
+	"that": true, "which": true, "were": true, "was": true, "with": true, "in": true,
+	"of": true, "named": true, "called": true, "and": true, "from": true, "to": true,
+	"modified": true, "changed": true, "edited": true, "updated": true, "created": true,
+	"than": true, "i": true, "some": true,
+}
+
+// ParseFileQuery splits a natural-language search such as "pdfs modified
+// last week larger than 10MB" into terms and filters. Relative dates are
+// resolved against now.
+func ParseFileQuery(query string, now time.Time) FileQuery {
+	var q FileQuery
+	var typeWords []string
+
+	words := strings.Fields(strings.ToLower(query))
+	for i := range words {
+		words[i] = strings.Trim(words[i], `?!,;:"'()`)
+	}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		if word == "" {
+			continue
+		}
+
+		switch word {
+		case "folder", "folders", "directory", "directories", "dir", "dirs":
+			q.Kind = "directory"
+			continue
+		}
+
+		if exts, ok := fileTypeGroups[strings.TrimSuffix(word, "s")]; ok {
+			q.Extensions = append(q.Extensions, exts...)
+			typeWords = append(typeWords, word)
+			continue
+		}
+		if ext := strings.TrimPrefix(word, "."); knownExtensions[ext] || knownExtensions[strings.TrimSuffix(ext, "s")] {
+			if !knownExtensions[ext] {
+				ext = strings.TrimSuffix(ext, "s")
+			}
+			q.Extensions = append(q.Extensions, ext)
+			typeWords = append(typeWords, word)
+			continue
+		}
+
+		if n := q.parseTime(words[i:], now); n > 0 {
+			i += n - 1
+			continue
+		}
+		if n := q.parseSize(words[i:]); n > 0 {
+			i += n - 1
+			continue
+		}
+
+		if !fileQueryStopWords[word] && len(word) > 1 {
+			q.Terms = append(q.Terms, word)
+		}
+	}
+
+	// "music folder" names a directory, not a kind of file
+	if q.Kind == "directory" && len(typeWords) > 0 {
+		q.Terms = append(q.Terms, typeWords...)
+		q.Extensions = nil
+	}
+
+	if len(q.Extensions) > 0 {
+		q.Filters = append(q.Filters, "type: "+strings.Join(q.Extensions, ", "))
+	}
+	if q.Kind == "directory" {
+		q.Filters = append(q.Filters, "folders only")
+	}
+	if !q.ModifiedAfter.IsZero() {
+		q.Filters = append(q.Filters, "modified after "+q.ModifiedAfter.Format("2006-01-02 15:04"))
+	}
+	if !q.ModifiedBefore.IsZero() {
+		q.Filters = append(q.Filters, "modified before "+q.ModifiedBefore.Format("2006-01-02 15:04"))
+	}
+	if q.MinSize > 0 {
+		q.Filters = append(q.Filters, "larger than "+humanSize(q.MinSize))
+	}
+	if q.MaxSize > 0 {
+		q.Filters = append(q.Filters, "smaller than "+humanSize(q.MaxSize))
+	}
+	return q
+}
+
+// HasFilters reports whether the query restricts anything besides the name
+func (q FileQuery) HasFilters() bool {
+	return len(q.Extensions) > 0 || q.Kind != "" || !q.ModifiedAfter.IsZero() ||
+		!q.ModifiedBefore.IsZero() || q.MinSize > 0 || q.MaxSize > 0
+}
+
+// Matches reports whether an index entry passes the filters
+func (q FileQuery) Matches(entry *IndexEntry) bool {
+	if q.Kind == "directory" && !entry.IsDir || q.Kind == "file" && entry.IsDir {
+		return false
+	}
+	if len(q.Extensions) > 0 {
+		if entry.IsDir {
+			return false
+		}
+		name := entry.lowerName()
+		matched := false
+		for _, ext := range q.Extensions {
+			if strings.HasSuffix(name, "."+ext) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if !q.ModifiedAfter.IsZero() && entry.ModTime.Before(q.ModifiedAfter) {
+		return false
+	}
+	if !q.ModifiedBefore.IsZero() && !entry.ModTime.Before(q.ModifiedBefore) {
+		return false
+	}
+	if q.MinSize > 0 && (entry.IsDir || entry.Size <= q.MinSize) {
+		return false
+	}
+	if q.MaxSize > 0 && (entry.IsDir || entry.Size >= q.MaxSize) {
+		return false
+	}
+	return true
+}
+
+// parseTime recognises a time filter at the start of words and returns the
+// number of words it used, or 0
+func (q *FileQuery) parseTime(words []string, now time.Time) int {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	at := func(i int) string {
+		if i < len(words) {
+			return words[i]
+		}
+		return ""
+	}
+
+	switch words[0] {
+	case "today":
+		q.ModifiedAfter = today
+		return 1
+	case "yesterday":
+		q.ModifiedAfter = today.AddDate(0, 0, -1)
+		q.ModifiedBefore = today
+		return 1
+	case "recent", "recently", "lately":
+		q.ModifiedAfter = now.AddDate(0, 0, -7)
+		return 1
+	case "this":
+		switch at(1) {
+		case "week":
+			// Weeks start on Monday
+			q.ModifiedAfter = today.AddDate(0, 0, -(int(today.Weekday())+6)%7)
+			return 2
+		case "month":
+			q.ModifiedAfter = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+			return 2
+		case "year":
+			q.ModifiedAfter = time.Date(now.Year(), 1, 1, 0, 0, 0, 0, now.Location())
+			return 2
+		}
+	case "last", "past", "previous", "within":
+		// "last week", "past 3 days", "within the last 2 hours"
+		n := 1
+		if at(n) == "the" {
+			n++
+		}
+		if at(n) == "last" || at(n) == "past" {
+			n++
+		}
+		count := 1
+		if c, err := strconv.Atoi(at(n)); err == nil && c > 0 {
+			count = c
+			n++
+		}
+		if after, ok := timeAgo(now, count, at(n)); ok {
+			q.ModifiedAfter = after
+			return n + 1
+		}
+	case "older", "before":
+		// "older than 30 days", "before 2024-01-31"
+		if date, err := time.ParseInLocation("2006-01-02", at(1), now.Location()); err == nil {
+			q.ModifiedBefore = date
+			return 2
+		}
+		n := 1
+		if at(n) == "than" {
+			n++
+		}
+		if count, err := strconv.Atoi(at(n)); err == nil && count > 0 {
+			if before, ok := timeAgo(now, count, at(n+1)); ok {
+				q.ModifiedBefore = before
+				return n + 2
+			}
+		}
+	case "since", "after":
+		if date, err := time.ParseInLocation("2006-01-02", at(1), now.Location()); err == nil {
+			q.ModifiedAfter = date
+			return 2
+		}
+	}
+	return 0
+}
+
+// timeAgo returns the time count units before now
+func timeAgo(now time.Time, count int, unit string) (time.Time, bool) {
+	switch strings.TrimSuffix(unit, "s") {
+	case "minute", "min":
+		return now.Add(-time.Duration(count) * time.Minute), true
+	case "hour", "hr", "h":
+		return now.Add(-time.Duration(count) * time.Hour), true
+	case "day", "d":
+		return now.AddDate(0, 0, -count), true
+	case "week", "wk", "w":
+		return now.AddDate(0, 0, -7*count), true
+	case "month", "mo":
+		return now.AddDate(0, -count, 0), true
+	case "year", "yr", "y":
+		return now.AddDate(-count, 0, 0), true
+	}
+	return time.Time{}, false
+}
+
+// parseSize recognises a size filter such as "larger than 100MB" or
+// "under 2 gb" at the start of words and returns the number of words it used
+func (q *FileQuery) parseSize(words []string) int {
+	var bound *int64
+	switch words[0] {
+	case "larger", "bigger", "greater", "more", "over", "above", ">":
+		bound = &q.MinSize
+	case "smaller", "less", "under", "below", "<":
+		bound = &q.MaxSize
+	default:
+		return 0
+	}
+
+	n := 1
+	if n < len(words) && words[n] == "than" {
+		n++
+	}
+	if n >= len(words) {
+		return 0
+	}
+
+	size, used := parseByteSize(words[n:])
+	if used == 0 {
+		return 0
+	}
+	*bound = size
+	return n + used
+}
+
+// parseByteSize parses "100mb", "1.5 GB" or "500 kilobytes" and returns the
+// size in bytes and the number of words used. A bare number is not a size.
+func parseByteSize(words []string) (int64, int) {
+	word := words[0]
+	split := len(word)
+	for i, r := range word {
+		if (r < '0' || r > '9') && r != '.' {
+			split = i
+			break
+		}
+	}
+
+	value, err := strconv.ParseFloat(word[:split], 64)
+	if err != nil || value <= 0 {
+		return 0, 0
+	}
+
+	unit, used := word[split:], 1
+	if unit == "" && len(words) > 1 {
+		unit, used = words[1], 2
+	}
+
+	var multiplier float64
+	switch strings.TrimSuffix(unit, "s") {
+	case "b", "byte":
+		multiplier = 1
+	case "k", "kb", "kib", "kilobyte":
+		multiplier = 1 << 10
+	case "m", "mb", "mib", "megabyte":
+		multiplier = 1 << 20
+	case "g", "gb", "gib", "gigabyte":
+		multiplier = 1 << 30
+	case "t", "tb", "tib", "terabyte":
+		multiplier = 1 << 40
+	default:
+		return 0, 0
+	}
+	return int64(value * multiplier), used
+}
+
+// humanSize formats a byte count, e.g. "1.5 GB"
+func humanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(size)/float64(div), "KMGTPE"[exp])
+}
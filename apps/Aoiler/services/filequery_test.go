@@ -0,0 +1,101 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseFileQuery(t *testing.T) {
+	// A Wednesday afternoon
+	now := time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC)
+	day := func(month time.Month, d int) time.Time { return time.Date(2024, month, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		query string
+		want  FileQuery
+	}{
+		{"pdfs modified last week larger than 10MB",
+			FileQuery{Extensions: []string{"pdf"}, ModifiedAfter: now.AddDate(0, 0, -7), MinSize: 10 << 20}},
+		{"where is my tax return from yesterday?",
+			FileQuery{Terms: []string{"tax", "return"}, ModifiedAfter: day(3, 12), ModifiedBefore: day(3, 13)}},
+		{"photos this week",
+			FileQuery{Extensions: fileTypeGroups["photo"], ModifiedAfter: day(3, 11)}},
+		{"find .iso under 2 gb", FileQuery{Extensions: []string{"iso"}, MaxSize: 2 << 30}},
+		{"invoice older than 30 days", FileQuery{Terms: []string{"invoice"}, ModifiedBefore: now.AddDate(0, 0, -30)}},
+		{"notes since 2024-01-31", FileQuery{Terms: []string{"notes"}, ModifiedAfter: day(1, 31)}},
+		{"videos within the last 2 hours", FileQuery{Extensions: fileTypeGroups["video"], ModifiedAfter: now.Add(-2 * time.Hour)}},
+		{"budget spreadsheet this month", FileQuery{Terms: []string{"budget"}, Extensions: fileTypeGroups["spreadsheet"], ModifiedAfter: day(3, 1)}},
+		// "music folder" is a folder called music, not a folder of music files
+		{"my music folder", FileQuery{Terms: []string{"music"}, Kind: "directory"}},
+		{"project folders today", FileQuery{Terms: []string{"project"}, Kind: "directory", ModifiedAfter: day(3, 13)}},
+		// A number alone is neither a size nor a date
+		{"report 2023", FileQuery{Terms: []string{"report", "2023"}}},
+	}
+	for _, tt := range tests {
+		got := ParseFileQuery(tt.query, now)
+		got.Filters = nil
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseFileQuery(%q) =\n%+v, want\n%+v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestParseFileQueryFilters(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC)
+	got := ParseFileQuery("mkv larger than 1.5 GB since 2024-01-01", now)
+	want := []string{"type: mkv", "modified after 2024-01-01 00:00", "larger than 1.5 GB"}
+	if !reflect.DeepEqual(got.Filters, want) {
+		t.Errorf("Filters = %q, want %q", got.Filters, want)
+	}
+	if !got.HasFilters() || ParseFileQuery("tax return", now).HasFilters() {
+		t.Error("HasFilters does not match the parsed filters")
+	}
+}
+
+func TestFileQueryMatches(t *testing.T) {
+	now := time.Date(2024, 3, 13, 15, 0, 0, 0, time.UTC)
+	q := ParseFileQuery("pdfs modified last week larger than 1MB", now)
+	entry := func(path string, isDir bool, size int64, modTime time.Time) *IndexEntry {
+		return &IndexEntry{Path: path, IsDir: isDir, Size: size, ModTime: modTime, lowerPath: strings.ToLower(path)}
+	}
+
+	tests := []struct {
+		entry *IndexEntry
+		want  bool
+	}{
+		{entry("/home/u/Report.PDF", false, 2<<20, now.AddDate(0, 0, -1)), true},
+		{entry("/home/u/report.pdf", false, 512<<10, now.AddDate(0, 0, -1)), false},
+		{entry("/home/u/report.pdf", false, 2<<20, now.AddDate(0, 0, -10)), false},
+		{entry("/home/u/report.docx", false, 2<<20, now.AddDate(0, 0, -1)), false},
+		{entry("/home/u/reports.pdf", true, 0, now.AddDate(0, 0, -1)), false},
+	}
+	for _, tt := range tests {
+		if got := q.Matches(tt.entry); got != tt.want {
+			t.Errorf("Matches(%s, %d bytes, %s) = %v, want %v", tt.entry.Path, tt.entry.Size, tt.entry.ModTime.Format(time.DateOnly), got, tt.want)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := []struct {
+		words []string
+		size  int64
+		used  int
+	}{
+		{[]string{"100mb"}, 100 << 20, 1},
+		{[]string{"1.5", "gb"}, 3 << 29, 2},
+		{[]string{"500", "kilobytes"}, 500 << 10, 2},
+		{[]string{"2t"}, 2 << 40, 1},
+		{[]string{"42"}, 0, 0},
+		{[]string{"42", "files"}, 0, 0},
+		{[]string{"mb"}, 0, 0},
+	}
+	for _, tt := range tests {
+		size, used := parseByteSize(tt.words)
+		if size != tt.size || used != tt.used {
+			t.Errorf("parseByteSize(%q) = %d, %d, want %d, %d", tt.words, size, used, tt.size, tt.used)
+		}
+	}
+}
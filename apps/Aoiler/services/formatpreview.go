@@ -0,0 +1,268 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// previewLifetime is how long a preview can be applied
+	previewLifetime = time.Hour
+	// maxFormatBackups is how many applied changes can be reverted
+	maxFormatBackups = 50
+)
+
+// formatPreview is a formatted version of a file that has not been written
+type formatPreview struct {
+	path      string
+	tool      string
+	original  []byte
+	formatted []byte
+	created   time.Time
+}
+
+// formatBackup is the content of a file before formatting was applied. It is
+// kept on disk so the change can be reverted after a restart.
+type formatBackup struct {
+	Path     string `json:"path"`
+	Tool     string `json:"tool"`
+	Original []byte `json:"original"`
+	// Formatted is the SHA-256 of what was written; a file that has changed
+	// since is not reverted
+	Formatted string    `json:"formatted"`
+	Created   time.Time `json:"created"`
+}
+
+// Preview formats a copy of the file and returns the changes as a unified
+// diff. The file is not modified until ApplyFormat is called with the
+// returned PreviewID.
+func (ls *LinterService) Preview(ctx context.Context, filePath string) (LinterResult, error) {
+	tool, filePath, err := ls.resolve(filePath)
+	if err != nil {
+		return LinterResult{}, err
+	}
+	if len(tool.Format) == 0 {
+		return LinterResult{}, fmt.Errorf("%s has no formatter configured", tool.Name)
+	}
+	if !commandInstalled(tool.Format) {
+		return LinterResult{}, fmt.Errorf("%s is not installed (needed to format %s files)", tool.Format[0], tool.Name)
+	}
+
+	src, err := os.ReadFile(filePath)
+	if err != nil {
+		return LinterResult{}, fmt.Errorf("failed to read %s: %w", filePath, err)
+	}
+	formatted, output, err := runFormatter(ctx, tool, filePath, src)
+	result := LinterResult{FilePath: filePath, Tool: tool.Name, Mode: LintModePreview, Output: output}
+	if err != nil {
+		return result, err
+	}
+
+	result.Diff = unifiedDiff(filepath.Base(filePath), src, formatted)
+	result.Changed = result.Diff != ""
+	if result.Changed {
+		result.PreviewID = ls.addPreview(&formatPreview{
+			path:      filePath,
+			tool:      tool.Name,
+			original:  src,
+			formatted: formatted,
+			created:   time.Now(),
+		})
+	}
+	return result, nil
+}
+
+// ApplyFormat writes a previewed change, keeping the original so that
+// RevertFormat can restore it. A file edited since the preview is left alone.
+func (ls *LinterService) ApplyFormat(previewID string) (LinterResult, error) {
+	ls.mu.Lock()
+	preview, ok := ls.previews[previewID]
+	delete(ls.previews, previewID)
+	ls.mu.Unlock()
+	if !ok || time.Since(preview.created) > previewLifetime {
+		return LinterResult{}, fmt.Errorf("no formatting preview to apply; preview the file again")
+	}
+
+	current, err := os.ReadFile(preview.path)
+	if err != nil {
+		return LinterResult{}, fmt.Errorf("failed to read %s: %w", preview.path, err)
+	}
+	if !bytes.Equal(current, preview.original) {
+		return LinterResult{}, fmt.Errorf("%s changed since the preview; preview it again", preview.path)
+	}
+
+	backupID, err := saveFormatBackup(formatBackup{
+		Path:      preview.path,
+		Tool:      preview.tool,
+		Original:  preview.original,
+		Formatted: contentHash(preview.formatted),
+		Created:   time.Now(),
+	})
+	if err != nil {
+		return LinterResult{}, err
+	}
+	if err := writeFilePreservingMode(preview.path, preview.formatted); err != nil {
+		return LinterResult{}, err
+	}
+
+	return LinterResult{
+		FilePath: preview.path,
+		Tool:     preview.tool,
+		Mode:     LintModeApply,
+		Fixed:    true,
+		Changed:  true,
+		Diff:     unifiedDiff(filepath.Base(preview.path), preview.original, preview.formatted),
+		BackupID: backupID,
+	}, nil
+}
+
+// RevertFormat restores a file to its content before formatting, unless it
+// has been edited since
+func (ls *LinterService) RevertFormat(backupID string) (LinterResult, error) {
+	if backupID == "" || strings.ContainsAny(backupID, `/\.`) {
+		return LinterResult{}, fmt.Errorf("no formatting to revert")
+	}
+	backupPath := filepath.Join(formatBackupDir(), backupID+".json")
+	data, err := os.ReadFile(backupPath)
+	if err != nil {
+		return LinterResult{}, fmt.Errorf("no formatting to revert")
+	}
+	var backup formatBackup
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return LinterResult{}, fmt.Errorf("failed to read backup: %w", err)
+	}
+
+	current, err := os.ReadFile(backup.Path)
+	if err != nil {
+		return LinterResult{}, fmt.Errorf("failed to read %s: %w", backup.Path, err)
+	}
+	if contentHash(current) != backup.Formatted {
+		return LinterResult{}, fmt.Errorf("%s changed since it was formatted; not reverting", backup.Path)
+	}
+	if err := writeFilePreservingMode(backup.Path, backup.Original); err != nil {
+		return LinterResult{}, err
+	}
+	os.Remove(backupPath)
+
+	return LinterResult{
+		FilePath: backup.Path,
+		Tool:     backup.Tool,
+		Mode:     LintModeRevert,
+		Fixed:    true,
+		Changed:  true,
+		Diff:     unifiedDiff(filepath.Base(backup.Path), current, backup.Original),
+	}, nil
+}
+
+// addPreview stores a preview and forgets expired ones
+func (ls *LinterService) addPreview(preview *formatPreview) string {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	for id, p := range ls.previews {
+		if time.Since(p.created) > previewLifetime {
+			delete(ls.previews, id)
+		}
+	}
+	id := NewRequestID()
+	ls.previews[id] = preview
+	return id
+}
+
+// latestPreview returns the ID of the newest preview, of path when set
+func (ls *LinterService) latestPreview(path string) string {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	var latestID string
+	var latest time.Time
+	for id, p := range ls.previews {
+		if path != "" && !sameFile(p.path, path) {
+			continue
+		}
+		if p.created.After(latest) {
+			latestID, latest = id, p.created
+		}
+	}
+	return latestID
+}
+
+func formatBackupDir() string {
+	return filepath.Join(dataDir(), "format-backups")
+}
+
+// saveFormatBackup writes a backup and drops the oldest beyond maxFormatBackups
+func saveFormatBackup(backup formatBackup) (string, error) {
+	data, err := json.Marshal(backup)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode backup: %w", err)
+	}
+	id := NewRequestID()
+	if err := writeFileAtomic(filepath.Join(formatBackupDir(), id+".json"), data, 0600); err != nil {
+		return "", fmt.Errorf("failed to save backup: %w", err)
+	}
+
+	backups := listFormatBackups()
+	for len(backups) > maxFormatBackups {
+		os.Remove(backups[0].path)
+		backups = backups[1:]
+	}
+	return id, nil
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// listFormatBackups returns the backup files, oldest first
+func listFormatBackups() []backupFile {
+	entries, err := os.ReadDir(formatBackupDir())
+	if err != nil {
+		return nil
+	}
+	var backups []backupFile
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			backups = append(backups, backupFile{filepath.Join(formatBackupDir(), entry.Name()), info.ModTime()})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.Before(backups[j].modTime) })
+	return backups
+}
+
+// latestFormatBackup returns the ID of the newest backup, of path when set
+func latestFormatBackup(path string) (string, error) {
+	backups := listFormatBackups()
+	for i := len(backups) - 1; i >= 0; i-- {
+		id := strings.TrimSuffix(filepath.Base(backups[i].path), ".json")
+		if path == "" {
+			return id, nil
+		}
+		data, err := os.ReadFile(backups[i].path)
+		if err != nil {
+			continue
+		}
+		var backup formatBackup
+		if json.Unmarshal(data, &backup) == nil && sameFile(backup.Path, path) {
+			return id, nil
+		}
+	}
+	return "", fmt.Errorf("no formatting to revert")
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
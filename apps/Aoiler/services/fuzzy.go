@@ -0,0 +1,95 @@
+package services
+
+// Scores used by fuzzyScore, modelled on fzf: matched characters earn
+// points, runs of consecutive matches and matches at word starts earn
+// bonuses, and gaps between matches cost a little
+const (
+	scoreMatch       = 16
+	bonusBoundary    = 8
+	bonusConsecutive = 6
+	bonusFirstChar   = 8
+	penaltyGapStart  = 3
+	penaltyGapExtend = 1
+)
+
+// fuzzyScore reports how well pattern matches text as a subsequence, or -1
+// when it does not match at all. Both are expected to be lower case.
+func fuzzyScore(text, pattern string) int {
+	if pattern == "" {
+		return 0
+	}
+
+	// Find the end of the first occurrence, then walk back from it to find
+	// the shortest window that still contains the whole pattern
+	pi := 0
+	end := -1
+	for ti := 0; ti < len(text); ti++ {
+		if text[ti] == pattern[pi] {
+			pi++
+			if pi == len(pattern) {
+				end = ti
+				break
+			}
+		}
+	}
+	if end < 0 {
+		return -1
+	}
+
+	start := end
+	pi = len(pattern) - 1
+	for ti := end; ti >= 0; ti-- {
+		if text[ti] == pattern[pi] {
+			pi--
+			if pi < 0 {
+				start = ti
+				break
+			}
+		}
+	}
+
+	score := 0
+	pi = 0
+	prev := -1
+	for ti := start; ti <= end && pi < len(pattern); ti++ {
+		if text[ti] != pattern[pi] {
+			continue
+		}
+
+		score += scoreMatch
+		if isBoundary(text, ti) {
+			score += bonusBoundary
+			if pi == 0 {
+				score += bonusFirstChar
+			}
+		}
+		if prev >= 0 {
+			if ti == prev+1 {
+				score += bonusConsecutive
+			} else {
+				score -= penaltyGapStart + penaltyGapExtend*(ti-prev-2)
+			}
+		}
+
+		prev = ti
+		pi++
+	}
+
+	// Scattered matches still match; they just rank last
+	if score < 1 {
+		score = 1
+	}
+	return score
+}
+
+// isBoundary reports whether text[i] starts a word
+func isBoundary(text string, i int) bool {
+	if i == 0 {
+		return true
+	}
+	switch text[i-1] {
+	case '/', '-', '_', '.', ' ':
+		return true
+	}
+	return false
+}
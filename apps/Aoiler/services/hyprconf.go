@@ -0,0 +1,113 @@
+package services
+
+import (
+	"fmt"
+	"strings"
+)
+
+// hyprIndent is the indentation of one section level
+const hyprIndent = "    "
+
+// formatHyprlandConf formats a Hyprland config: sections are indented,
+// assignments get single spaces around their "=", and runs of blank lines
+// are collapsed into one
+func formatHyprlandConf(src []byte) []byte {
+	var out strings.Builder
+	depth := 0
+	blank := false
+
+	for _, raw := range strings.Split(string(src), "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			blank = out.Len() > 0
+			continue
+		}
+
+		code, comment := splitHyprComment(line)
+		if strings.HasPrefix(code, "}") {
+			depth = max(0, depth-1)
+		}
+		if blank {
+			out.WriteByte('\n')
+			blank = false
+		}
+
+		out.WriteString(strings.Repeat(hyprIndent, depth))
+		out.WriteString(formatHyprLine(code, comment))
+		out.WriteByte('\n')
+
+		if strings.HasSuffix(code, "{") {
+			depth++
+		}
+	}
+	return []byte(out.String())
+}
+
+// formatHyprLine normalizes the spacing of one trimmed line
+func formatHyprLine(code, comment string) string {
+	switch {
+	case code == "":
+	case strings.HasSuffix(code, "{"):
+		if name := strings.TrimSpace(strings.TrimSuffix(code, "{")); name != "" {
+			code = name + " {"
+		}
+	case strings.Contains(code, "="):
+		key, value, _ := strings.Cut(code, "=")
+		code = strings.TrimSpace(strings.TrimSpace(key) + " = " + strings.TrimSpace(value))
+	}
+
+	if comment == "" {
+		return code
+	}
+	if code == "" {
+		return comment
+	}
+	return code + " " + comment
+}
+
+// splitHyprComment splits a trimmed line into code and a trailing comment.
+// "##" is an escaped "#" and does not start a comment.
+func splitHyprComment(line string) (string, string) {
+	for i := 0; i < len(line); i++ {
+		if line[i] != '#' {
+			continue
+		}
+		if i+1 < len(line) && line[i+1] == '#' {
+			i++
+			continue
+		}
+		return strings.TrimSpace(line[:i]), line[i:]
+	}
+	return line, ""
+}
+
+// lintHyprlandConf reports unbalanced sections and lines that are neither
+// assignments nor section braces
+func lintHyprlandConf(path string, src []byte) []Diagnostic {
+	var diagnostics []Diagnostic
+	var open []int
+
+	for i, raw := range strings.Split(string(src), "\n") {
+		lineNo := i + 1
+		code, _ := splitHyprComment(strings.TrimSpace(raw))
+
+		switch {
+		case code == "":
+		case code == "}":
+			if len(open) == 0 {
+				diagnostics = append(diagnostics, Diagnostic{File: path, Line: lineNo, Message: "unexpected }"})
+				continue
+			}
+			open = open[:len(open)-1]
+		case strings.HasSuffix(code, "{"):
+			open = append(open, lineNo)
+		case !strings.Contains(code, "="):
+			diagnostics = append(diagnostics, Diagnostic{File: path, Line: lineNo, Message: "expected key = value"})
+		}
+	}
+
+	for _, lineNo := range open {
+		diagnostics = append(diagnostics, Diagnostic{File: path, Line: lineNo, Message: fmt.Sprintf("section opened on line %d is never closed", lineNo)})
+	}
+	return diagnostics
+}
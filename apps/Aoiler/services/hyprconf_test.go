@@ -0,0 +1,91 @@
+package services
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitHyprComment(t *testing.T) {
+	tests := []struct {
+		line, code, comment string
+	}{
+		{"gaps_in = 5", "gaps_in = 5", ""},
+		{"gaps_in = 5   # inner gaps", "gaps_in = 5", "# inner gaps"},
+		{"# a whole-line comment", "", "# a whole-line comment"},
+		{"bind = SUPER, 3, exec, echo ##3", "bind = SUPER, 3, exec, echo ##3", ""},
+		{"col = ##ff0000 # red", "col = ##ff0000", "# red"},
+		{"#", "", "#"},
+	}
+	for _, tt := range tests {
+		code, comment := splitHyprComment(tt.line)
+		if code != tt.code || comment != tt.comment {
+			t.Errorf("splitHyprComment(%q) = %q, %q; want %q, %q", tt.line, code, comment, tt.code, tt.comment)
+		}
+	}
+}
+
+func TestFormatHyprlandConf(t *testing.T) {
+	src := `# Monitors
+monitor=,preferred,auto,1
+
+
+general{
+gaps_in=5 # inner
+  border_size   =2
+decoration {
+rounding=10
+}
+}
+}
+bind=SUPER,Q,exec,kitty
+`
+	want := `# Monitors
+monitor = ,preferred,auto,1
+
+general {
+    gaps_in = 5 # inner
+    border_size = 2
+    decoration {
+        rounding = 10
+    }
+}
+}
+bind = SUPER,Q,exec,kitty
+`
+	got := string(formatHyprlandConf([]byte(src)))
+	if got != want {
+		t.Errorf("formatHyprlandConf =\n%s\nwant\n%s", got, want)
+	}
+	if again := string(formatHyprlandConf([]byte(got))); again != got {
+		t.Errorf("formatting twice changed the config again:\n%s", again)
+	}
+
+	// Leading blank lines are dropped, an empty config stays empty
+	if got := string(formatHyprlandConf([]byte("\n\n  \n"))); got != "" {
+		t.Errorf("formatHyprlandConf(blank) = %q, want empty", got)
+	}
+}
+
+func TestLintHyprlandConf(t *testing.T) {
+	src := `general {
+    gaps_in = 5
+    just some words
+}
+}
+input { # opened here
+    kb_layout = us
+# exec-once = waybar {
+`
+	want := []Diagnostic{
+		{File: "hyprland.conf", Line: 3, Message: "expected key = value"},
+		{File: "hyprland.conf", Line: 5, Message: "unexpected }"},
+		{File: "hyprland.conf", Line: 6, Message: "section opened on line 6 is never closed"},
+	}
+	if got := lintHyprlandConf("hyprland.conf", []byte(src)); !reflect.DeepEqual(got, want) {
+		t.Errorf("lintHyprlandConf = %+v, want %+v", got, want)
+	}
+
+	if got := lintHyprlandConf("ok.conf", []byte("a = 1\nsection {\n    b = 2\n}\n")); len(got) != 0 {
+		t.Errorf("lintHyprlandConf(valid) = %+v, want nothing", got)
+	}
+}
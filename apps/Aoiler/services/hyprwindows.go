@@ -0,0 +1,581 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// HyprlandClient is a window as listed by hyprctl clients -j
+type HyprlandClient struct {
+	Address          string                 `json:"address"`
+	Mapped           bool                   `json:"mapped"`
+	Hidden           bool                   `json:"hidden"`
+	At               []int                  `json:"at"`
+	Size             []int                  `json:"size"`
+	Workspace        map[string]interface{} `json:"workspace"`
+	Floating         bool                   `json:"floating"`
+	Pseudo           bool                   `json:"pseudo"`
+	Monitor          int                    `json:"monitor"`
+	Class            string                 `json:"class"`
+	Title            string                 `json:"title"`
+	InitialClass     string                 `json:"initialClass"`
+	InitialTitle     string                 `json:"initialTitle"`
+	PID              int                    `json:"pid"`
+	Xwayland         bool                   `json:"xwayland"`
+	Pinned           bool                   `json:"pinned"`
+	Fullscreen       int                    `json:"fullscreen"`
+	FullscreenClient int                    `json:"fullscreenClient"`
+	Grouped          []string               `json:"grouped"`
+	Tags             []string               `json:"tags"`
+	Swallowing       string                 `json:"swallowing"`
+	FocusHistoryID   int                    `json:"focusHistoryID"`
+}
+
+// Window actions
+const (
+	WindowMove        = "move"
+	WindowFocus       = "focus"
+	WindowClose       = "close"
+	WindowFloat       = "float"
+	WindowTile        = "tile"
+	WindowToggleFloat = "togglefloat"
+	WindowPin         = "pin"
+	WindowUnpin       = "unpin"
+	WindowFullscreen  = "fullscreen"
+	// WindowWorkspace switches to a workspace rather than acting on windows
+	WindowWorkspace = "workspace"
+)
+
+// WindowResult reports what a window command did
+type WindowResult struct {
+	Query   string           `json:"query"`
+	Action  string           `json:"action"`
+	Windows []HyprlandClient `json:"windows"`
+	// Dispatches are the hyprctl dispatch calls that were made
+	Dispatches []string `json:"dispatches"`
+	Output     string   `json:"output"`
+	Success    bool     `json:"success"`
+}
+
+// windowCommand is a parsed window command
+type windowCommand struct {
+	action string
+	target windowTarget
+	// workspace is where windows are moved or which workspace to switch to
+	workspace string
+	// follow moves the view along with moved windows
+	follow bool
+}
+
+// windowTarget names the windows a command acts on
+type windowTarget struct {
+	// term matches class and title; empty means the last focused window
+	term string
+	all  bool
+	// onWorkspace limits the windows to one workspace
+	onWorkspace string
+}
+
+// windowAliases let a query name a kind of window rather than its class
+var windowAliases = map[string][]string{
+	"video":    {"mpv", "vlc", "celluloid", "picture-in-picture", "youtube"},
+	"browser":  {"firefox", "chromium", "google-chrome", "brave", "zen", "librewolf"},
+	"terminal": {"kitty", "alacritty", "foot", "ghostty", "wezterm"},
+	"editor":   {"code", "codium", "nvim", "zed", "gedit"},
+	"music":    {"spotify", "rhythmbox", "spot"},
+	"files":    {"nautilus", "thunar", "dolphin", "nemo"},
+}
+
+var (
+	windowVerbPattern  = regexp.MustCompile(`^(move|send|put|throw|focus|switch to|go to|close|kill|quit|float|unfloat|tile|pin|unpin|fullscreen|maximize|toggle floating|toggle float|make)\b\s*(.*)$`)
+	moveToPattern      = regexp.MustCompile(`^(.*?)\s*\bto (?:workspace|ws)\s+(\S+)(?:\s+(and follow|and go there|and switch to it|silently))?$`)
+	makePattern        = regexp.MustCompile(`^(.*?)\s*\b(float|floating|tiled|tiling|fullscreen)$`)
+	onWorkspacePattern = regexp.MustCompile(`^(?:all\s+)?(?:the\s+)?(?:windows|everything|all)\s+on\s+(?:workspace|ws)\s+(\S+)$`)
+	allPattern         = regexp.MustCompile(`^(?:all|every)\s+(?:the\s+)?(.*?)(?:\s+windows?)?$`)
+)
+
+// activeWindowWords refer to the window the user focused last
+var activeWindowWords = map[string]bool{
+	"": true, "this": true, "it": true, "this window": true, "current window": true,
+	"the current window": true, "the active window": true, "active window": true, "window": true,
+}
+
+// parseWindowCommand reads "move firefox to workspace 3", "float this
+// window", "close all windows on workspace 5" and similar commands
+func parseWindowCommand(query string) (windowCommand, bool) {
+	lower := strings.ToLower(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), ".!")))
+	m := windowVerbPattern.FindStringSubmatch(lower)
+	if m == nil {
+		return windowCommand{}, false
+	}
+	verb, rest := m[1], m[2]
+
+	var cmd windowCommand
+	switch verb {
+	case "go to", "switch to":
+		if ws, ok := strings.CutPrefix(rest, "workspace "); ok {
+			return windowCommand{action: WindowWorkspace, workspace: strings.TrimSpace(ws)}, true
+		}
+		cmd.action = WindowFocus
+	case "move", "send", "put", "throw":
+		mm := moveToPattern.FindStringSubmatch(rest)
+		if mm == nil {
+			return windowCommand{}, false
+		}
+		cmd.action, rest, cmd.workspace = WindowMove, mm[1], mm[2]
+		cmd.follow = mm[3] != "" && mm[3] != "silently"
+	case "make":
+		mm := makePattern.FindStringSubmatch(rest)
+		if mm == nil {
+			return windowCommand{}, false
+		}
+		rest = mm[1]
+		switch mm[2] {
+		case "float", "floating":
+			cmd.action = WindowFloat
+		case "tiled", "tiling":
+			cmd.action = WindowTile
+		default:
+			cmd.action = WindowFullscreen
+		}
+	case "close", "kill", "quit":
+		cmd.action = WindowClose
+	case "unfloat", "tile":
+		cmd.action = WindowTile
+	case "toggle floating", "toggle float":
+		cmd.action = WindowToggleFloat
+	case "maximize":
+		cmd.action = WindowFullscreen
+	default:
+		cmd.action = verb
+	}
+
+	cmd.target = parseWindowTarget(rest)
+	return cmd, true
+}
+
+func parseWindowTarget(text string) windowTarget {
+	text = strings.TrimSpace(text)
+	if m := onWorkspacePattern.FindStringSubmatch(text); m != nil {
+		return windowTarget{all: true, onWorkspace: m[1]}
+	}
+	if m := allPattern.FindStringSubmatch(text); m != nil {
+		term := strings.TrimSuffix(strings.TrimSuffix(m[1], "windows"), "window")
+		return windowTarget{all: true, term: strings.TrimSpace(term)}
+	}
+	if activeWindowWords[text] {
+		return windowTarget{}
+	}
+	text = strings.TrimPrefix(text, "the ")
+	text = strings.TrimSuffix(strings.TrimSuffix(text, " windows"), " window")
+	return windowTarget{term: strings.TrimSpace(text)}
+}
+
+// mentionsWindows reports whether a command is clearly about windows even
+// when no window matches it
+func (cmd windowCommand) mentionsWindows(query string) bool {
+	lower := strings.ToLower(query)
+	return cmd.action == WindowWorkspace || cmd.target.onWorkspace != "" ||
+		containsWord(lower, "window") || containsWord(lower, "windows") || containsWord(lower, "workspace")
+}
+
+// WindowService moves, focuses, floats, pins and closes Hyprland windows
+type WindowService struct {
+	mu sync.Mutex
+	// clients is a short-lived copy of the window list for MatchesQuery,
+	// which runs on every keystroke
+	clients   []HyprlandClient
+	clientsAt time.Time
+}
+
+// windowListTTL is how long MatchesQuery reuses the window list
+const windowListTTL = 2 * time.Second
+
+func NewWindowService() *WindowService {
+	return &WindowService{}
+}
+
+func (ws *WindowService) Name() string { return "windows" }
+func (ws *WindowService) Description() string {
+	return "Move, focus, float, pin and close Hyprland windows"
+}
+
+// Keywords is empty: window commands are recognized by MatchesQuery, since
+// words like "pin" or "close" are too common on their own
+func (ws *WindowService) Keywords() []string { return nil }
+
+// MatchesQuery claims window commands that talk about windows or
+// workspaces, or whose target names an open window. A bare "close" or
+// "pin it" names neither, so it is left to the other services.
+func (ws *WindowService) MatchesQuery(query string) bool {
+	cmd, ok := parseWindowCommand(query)
+	if !ok {
+		return false
+	}
+	if cmd.mentionsWindows(query) {
+		return true
+	}
+	if cmd.target.term == "" {
+		return false
+	}
+
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+	if time.Since(ws.clientsAt) > windowListTTL {
+		clients, err := hyprClients(context.Background())
+		if err != nil {
+			return false
+		}
+		ws.clients, ws.clientsAt = clients, time.Now()
+	}
+	for _, client := range ws.clients {
+		if windowScore(client, cmd.target.term) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSideEffects reports true: every command changes, and may close, the
+// user's windows
+func (ws *WindowService) HasSideEffects(intent Intent) bool { return true }
+
+func (ws *WindowService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	cmd, ok := parseWindowCommand(intent.Query)
+	if !ok {
+		return nil, fmt.Errorf("not a window command: %q", intent.Query)
+	}
+	result := WindowResult{Query: intent.Query, Action: cmd.action, Windows: []HyprlandClient{}}
+
+	if cmd.action == WindowWorkspace {
+		dispatch := []string{"workspace", hyprWorkspace(cmd.workspace)}
+		if err := hyprDispatch(ctx, dispatch...); err != nil {
+			return nil, err
+		}
+		result.Dispatches = []string{strings.Join(dispatch, " ")}
+		result.Output = "Switched to workspace " + cmd.workspace
+		result.Success = true
+		return result, nil
+	}
+
+	windows, err := resolveWindows(ctx, cmd.target)
+	if err != nil {
+		return nil, err
+	}
+	result.Windows = windows
+
+	var skipped []string
+	for _, window := range windows {
+		dispatches, reason := windowDispatches(cmd, window)
+		if reason != "" {
+			skipped = append(skipped, fmt.Sprintf("%s is %s", windowLabel(window), reason))
+		}
+		for _, dispatch := range dispatches {
+			if err := hyprDispatch(ctx, dispatch...); err != nil {
+				result.Output = summarizeWindows(cmd, windows, skipped)
+				return result, err
+			}
+			result.Dispatches = append(result.Dispatches, strings.Join(dispatch, " "))
+		}
+	}
+
+	result.Output = summarizeWindows(cmd, windows, skipped)
+	result.Success = true
+	return result, nil
+}
+
+// resolveWindows finds the windows a target names: the last focused window,
+// every window on a workspace, or the best match (or all matches) for a term
+func resolveWindows(ctx context.Context, target windowTarget) ([]HyprlandClient, error) {
+	clients, err := hyprClients(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if target.term == "" && !target.all {
+		// Aoiler itself has focus while the query is typed, and hyprClients
+		// leaves it out, so the most recently focused client is the user's
+		var active *HyprlandClient
+		for i, client := range clients {
+			if client.Mapped && (active == nil || client.FocusHistoryID < active.FocusHistoryID) {
+				active = &clients[i]
+			}
+		}
+		if active == nil {
+			return nil, fmt.Errorf("no window is open")
+		}
+		return []HyprlandClient{*active}, nil
+	}
+
+	type scored struct {
+		client HyprlandClient
+		score  int
+	}
+	var matches []scored
+	for _, client := range clients {
+		if target.onWorkspace != "" && !onWorkspace(client, target.onWorkspace) {
+			continue
+		}
+		score := 1
+		if target.term != "" {
+			score = windowScore(client, target.term)
+		}
+		if score > 0 {
+			matches = append(matches, scored{client, score})
+		}
+	}
+	if len(matches) == 0 {
+		if target.onWorkspace != "" {
+			return nil, fmt.Errorf("no windows on workspace %s", target.onWorkspace)
+		}
+		return nil, fmt.Errorf("no window matches %q", target.term)
+	}
+
+	// Best match first, then the most recently focused
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return matches[i].client.FocusHistoryID < matches[j].client.FocusHistoryID
+	})
+	if !target.all {
+		return []HyprlandClient{matches[0].client}, nil
+	}
+	windows := make([]HyprlandClient, len(matches))
+	for i, match := range matches {
+		windows[i] = match.client
+	}
+	return windows, nil
+}
+
+// windowScore rates how well term names a window, or 0 when it does not
+func windowScore(client HyprlandClient, term string) int {
+	if !client.Mapped {
+		return 0
+	}
+	terms, ok := windowAliases[term]
+	if !ok {
+		terms = []string{term}
+	}
+
+	best := 0
+	for _, t := range terms {
+		for _, class := range []string{client.Class, client.InitialClass} {
+			class = strings.ToLower(class)
+			switch {
+			case class == "":
+			case class == t || strings.HasSuffix(class, "."+t):
+				// org.gnome.Nautilus is named by "nautilus"
+				best = max(best, 100)
+			case strings.Contains(class, t):
+				best = max(best, 80)
+			case fuzzyScore(class, t) >= 12*len(t):
+				best = max(best, 40)
+			}
+		}
+		if strings.Contains(strings.ToLower(client.Title), t) {
+			best = max(best, 60)
+		}
+	}
+	return best
+}
+
+func onWorkspace(client HyprlandClient, workspace string) bool {
+	if name, _ := client.Workspace["name"].(string); strings.EqualFold(name, workspace) {
+		return true
+	}
+	id, _ := client.Workspace["id"].(float64)
+	return strconv.Itoa(int(id)) == workspace
+}
+
+// hyprWorkspace turns a workspace as spoken into dispatcher syntax:
+// "scratchpad" and "special" mean the special workspace
+func hyprWorkspace(workspace string) string {
+	switch workspace {
+	case "scratchpad", "special":
+		return "special"
+	}
+	return workspace
+}
+
+// windowDispatches returns the dispatcher calls that apply cmd to a
+// window, or the reason nothing needs doing
+func windowDispatches(cmd windowCommand, window HyprlandClient) ([][]string, string) {
+	address := "address:" + window.Address
+	switch cmd.action {
+	case WindowMove:
+		dispatcher := "movetoworkspacesilent"
+		if cmd.follow {
+			dispatcher = "movetoworkspace"
+		}
+		return [][]string{{dispatcher, hyprWorkspace(cmd.workspace) + "," + address}}, ""
+	case WindowFocus:
+		return [][]string{{"focuswindow", address}}, ""
+	case WindowClose:
+		return [][]string{{"closewindow", address}}, ""
+	case WindowFloat:
+		if window.Floating {
+			return nil, "already floating"
+		}
+		return [][]string{{"setfloating", address}}, ""
+	case WindowTile:
+		if !window.Floating {
+			return nil, "already tiled"
+		}
+		return [][]string{{"settiled", address}}, ""
+	case WindowToggleFloat:
+		return [][]string{{"togglefloating", address}}, ""
+	case WindowPin:
+		if window.Pinned {
+			return nil, "already pinned"
+		}
+		// Only floating windows can be pinned
+		var dispatches [][]string
+		if !window.Floating {
+			dispatches = append(dispatches, []string{"setfloating", address})
+		}
+		return append(dispatches, []string{"pin", address}), ""
+	case WindowUnpin:
+		if !window.Pinned {
+			return nil, "not pinned"
+		}
+		return [][]string{{"pin", address}}, ""
+	case WindowFullscreen:
+		// fullscreen acts on the focused window
+		return [][]string{{"focuswindow", address}, {"fullscreen", "0"}}, ""
+	}
+	return nil, "not something Aoiler can do"
+}
+
+// windowPastTense describes each action in summaries
+var windowPastTense = map[string]string{
+	WindowFocus:       "Focused",
+	WindowClose:       "Closed",
+	WindowFloat:       "Floated",
+	WindowTile:        "Tiled",
+	WindowToggleFloat: "Toggled floating for",
+	WindowPin:         "Pinned",
+	WindowUnpin:       "Unpinned",
+	WindowFullscreen:  "Toggled fullscreen for",
+}
+
+// summarizeWindows says what a command did, e.g. "Moved firefox to workspace 3"
+func summarizeWindows(cmd windowCommand, windows []HyprlandClient, skipped []string) string {
+	acted := len(windows) - len(skipped)
+	var lines []string
+	if acted > 0 {
+		subject := fmt.Sprintf("%d windows", acted)
+		if cmd.target.term != "" {
+			subject = fmt.Sprintf("%d %s windows", acted, cmd.target.term)
+		}
+		if acted == 1 {
+			for _, window := range windows {
+				if !containsPrefix(skipped, windowLabel(window)) {
+					subject = windowLabel(window)
+				}
+			}
+		}
+		if cmd.target.onWorkspace != "" {
+			subject += " on workspace " + cmd.target.onWorkspace
+		}
+		if cmd.action == WindowMove {
+			lines = append(lines, fmt.Sprintf("Moved %s to workspace %s", subject, cmd.workspace))
+		} else {
+			lines = append(lines, windowPastTense[cmd.action]+" "+subject)
+		}
+	}
+	return strings.Join(append(lines, skipped...), "\n")
+}
+
+func containsPrefix(list []string, prefix string) bool {
+	for _, item := range list {
+		if strings.HasPrefix(item, prefix+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// windowLabel names a window by its class and title
+func windowLabel(window HyprlandClient) string {
+	title := window.Title
+	if len([]rune(title)) > 40 {
+		title = string([]rune(title)[:40]) + "…"
+	}
+	switch {
+	case window.Class == "":
+		return fmt.Sprintf("%q", title)
+	case title == "" || strings.EqualFold(title, window.Class):
+		return window.Class
+	}
+	return fmt.Sprintf("%s (%s)", window.Class, title)
+}
+
+// aoilerClass is the window class of Aoiler's own window, which
+// WindowRules.conf keeps on special:aoiler
+const aoilerClass = "Aoiler"
+
+// hyprClients lists the open windows other than Aoiler's own, so commands
+// never act on the window they were typed into
+func hyprClients(ctx context.Context) ([]HyprlandClient, error) {
+	var all []HyprlandClient
+	if err := hyprctlJSON(ctx, &all, "clients"); err != nil {
+		return nil, err
+	}
+	clients := all[:0]
+	for _, client := range all {
+		if !strings.EqualFold(client.Class, aoilerClass) && !strings.EqualFold(client.InitialClass, aoilerClass) {
+			clients = append(clients, client)
+		}
+	}
+	return clients, nil
+}
+
+// hyprctlJSON runs hyprctl with -j and decodes its answer into v
+func hyprctlJSON(ctx context.Context, v interface{}, args ...string) error {
+	if err := checkHyprland(); err != nil {
+		return err
+	}
+	output, err := commandContext(ctx, "hyprctl", append(args, "-j")...).Output()
+	if err != nil {
+		return fmt.Errorf("hyprctl %s failed: %w", args[0], err)
+	}
+	if err := json.Unmarshal(output, v); err != nil {
+		return fmt.Errorf("failed to parse hyprctl %s output: %w", args[0], err)
+	}
+	return nil
+}
+
+// hyprDispatch runs a Hyprland dispatcher, which answers "ok" on success
+func hyprDispatch(ctx context.Context, args ...string) error {
+	if err := checkHyprland(); err != nil {
+		return err
+	}
+	output, err := commandContext(ctx, "hyprctl", append([]string{"dispatch"}, args...)...).CombinedOutput()
+	reply := strings.TrimSpace(string(output))
+	if err != nil {
+		return fmt.Errorf("hyprctl dispatch %s: %w: %s", args[0], err, reply)
+	}
+	if reply != "ok" {
+		return fmt.Errorf("hyprctl dispatch %s: %s", args[0], reply)
+	}
+	return nil
+}
+
+func checkHyprland() error {
+	if os.Getenv("HYPRLAND_INSTANCE_SIGNATURE") == "" {
+		return fmt.Errorf("Hyprland is not running")
+	}
+	if _, err := exec.LookPath("hyprctl"); err != nil {
+		return fmt.Errorf("hyprctl is not installed")
+	}
+	return nil
+}
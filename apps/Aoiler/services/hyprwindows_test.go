@@ -0,0 +1,153 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseWindowCommand(t *testing.T) {
+	tests := []struct {
+		query string
+		want  windowCommand
+		ok    bool
+	}{
+		{"move firefox to workspace 3", windowCommand{action: WindowMove, target: windowTarget{term: "firefox"}, workspace: "3"}, true},
+		{"send it to ws 2 and follow", windowCommand{action: WindowMove, workspace: "2", follow: true}, true},
+		{"move kitty to workspace scratchpad silently", windowCommand{action: WindowMove, target: windowTarget{term: "kitty"}, workspace: "scratchpad"}, true},
+		{"float this window", windowCommand{action: WindowFloat}, true},
+		{"focus kitty", windowCommand{action: WindowFocus, target: windowTarget{term: "kitty"}}, true},
+		{"switch to firefox", windowCommand{action: WindowFocus, target: windowTarget{term: "firefox"}}, true},
+		{"go to workspace 4", windowCommand{action: WindowWorkspace, workspace: "4"}, true},
+		{"close all windows on workspace 5", windowCommand{action: WindowClose, target: windowTarget{all: true, onWorkspace: "5"}}, true},
+		{"close all firefox windows", windowCommand{action: WindowClose, target: windowTarget{all: true, term: "firefox"}}, true},
+		{"pin the video", windowCommand{action: WindowPin, target: windowTarget{term: "video"}}, true},
+		{"make mpv fullscreen", windowCommand{action: WindowFullscreen, target: windowTarget{term: "mpv"}}, true},
+		{"make it tiled", windowCommand{action: WindowTile}, true},
+		{"toggle floating", windowCommand{action: WindowToggleFloat}, true},
+		{"Fullscreen.", windowCommand{action: WindowFullscreen}, true},
+		{"move the chair to the kitchen", windowCommand{}, false},
+		{"make dinner", windowCommand{}, false},
+		{"what is a window manager", windowCommand{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			got, ok := parseWindowCommand(tt.query)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("parseWindowCommand(%q) = %+v, %v; want %+v, %v", tt.query, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestWindowScore(t *testing.T) {
+	mpv := HyprlandClient{Mapped: true, Class: "mpv", Title: "movie.mkv - mpv"}
+	nautilus := HyprlandClient{Mapped: true, Class: "org.gnome.Nautilus", Title: "Downloads"}
+	tests := []struct {
+		client HyprlandClient
+		term   string
+		want   int
+	}{
+		{mpv, "mpv", 100},
+		{mpv, "video", 100},
+		{mpv, "movie", 60},
+		{mpv, "firefox", 0},
+		{nautilus, "nautilus", 100},
+		{nautilus, "files", 100},
+		{nautilus, "gnome", 80},
+		{HyprlandClient{Class: "mpv"}, "mpv", 0},
+	}
+	for _, tt := range tests {
+		if got := windowScore(tt.client, tt.term); got != tt.want {
+			t.Errorf("windowScore(%s, %q) = %d, want %d", tt.client.Class, tt.term, got, tt.want)
+		}
+	}
+}
+
+// fakeHyprctl puts a hyprctl on PATH that lists clients as JSON
+func fakeHyprctl(t *testing.T, clients string) {
+	dir := t.TempDir()
+	script := "#!/bin/sh\ncase \"$1\" in\nclients) cat <<'EOF'\n" + clients + "\nEOF\n;;\ndispatch) echo ok;;\nesac\n"
+	if err := os.WriteFile(filepath.Join(dir, "hyprctl"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+	t.Setenv("HYPRLAND_INSTANCE_SIGNATURE", "test")
+}
+
+func TestResolveWindows(t *testing.T) {
+	fakeHyprctl(t, `[
+		{"address":"0x1","mapped":true,"class":"Aoiler","initialClass":"Aoiler","workspace":{"id":-98,"name":"special:aoiler"},"focusHistoryID":0},
+		{"address":"0x2","mapped":true,"class":"kitty","title":"~","workspace":{"id":5,"name":"5"},"focusHistoryID":1},
+		{"address":"0x3","mapped":true,"class":"firefox","title":"Docs","workspace":{"id":1,"name":"1"},"focusHistoryID":3},
+		{"address":"0x4","mapped":true,"class":"firefox","title":"Mail","workspace":{"id":5,"name":"5"},"focusHistoryID":2}
+	]`)
+
+	tests := []struct {
+		name   string
+		target windowTarget
+		want   []string
+	}{
+		{"last focused skips Aoiler", windowTarget{}, []string{"0x2"}},
+		{"best match is most recent", windowTarget{term: "firefox"}, []string{"0x4"}},
+		{"all matches", windowTarget{term: "firefox", all: true}, []string{"0x4", "0x3"}},
+		{"workspace", windowTarget{all: true, onWorkspace: "5"}, []string{"0x2", "0x4"}},
+		{"Aoiler is never a target", windowTarget{term: "aoiler"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			windows, err := resolveWindows(context.Background(), tt.target)
+			if tt.want == nil {
+				if err == nil {
+					t.Fatalf("resolveWindows() = %v, want an error", windows)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, window := range windows {
+				got = append(got, window.Address)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("resolveWindows() = %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("resolveWindows() = %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestWindowServiceMatchesQuery(t *testing.T) {
+	fakeHyprctl(t, `[
+		{"address":"0x2","mapped":true,"class":"kitty","title":"~","workspace":{"id":5,"name":"5"},"focusHistoryID":1},
+		{"address":"0x3","mapped":true,"class":"firefox","title":"Docs","workspace":{"id":1,"name":"1"},"focusHistoryID":2}
+	]`)
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"close firefox", true},
+		{"close this window", true},
+		{"close all windows on workspace 5", true},
+		{"go to workspace 2", true},
+		{"pin the terminal", true},
+		{"close", false},
+		{"close it", false},
+		{"close all", false},
+		{"toggle floating", false},
+		{"close the door", false},
+	}
+	ws := NewWindowService()
+	for _, tt := range tests {
+		if got := ws.MatchesQuery(tt.query); got != tt.want {
+			t.Errorf("MatchesQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
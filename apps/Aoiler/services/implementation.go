@@ -1,39 +1,91 @@
 package services
 
 import (
+	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
 )
 
 // Result types
 type FileSearchResult struct {
-	Path  string `json:"path"`
-	Type  string `json:"type"`
-	Found bool   `json:"found"`
+	// Results are ranked best first
+	Results []FileMatch `json:"results"`
+	// Filters describes the filters recognised in the query
+	Filters []string `json:"filters,omitempty"`
+	Found   bool     `json:"found"`
+}
+
+// FileMatch is a single file search result
+type FileMatch struct {
+	Path    string    `json:"path"`
+	Type    string    `json:"type"`
+	Score   int       `json:"score"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
 }
 
 type OrganizerResult struct {
 	Output  string `json:"output"`
 	Success bool   `json:"success"`
+	Path    string `json:"path"`
+	Mode    string `json:"mode,omitempty"`
+	// Moves are planned, carried out or undone, depending on the flags below
+	Moves   []OrganizeMove `json:"moves"`
+	Skipped int            `json:"skipped,omitempty"`
+	Failed  []string       `json:"failed,omitempty"`
+	// PlanID executes a dry-run plan
+	PlanID    string `json:"planId,omitempty"`
+	Executed  bool   `json:"executed,omitempty"`
+	JournalID string `json:"journalId,omitempty"`
+	Undone    bool   `json:"undone,omitempty"`
 }
 
 type LinterResult struct {
 	Output   string `json:"output"`
 	Fixed    bool   `json:"fixed"`
 	FilePath string `json:"filePath"`
+	Tool     string `json:"tool"`
+	// Mode is one of the LintMode constants
+	Mode        string       `json:"mode"`
+	Diagnostics []Diagnostic `json:"diagnostics,omitempty"`
+	// Diff shows what formatting changes, as a unified diff
+	Diff    string `json:"diff,omitempty"`
+	Changed bool   `json:"changed"`
+	// PreviewID applies a previewed change; BackupID reverts an applied one
+	PreviewID string `json:"previewId,omitempty"`
+	BackupID  string `json:"backupId,omitempty"`
 }
 
 type OCRResult struct {
 	Text    string `json:"text"`
 	Success bool   `json:"success"`
+	// Source is the image file read, or "screen" for a capture
+	Source       string `json:"source"`
+	Language     string `json:"language"`
+	PSM          int    `json:"psm"`
+	Preprocessed bool   `json:"preprocessed"`
+	// Copied reports whether the text was put on the clipboard
+	Copied bool `json:"copied"`
+	// HistoryID is the capture in the OCR history
+	HistoryID string `json:"historyId,omitempty"`
 }
 
 type ConverterResult struct {
 	OutputPath string `json:"outputPath"`
 	Success    bool   `json:"success"`
+	OutputSize int64  `json:"outputSize"`
+	// Duration is the length of the input media and Elapsed the time the
+	// conversion took, both in seconds
+	Duration float64 `json:"duration"`
+	Elapsed  float64 `json:"elapsed"`
+	// Options are the settings the conversion ran with
+	Options ConvertOptions `json:"options"`
 }
 
 
@@ -44,73 +96,170 @@ type AutoCompleteResult struct {
 }
 
 // FileSearchService handles file/directory search
-type FileSearchService struct{}
+type FileSearchService struct {
+	index *FileIndex
+
+	mu         sync.RWMutex
+	maxResults int
+}
 
 func NewFileSearchService() *FileSearchService {
-	return &FileSearchService{}
+	return &FileSearchService{
+		index:      NewFileIndex(),
+		maxResults: DefaultConfig().Services.FileSearch.MaxResults,
+	}
 }
 
-func (fs *FileSearchService) Search(query string) (FileSearchResult, error) {
-	searchTerms := extractSearchTerms(query)
+// ApplyConfig sets the directories indexed. The index only starts once a
+// config is applied, so instances used just for path completion stay idle.
+func (fs *FileSearchService) ApplyConfig(cfg Config) {
+	fs.mu.Lock()
+	fs.maxResults = cfg.Services.FileSearch.MaxResults
+	fs.mu.Unlock()
 
-	homeDir, _ := os.UserHomeDir()
-	configDir := filepath.Join(homeDir, ".config")
+	fs.index.Configure(cfg.Services.FileSearch.Roots, cfg.Services.FileSearch.Excludes)
+}
 
-	var foundPath string
-	var bestScore int
+// Close stops the indexer and saves the index
+func (fs *FileSearchService) Close() error {
+	return fs.index.Close()
+}
 
-	filepath.Walk(configDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return nil
-		}
+func (fs *FileSearchService) Name() string        { return "filesearch" }
+func (fs *FileSearchService) Description() string { return "Find files and directories" }
 
-		fileName := strings.ToLower(filepath.Base(path))
-		lowerPath := strings.ToLower(path)
+func (fs *FileSearchService) Keywords() []string {
+	return []string{"find", "where is", "locate", "search for", "look for"}
+}
 
-		// Calculate match score
-		score := 0
-		matchedTerms := 0
+func (fs *FileSearchService) Params() map[string]string {
+	return map[string]string{
+		ParamTerms: "words from the name of the file or directory, without filters",
+	}
+}
 
-		for _, term := range searchTerms {
-			// Exact filename match gets highest score
-			if fileName == term || fileName == term+".conf" || fileName == term+".config" {
-				score += 100
-			} else if strings.HasPrefix(fileName, term) {
-				score += 50
-			} else if strings.Contains(fileName, term) {
-				score += 25
-			} else if strings.Contains(lowerPath, term) {
-				score += 10
-			}
+func (fs *FileSearchService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	// Filters always come from the full query; the classifier may have
+	// narrowed the name terms down
+	query := ParseFileQuery(intent.Query, time.Now())
+	if terms := intent.Params[ParamTerms]; terms != "" {
+		query.Terms = ParseFileQuery(terms, time.Now()).Terms
+	}
+	return fs.Find(ctx, query)
+}
 
-			if strings.Contains(lowerPath, term) {
-				matchedTerms++
-			}
+// Search finds files matching a natural-language query
+func (fs *FileSearchService) Search(ctx context.Context, query string) (FileSearchResult, error) {
+	return fs.Find(ctx, ParseFileQuery(query, time.Now()))
+}
+
+// Find ranks the indexed files against the query terms with fuzzy matching
+// and returns the best matches that pass the query's filters. Without terms,
+// the most recently modified matches come first.
+func (fs *FileSearchService) Find(ctx context.Context, query FileQuery) (FileSearchResult, error) {
+	if len(query.Terms) == 0 && !query.HasFilters() {
+		return FileSearchResult{Found: false}, fmt.Errorf("nothing to search for")
+	}
+
+	fs.mu.RLock()
+	limit := fs.maxResults
+	fs.mu.RUnlock()
+	if limit <= 0 {
+		limit = 10
+	}
+
+	better := func(a, b FileMatch) bool {
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if len(query.Terms) == 0 && !a.ModTime.Equal(b.ModTime) {
+			return a.ModTime.After(b.ModTime)
+		}
+		if len(a.Path) != len(b.Path) {
+			return len(a.Path) < len(b.Path)
+		}
+		return a.Path < b.Path
+	}
+	var matches []FileMatch
+	trim := func() {
+		sort.Slice(matches, func(i, j int) bool { return better(matches[i], matches[j]) })
+		if len(matches) > limit {
+			matches = matches[:limit]
 		}
+	}
 
-		// Only consider if all terms are matched
-		if matchedTerms == len(searchTerms) && score > bestScore {
-			bestScore = score
-			foundPath = path
+	var scanned int
+	fs.index.Each(func(entry *IndexEntry) bool {
+		// Check for cancellation now and then rather than on every entry
+		if scanned++; scanned%4096 == 0 && ctx.Err() != nil {
+			return false
+		}
+		if !query.Matches(entry) {
+			return true
 		}
 
-		return nil
-	})
+		score, ok := scoreEntry(entry, query.Terms)
+		if !ok {
+			return true
+		}
 
-	if foundPath != "" {
 		fileType := "file"
-		if info, _ := os.Stat(foundPath); info != nil && info.IsDir() {
+		if entry.IsDir {
 			fileType = "directory"
 		}
+		matches = append(matches, FileMatch{
+			Path:    entry.Path,
+			Type:    fileType,
+			Score:   score,
+			Size:    entry.Size,
+			ModTime: entry.ModTime,
+		})
+		// Keep memory bounded when a short term matches almost everything
+		if len(matches) >= 8*limit {
+			trim()
+		}
+		return true
+	})
+
+	if err := ctx.Err(); err != nil {
+		return FileSearchResult{Found: false}, err
+	}
 
+	trim()
+	if len(matches) > 0 {
 		return FileSearchResult{
-			Path:  foundPath,
-			Type:  fileType,
-			Found: true,
+			Results: matches,
+			Filters: query.Filters,
+			Found:   true,
 		}, nil
 	}
 
-	return FileSearchResult{Found: false}, fmt.Errorf("file not found")
+	if fs.index.Building() {
+		return FileSearchResult{Found: false, Filters: query.Filters}, fmt.Errorf("file not found (the file index is still being built)")
+	}
+	return FileSearchResult{Found: false, Filters: query.Filters}, fmt.Errorf("file not found")
+}
+
+// scoreEntry fuzzy-matches every term against the entry. A term matching the
+// file name counts double, and exact names (ignoring the extension) win.
+func scoreEntry(entry *IndexEntry, terms []string) (int, bool) {
+	name := entry.lowerName()
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+
+	score := 0
+	for _, term := range terms {
+		if s := fuzzyScore(name, term); s >= 0 {
+			score += 2 * s
+			if name == term || stem == term {
+				score += 100
+			}
+		} else if s := fuzzyScore(entry.lowerPath, term); s >= 0 {
+			score += s
+		} else {
+			return 0, false
+		}
+	}
+	return score, true
 }
 
 // AutoComplete returns matching file paths for partial input
@@ -189,348 +338,50 @@ func (fs *FileSearchService) GetPathSuggestions(input string, forceFromStart boo
 	}, nil
 }
 
-func extractSearchTerms(query string) []string {
-	commonWords := map[string]bool{
-		"where": true, "is": true, "my": true, "the": true, "a": true,
-		"find": true, "search": true, "for": true, "file": true,
-	}
-
-	words := strings.Fields(strings.ToLower(query))
-	var terms []string
-
-	for _, word := range words {
-		if !commonWords[word] && len(word) > 2 {
-			terms = append(terms, word)
-		}
-	}
-
-	return terms
-}
-
-// OrganizerService handles file organization with kondo
-type OrganizerService struct{}
-
-func NewOrganizerService() *OrganizerService {
-	return &OrganizerService{}
-}
-
-func (o *OrganizerService) Organize(query, mode string) (OrganizerResult, error) {
-	path := extractPath(query)
-	homeDir, _ := os.UserHomeDir()
-	if path == "" {
-		path = "."
-	}
-
-	if strings.HasPrefix(path, "~") {
-		path = filepath.Join(homeDir, path[1:])
-	}
-
-	var cmd *exec.Cmd
-	if mode == "filename" {
-		cmd = exec.Command("kondo", "-f", "-nui", path)
-		cmd.Env = append(os.Environ(), "PATH="+os.Getenv("PATH")+":"+filepath.Join(homeDir, ".local/bin"))
-	} else {
-		cmd = exec.Command("kondo", "-c", "-nui", path)
-		cmd.Env = append(os.Environ(), "PATH="+os.Getenv("PATH")+":"+filepath.Join(homeDir, ".local/bin"))
-	}
-
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return OrganizerResult{
-			Output:  string(output),
-			Success: false,
-		}, err
-	}
-
-	return OrganizerResult{
-		Output:  string(output),
-		Success: true,
-	}, nil
-}
-
-// GetPathSuggestions for organizer - always shows path suggestions
-func (o *OrganizerService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
-	fs := NewFileSearchService()
-	return fs.GetPathSuggestions(input, true)
-}
-
-// LinterService handles linting and formatting
-type LinterService struct{}
-
-func NewLinterService() *LinterService {
-	return &LinterService{}
-}
-
-func (ls *LinterService) LintFormat(query string) (LinterResult, error) {
-	filePath := extractPath(query)
-	if filePath == "" {
-		return LinterResult{}, fmt.Errorf("no file path found in query")
-	}
-
-	ext := strings.ToLower(filepath.Ext(filePath))
-
-	var cmd *exec.Cmd
-	switch ext {
-	case ".py":
-		cmd = exec.Command("black", filePath)
-	case ".go":
-		cmd = exec.Command("gofmt", "-w", filePath)
-	case ".sh":
-		cmd = exec.Command("shfmt", "-w", filePath)
-	case ".js", ".ts", ".jsx", ".tsx":
-		cmd = exec.Command("prettier", "--write", filePath)
-	default:
-		return LinterResult{}, fmt.Errorf("unsupported file type: %s", ext)
-	}
-
-	output, err := cmd.CombinedOutput()
-
-	return LinterResult{
-		Output:   string(output),
-		Fixed:    err == nil,
-		FilePath: filePath,
-	}, err
-}
-
-// GetPathSuggestions for linter - always shows path suggestions
-func (ls *LinterService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
-	fs := NewFileSearchService()
-	result, err := fs.GetPathSuggestions(input, true)
-
-	if err != nil {
-		return result, err
-	}
-
-	// Filter to only show supported file types
-	supportedExts := map[string]bool{
-		".py": true, ".go": true, ".sh": true,
-		".js": true, ".ts": true, ".jsx": true, ".tsx": true,
-	}
-
+// Helper functions
+func filterSuggestions(suggestions []string, filter PathFilter) []string {
 	var filtered []string
-	for _, path := range result.Suggestions {
-		ext := strings.ToLower(filepath.Ext(path))
-		// Include directories (for navigation) and supported files
-		if strings.HasSuffix(path, "/") || supportedExts[ext] {
+	for _, path := range suggestions {
+		// Include directories (for navigation) and accepted files
+		if strings.HasSuffix(path, "/") || filter.AcceptsPath(path) {
 			filtered = append(filtered, path)
 		}
 	}
-
-	result.Suggestions = filtered
-	return result, nil
+	return filtered
 }
 
-// OCRService handles OCR with tesseract and grim
-type OCRService struct {
-	scriptPath string
-}
-
-func NewOCRService() *OCRService {
-	homeDir, _ := os.UserHomeDir()
-	scriptPath := filepath.Join(homeDir, ".config/hecate/scripts/ocr-capture.sh")
-	if _, err := os.Stat(scriptPath); err == nil {
-		return &OCRService{scriptPath: scriptPath}
-	}
-	return &OCRService{}
-}
-
-func (ocr *OCRService) ExtractText() (OCRResult, error) {
-	var output []byte
-	var err error
-
-	if ocr.scriptPath != "" {
-		cmd := exec.Command(ocr.scriptPath, "-au")
-		output, err = cmd.CombinedOutput()
-	} else {
-		scriptPath := "/tmp/ocr_capture.sh"
-		script := `#!/bin/bash
-set -e
-TMPFILE="/tmp/ocr_screenshot_$(date +%s).png"
-LANG="eng"
-AUTO_MODE=false
-
-while [[ $# -gt 0 ]]; do
-    case $1 in
-        -au|--auto)
-            AUTO_MODE=true
-            shift
-            ;;
-        *)
-            shift
-            ;;
-    esac
-done
-
-if [ "$AUTO_MODE" = false ]; then
-    echo "Select area to capture..." >&2
-fi
-
-if ! grim -g "$(slurp)" "$TMPFILE" 2>/dev/null; then
-    echo "Screenshot cancelled or failed" >&2
-    exit 1
-fi
-
-if [ "$AUTO_MODE" = false ]; then
-    echo "Running OCR..." >&2
-fi
-
-OCR_OUTPUT=$(tesseract "$TMPFILE" stdout -l "$LANG" 2>/dev/null)
-rm -f "$TMPFILE"
-
-if [ -z "$OCR_OUTPUT" ]; then
-    echo "No text detected" >&2
-    exit 1
-fi
-
-echo "$OCR_OUTPUT"
-exit 0
-`
-
-		if writeErr := os.WriteFile(scriptPath, []byte(script), 0755); writeErr != nil {
-			return OCRResult{Success: false}, fmt.Errorf("failed to create OCR script: %w", writeErr)
+func extractPath(query string) string {
+	words := strings.Fields(query)
+	for _, word := range words {
+		if isExtensionWord(word) {
+			continue
 		}
-
-		cmd := exec.Command("bash", scriptPath, "-au")
-		output, err = cmd.CombinedOutput()
-
-		os.Remove(scriptPath)
-	}
-
-	if err != nil {
-		return OCRResult{
-			Text:    string(output),
-			Success: false,
-		}, fmt.Errorf("OCR failed: %w", err)
-	}
-
-	return OCRResult{
-		Text:    strings.TrimSpace(string(output)),
-		Success: true,
-	}, nil
-}
-
-// ExtractTextFromFile performs OCR on an uploaded image file
-func (ocr *OCRService) ExtractTextFromFile(imagePath string) (OCRResult, error) {
-	if _, err := os.Stat(imagePath); os.IsNotExist(err) {
-		return OCRResult{Success: false}, fmt.Errorf("image file not found: %s", imagePath)
-	}
-
-	cmd := exec.Command("tesseract", imagePath, "stdout")
-	output, err := cmd.CombinedOutput()
-
-	if err != nil {
-		return OCRResult{
-			Text:    string(output),
-			Success: false,
-		}, fmt.Errorf("OCR failed: %w", err)
-	}
-
-	return OCRResult{
-		Text:    strings.TrimSpace(string(output)),
-		Success: true,
-	}, nil
-}
-
-// GetPathSuggestions for OCR file upload - shows image files
-func (ocr *OCRService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
-	fs := NewFileSearchService()
-	result, err := fs.GetPathSuggestions(input, true)
-
-	if err != nil {
-		return result, err
-	}
-
-	// Filter to only show image files
-	imageExts := map[string]bool{
-		".png": true, ".jpg": true, ".jpeg": true,
-		".bmp": true, ".tiff": true, ".tif": true,
-		".gif": true, ".webp": true,
-	}
-
-	var filtered []string
-	for _, path := range result.Suggestions {
-		ext := strings.ToLower(filepath.Ext(path))
-		// Include directories (for navigation) and image files
-		if strings.HasSuffix(path, "/") || imageExts[ext] {
-			filtered = append(filtered, path)
+		if strings.Contains(word, "/") || strings.Contains(word, ".") {
+			return word
 		}
 	}
-
-	result.Suggestions = filtered
-	return result, nil
-}
-
-// ConverterService handles file conversion with ffmpeg
-type ConverterService struct{}
-
-func NewConverterService() *ConverterService {
-	return &ConverterService{}
-}
-
-func (cs *ConverterService) Convert(query string) (ConverterResult, error) {
-	inputPath := extractPath(query)
-	if inputPath == "" {
-		return ConverterResult{}, fmt.Errorf("no input file found")
-	}
-
-	targetFormat := extractFormat(query)
-	if targetFormat == "" {
-		return ConverterResult{}, fmt.Errorf("no target format specified")
-	}
-
-	outputPath := strings.TrimSuffix(inputPath, filepath.Ext(inputPath)) + "." + targetFormat
-
-	cmd := exec.Command("ffmpeg", "-i", inputPath, outputPath)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		return ConverterResult{Success: false}, fmt.Errorf("conversion failed: %s", string(output))
-	}
-
-	return ConverterResult{
-		OutputPath: outputPath,
-		Success:    true,
-	}, nil
+	return ""
 }
 
-// GetPathSuggestions for converter - shows media files
-func (cs *ConverterService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
-	fs := NewFileSearchService()
-	result, err := fs.GetPathSuggestions(input, true)
-
-	if err != nil {
-		return result, err
-	}
-
-	// Filter to only show media files
-	mediaExts := map[string]bool{
-		".mp4": true, ".webm": true, ".avi": true, ".mkv": true, ".mov": true,
-		".mp3": true, ".wav": true, ".flac": true, ".ogg": true, ".m4a": true,
-		".png": true, ".jpg": true, ".jpeg": true, ".gif": true, ".webp": true,
-	}
-
-	var filtered []string
-	for _, path := range result.Suggestions {
-		ext := strings.ToLower(filepath.Ext(path))
-		// Include directories (for navigation) and media files
-		if strings.HasSuffix(path, "/") || mediaExts[ext] {
-			filtered = append(filtered, path)
+// withoutPaths drops the words extractPath would take for a path, so the
+// words of a file name are not read as part of the request
+func withoutPaths(query string) string {
+	var words []string
+	for _, word := range strings.Fields(query) {
+		if isExtensionWord(word) || !strings.Contains(word, "/") && !strings.Contains(word, ".") {
+			words = append(words, word)
 		}
 	}
-
-	result.Suggestions = filtered
-	return result, nil
+	return strings.Join(words, " ")
 }
 
-
-// Helper functions
-func extractPath(query string) string {
-	words := strings.Fields(query)
-	for _, word := range words {
-		if strings.Contains(word, "/") || strings.Contains(word, ".") {
-			return word
-		}
+// isExtensionWord reports whether word names a file type, as in "all .mov"
+func isExtensionWord(word string) bool {
+	ext, ok := strings.CutPrefix(strings.ToLower(word), ".")
+	if !ok {
+		return false
 	}
-	return ""
+	return knownExtensions[ext] || knownExtensions[strings.TrimSuffix(ext, "s")]
 }
 
 func extractPathFromInput(input string) string {
@@ -552,13 +403,36 @@ func extractPathFromInput(input string) string {
 }
 
 func extractFormat(query string) string {
-	formats := []string{"mp4", "webm", "mp3", "wav", "png", "jpg", "jpeg", "gif"}
+	formats := []string{
+		"mp4", "webm", "mkv", "mov", "avi", "gif",
+		"mp3", "wav", "flac", "ogg", "opus", "m4a",
+		"png", "jpg", "jpeg", "webp",
+	}
 	lowerQuery := strings.ToLower(query)
 
-	for _, format := range formats {
-		if strings.Contains(lowerQuery, format) {
-			return format
+	// The extension of the input file is not the target format
+	if path := extractPath(query); path != "" {
+		lowerQuery = strings.Replace(lowerQuery, strings.ToLower(path), " ", 1)
+	}
+
+	// "convert all mov to mp4": the format after "to" wins over the rest
+	found := ""
+	prev := ""
+	for _, word := range strings.FieldsFunc(lowerQuery, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		for _, format := range formats {
+			if word != format {
+				continue
+			}
+			if prev == "to" || prev == "into" || prev == "as" {
+				return format
+			}
+			if found == "" {
+				found = format
+			}
 		}
+		prev = word
 	}
-	return ""
+	return found
 }
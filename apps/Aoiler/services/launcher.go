@@ -0,0 +1,442 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/BurntSushi/toml"
+)
+
+// LauncherApp is an application, or one of its actions, offered for a query
+type LauncherApp struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// Action is the ID of a desktop action, such as new-private-window
+	Action     string `json:"action,omitempty"`
+	ActionName string `json:"actionName,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+	Icon       string `json:"icon,omitempty"`
+	Launches   int    `json:"launches"`
+	Score      int    `json:"score"`
+}
+
+// LauncherResult is the application launched for a query and the other
+// applications that matched
+type LauncherResult struct {
+	Query    string        `json:"query"`
+	Launched *LauncherApp  `json:"launched,omitempty"`
+	Command  string        `json:"command,omitempty"`
+	Matches  []LauncherApp `json:"matches"`
+	Success  bool          `json:"success"`
+}
+
+// launchRecord counts how often an application or action was launched
+type launchRecord struct {
+	Count int       `json:"count"`
+	Last  time.Time `json:"last"`
+}
+
+// launcherVerbs introduce a launch, as in "launch firefox" or "open files"
+var launcherVerbs = regexp.MustCompile(`(?i)^(?:launch|open|start|run)\s+(?:the\s+)?(?:app(?:lication)?\s+)?`)
+
+// LauncherService starts applications from their .desktop files through
+// Hyprland. Applications are ranked by how well their names, generic names,
+// keywords and commands match, plus how often they were launched recently.
+type LauncherService struct {
+	mu         sync.Mutex
+	entries    []DesktopEntry
+	dirStamps  map[string]time.Time
+	history    map[string]launchRecord
+	loaded     bool
+	terminal   string
+	maxResults int
+}
+
+func NewLauncherService() *LauncherService {
+	cfg := DefaultConfig().Services.Launcher
+	return &LauncherService{terminal: cfg.Terminal, maxResults: cfg.MaxResults}
+}
+
+// ApplyConfig sets the terminal for Terminal=true applications and the
+// number of matches listed
+func (ls *LauncherService) ApplyConfig(cfg Config) {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.terminal = cfg.Services.Launcher.Terminal
+	ls.maxResults = cfg.Services.Launcher.MaxResults
+}
+
+func (ls *LauncherService) Name() string        { return "launcher" }
+func (ls *LauncherService) Description() string { return "Launch desktop applications" }
+
+func (ls *LauncherService) Keywords() []string {
+	return []string{"launch"}
+}
+
+// MatchesQuery claims the exact name or command of an application
+// ("firefox"), or a launch verb followed by something that matches an
+// application well. It runs on every keystroke, so it looks at the entries
+// already loaded instead of checking the application directories.
+func (ls *LauncherService) MatchesQuery(query string) bool {
+	term, verb := launcherTerm(query)
+	if term == "" {
+		return false
+	}
+	if !verb && len(strings.Fields(term)) > 3 {
+		return false
+	}
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if ls.dirStamps == nil {
+		ls.refresh()
+	}
+	for _, entry := range ls.entries {
+		if verb {
+			if score, _ := entryScore(entry, term); score >= 12*len(term) {
+				return true
+			}
+		} else if namesEntry(entry, term) {
+			return true
+		}
+	}
+	return false
+}
+
+// HasSideEffects reports true: every call starts a program
+func (ls *LauncherService) HasSideEffects(intent Intent) bool { return true }
+
+func (ls *LauncherService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	term, _ := launcherTerm(intent.Query)
+	if term == "" {
+		return nil, fmt.Errorf("which application should be launched?")
+	}
+
+	matches := ls.Search(term)
+	if len(matches) == 0 {
+		return nil, fmt.Errorf("no application matches %q", term)
+	}
+
+	launched, command, err := ls.Launch(ctx, matches[0].ID, matches[0].Action)
+	if err != nil {
+		return nil, err
+	}
+	return LauncherResult{
+		Query:    intent.Query,
+		Launched: &launched,
+		Command:  command,
+		Matches:  matches,
+		Success:  true,
+	}, nil
+}
+
+// launcherTerm strips a launch verb from the query. verb reports whether
+// there was one.
+func launcherTerm(query string) (term string, verb bool) {
+	query = strings.TrimSpace(query)
+	term = launcherVerbs.ReplaceAllString(query, "")
+	return strings.ToLower(strings.TrimSpace(term)), term != query
+}
+
+// namesEntry reports whether term is the name or command of the entry, or
+// the full name of one of its actions
+func namesEntry(entry DesktopEntry, term string) bool {
+	candidates := append([]string{filepath.Base(entry.commandName())}, entry.names...)
+	for _, action := range entry.Actions {
+		candidates = append(candidates, entry.Name+" "+action.Name)
+	}
+	for _, candidate := range candidates {
+		if strings.ToLower(candidate) == term {
+			return true
+		}
+	}
+	return false
+}
+
+// Search ranks the applications and actions matching term
+func (ls *LauncherService) Search(term string) []LauncherApp {
+	term = strings.ToLower(strings.TrimSpace(term))
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.refresh()
+
+	var matches []LauncherApp
+	for _, entry := range ls.entries {
+		score, actionIndex := entryScore(entry, term)
+		if score < 0 {
+			continue
+		}
+		app := LauncherApp{ID: entry.ID, Name: entry.Name, Comment: entry.Comment, Icon: entry.Icon}
+		if actionIndex >= 0 {
+			action := entry.Actions[actionIndex]
+			app.Action, app.ActionName = action.ID, action.Name
+			app.Icon = firstNonEmpty(action.Icon, entry.Icon)
+		}
+		record := ls.history[historyKey(app.ID, app.Action)]
+		app.Launches = record.Count
+		app.Score = score + frecencyBonus(record, time.Now())
+		matches = append(matches, app)
+	}
+
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].Name < matches[j].Name
+	})
+	if len(matches) > ls.maxResults && ls.maxResults > 0 {
+		matches = matches[:ls.maxResults]
+	}
+	return matches
+}
+
+// entryScore scores how well term matches an entry, or -1. actionIndex is
+// the action that matched better than the application itself, or -1.
+func entryScore(entry DesktopEntry, term string) (score, actionIndex int) {
+	best := -1
+	for _, name := range entry.names {
+		lower := strings.ToLower(name)
+		s := fuzzyScore(lower, term)
+		if s < 0 {
+			continue
+		}
+		switch {
+		case lower == term:
+			s += 50
+		case strings.HasPrefix(lower, term):
+			s += 25
+		}
+		best = max(best, s)
+	}
+
+	// Other texts count for less than the name
+	others := append([]string{entry.GenericName, filepath.Base(entry.commandName())}, entry.Keywords...)
+	for _, text := range others {
+		if s := fuzzyScore(strings.ToLower(text), term); s >= 0 {
+			best = max(best, s*3/4)
+		}
+	}
+
+	actionIndex = -1
+	for i, action := range entry.Actions {
+		s := fuzzyScore(strings.ToLower(entry.Name+" "+action.Name), term)
+		// Ties go to the application, so "firefox" does not open a private window
+		if s > best {
+			best, actionIndex = s, i
+		}
+	}
+	return best, actionIndex
+}
+
+// frecencyBonus favors applications launched often and recently
+func frecencyBonus(record launchRecord, now time.Time) int {
+	if record.Count == 0 {
+		return 0
+	}
+	weight := 0.25
+	switch age := now.Sub(record.Last); {
+	case age < 4*24*time.Hour:
+		weight = 1
+	case age < 14*24*time.Hour:
+		weight = 0.7
+	case age < 60*24*time.Hour:
+		weight = 0.5
+	}
+	return int(12 * math.Log2(1+float64(record.Count)) * weight)
+}
+
+// Launch starts an application, or one of its actions, and records the
+// launch for ranking. It returns the shell command that was run.
+func (ls *LauncherService) Launch(ctx context.Context, id, action string) (LauncherApp, string, error) {
+	ls.mu.Lock()
+	ls.refresh()
+	var entry *DesktopEntry
+	for i := range ls.entries {
+		if ls.entries[i].ID == id {
+			entry = &ls.entries[i]
+			break
+		}
+	}
+	terminal := ls.terminal
+	ls.mu.Unlock()
+	if entry == nil {
+		return LauncherApp{}, "", fmt.Errorf("application not found: %s", id)
+	}
+
+	app := LauncherApp{ID: entry.ID, Name: entry.Name, Comment: entry.Comment, Icon: entry.Icon}
+	execLine := entry.exec
+	if action != "" {
+		found := false
+		for _, a := range entry.Actions {
+			if a.ID == action {
+				app.Action, app.ActionName, execLine = a.ID, a.Name, a.exec
+				app.Icon = firstNonEmpty(a.Icon, entry.Icon)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return app, "", fmt.Errorf("%s has no action %q", entry.Name, action)
+		}
+	}
+
+	args, err := entry.execArgs(execLine, app.Icon)
+	if err != nil {
+		return app, "", err
+	}
+	if entry.terminal {
+		args = append([]string{launcherTerminal(terminal), "-e"}, args...)
+	}
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	command := strings.Join(quoted, " ")
+	if entry.workDir != "" {
+		command = "cd " + shellQuote(expandHome(entry.workDir)) + " && " + command
+	}
+
+	if err := runDetached(ctx, command); err != nil {
+		return app, command, fmt.Errorf("failed to launch %s: %w", app.Name, err)
+	}
+
+	ls.mu.Lock()
+	key := historyKey(app.ID, app.Action)
+	record := ls.history[key]
+	record.Count++
+	record.Last = time.Now()
+	ls.history[key] = record
+	app.Launches = record.Count
+	err = ls.saveHistory()
+	ls.mu.Unlock()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+	}
+	return app, command, nil
+}
+
+// runDetached hands command to Hyprland, so the application belongs to the
+// compositor rather than to Aoiler. Outside Hyprland it is started in its
+// own session instead.
+func runDetached(ctx context.Context, command string) error {
+	if checkHyprland() == nil {
+		return hyprDispatch(ctx, "exec", command)
+	}
+
+	cmd := exec.Command("/bin/sh", "-c", command)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	go cmd.Wait()
+	return nil
+}
+
+// launcherTerminal picks the terminal for Terminal=true applications: the
+// configured one, Hecate's preferred terminal, $TERMINAL, or kitty
+func launcherTerminal(configured string) string {
+	if configured != "" {
+		return configured
+	}
+	homeDir, _ := os.UserHomeDir()
+	var hecate struct {
+		Preferences struct {
+			Term string `toml:"term"`
+		} `toml:"preferences"`
+	}
+	if _, err := toml.DecodeFile(filepath.Join(homeDir, ".config", "hecate", "hecate.toml"), &hecate); err == nil && hecate.Preferences.Term != "" {
+		return hecate.Preferences.Term
+	}
+	return firstNonEmpty(os.Getenv("TERMINAL"), "kitty")
+}
+
+// commandName returns the program an entry runs
+func (e DesktopEntry) commandName() string {
+	words, err := splitExec(e.exec)
+	if err != nil || len(words) == 0 {
+		return ""
+	}
+	return words[0]
+}
+
+func historyKey(id, action string) string {
+	if action == "" {
+		return id
+	}
+	return id + "#" + action
+}
+
+// refresh rescans the application directories when one of them changed.
+// Callers hold ls.mu.
+func (ls *LauncherService) refresh() {
+	if !ls.loaded {
+		ls.loadHistory()
+		ls.loaded = true
+	}
+
+	dirs := applicationDirs()
+	stamps := make(map[string]time.Time, len(dirs))
+	for _, dir := range dirs {
+		if info, err := os.Stat(dir); err == nil {
+			stamps[dir] = info.ModTime()
+		}
+	}
+	if ls.dirStamps != nil && sameStamps(stamps, ls.dirStamps) {
+		return
+	}
+	ls.entries = loadDesktopEntries(dirs, desktopLocales())
+	ls.dirStamps = stamps
+}
+
+func sameStamps(a, b map[string]time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for dir, stamp := range a {
+		if !b[dir].Equal(stamp) {
+			return false
+		}
+	}
+	return true
+}
+
+func launcherHistoryPath() string {
+	return filepath.Join(dataDir(), "launcher-history.json")
+}
+
+func (ls *LauncherService) loadHistory() {
+	ls.history = make(map[string]launchRecord)
+	data, err := os.ReadFile(launcherHistoryPath())
+	if err != nil {
+		if !os.IsNotExist(err) {
+			fmt.Fprintf(os.Stderr, "aoiler: failed to read launch history: %v\n", err)
+		}
+		return
+	}
+	if err := json.Unmarshal(data, &ls.history); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: failed to parse %s: %v\n", launcherHistoryPath(), err)
+		ls.history = make(map[string]launchRecord)
+	}
+}
+
+func (ls *LauncherService) saveHistory() error {
+	data, err := json.MarshalIndent(ls.history, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode launch history: %w", err)
+	}
+	if err := writeFileAtomic(launcherHistoryPath(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save launch history: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,87 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// launcherFixture points the application directories at a temporary one
+// and returns it
+func launcherFixture(t *testing.T) string {
+	t.Helper()
+	dataHome := t.TempDir()
+	t.Setenv("XDG_DATA_HOME", dataHome)
+	t.Setenv("XDG_DATA_DIRS", t.TempDir())
+	dir := filepath.Join(dataHome, "applications")
+	if err := os.Mkdir(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+func writeDesktopFile(t *testing.T, dir, id, content string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(dir, id+".desktop"), []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLauncherMatchesQuery(t *testing.T) {
+	dir := launcherFixture(t)
+	writeDesktopFile(t, dir, "firefox", `[Desktop Entry]
+Type=Application
+Name=Firefox
+GenericName=Web Browser
+Keywords=internet;www;
+Exec=firefox %u
+Actions=new-private-window;
+
+[Desktop Action new-private-window]
+Name=Private Window
+Exec=firefox --private-window %u
+`)
+	writeDesktopFile(t, dir, "yelp", `[Desktop Entry]
+Type=Application
+Name=Help
+Keywords=documentation;manual;
+Exec=yelp %u
+`)
+
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"firefox", true},
+		{"Firefox", true},
+		{"yelp", true},
+		{"firefox private window", true},
+		{"launch firefox", true},
+		{"open help", true},
+		{"open fire", true},
+		{"fire", false},
+		{"internet", false},
+		{"manual", false},
+		{"firefox private", false},
+		{"help me write a letter", false},
+	}
+	ls := NewLauncherService()
+	for _, tt := range tests {
+		if got := ls.MatchesQuery(tt.query); got != tt.want {
+			t.Errorf("MatchesQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+
+	// Classification keeps to the applications already loaded; a search
+	// picks up new ones
+	writeDesktopFile(t, dir, "kitty", "[Desktop Entry]\nType=Application\nName=kitty\nExec=kitty\n")
+	if ls.MatchesQuery("kitty") {
+		t.Error("MatchesQuery rescanned the application directories")
+	}
+	if matches := ls.Search("kitty"); len(matches) == 0 || matches[0].ID != "kitty.desktop" {
+		t.Errorf("Search(kitty) = %+v, want kitty.desktop first", matches)
+	}
+	if !ls.MatchesQuery("kitty") {
+		t.Error("MatchesQuery(kitty) = false after the search loaded it")
+	}
+}
@@ -0,0 +1,517 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// LinterTool maps file patterns to the commands that format and lint them.
+// "{file}" in a command is replaced with the path of the file.
+type LinterTool struct {
+	Name string `toml:"name" json:"name"`
+	// Patterns are extensions such as ".rs" or globs matched against the
+	// file name, such as "hyprland.conf"; a glob with a slash is matched
+	// against the end of the path, such as "hypr/*.conf"
+	Patterns []string `toml:"patterns" json:"patterns"`
+	// Format rewrites the file in place
+	Format []string `toml:"format,omitempty" json:"format,omitempty"`
+	// Stdin means Format reads the file on stdin and writes the result to
+	// stdout instead of editing it
+	Stdin bool `toml:"stdin,omitempty" json:"stdin,omitempty"`
+	// Lint reports problems without changing the file
+	Lint []string `toml:"lint,omitempty" json:"lint,omitempty"`
+	// Disabled turns off a default tool of the same name
+	Disabled bool `toml:"disabled,omitempty" json:"disabled,omitempty"`
+}
+
+// LinterToolStatus describes a tool and whether its commands are installed
+type LinterToolStatus struct {
+	LinterTool
+	FormatInstalled bool `json:"formatInstalled"`
+	LintInstalled   bool `json:"lintInstalled"`
+}
+
+// Diagnostic is a problem reported by a lint pass
+type Diagnostic struct {
+	File    string `json:"file"`
+	Line    int    `json:"line"`
+	Column  int    `json:"column,omitempty"`
+	Message string `json:"message"`
+}
+
+// Linter modes
+const (
+	LintModeFormat  = "format"
+	LintModeLint    = "lint"
+	LintModePreview = "preview"
+	LintModeApply   = "apply"
+	LintModeRevert  = "revert"
+)
+
+// builtinHyprland names the Go formatter and checker for Hyprland configs
+const builtinHyprland = "builtin:hyprland"
+
+// defaultLinterTools are used unless the config disables or replaces them
+func defaultLinterTools() []LinterTool {
+	return []LinterTool{
+		{Name: "python", Patterns: []string{".py"},
+			Format: []string{"black", "-q", "{file}"},
+			Lint:   []string{"ruff", "check", "--output-format=concise", "{file}"}},
+		{Name: "go", Patterns: []string{".go"},
+			Format: []string{"gofmt", "-w", "{file}"},
+			Lint:   []string{"go", "vet", "{file}"}},
+		{Name: "shell", Patterns: []string{".sh", ".bash"},
+			Format: []string{"shfmt", "-w", "{file}"},
+			Lint:   []string{"shellcheck", "-f", "gcc", "{file}"}},
+		{Name: "rust", Patterns: []string{".rs"},
+			Format: []string{"rustfmt", "--edition", "2021"},
+			Stdin:  true,
+			Lint:   []string{"rustfmt", "--check", "--edition", "2021", "{file}"}},
+		{Name: "lua", Patterns: []string{".lua"},
+			Format: []string{"stylua", "{file}"},
+			Lint:   []string{"luacheck", "--formatter", "plain", "--codes", "{file}"}},
+		{Name: "c", Patterns: []string{".c", ".h", ".cc", ".cpp", ".cxx", ".hpp"},
+			Format: []string{"clang-format", "-i", "{file}"},
+			Lint:   []string{"clang-format", "--dry-run", "{file}"}},
+		{Name: "toml", Patterns: []string{".toml"},
+			Format: []string{"taplo", "fmt", "{file}"},
+			Lint:   []string{"taplo", "lint", "{file}"}},
+		{Name: "yaml", Patterns: []string{".yaml", ".yml"},
+			Format: []string{"yamlfmt", "{file}"},
+			Lint:   []string{"yamllint", "-f", "parsable", "{file}"}},
+		{Name: "json", Patterns: []string{".json"},
+			Format: []string{"jq", "--indent", "2", "."},
+			Stdin:  true,
+			Lint:   []string{"jq", "empty", "{file}"}},
+		{Name: "hyprland", Patterns: []string{"hyprland.conf", "hypr/*.conf"},
+			Format: []string{builtinHyprland},
+			Lint:   []string{builtinHyprland}},
+		{Name: "prettier", Patterns: []string{".js", ".ts", ".jsx", ".tsx", ".css", ".scss", ".html"},
+			Format: []string{"prettier", "--write", "{file}"}},
+	}
+}
+
+// mergeLinterTools puts the configured tools ahead of the defaults so they
+// take precedence for the same files. A configured tool named like a
+// default replaces it; later configs override earlier ones.
+func mergeLinterTools(defaults []LinterTool, configured ...[]LinterTool) []LinterTool {
+	var custom []LinterTool
+	index := make(map[string]int)
+	for _, tools := range configured {
+		for _, tool := range tools {
+			if i, ok := index[tool.Name]; ok {
+				custom[i] = tool
+				continue
+			}
+			index[tool.Name] = len(custom)
+			custom = append(custom, tool)
+		}
+	}
+
+	merged := custom
+	for _, tool := range defaults {
+		if _, ok := index[tool.Name]; !ok {
+			merged = append(merged, tool)
+		}
+	}
+	return merged
+}
+
+// Matches reports whether the tool handles path
+func (t LinterTool) Matches(path string) bool {
+	lowerPath := strings.ToLower(filepath.ToSlash(path))
+	name := lowerPath[strings.LastIndex(lowerPath, "/")+1:]
+
+	for _, pattern := range t.Patterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case strings.HasPrefix(pattern, ".") && !strings.ContainsAny(pattern, "*?["):
+			if strings.HasSuffix(name, pattern) {
+				return true
+			}
+		case strings.Contains(pattern, "/"):
+			depth := strings.Count(pattern, "/") + 1
+			parts := strings.Split(lowerPath, "/")
+			if len(parts) >= depth {
+				if ok, _ := filepath.Match(pattern, strings.Join(parts[len(parts)-depth:], "/")); ok {
+					return true
+				}
+			}
+		default:
+			if ok, _ := filepath.Match(pattern, name); ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// commandInstalled reports whether the program a command runs is on PATH
+func commandInstalled(command []string) bool {
+	if len(command) == 0 {
+		return false
+	}
+	if strings.HasPrefix(command[0], "builtin:") {
+		return true
+	}
+	_, err := exec.LookPath(command[0])
+	return err == nil
+}
+
+// LinterService handles linting and formatting
+type LinterService struct {
+	mu    sync.RWMutex
+	tools []LinterTool
+	// previews are formatted files waiting to be applied, by ID
+	previews map[string]*formatPreview
+}
+
+func NewLinterService() *LinterService {
+	return &LinterService{
+		tools:    defaultLinterTools(),
+		previews: make(map[string]*formatPreview),
+	}
+}
+
+// ApplyConfig merges the tools from aoiler.toml and linters.toml with the defaults
+func (ls *LinterService) ApplyConfig(cfg Config) {
+	tools := mergeLinterTools(defaultLinterTools(), cfg.Services.Linter.Tools, cfg.Services.Linter.fileTools)
+
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	ls.tools = tools
+}
+
+func (ls *LinterService) Name() string        { return "linter" }
+func (ls *LinterService) Description() string { return "Lint and format code files" }
+
+func (ls *LinterService) Keywords() []string {
+	return []string{"lint", "format", "check code", "fix code"}
+}
+
+func (ls *LinterService) Params() map[string]string {
+	return map[string]string{
+		ParamPath: "source file to format or lint",
+		ParamMode: `"format" to rewrite the file, "preview" to show the changes as a diff first, "apply" or "revert" for the last preview or formatting, or "lint" to only report problems`,
+	}
+}
+
+// HasSideEffects reports whether the intent rewrites the file rather than
+// linting it or previewing the changes
+func (ls *LinterService) HasSideEffects(intent Intent) bool {
+	mode := ls.mode(intent)
+	return mode != LintModeLint && mode != LintModePreview
+}
+
+func (ls *LinterService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	path := intent.Params[ParamPath]
+	switch ls.mode(intent) {
+	case LintModeLint:
+		return ls.Lint(ctx, path)
+	case LintModePreview:
+		return ls.Preview(ctx, path)
+	case LintModeApply:
+		return ls.ApplyFormat(ls.latestPreview(expandHome(path)))
+	case LintModeRevert:
+		backupID, err := latestFormatBackup(expandHome(path))
+		if err != nil {
+			return LinterResult{}, err
+		}
+		return ls.RevertFormat(backupID)
+	}
+	return ls.LintFormat(ctx, path)
+}
+
+// mode returns the mode given in the intent's params, or else the one its
+// query asks for
+func (ls *LinterService) mode(intent Intent) string {
+	switch mode := intent.Params[ParamMode]; mode {
+	case LintModeFormat, LintModeLint, LintModePreview, LintModeApply, LintModeRevert:
+		return mode
+	}
+	return lintModeOf(intent.Query)
+}
+
+// lintModeOf reads whether a query asks to format or only to check a file.
+// Paths are left out, so "lint undo_stack.go" does not revert anything.
+func lintModeOf(query string) string {
+	lowerQuery := strings.ToLower(withoutPaths(query))
+	modes := []struct {
+		mode  string
+		words []string
+	}{
+		{LintModeRevert, []string{"undo", "revert", "restore"}},
+		{LintModeApply, []string{"apply"}},
+		{LintModePreview, []string{"preview", "dry", "diff", "would"}},
+		{LintModeFormat, []string{"format", "formatting", "fix", "prettify", "reformat"}},
+		{LintModeLint, []string{"lint", "linting", "check", "diagnose"}},
+	}
+	for _, m := range modes {
+		for _, word := range m.words {
+			if containsWholeWord(lowerQuery, word) {
+				return m.mode
+			}
+		}
+	}
+	return LintModeFormat
+}
+
+// Tools lists the formatters and linters in the order they are tried,
+// with whether each one is installed
+func (ls *LinterService) Tools() []LinterToolStatus {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+
+	status := make([]LinterToolStatus, 0, len(ls.tools))
+	for _, tool := range ls.tools {
+		status = append(status, LinterToolStatus{
+			LinterTool:      tool,
+			FormatInstalled: commandInstalled(tool.Format),
+			LintInstalled:   commandInstalled(tool.Lint),
+		})
+	}
+	return status
+}
+
+// toolFor returns the first enabled tool that handles path
+func (ls *LinterService) toolFor(path string) (LinterTool, bool) {
+	ls.mu.RLock()
+	defer ls.mu.RUnlock()
+	for _, tool := range ls.tools {
+		if !tool.Disabled && tool.Matches(path) {
+			return tool, true
+		}
+	}
+	return LinterTool{}, false
+}
+
+// AcceptsPath reports whether the linter has a formatter for the file
+func (ls *LinterService) AcceptsPath(path string) bool {
+	_, ok := ls.toolFor(path)
+	return ok
+}
+
+// LintFormat formats the file in place with the tool configured for it.
+// The original is kept so the change can be reverted.
+func (ls *LinterService) LintFormat(ctx context.Context, filePath string) (LinterResult, error) {
+	preview, err := ls.Preview(ctx, filePath)
+	if err != nil {
+		return preview, err
+	}
+	if !preview.Changed {
+		preview.Mode = LintModeFormat
+		preview.Fixed = true
+		return preview, nil
+	}
+
+	result, err := ls.ApplyFormat(preview.PreviewID)
+	result.Mode = LintModeFormat
+	result.Output = preview.Output
+	return result, err
+}
+
+// Lint runs the lint command configured for the file and parses what it
+// reports into diagnostics. Finding problems is not an error.
+func (ls *LinterService) Lint(ctx context.Context, filePath string) (LinterResult, error) {
+	tool, filePath, err := ls.resolve(filePath)
+	if err != nil {
+		return LinterResult{}, err
+	}
+	if len(tool.Lint) == 0 {
+		return LinterResult{}, fmt.Errorf("%s has no linter configured", tool.Name)
+	}
+	if !commandInstalled(tool.Lint) {
+		return LinterResult{}, fmt.Errorf("%s is not installed (needed to lint %s files)", tool.Lint[0], tool.Name)
+	}
+
+	result := LinterResult{FilePath: filePath, Tool: tool.Name, Mode: LintModeLint}
+
+	if tool.Lint[0] == builtinHyprland {
+		src, err := os.ReadFile(filePath)
+		if err != nil {
+			return LinterResult{}, fmt.Errorf("failed to read %s: %w", filePath, err)
+		}
+		result.Diagnostics = lintHyprlandConf(filePath, src)
+		return result, nil
+	}
+
+	cmd := commandContext(ctx, tool.Lint[0], expandFileArgs(tool.Lint[1:], filePath)...)
+	output, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return LinterResult{}, ctx.Err()
+	}
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return LinterResult{}, fmt.Errorf("failed to run %s: %w", tool.Lint[0], err)
+	}
+
+	// Linters exit non-zero when they find something
+	result.Output = string(output)
+	result.Diagnostics = parseDiagnostics(result.Output, filePath)
+	return result, nil
+}
+
+// resolve expands the path and finds the tool for it
+func (ls *LinterService) resolve(filePath string) (LinterTool, string, error) {
+	if filePath == "" {
+		return LinterTool{}, "", fmt.Errorf("no file path found in query")
+	}
+	filePath = expandHome(filePath)
+	tool, ok := ls.toolFor(filePath)
+	if !ok {
+		return LinterTool{}, "", fmt.Errorf("unsupported file type: %s", filepath.Base(filePath))
+	}
+	return tool, filePath, nil
+}
+
+// runFormatter returns src as the tool formats it, without touching
+// filePath. Tools that edit in place work on a copy next to the file so
+// they still find the project's settings.
+func runFormatter(ctx context.Context, tool LinterTool, filePath string, src []byte) ([]byte, string, error) {
+	if tool.Format[0] == builtinHyprland {
+		return formatHyprlandConf(src), "", nil
+	}
+
+	if tool.Stdin {
+		cmd := commandContext(ctx, tool.Format[0], expandFileArgs(tool.Format[1:], filePath)...)
+		cmd.Stdin = bytes.NewReader(src)
+		var stdout, stderr bytes.Buffer
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+		if err := cmd.Run(); err != nil {
+			return nil, stderr.String(), fmt.Errorf("%s failed: %w", tool.Format[0], err)
+		}
+		return stdout.Bytes(), stderr.String(), nil
+	}
+
+	copyPath, err := writeFormatCopy(filePath, src)
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.Remove(copyPath)
+
+	cmd := commandContext(ctx, tool.Format[0], expandFileArgs(tool.Format[1:], copyPath)...)
+	output, err := cmd.CombinedOutput()
+	// Messages about the copy are about the file
+	message := strings.ReplaceAll(string(output), copyPath, filePath)
+	if err != nil {
+		return nil, message, fmt.Errorf("%s failed: %w", tool.Format[0], err)
+	}
+
+	formatted, err := os.ReadFile(copyPath)
+	if err != nil {
+		return nil, message, fmt.Errorf("failed to read formatted copy: %w", err)
+	}
+	return formatted, message, nil
+}
+
+// writeFormatCopy writes src to a hidden file beside filePath with the same
+// extension, or to the temp directory when that folder is read-only
+func writeFormatCopy(filePath string, src []byte) (string, error) {
+	ext := filepath.Ext(filePath)
+	pattern := "." + strings.TrimSuffix(filepath.Base(filePath), ext) + ".aoiler-*" + ext
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), pattern)
+	if err != nil {
+		tmp, err = os.CreateTemp("", pattern)
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to create a copy to format: %w", err)
+	}
+	if _, err := tmp.Write(src); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", fmt.Errorf("failed to create a copy to format: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return tmp.Name(), nil
+}
+
+// expandFileArgs replaces {file} in args with path
+func expandFileArgs(args []string, path string) []string {
+	expanded := make([]string, len(args))
+	for i, arg := range args {
+		expanded[i] = strings.ReplaceAll(arg, "{file}", path)
+	}
+	return expanded
+}
+
+// writeFilePreservingMode replaces the content of an existing file without
+// changing its permissions. Symlinked dotfiles keep their link.
+func writeFilePreservingMode(path string, data []byte) error {
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		path = target
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(path, data, info.Mode().Perm()); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
+
+// Diagnostic formats understood by parseDiagnostics
+var (
+	// file:line:col: message, as printed by go vet, ruff, shellcheck -f gcc,
+	// clang-format, luacheck and yamllint -f parsable
+	gccDiagnostic = regexp.MustCompile(`(\S+?):(\d+):(?:(\d+):)?\s*(.+)`)
+	// "... at line 3, column 5", as printed by jq and rustfmt --check
+	atLineDiagnostic = regexp.MustCompile(`(?i)\bat line (\d+)(?:, column (\d+))?`)
+)
+
+// parseDiagnostics extracts file:line:message entries from linter output.
+// Lines that name no position are left in the raw output only.
+func parseDiagnostics(output, filePath string) []Diagnostic {
+	var diagnostics []Diagnostic
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		if m := gccDiagnostic.FindStringSubmatch(line); m != nil {
+			file := m[1]
+			if file == "<stdin>" || file == "-" {
+				file = filePath
+			}
+			lineNo, _ := strconv.Atoi(m[2])
+			column, _ := strconv.Atoi(m[3])
+			diagnostics = append(diagnostics, Diagnostic{File: file, Line: lineNo, Column: column, Message: m[4]})
+			continue
+		}
+		if m := atLineDiagnostic.FindStringSubmatch(line); m != nil {
+			lineNo, _ := strconv.Atoi(m[1])
+			column, _ := strconv.Atoi(m[2])
+			diagnostics = append(diagnostics, Diagnostic{File: filePath, Line: lineNo, Column: column, Message: line})
+		}
+	}
+	return diagnostics
+}
+
+// GetPathSuggestions for linter - always shows path suggestions
+func (ls *LinterService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
+	fs := NewFileSearchService()
+	result, err := fs.GetPathSuggestions(input, true)
+
+	if err != nil {
+		return result, err
+	}
+
+	// Filter to only show supported file types
+	result.Suggestions = filterSuggestions(result.Suggestions, ls)
+	return result, nil
+}
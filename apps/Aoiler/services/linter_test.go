@@ -0,0 +1,34 @@
+package services
+
+import "testing"
+
+func TestLintModeOf(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"format main.go", LintModeFormat},
+		{"lint main.go", LintModeLint},
+		{"check ~/scripts/deploy.sh", LintModeLint},
+		{"preview formatting of app.py", LintModePreview},
+		{"format main.go as a dry run", LintModePreview},
+		{"show the diff for main.go", LintModePreview},
+		{"apply the formatting", LintModeApply},
+		{"undo the formatting of main.go", LintModeRevert},
+		{"restore ~/notes.md", LintModeRevert},
+		// Words inside a path or a longer word choose nothing
+		{"lint undo_stack.go", LintModeLint},
+		{"format ~/scripts/restore.py", LintModeFormat},
+		{"format apply_patch.sh", LintModeFormat},
+		{"format ~/src/diff.go", LintModeFormat},
+		{"lint ./preview/checker.go", LintModeLint},
+		{"check applications.py", LintModeLint},
+		{"prettify restored.json", LintModeFormat},
+		{"main.go", LintModeFormat},
+	}
+	for _, tt := range tests {
+		if got := lintModeOf(tt.query); got != tt.want {
+			t.Errorf("lintModeOf(%q) = %s, want %s", tt.query, got, tt.want)
+		}
+	}
+}
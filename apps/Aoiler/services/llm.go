@@ -1,50 +1,155 @@
 package services
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
 	"os"
 	"strings"
+	"sync"
 	"time"
 )
 
 // LLMProvider represents different LLM providers
 type LLMProvider string
 type LLMResult struct {
-	Response string `json:"response"`
-	Success  bool   `json:"success"`
-	Provider string `json:"provider,omitempty"`
+	Response  string `json:"response"`
+	Success   bool   `json:"success"`
+	Provider  string `json:"provider,omitempty"`
+	SessionID string `json:"sessionId,omitempty"`
+	// ToolCalls are the services the model ran while answering
+	ToolCalls []ToolCallRecord `json:"toolCalls,omitempty"`
+
+	// calls are the tools the model asked for in this response
+	calls []ToolCall
 }
+
 const (
 	ProviderOpenAI  LLMProvider = "openai"
 	ProviderClaude  LLMProvider = "claude"
 	ProviderGemini  LLMProvider = "gemini"
+	ProviderLocal   LLMProvider = "local"
+	ProviderOllama  LLMProvider = "ollama"
 	ProviderDefault LLMProvider = "default"
 )
 
+// allProviders lists the supported providers in their default priority
+var allProviders = []LLMProvider{ProviderOpenAI, ProviderClaude, ProviderGemini, ProviderLocal, ProviderOllama}
+
+// defaultModels are used when neither aoiler.toml nor the environment names a
+// model. Self-hosted providers have no sensible default.
+var defaultModels = map[LLMProvider]string{
+	ProviderOpenAI: "gpt-4o-mini",
+	ProviderClaude: "claude-3-5-sonnet-20241022",
+	ProviderGemini: "gemini-1.5-flash",
+}
+
+var defaultBaseURLs = map[LLMProvider]string{
+	ProviderOpenAI: "https://api.openai.com/v1",
+	ProviderClaude: "https://api.anthropic.com/v1",
+	ProviderGemini: "https://generativelanguage.googleapis.com/v1beta",
+}
+
+// providerEnv names the environment variables that override aoiler.toml
+var providerEnv = map[LLMProvider]struct{ key, model, baseURL string }{
+	ProviderOpenAI: {key: "OPENAI_API_KEY"},
+	ProviderClaude: {key: "CLAUDE_API_KEY"},
+	ProviderGemini: {key: "GEMINI_API_KEY"},
+	ProviderLocal:  {key: "AOILER_LOCAL_API_KEY", model: "AOILER_LOCAL_MODEL", baseURL: "AOILER_LOCAL_BASE_URL"},
+	ProviderOllama: {model: "OLLAMA_MODEL", baseURL: "OLLAMA_HOST"},
+}
+
 // LLMService handles LLM API queries
 type LLMService struct {
-	provider       LLMProvider
-	openAIKey      string
-	claudeKey      string
-	geminiKey      string
-	httpClient     *http.Client
-	defaultModel   map[LLMProvider]string
+	mu           sync.RWMutex
+	provider     LLMProvider
+	priority     []LLMProvider
+	apiKey       map[LLMProvider]string
+	defaultModel map[LLMProvider]string
+	baseURL      map[LLMProvider]string
+	maxTokens    int
+	temperature  *float64
+	systemPrompt string
+	useTools     bool
+	httpClient   *http.Client
+	sessions     *SessionStore
+	toolbox      *Toolbox
+}
+
+// providerSettings is a snapshot of everything one request needs, taken
+// when the request starts so a config reload cannot change it mid-stream
+type providerSettings struct {
+	provider     LLMProvider
+	baseURL      string
+	apiKey       string
+	model        string
+	maxTokens    int
+	temperature  *float64
+	systemPrompt string
+	useTools     bool
+	client       *http.Client
 }
 
 // OpenAI API structures
 type OpenAIRequest struct {
-	Model    string          `json:"model"`
-	Messages []OpenAIMessage `json:"messages"`
-	Stream   bool            `json:"stream"`
+	Model       string          `json:"model"`
+	Messages    []OpenAIMessage `json:"messages"`
+	Stream      bool            `json:"stream"`
+	MaxTokens   int             `json:"max_tokens,omitempty"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	Tools       []OpenAITool    `json:"tools,omitempty"`
 }
 
 type OpenAIMessage struct {
 	Role    string `json:"role"`
 	Content string `json:"content"`
+	// ToolCalls are made by the assistant; ToolCallID marks the answer to one
+	ToolCalls  []OpenAIToolCall `json:"tool_calls,omitempty"`
+	ToolCallID string           `json:"tool_call_id,omitempty"`
+}
+
+type OpenAITool struct {
+	Type     string         `json:"type"`
+	Function OpenAIFunction `json:"function"`
+}
+
+type OpenAIFunction struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type OpenAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name string `json:"name"`
+		// Arguments is a JSON object encoded as a string
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+// OpenAIStreamChunk is a single server-sent event of a streamed completion
+type OpenAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+			// ToolCalls arrive in pieces; Index says which call a piece extends
+			ToolCalls []struct {
+				Index    int    `json:"index"`
+				ID       string `json:"id"`
+				Function struct {
+					Name      string `json:"name"`
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+	} `json:"choices"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
 }
 
 type OpenAIResponse struct {
@@ -59,14 +164,37 @@ type OpenAIResponse struct {
 
 // Claude API structures
 type ClaudeRequest struct {
-	Model     string          `json:"model"`
-	Messages  []ClaudeMessage `json:"messages"`
-	MaxTokens int             `json:"max_tokens"`
+	Model       string          `json:"model"`
+	System      string          `json:"system,omitempty"`
+	Messages    []ClaudeMessage `json:"messages"`
+	MaxTokens   int             `json:"max_tokens"`
+	Temperature *float64        `json:"temperature,omitempty"`
+	Stream      bool            `json:"stream,omitempty"`
+	Tools       []ClaudeTool    `json:"tools,omitempty"`
 }
 
 type ClaudeMessage struct {
-	Role    string `json:"role"`
-	Content string `json:"content"`
+	Role string `json:"role"`
+	// Content is a string, or a []ClaudeContentBlock for tool use
+	Content interface{} `json:"content"`
+}
+
+type ClaudeTool struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	InputSchema interface{} `json:"input_schema"`
+}
+
+// ClaudeContentBlock is a text, tool_use or tool_result block
+type ClaudeContentBlock struct {
+	Type      string      `json:"type"`
+	Text      string      `json:"text,omitempty"`
+	ID        string      `json:"id,omitempty"`
+	Name      string      `json:"name,omitempty"`
+	Input     interface{} `json:"input,omitempty"`
+	ToolUseID string      `json:"tool_use_id,omitempty"`
+	Content   string      `json:"content,omitempty"`
+	IsError   bool        `json:"is_error,omitempty"`
 }
 
 type ClaudeResponse struct {
@@ -79,17 +207,71 @@ type ClaudeResponse struct {
 	} `json:"error,omitempty"`
 }
 
+// ClaudeStreamEvent is a single message-stream event. Only the fields of
+// content_block_start, content_block_delta and error events are decoded.
+type ClaudeStreamEvent struct {
+	Type  string `json:"type"`
+	Index int    `json:"index"`
+	// ContentBlock starts a block; tool_use blocks carry the tool to call
+	ContentBlock struct {
+		Type string `json:"type"`
+		ID   string `json:"id"`
+		Name string `json:"name"`
+	} `json:"content_block"`
+	Delta struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+		// PartialJSON is a piece of the input of a tool_use block
+		PartialJSON string `json:"partial_json"`
+	} `json:"delta"`
+	Error *struct {
+		Message string `json:"message"`
+		Type    string `json:"type"`
+	} `json:"error,omitempty"`
+}
+
 // Gemini API structures
 type GeminiRequest struct {
-	Contents []GeminiContent `json:"contents"`
+	SystemInstruction *GeminiContent          `json:"systemInstruction,omitempty"`
+	Contents          []GeminiContent         `json:"contents"`
+	GenerationConfig  *GeminiGenerationConfig `json:"generationConfig,omitempty"`
+	Tools             []GeminiTool            `json:"tools,omitempty"`
+}
+
+type GeminiGenerationConfig struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
 }
 
 type GeminiContent struct {
+	Role  string       `json:"role,omitempty"`
 	Parts []GeminiPart `json:"parts"`
 }
 
 type GeminiPart struct {
-	Text string `json:"text"`
+	Text             string                  `json:"text,omitempty"`
+	FunctionCall     *GeminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *GeminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+type GeminiTool struct {
+	FunctionDeclarations []GeminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+type GeminiFunctionDeclaration struct {
+	Name        string      `json:"name"`
+	Description string      `json:"description,omitempty"`
+	Parameters  interface{} `json:"parameters,omitempty"`
+}
+
+type GeminiFunctionCall struct {
+	Name string                 `json:"name"`
+	Args map[string]interface{} `json:"args"`
+}
+
+type GeminiFunctionResponse struct {
+	Name     string                 `json:"name"`
+	Response map[string]interface{} `json:"response"`
 }
 
 type GeminiResponse struct {
@@ -101,187 +283,378 @@ type GeminiResponse struct {
 	Error *struct {
 		Message string `json:"message"`
 		Code    int    `json:"code"`
+		Status  string `json:"status"`
 	} `json:"error,omitempty"`
 }
 
-// NewLLMService creates a new LLM service
-func NewLLMService() *LLMService {
-	service := &LLMService{
-		openAIKey: os.Getenv("OPENAI_API_KEY"),
-		claudeKey: os.Getenv("CLAUDE_API_KEY"),
-		geminiKey: os.Getenv("GEMINI_API_KEY"),
-		httpClient: &http.Client{
-			Timeout: 60 * time.Second,
-		},
-		defaultModel: map[LLMProvider]string{
-			ProviderOpenAI: "gpt-4o-mini",
-			ProviderClaude: "claude-3-5-sonnet-20241022",
-			ProviderGemini: "gemini-1.5-flash",
-		},
+// NewLLMService creates a new LLM service that keeps conversations in sessions
+func NewLLMService(sessions *SessionStore) *LLMService {
+	service := &LLMService{sessions: sessions}
+	service.ApplyConfig(DefaultConfig())
+	return service
+}
+
+// ApplyConfig replaces the provider settings with those from cfg. Environment
+// variables win over the file so keys exported in a shell keep working.
+func (llm *LLMService) ApplyConfig(cfg Config) {
+	apiKey := make(map[LLMProvider]string)
+	models := make(map[LLMProvider]string)
+	baseURLs := make(map[LLMProvider]string)
+
+	for _, provider := range allProviders {
+		file := cfg.LLM.Providers[string(provider)]
+		env := providerEnv[provider]
+
+		apiKey[provider] = firstNonEmpty(getenv(env.key), file.APIKey)
+		models[provider] = firstNonEmpty(getenv(env.model), file.Model, defaultModels[provider])
+		baseURLs[provider] = firstNonEmpty(getenv(env.baseURL), file.BaseURL, defaultBaseURLs[provider])
 	}
 
-	// Determine which provider to use based on available keys
-	service.provider = service.detectProvider()
+	var priority []LLMProvider
+	for _, name := range cfg.LLM.Priority {
+		priority = append(priority, LLMProvider(name))
+	}
+	if len(priority) == 0 {
+		priority = allProviders
+	}
 
-	return service
+	maxTokens := cfg.LLM.MaxTokens
+	if maxTokens <= 0 {
+		maxTokens = 4096
+	}
+	timeout := time.Duration(cfg.LLM.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = 60 * time.Second
+	}
+
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+
+	llm.apiKey = apiKey
+	llm.defaultModel = models
+	llm.baseURL = baseURLs
+	llm.priority = priority
+	llm.maxTokens = maxTokens
+	llm.temperature = cfg.LLM.Temperature
+	llm.systemPrompt = strings.TrimSpace(cfg.LLM.SystemPrompt)
+	llm.useTools = cfg.LLM.Tools
+	llm.httpClient = newStreamingClient(timeout)
+
+	// Determine which provider to use based on the configured priority
+	llm.provider = llm.detectProvider()
 }
 
-// detectProvider determines which provider to use based on available API keys
+func (llm *LLMService) Name() string        { return "llm" }
+func (llm *LLMService) Description() string { return "Query LLM for assistance" }
+
+// Keywords is empty: the LLM is reached as the registry fallback
+func (llm *LLMService) Keywords() []string { return nil }
+
+func (llm *LLMService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	return llm.Chat(ctx, intent.SessionID, intent.Query)
+}
+
+// detectProvider returns the first configured provider in priority order.
+// Callers must hold llm.mu.
 func (llm *LLMService) detectProvider() LLMProvider {
-	// Priority: OpenAI > Claude > Gemini
-	if llm.openAIKey != "" {
-		return ProviderOpenAI
+	for _, provider := range llm.priority {
+		if llm.isConfigured(provider) {
+			return provider
+		}
 	}
-	if llm.claudeKey != "" {
-		return ProviderClaude
+	return ProviderDefault
+}
+
+// isConfigured reports whether a provider can be used. Cloud providers need
+// an API key; self-hosted ones need a server address and a model name.
+// Callers must hold llm.mu.
+func (llm *LLMService) isConfigured(provider LLMProvider) bool {
+	switch provider {
+	case ProviderOpenAI, ProviderClaude, ProviderGemini:
+		return llm.apiKey[provider] != ""
+	case ProviderLocal:
+		return llm.baseURL[ProviderLocal] != "" && llm.defaultModel[ProviderLocal] != ""
+	case ProviderOllama:
+		// The server address defaults to localhost, so only the model is required
+		return llm.defaultModel[ProviderOllama] != ""
+	}
+	return false
+}
+
+// Query sends a single, context-free query to the configured LLM provider
+func (llm *LLMService) Query(ctx context.Context, query string) (LLMResult, error) {
+	return llm.complete(ctx, []ChatMessage{{Role: RoleUser, Content: query}})
+}
+
+// Chat continues the session with the given ID, or starts a new one when the
+// ID is empty. The whole history is replayed to the provider and the turn is
+// persisted once the provider answers.
+func (llm *LLMService) Chat(ctx context.Context, sessionID, query string) (LLMResult, error) {
+	var session *ChatSession
+	if sessionID != "" {
+		loaded, err := llm.sessions.Load(sessionID)
+		if err != nil {
+			return LLMResult{Success: false}, err
+		}
+		session = loaded
+	} else {
+		session = llm.sessions.NewSession(query)
 	}
-	if llm.geminiKey != "" {
-		return ProviderGemini
+
+	history := append(session.Messages, ChatMessage{
+		Role:      RoleUser,
+		Content:   query,
+		Timestamp: time.Now(),
+	})
+
+	result, err := llm.completeWithTools(ctx, history)
+	result.SessionID = session.ID
+	if err != nil || !result.Success {
+		// Unanswered turns are not saved so the history keeps alternating
+		return result, err
 	}
-	return ProviderDefault
+
+	session.Messages = append(history, ChatMessage{
+		Role:      RoleAssistant,
+		Content:   result.Response,
+		Provider:  result.Provider,
+		Timestamp: time.Now(),
+	})
+	session.UpdatedAt = time.Now()
+
+	if err := llm.sessions.Save(session); err != nil {
+		return result, err
+	}
+	return result, nil
 }
 
-// Query sends a query to the configured LLM provider
-func (llm *LLMService) Query(query string) (LLMResult, error) {
-	if llm.provider == ProviderDefault {
+// complete sends the conversation to the configured LLM provider. The response
+// is streamed: every chunk is emitted as a token event for the request
+// attached to ctx, and the full text is returned once the stream ends.
+func (llm *LLMService) complete(ctx context.Context, messages []ChatMessage) (LLMResult, error) {
+	p := llm.settings()
+
+	if p.provider == ProviderDefault {
 		return LLMResult{
-			Response: "No LLM API key configured. Please set one of:\n- OPENAI_API_KEY\n- CLAUDE_API_KEY\n- GEMINI_API_KEY",
+			Response: "No LLM provider configured. Please set one of:\n- OPENAI_API_KEY\n- CLAUDE_API_KEY\n- GEMINI_API_KEY\n- AOILER_LOCAL_BASE_URL and AOILER_LOCAL_MODEL\n- OLLAMA_MODEL",
 			Success:  false,
 		}, nil
 	}
 
-	switch llm.provider {
+	return llm.send(ctx, p, conversation{messages: messages})
+}
+
+// send streams one response to the conversation from the provider in p
+func (llm *LLMService) send(ctx context.Context, p providerSettings, conv conversation) (LLMResult, error) {
+	var result LLMResult
+	var err error
+
+	switch p.provider {
 	case ProviderOpenAI:
-		return llm.queryOpenAI(query)
+		result, err = llm.queryOpenAICompatible(ctx, "OpenAI", p, conv)
 	case ProviderClaude:
-		return llm.queryClaude(query)
+		result, err = llm.queryClaude(ctx, p, conv)
 	case ProviderGemini:
-		return llm.queryGemini(query)
+		result, err = llm.queryGemini(ctx, p, conv)
+	case ProviderLocal:
+		result, err = llm.queryOpenAICompatible(ctx, "Local", p, conv)
+	case ProviderOllama:
+		result, err = llm.queryOllama(ctx, p, conv.messages)
 	default:
 		return LLMResult{
 			Response: "Unknown provider",
 			Success:  false,
-		}, fmt.Errorf("unknown provider: %s", llm.provider)
+		}, fmt.Errorf("unknown provider: %s", p.provider)
 	}
+
+	result.Provider = string(p.provider)
+	return result, err
 }
 
-// queryOpenAI sends a query to OpenAI API
-func (llm *LLMService) queryOpenAI(query string) (LLMResult, error) {
-	url := "https://api.openai.com/v1/chat/completions"
+// settings snapshots the configuration of the active provider
+func (llm *LLMService) settings() providerSettings {
+	llm.mu.RLock()
+	defer llm.mu.RUnlock()
+	return llm.settingsFor(llm.provider)
+}
 
-	reqBody := OpenAIRequest{
-		Model: llm.defaultModel[ProviderOpenAI],
-		Messages: []OpenAIMessage{
-			{
-				Role:    "user",
-				Content: query,
-			},
-		},
-		Stream: false,
+// settingsFor snapshots the configuration of a provider. Callers must hold llm.mu.
+func (llm *LLMService) settingsFor(provider LLMProvider) providerSettings {
+	return providerSettings{
+		provider:     provider,
+		baseURL:      strings.TrimSuffix(llm.baseURL[provider], "/"),
+		apiKey:       llm.apiKey[provider],
+		model:        llm.defaultModel[provider],
+		maxTokens:    llm.maxTokens,
+		temperature:  llm.temperature,
+		systemPrompt: llm.systemPrompt,
+		useTools:     llm.useTools,
+		client:       llm.httpClient,
 	}
+}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to marshal request: %w", err)
-	}
+// queryOpenAICompatible streams a query from any server implementing the
+// OpenAI chat completions API (OpenAI itself, llama.cpp, vLLM, LM Studio, ...).
+// label names the provider in error messages.
+func (llm *LLMService) queryOpenAICompatible(ctx context.Context, label string, p providerSettings, conv conversation) (LLMResult, error) {
+	url := p.baseURL + "/chat/completions"
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to create request: %w", err)
+	reqBody := OpenAIRequest{
+		Model:       p.model,
+		Messages:    toOpenAIConversation(p.systemPrompt, conv),
+		Stream:      true,
+		MaxTokens:   p.maxTokens,
+		Temperature: p.temperature,
+		Tools:       toOpenAITools(conv.tools),
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+llm.openAIKey)
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
 
-	resp, err := llm.httpClient.Do(req)
+	resp, err := sendLLMRequest(ctx, p, label, "POST", url, headers, reqBody)
 	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("request failed: %w", err)
+		return LLMResult{Success: false}, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var text strings.Builder
+	var apiErr error
+	var calls []*streamedCall
+
+	err = readSSE(resp.Body, func(event, data string) error {
+		if data == "[DONE]" {
+			return errStreamDone
+		}
+
+		var chunk OpenAIStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != nil {
+			apiErr = streamError(p, label, chunk.Error.Type, chunk.Error.Message)
+			return errStreamDone
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content != "" {
+				text.WriteString(choice.Delta.Content)
+				Emit(ctx, EventToken, choice.Delta.Content)
+			}
+			for _, piece := range choice.Delta.ToolCalls {
+				for len(calls) <= piece.Index {
+					calls = append(calls, &streamedCall{})
+				}
+				call := calls[piece.Index]
+				call.id += piece.ID
+				call.name += piece.Function.Name
+				call.arguments.WriteString(piece.Function.Arguments)
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return LLMResult{Success: false}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var openAIResp OpenAIResponse
-	if err := json.Unmarshal(body, &openAIResp); err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to parse response: %w", err)
+	if apiErr != nil {
+		return LLMResult{Success: false}, apiErr
 	}
 
-	if openAIResp.Error != nil {
-		return LLMResult{
-			Response: fmt.Sprintf("OpenAI Error: %s", openAIResp.Error.Message),
-			Success:  false,
-		}, nil
+	toolCalls, err := finishStreamedCalls(calls)
+	if err != nil {
+		return LLMResult{Success: false}, err
 	}
-
-	if len(openAIResp.Choices) == 0 {
+	if text.Len() == 0 && len(toolCalls) == 0 {
 		return LLMResult{
-			Response: "No response from OpenAI",
+			Response: fmt.Sprintf("No response from %s", label),
 			Success:  false,
 		}, nil
 	}
 
 	return LLMResult{
-		Response: strings.TrimSpace(openAIResp.Choices[0].Message.Content),
+		Response: strings.TrimSpace(text.String()),
 		Success:  true,
+		calls:    toolCalls,
 	}, nil
 }
 
-// queryClaude sends a query to Claude API
-func (llm *LLMService) queryClaude(query string) (LLMResult, error) {
-	url := "https://api.anthropic.com/v1/messages"
+// queryClaude streams a query from the Claude messages API
+func (llm *LLMService) queryClaude(ctx context.Context, p providerSettings, conv conversation) (LLMResult, error) {
+	url := p.baseURL + "/messages"
 
 	reqBody := ClaudeRequest{
-		Model: llm.defaultModel[ProviderClaude],
-		Messages: []ClaudeMessage{
-			{
-				Role:    "user",
-				Content: query,
-			},
-		},
-		MaxTokens: 4096,
+		Model:       p.model,
+		System:      p.systemPrompt,
+		Messages:    toClaudeConversation(conv),
+		MaxTokens:   p.maxTokens,
+		Temperature: p.temperature,
+		Stream:      true,
+		Tools:       toClaudeTools(conv.tools),
 	}
 
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to marshal request: %w", err)
+	headers := map[string]string{
+		"x-api-key":         p.apiKey,
+		"anthropic-version": "2023-06-01",
 	}
 
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	resp, err := sendLLMRequest(ctx, p, "Claude", "POST", url, headers, reqBody)
 	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to create request: %w", err)
+		return LLMResult{Success: false}, err
 	}
+	defer resp.Body.Close()
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("x-api-key", llm.claudeKey)
-	req.Header.Set("anthropic-version", "2023-06-01")
+	var text strings.Builder
+	var apiErr error
+	var calls []*streamedCall
+	// blocks maps the index of each tool_use block to its call
+	blocks := make(map[int]*streamedCall)
 
-	resp, err := llm.httpClient.Do(req)
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("request failed: %w", err)
-	}
-	defer resp.Body.Close()
+	err = readSSE(resp.Body, func(event, data string) error {
+		var streamEvent ClaudeStreamEvent
+		if err := json.Unmarshal([]byte(data), &streamEvent); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
 
-	body, err := io.ReadAll(resp.Body)
+		switch streamEvent.Type {
+		case "content_block_start":
+			if streamEvent.ContentBlock.Type == "tool_use" {
+				call := &streamedCall{id: streamEvent.ContentBlock.ID, name: streamEvent.ContentBlock.Name}
+				blocks[streamEvent.Index] = call
+				calls = append(calls, call)
+			}
+		case "content_block_delta":
+			if streamEvent.Delta.Text != "" {
+				text.WriteString(streamEvent.Delta.Text)
+				Emit(ctx, EventToken, streamEvent.Delta.Text)
+			}
+			if call, ok := blocks[streamEvent.Index]; ok {
+				call.arguments.WriteString(streamEvent.Delta.PartialJSON)
+			}
+		case "message_stop":
+			return errStreamDone
+		case "error":
+			if streamEvent.Error != nil {
+				apiErr = streamError(p, "Claude", streamEvent.Error.Type, streamEvent.Error.Message)
+			}
+			return errStreamDone
+		}
+		return nil
+	})
 	if err != nil {
 		return LLMResult{Success: false}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var claudeResp ClaudeResponse
-	if err := json.Unmarshal(body, &claudeResp); err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to parse response: %w", err)
+	if apiErr != nil {
+		return LLMResult{Success: false}, apiErr
 	}
 
-	if claudeResp.Error != nil {
-		return LLMResult{
-			Response: fmt.Sprintf("Claude Error: %s", claudeResp.Error.Message),
-			Success:  false,
-		}, nil
+	toolCalls, err := finishStreamedCalls(calls)
+	if err != nil {
+		return LLMResult{Success: false}, err
 	}
-
-	if len(claudeResp.Content) == 0 {
+	if text.Len() == 0 && len(toolCalls) == 0 {
 		return LLMResult{
 			Response: "No response from Claude",
 			Success:  false,
@@ -289,63 +662,78 @@ func (llm *LLMService) queryClaude(query string) (LLMResult, error) {
 	}
 
 	return LLMResult{
-		Response: strings.TrimSpace(claudeResp.Content[0].Text),
+		Response: strings.TrimSpace(text.String()),
 		Success:  true,
+		calls:    toolCalls,
 	}, nil
 }
 
-// queryGemini sends a query to Gemini API
-func (llm *LLMService) queryGemini(query string) (LLMResult, error) {
-	model := llm.defaultModel[ProviderGemini]
-	url := fmt.Sprintf("https://generativelanguage.googleapis.com/v1beta/models/%s:generateContent?key=%s",
-		model, llm.geminiKey)
+// queryGemini streams a query from the Gemini streamGenerateContent API
+func (llm *LLMService) queryGemini(ctx context.Context, p providerSettings, conv conversation) (LLMResult, error) {
+	url := fmt.Sprintf("%s/models/%s:streamGenerateContent?alt=sse", p.baseURL, p.model)
 
 	reqBody := GeminiRequest{
-		Contents: []GeminiContent{
-			{
-				Parts: []GeminiPart{
-					{Text: query},
-				},
-			},
+		Contents: toGeminiConversation(conv),
+		Tools:    toGeminiTools(conv.tools),
+		GenerationConfig: &GeminiGenerationConfig{
+			Temperature:     p.temperature,
+			MaxOutputTokens: p.maxTokens,
 		},
 	}
-
-	jsonData, err := json.Marshal(reqBody)
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to marshal request: %w", err)
-	}
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
-	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to create request: %w", err)
+	if p.systemPrompt != "" {
+		reqBody.SystemInstruction = &GeminiContent{Parts: []GeminiPart{{Text: p.systemPrompt}}}
 	}
 
-	req.Header.Set("Content-Type", "application/json")
+	// The key goes in a header so it does not end up in logs as part of the URL
+	headers := map[string]string{"x-goog-api-key": p.apiKey}
 
-	resp, err := llm.httpClient.Do(req)
+	resp, err := sendLLMRequest(ctx, p, "Gemini", "POST", url, headers, reqBody)
 	if err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("request failed: %w", err)
+		return LLMResult{Success: false}, err
 	}
 	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	var text strings.Builder
+	var apiErr error
+	var toolCalls []ToolCall
+
+	err = readSSE(resp.Body, func(event, data string) error {
+		var chunk GeminiResponse
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != nil {
+			apiErr = streamError(p, "Gemini", chunk.Error.Status, chunk.Error.Message)
+			return errStreamDone
+		}
+
+		for _, candidate := range chunk.Candidates {
+			for _, part := range candidate.Content.Parts {
+				if part.Text != "" {
+					text.WriteString(part.Text)
+					Emit(ctx, EventToken, part.Text)
+				}
+				// Function calls arrive whole; Gemini does not give them IDs
+				if part.FunctionCall != nil {
+					toolCalls = append(toolCalls, ToolCall{
+						ID:        NewRequestID(),
+						Name:      part.FunctionCall.Name,
+						Arguments: part.FunctionCall.Args,
+					})
+				}
+			}
+		}
+		return nil
+	})
 	if err != nil {
 		return LLMResult{Success: false}, fmt.Errorf("failed to read response: %w", err)
 	}
 
-	var geminiResp GeminiResponse
-	if err := json.Unmarshal(body, &geminiResp); err != nil {
-		return LLMResult{Success: false}, fmt.Errorf("failed to parse response: %w", err)
-	}
-
-	if geminiResp.Error != nil {
-		return LLMResult{
-			Response: fmt.Sprintf("Gemini Error: %s", geminiResp.Error.Message),
-			Success:  false,
-		}, nil
+	if apiErr != nil {
+		return LLMResult{Success: false}, apiErr
 	}
 
-	if len(geminiResp.Candidates) == 0 || len(geminiResp.Candidates[0].Content.Parts) == 0 {
+	if text.Len() == 0 && len(toolCalls) == 0 {
 		return LLMResult{
 			Response: "No response from Gemini",
 			Success:  false,
@@ -353,31 +741,91 @@ func (llm *LLMService) queryGemini(query string) (LLMResult, error) {
 	}
 
 	return LLMResult{
-		Response: strings.TrimSpace(geminiResp.Candidates[0].Content.Parts[0].Text),
+		Response: strings.TrimSpace(text.String()),
 		Success:  true,
+		calls:    toolCalls,
 	}, nil
 }
 
+// toOpenAIMessages converts a conversation to OpenAI chat messages, led by
+// the system prompt when one is configured
+func toOpenAIMessages(systemPrompt string, messages []ChatMessage) []OpenAIMessage {
+	converted := make([]OpenAIMessage, 0, len(messages)+1)
+	if systemPrompt != "" {
+		converted = append(converted, OpenAIMessage{Role: "system", Content: systemPrompt})
+	}
+	for _, msg := range messages {
+		converted = append(converted, OpenAIMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return converted
+}
+
+// toClaudeMessages converts a conversation to Claude messages
+func toClaudeMessages(messages []ChatMessage) []ClaudeMessage {
+	converted := make([]ClaudeMessage, 0, len(messages))
+	for _, msg := range messages {
+		converted = append(converted, ClaudeMessage{Role: msg.Role, Content: msg.Content})
+	}
+	return converted
+}
+
+// toGeminiContents converts a conversation to Gemini contents, which call
+// the assistant role "model"
+func toGeminiContents(messages []ChatMessage) []GeminiContent {
+	converted := make([]GeminiContent, 0, len(messages))
+	for _, msg := range messages {
+		role := msg.Role
+		if role == RoleAssistant {
+			role = "model"
+		}
+		converted = append(converted, GeminiContent{
+			Role:  role,
+			Parts: []GeminiPart{{Text: msg.Content}},
+		})
+	}
+	return converted
+}
+
+// Available reports whether any provider is configured
+func (llm *LLMService) Available() bool {
+	llm.mu.RLock()
+	defer llm.mu.RUnlock()
+	return llm.provider != ProviderDefault
+}
+
 // GetCurrentProvider returns the currently active provider
 func (llm *LLMService) GetCurrentProvider() string {
+	llm.mu.RLock()
+	defer llm.mu.RUnlock()
 	return string(llm.provider)
 }
 
-// SetProvider allows manual override of the provider
+// SetProvider allows manual override of the provider until the next config reload
 func (llm *LLMService) SetProvider(provider LLMProvider) error {
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+
 	switch provider {
 	case ProviderOpenAI:
-		if llm.openAIKey == "" {
+		if !llm.isConfigured(provider) {
 			return fmt.Errorf("OpenAI API key not configured")
 		}
 	case ProviderClaude:
-		if llm.claudeKey == "" {
+		if !llm.isConfigured(provider) {
 			return fmt.Errorf("Claude API key not configured")
 		}
 	case ProviderGemini:
-		if llm.geminiKey == "" {
+		if !llm.isConfigured(provider) {
 			return fmt.Errorf("Gemini API key not configured")
 		}
+	case ProviderLocal:
+		if !llm.isConfigured(ProviderLocal) {
+			return fmt.Errorf("local provider needs a base URL and a model")
+		}
+	case ProviderOllama:
+		if !llm.isConfigured(ProviderOllama) {
+			return fmt.Errorf("Ollama model not configured")
+		}
 	default:
 		return fmt.Errorf("invalid provider: %s", provider)
 	}
@@ -385,17 +833,86 @@ func (llm *LLMService) SetProvider(provider LLMProvider) error {
 	return nil
 }
 
-// GetAvailableProviders returns a list of providers with configured API keys
+// GetAvailableProviders returns a list of providers that are configured
 func (llm *LLMService) GetAvailableProviders() []string {
+	llm.mu.RLock()
+	defer llm.mu.RUnlock()
+
 	var providers []string
-	if llm.openAIKey != "" {
-		providers = append(providers, string(ProviderOpenAI))
+	for _, provider := range llm.priority {
+		if llm.isConfigured(provider) {
+			providers = append(providers, string(provider))
+		}
 	}
-	if llm.claudeKey != "" {
-		providers = append(providers, string(ProviderClaude))
+	return providers
+}
+
+// SetModel changes the model used for a provider until the next config
+// reload. A model can make a self-hosted provider usable, so the active
+// provider is picked again when none was configured.
+func (llm *LLMService) SetModel(provider LLMProvider, model string) error {
+	model = strings.TrimSpace(model)
+	if model == "" {
+		return fmt.Errorf("model name cannot be empty")
 	}
-	if llm.geminiKey != "" {
-		providers = append(providers, string(ProviderGemini))
+	if err := checkProvider(provider); err != nil {
+		return err
 	}
-	return providers
+
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+	llm.defaultModel[provider] = model
+	llm.redetectProvider()
+	return nil
+}
+
+// SetBaseURL points a provider at a different server, e.g. a self-hosted
+// endpoint or a test server, until the next config reload
+func (llm *LLMService) SetBaseURL(provider LLMProvider, baseURL string) error {
+	if err := checkProvider(provider); err != nil {
+		return err
+	}
+	if baseURL != "" && !strings.Contains(baseURL, "://") && provider != ProviderOllama {
+		return fmt.Errorf("base URL needs a scheme: %s", baseURL)
+	}
+
+	llm.mu.Lock()
+	defer llm.mu.Unlock()
+	llm.baseURL[provider] = baseURL
+	llm.redetectProvider()
+	return nil
+}
+
+// redetectProvider picks the active provider again when it is not usable,
+// keeping a choice made with SetProvider otherwise. Callers must hold llm.mu.
+func (llm *LLMService) redetectProvider() {
+	if llm.provider == ProviderDefault || !llm.isConfigured(llm.provider) {
+		llm.provider = llm.detectProvider()
+	}
+}
+
+// checkProvider reports an error for names that are not a supported provider
+func checkProvider(provider LLMProvider) error {
+	for _, known := range allProviders {
+		if provider == known {
+			return nil
+		}
+	}
+	return fmt.Errorf("invalid provider: %s", provider)
+}
+
+func getenv(name string) string {
+	if name == "" {
+		return ""
+	}
+	return os.Getenv(name)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
 }
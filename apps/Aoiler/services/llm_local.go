@@ -0,0 +1,180 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// defaultOllamaURL is where Ollama listens unless OLLAMA_HOST says otherwise
+const defaultOllamaURL = "http://127.0.0.1:11434"
+
+// Ollama API structures
+type OllamaRequest struct {
+	Model    string          `json:"model"`
+	Messages []OpenAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+	Options  *OllamaOptions  `json:"options,omitempty"`
+}
+
+type OllamaOptions struct {
+	Temperature *float64 `json:"temperature,omitempty"`
+	NumPredict  int      `json:"num_predict,omitempty"`
+}
+
+// OllamaChunk is one line of the newline-delimited /api/chat stream
+type OllamaChunk struct {
+	Message OpenAIMessage `json:"message"`
+	Done    bool          `json:"done"`
+	Error   string        `json:"error,omitempty"`
+}
+
+type OllamaTagsResponse struct {
+	Models []struct {
+		Name string `json:"name"`
+	} `json:"models"`
+}
+
+// OpenAIModelsResponse is the body of GET /models on OpenAI-compatible servers
+type OpenAIModelsResponse struct {
+	Data []struct {
+		ID string `json:"id"`
+	} `json:"data"`
+}
+
+// ollamaURL returns the Ollama server address. OLLAMA_HOST is often set
+// without a scheme (e.g. "0.0.0.0:11434"), so one is added when missing.
+func ollamaURL(baseURL string) string {
+	host := strings.TrimSuffix(baseURL, "/")
+	if host == "" {
+		return defaultOllamaURL
+	}
+	if !strings.Contains(host, "://") {
+		host = "http://" + host
+	}
+	return host
+}
+
+// queryOllama streams a query from Ollama's native /api/chat endpoint
+func (llm *LLMService) queryOllama(ctx context.Context, p providerSettings, messages []ChatMessage) (LLMResult, error) {
+	url := ollamaURL(p.baseURL) + "/api/chat"
+
+	reqBody := OllamaRequest{
+		Model:    p.model,
+		Messages: toOpenAIMessages(p.systemPrompt, messages),
+		Stream:   true,
+		Options: &OllamaOptions{
+			Temperature: p.temperature,
+			NumPredict:  p.maxTokens,
+		},
+	}
+
+	resp, err := sendLLMRequest(ctx, p, "Ollama", "POST", url, nil, reqBody)
+	if err != nil {
+		return LLMResult{Success: false}, err
+	}
+	defer resp.Body.Close()
+
+	var text strings.Builder
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		var chunk OllamaChunk
+		if err := json.Unmarshal([]byte(line), &chunk); err != nil {
+			return LLMResult{Success: false}, fmt.Errorf("failed to parse response: %w", err)
+		}
+		if chunk.Error != "" {
+			return LLMResult{Success: false}, streamError(p, "Ollama", "", chunk.Error)
+		}
+
+		if chunk.Message.Content != "" {
+			text.WriteString(chunk.Message.Content)
+			Emit(ctx, EventToken, chunk.Message.Content)
+		}
+		if chunk.Done {
+			break
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return LLMResult{Success: false}, fmt.Errorf("failed to read response: %w", err)
+	}
+
+	if text.Len() == 0 {
+		return LLMResult{
+			Response: "No response from Ollama",
+			Success:  false,
+		}, nil
+	}
+
+	return LLMResult{
+		Response: strings.TrimSpace(text.String()),
+		Success:  true,
+	}, nil
+}
+
+// ListModels asks a provider's server which models it offers. Only
+// self-hosted providers and OpenAI expose a listing endpoint.
+func (llm *LLMService) ListModels(ctx context.Context, provider LLMProvider) ([]string, error) {
+	llm.mu.RLock()
+	p := llm.settingsFor(provider)
+	llm.mu.RUnlock()
+
+	switch provider {
+	case ProviderOllama:
+		var tags OllamaTagsResponse
+		if err := getJSON(ctx, p, "Ollama", ollamaURL(p.baseURL)+"/api/tags", &tags); err != nil {
+			return nil, err
+		}
+		models := make([]string, 0, len(tags.Models))
+		for _, model := range tags.Models {
+			models = append(models, model.Name)
+		}
+		return models, nil
+
+	case ProviderLocal, ProviderOpenAI:
+		if p.baseURL == "" {
+			return nil, fmt.Errorf("no base URL configured for %s", provider)
+		}
+
+		var list OpenAIModelsResponse
+		if err := getJSON(ctx, p, string(provider), p.baseURL+"/models", &list); err != nil {
+			return nil, err
+		}
+		models := make([]string, 0, len(list.Data))
+		for _, model := range list.Data {
+			models = append(models, model.ID)
+		}
+		return models, nil
+
+	default:
+		return nil, fmt.Errorf("model listing not supported for provider: %s", provider)
+	}
+}
+
+// getJSON fetches url and decodes the JSON body into v. The API key, if
+// any, is sent as a bearer token.
+func getJSON(ctx context.Context, p providerSettings, label, url string, v interface{}) error {
+	headers := map[string]string{}
+	if p.apiKey != "" {
+		headers["Authorization"] = "Bearer " + p.apiKey
+	}
+
+	resp, err := sendLLMRequest(ctx, p, label, "GET", url, headers, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(v); err != nil {
+		return fmt.Errorf("failed to parse response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+const testAPIKey = "sk-test-secret"
+
+// clearProviderEnv hides the keys exported in the environment from the test
+func clearProviderEnv(t *testing.T) {
+	t.Helper()
+	for _, env := range providerEnv {
+		for _, name := range []string{env.key, env.model, env.baseURL} {
+			if name != "" {
+				t.Setenv(name, "")
+			}
+		}
+	}
+}
+
+// newTestLLM returns an LLM service that only knows provider, pointed at
+// server
+func newTestLLM(t *testing.T, provider LLMProvider, server *httptest.Server) *LLMService {
+	t.Helper()
+	clearProviderEnv(t)
+
+	cfg := DefaultConfig()
+	cfg.LLM.Priority = []string{string(provider)}
+	cfg.LLM.Providers = map[string]ProviderConfig{
+		string(provider): {APIKey: testAPIKey, Model: "test-model"},
+	}
+	llm := NewLLMService(nil)
+	llm.ApplyConfig(cfg)
+	if err := llm.SetBaseURL(provider, server.URL); err != nil {
+		t.Fatal(err)
+	}
+	if got := llm.GetCurrentProvider(); got != string(provider) {
+		t.Fatalf("active provider = %s, want %s", got, provider)
+	}
+	return llm
+}
+
+// queryWithTokens runs a query and collects the streamed tokens
+func queryWithTokens(llm *LLMService, query string) (LLMResult, []string, error) {
+	var tokens []string
+	ctx := WithRequest(context.Background(), "test", func(event Event) {
+		if event.Type == EventToken {
+			tokens = append(tokens, event.Data.(string))
+		}
+	})
+	result, err := llm.Query(ctx, query)
+	return result, tokens, err
+}
+
+// writeSSE writes each event as a server-sent event and flushes it
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		fmt.Fprintf(w, "%s\n\n", event)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func decodeBody(t *testing.T, r *http.Request) map[string]interface{} {
+	t.Helper()
+	var body map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		t.Errorf("request body: %v", err)
+	}
+	return body
+}
+
+func TestLLMAdapters(t *testing.T) {
+	tests := []struct {
+		provider LLMProvider
+		// handler checks the request and streams "Hello" and " world"
+		handler http.HandlerFunc
+	}{
+		{ProviderOpenAI, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/chat/completions" || r.Header.Get("Authorization") != "Bearer "+testAPIKey {
+				t.Errorf("unexpected request %s with Authorization %q", r.URL.Path, r.Header.Get("Authorization"))
+			}
+			body := decodeBody(t, r)
+			if body["model"] != "test-model" || body["stream"] != true {
+				t.Errorf("unexpected body %v", body)
+			}
+			writeSSE(w,
+				`data: {"choices":[{"delta":{"content":"Hello"}}]}`,
+				`data: {"choices":[{"delta":{"content":" world"}}]}`,
+				`data: [DONE]`)
+		}},
+		{ProviderLocal, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/chat/completions" {
+				t.Errorf("unexpected path %s", r.URL.Path)
+			}
+			writeSSE(w,
+				`data: {"choices":[{"delta":{"content":"Hello"}}]}`,
+				`data: {"choices":[{"delta":{"content":" world"}}]}`,
+				`data: [DONE]`)
+		}},
+		{ProviderClaude, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/messages" || r.Header.Get("x-api-key") != testAPIKey || r.Header.Get("anthropic-version") == "" {
+				t.Errorf("unexpected request %s with headers %v", r.URL.Path, r.Header)
+			}
+			if body := decodeBody(t, r); body["model"] != "test-model" {
+				t.Errorf("unexpected body %v", body)
+			}
+			writeSSE(w,
+				"event: message_start\ndata: {\"type\":\"message_start\"}",
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hello\"}}",
+				"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\" world\"}}",
+				"event: message_stop\ndata: {\"type\":\"message_stop\"}")
+		}},
+		{ProviderGemini, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/models/test-model:streamGenerateContent" || r.URL.Query().Get("alt") != "sse" {
+				t.Errorf("unexpected request %s", r.URL)
+			}
+			if r.Header.Get("x-goog-api-key") != testAPIKey || strings.Contains(r.URL.RawQuery, testAPIKey) {
+				t.Errorf("key not sent in the header only")
+			}
+			writeSSE(w,
+				`data: {"candidates":[{"content":{"parts":[{"text":"Hello"}]}}]}`,
+				`data: {"candidates":[{"content":{"parts":[{"text":" world"}]}}]}`)
+		}},
+		{ProviderOllama, func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path != "/api/chat" {
+				t.Errorf("unexpected path %s", r.URL.Path)
+			}
+			if body := decodeBody(t, r); body["model"] != "test-model" {
+				t.Errorf("unexpected body %v", body)
+			}
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":"Hello"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":" world"},"done":false}`)
+			fmt.Fprintln(w, `{"message":{"role":"assistant","content":""},"done":true}`)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.provider), func(t *testing.T) {
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			llm := newTestLLM(t, tt.provider, server)
+
+			result, tokens, err := queryWithTokens(llm, "hi")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.Success || result.Response != "Hello world" || result.Provider != string(tt.provider) {
+				t.Errorf("result = %+v", result)
+			}
+			if strings.Join(tokens, "|") != "Hello| world" {
+				t.Errorf("tokens = %q", tokens)
+			}
+		})
+	}
+}
+
+func TestLLMRetry(t *testing.T) {
+	var attempts atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if attempts.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0.01")
+			w.WriteHeader(http.StatusTooManyRequests)
+			io.WriteString(w, `{"error":{"message":"slow down","type":"rate_limit_error"}}`)
+			return
+		}
+		writeSSE(w, `data: {"choices":[{"delta":{"content":"ok"}}]}`, `data: [DONE]`)
+	}))
+	defer server.Close()
+	llm := newTestLLM(t, ProviderOpenAI, server)
+
+	result, _, err := queryWithTokens(llm, "hi")
+	if err != nil || result.Response != "ok" {
+		t.Fatalf("Query() = %+v, %v", result, err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Errorf("attempts = %d, want 3", got)
+	}
+}
+
+func TestLLMErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		body     string
+		kind     error
+		attempts int32
+	}{
+		{"auth", http.StatusUnauthorized, `{"error":{"message":"bad key ` + testAPIKey + `","type":"authentication_error"}}`, ErrLLMAuth, 1},
+		{"bad request", http.StatusBadRequest, `{"error":{"message":"no such model","type":"invalid_request_error"}}`, ErrLLMBadRequest, 1},
+		{"out of credit", http.StatusTooManyRequests, `{"error":{"message":"quota","type":"insufficient_quota"}}`, ErrLLMProvider, 1},
+		{"proxy page", http.StatusForbidden, `<html><body>Forbidden</body></html>`, ErrLLMAuth, 1},
+		{"retry too long", http.StatusServiceUnavailable, `{"error":"busy"}`, ErrLLMOverloaded, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				attempts.Add(1)
+				// Longer than maxRetryAfter, so overloaded servers are not retried
+				w.Header().Set("Retry-After", "3600")
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer server.Close()
+			llm := newTestLLM(t, ProviderOpenAI, server)
+
+			_, _, err := queryWithTokens(llm, "hi")
+			var llmErr *LLMError
+			if !errors.As(err, &llmErr) || !errors.Is(err, tt.kind) {
+				t.Fatalf("Query() error = %v, want %v", err, tt.kind)
+			}
+			if llmErr.Status != tt.status {
+				t.Errorf("status = %d, want %d", llmErr.Status, tt.status)
+			}
+			if strings.Contains(err.Error(), testAPIKey) {
+				t.Errorf("error leaks the API key: %v", err)
+			}
+			if got := attempts.Load(); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+		})
+	}
+}
+
+func TestLLMStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w,
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"index\":0,\"delta\":{\"type\":\"text_delta\",\"text\":\"Hel\"}}",
+			"event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}")
+	}))
+	defer server.Close()
+	llm := newTestLLM(t, ProviderClaude, server)
+
+	_, _, err := queryWithTokens(llm, "hi")
+	if !errors.Is(err, ErrLLMOverloaded) {
+		t.Fatalf("Query() error = %v, want %v", err, ErrLLMOverloaded)
+	}
+}
+
+func TestLLMSetModel(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+	llm := newTestLLM(t, ProviderClaude, server)
+
+	if err := llm.SetModel(ProviderClaude, "  "); err == nil {
+		t.Error("SetModel accepted an empty model")
+	}
+	if err := llm.SetModel("gpt", "x"); err == nil {
+		t.Error("SetModel accepted an unknown provider")
+	}
+	if err := llm.SetBaseURL(ProviderLocal, "localhost:8080"); err == nil {
+		t.Error("SetBaseURL accepted a URL without a scheme")
+	}
+
+	// Without a usable provider, a model for Ollama makes it the active one
+	llm.ApplyConfig(DefaultConfig())
+	if llm.Available() {
+		t.Fatal("no provider should be configured")
+	}
+	if err := llm.SetModel(ProviderOllama, "llama3"); err != nil {
+		t.Fatal(err)
+	}
+	if got := llm.GetCurrentProvider(); got != string(ProviderOllama) {
+		t.Errorf("active provider = %s, want ollama", got)
+	}
+}
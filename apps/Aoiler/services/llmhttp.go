@@ -0,0 +1,282 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Kinds of failed LLM requests. An *LLMError matches its kind with errors.Is.
+var (
+	ErrLLMAuth       = errors.New("authentication failed")
+	ErrLLMRateLimit  = errors.New("rate limited")
+	ErrLLMOverloaded = errors.New("provider overloaded or unavailable")
+	ErrLLMBadRequest = errors.New("bad request")
+	ErrLLMNetwork    = errors.New("network error")
+	// ErrLLMProvider is any other error the provider reports
+	ErrLLMProvider = errors.New("provider error")
+)
+
+const (
+	// maxLLMAttempts is how often a request is sent before giving up
+	maxLLMAttempts = 4
+	// retryBaseDelay doubles with every retry, up to maxRetryDelay
+	retryBaseDelay = time.Second
+	maxRetryDelay  = 30 * time.Second
+	// maxRetryAfter is the longest Retry-After that is waited for
+	maxRetryAfter = time.Minute
+	// maxErrorBody bounds how much of an error response is read
+	maxErrorBody = 64 * 1024
+)
+
+// LLMError is a request an LLM provider failed or refused
+type LLMError struct {
+	Provider string
+	// Kind is one of the ErrLLM errors
+	Kind error
+	// Status is the HTTP status, or 0 when no response arrived
+	Status int
+	// Message is the provider's explanation, if it gave one
+	Message    string
+	RetryAfter time.Duration
+	Err        error
+
+	// secret is kept out of the error text
+	secret string
+}
+
+func (e *LLMError) Error() string {
+	msg := fmt.Sprintf("%s: %v", e.Provider, e.Kind)
+	if e.Status != 0 {
+		msg += fmt.Sprintf(" (HTTP %d)", e.Status)
+	}
+	if e.Message != "" {
+		msg += ": " + e.Message
+	} else if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.RetryAfter > 0 {
+		msg += fmt.Sprintf("; retry after %s", e.RetryAfter.Round(100*time.Millisecond))
+	}
+	return redact(msg, e.secret)
+}
+
+func (e *LLMError) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Kind, e.Err}
+	}
+	return []error{e.Kind}
+}
+
+// retryable reports whether sending the request again may succeed
+func (e *LLMError) retryable() bool {
+	return e.Kind == ErrLLMRateLimit || e.Kind == ErrLLMOverloaded || e.Kind == ErrLLMNetwork
+}
+
+// sendLLMRequest sends body as JSON (or nothing when body is nil) and
+// returns the open response once the provider accepts the request.
+// Rate limits, overloaded servers and network errors are retried with
+// jittered exponential backoff, honoring Retry-After; other failures are
+// returned as an *LLMError right away.
+func sendLLMRequest(ctx context.Context, p providerSettings, label, method, url string, headers map[string]string, body interface{}) (*http.Response, error) {
+	var payload []byte
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal request: %w", err)
+		}
+		payload = data
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := tryLLMRequest(ctx, p, label, method, url, headers, payload)
+		if err == nil {
+			return resp, nil
+		}
+
+		var llmErr *LLMError
+		if !errors.As(err, &llmErr) || !llmErr.retryable() || attempt == maxLLMAttempts || llmErr.RetryAfter > maxRetryAfter {
+			return nil, err
+		}
+
+		delay := retryDelay(attempt, llmErr.RetryAfter)
+		fmt.Fprintf(os.Stderr, "aoiler: %v; retrying in %s\n", err, delay.Round(100*time.Millisecond))
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// tryLLMRequest sends the request once
+func tryLLMRequest(ctx context.Context, p providerSettings, label, method, url string, headers map[string]string, payload []byte) (*http.Response, error) {
+	var reader io.Reader
+	if payload != nil {
+		reader = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %s", redact(err.Error(), p.apiKey))
+	}
+	if payload != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, &LLMError{Provider: label, Kind: ErrLLMNetwork, Err: err, secret: p.apiKey}
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+	message, errType := parseErrorBody(data)
+	return nil, &LLMError{
+		Provider:   label,
+		Kind:       errorKindForStatus(resp.StatusCode, errType),
+		Status:     resp.StatusCode,
+		Message:    message,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+		secret:     p.apiKey,
+	}
+}
+
+// streamError turns an error reported inside a response stream into an
+// *LLMError. errType is the provider's name for the error, if any.
+func streamError(p providerSettings, label, errType, message string) error {
+	return &LLMError{
+		Provider: label,
+		Kind:     errorKindForType(errType),
+		Message:  message,
+		secret:   p.apiKey,
+	}
+}
+
+// retryDelay returns how long to wait before the given retry. Half of the
+// backoff is random, so clients that failed together do not retry together.
+func retryDelay(attempt int, retryAfter time.Duration) time.Duration {
+	if retryAfter > 0 {
+		return retryAfter
+	}
+	backoff := min(retryBaseDelay<<(attempt-1), maxRetryDelay)
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// parseRetryAfter reads a Retry-After header, given in seconds or as a date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.ParseFloat(value, 64); err == nil && seconds > 0 {
+		return time.Duration(seconds * float64(time.Second))
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// parseErrorBody extracts the message and error type from an error
+// response. The providers nest them under "error" (Ollama uses a plain
+// string); anything else, such as an HTML page from a proxy, is returned
+// as text.
+func parseErrorBody(body []byte) (string, string) {
+	var envelope struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+	}
+	if err := json.Unmarshal(body, &envelope); err == nil {
+		var detail struct {
+			Message string `json:"message"`
+			Type    string `json:"type"`
+			// Status is Gemini's name for the error, e.g. RESOURCE_EXHAUSTED
+			Status string `json:"status"`
+		}
+		if json.Unmarshal(envelope.Error, &detail) == nil && detail.Message != "" {
+			return detail.Message, firstNonEmpty(detail.Type, detail.Status)
+		}
+		var text string
+		if json.Unmarshal(envelope.Error, &text) == nil && text != "" {
+			return text, ""
+		}
+		if envelope.Message != "" {
+			return envelope.Message, ""
+		}
+	}
+
+	text := strings.Join(strings.Fields(string(body)), " ")
+	if len(text) > 300 {
+		text = text[:300] + "..."
+	}
+	return text, ""
+}
+
+func errorKindForStatus(status int, errType string) error {
+	switch {
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrLLMAuth
+	case status == http.StatusTooManyRequests && errType == "insufficient_quota":
+		// Out of credit: waiting does not help
+		return ErrLLMProvider
+	case status == http.StatusTooManyRequests:
+		return ErrLLMRateLimit
+	case status == http.StatusRequestTimeout:
+		return ErrLLMNetwork
+	case status == http.StatusInternalServerError, status == http.StatusBadGateway,
+		status == http.StatusServiceUnavailable, status == http.StatusGatewayTimeout,
+		status == 529: // Anthropic's "overloaded"
+		return ErrLLMOverloaded
+	case status >= 400 && status < 500:
+		return ErrLLMBadRequest
+	}
+	return ErrLLMProvider
+}
+
+func errorKindForType(errType string) error {
+	lower := strings.ToLower(errType)
+	switch {
+	case strings.Contains(lower, "auth"), strings.Contains(lower, "permission"):
+		return ErrLLMAuth
+	case strings.Contains(lower, "rate_limit"), lower == "resource_exhausted":
+		return ErrLLMRateLimit
+	case strings.Contains(lower, "overloaded"), lower == "unavailable", lower == "api_error", lower == "server_error":
+		return ErrLLMOverloaded
+	case strings.Contains(lower, "invalid"):
+		return ErrLLMBadRequest
+	}
+	return ErrLLMProvider
+}
+
+// keyParam matches API keys passed in URLs
+var keyParam = regexp.MustCompile(`(?i)((?:api_?)?key=)[^&\s"]+`)
+
+// redact hides secret, and any key passed as a URL parameter, in text
+// meant for logs and error messages
+func redact(text, secret string) string {
+	if secret != "" {
+		text = strings.ReplaceAll(text, secret, "[redacted]")
+	}
+	return keyParam.ReplaceAllString(text, "${1}[redacted]")
+}
@@ -1,137 +1,200 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"strings"
+	"os"
 )
 
 // Intent represents classified user intent
 type Intent struct {
 	ServiceName string
+	Query       string
 	Confidence  float64
 	Params      map[string]string
+	// SessionID selects the conversation the LLM continues; empty starts a new one
+	SessionID string
 }
 
 // ServiceManager manages all services
 type ServiceManager struct {
-	fileSearch *FileSearchService
-	organizer  *OrganizerService
+	registry   *Registry
+	config     *ConfigStore
+	sessions   *SessionStore
+	llm        *LLMService
 	linter     *LinterService
+	organizer  *OrganizerService
 	ocr        *OCRService
-	converter  *ConverterService
-	llm        *LLMService
+	ocrHistory *OCRHistory
+	launcher   *LauncherService
+	tools      *Toolbox
 }
 
-// NewServiceManager creates a new service manager
+// NewServiceManager creates a new service manager with the built-in services registered
 func NewServiceManager() *ServiceManager {
-	return &ServiceManager{
-		fileSearch: NewFileSearchService(),
-		organizer:  NewOrganizerService(),
-		linter:     NewLinterService(),
-		ocr:        NewOCRService(),
-		converter:  NewConverterService(),
-		llm:        NewLLMService(),
+	sm := &ServiceManager{
+		registry:   NewRegistry(),
+		config:     NewConfigStore(),
+		sessions:   NewSessionStore(),
+		ocrHistory: NewOCRHistory(),
 	}
-}
-
-// ClassifyIntent uses keyword matching to determine intent
-func (sm *ServiceManager) ClassifyIntent(query string) Intent {
-	lowerQuery := strings.ToLower(query)
+	sm.llm = NewLLMService(sm.sessions)
+	sm.linter = NewLinterService()
+	sm.organizer = NewOrganizerService()
+	sm.ocr = NewOCRService(sm.ocrHistory)
+	sm.launcher = NewLauncherService()
 
-	// File search patterns
-	fileSearchKeywords := []string{"find", "where is", "locate", "search for", "look for"}
-	for _, keyword := range fileSearchKeywords {
-		if strings.Contains(lowerQuery, keyword) {
-			return Intent{
-				ServiceName: "filesearch",
-				Confidence:  0.9,
-				Params:      map[string]string{"query": query},
-			}
+	builtin := []Service{
+		NewFileSearchService(),
+		sm.organizer,
+		sm.linter,
+		sm.ocr,
+		NewConverterService(),
+		NewCalculatorService(),
+		NewMediaService(),
+		sm.launcher,
+		NewWindowService(),
+		sm.llm,
+	}
+	// The built-in services are fixed, so failing to wire them is a bug
+	for _, service := range builtin {
+		if err := sm.registry.Register(service); err != nil {
+			panic(fmt.Sprintf("register built-in service: %v", err))
 		}
 	}
+	if err := sm.registry.SetFallback("llm"); err != nil {
+		panic(fmt.Sprintf("set fallback service: %v", err))
+	}
+	sm.tools = NewToolbox(sm.registry)
+	sm.llm.SetToolbox(sm.tools)
 
-	// Organizer patterns
-	organizerKeywords := []string{"organize", "clean", "sort", "kondo"}
-	for _, keyword := range organizerKeywords {
-		if strings.Contains(lowerQuery, keyword) {
-			params := make(map[string]string)
-			if strings.Contains(lowerQuery, "category") || strings.Contains(lowerQuery, "type") {
-				params["mode"] = "category"
-			} else if strings.Contains(lowerQuery, "filename") || strings.Contains(lowerQuery, "name") {
-				params["mode"] = "filename"
-			}
-			return Intent{
-				ServiceName: "organizer",
-				Confidence:  0.9,
-				Params:      params,
-			}
-		}
+	if err := sm.config.Load(); err != nil {
+		fmt.Fprintf(os.Stderr, "aoiler: %v, using defaults\n", err)
 	}
+	sm.applyConfig(sm.config.Get())
+	sm.config.OnChange(sm.applyConfig)
 
-	// Linter patterns
-	linterKeywords := []string{"lint", "format", "check code", "fix code"}
-	for _, keyword := range linterKeywords {
-		if strings.Contains(lowerQuery, keyword) {
-			return Intent{
-				ServiceName: "linter",
-				Confidence:  0.9,
-				Params:      map[string]string{"query": query},
-			}
-		}
+	return sm
+}
+
+// Register adds a service so it takes part in classification and routing
+func (sm *ServiceManager) Register(service Service) error {
+	if err := sm.registry.Register(service); err != nil {
+		return err
+	}
+	if configurable, ok := service.(Configurable); ok {
+		configurable.ApplyConfig(sm.config.Get())
 	}
+	return nil
+}
 
-	// OCR patterns
-	ocrKeywords := []string{"ocr", "extract text", "read screen", "capture text", "screenshot text"}
-	for _, keyword := range ocrKeywords {
-		if strings.Contains(lowerQuery, keyword) {
-			return Intent{
-				ServiceName: "ocr",
-				Confidence:  0.9,
-				Params:      map[string]string{},
-			}
+// Config returns the store backing aoiler.toml
+func (sm *ServiceManager) Config() *ConfigStore {
+	return sm.config
+}
+
+// applyConfig hands the config to every service that reads options from it
+func (sm *ServiceManager) applyConfig(cfg Config) {
+	for _, service := range sm.registry.Services() {
+		if configurable, ok := service.(Configurable); ok {
+			configurable.ApplyConfig(cfg)
 		}
 	}
+}
 
-	// Converter patterns
-	converterKeywords := []string{"convert", "transcode", "change format", "encode"}
-	for _, keyword := range converterKeywords {
-		if strings.Contains(lowerQuery, keyword) {
-			return Intent{
-				ServiceName: "converter",
-				Confidence:  0.9,
-				Params:      map[string]string{"query": query},
+// Close stops the config watcher and any background work of the services,
+// such as the file indexer
+func (sm *ServiceManager) Close() error {
+	err := sm.config.Close()
+	for _, service := range sm.registry.Services() {
+		if closer, ok := service.(interface{ Close() error }); ok {
+			if closeErr := closer.Close(); closeErr != nil && err == nil {
+				err = closeErr
 			}
 		}
 	}
+	return err
+}
+
+// Services returns the registered services
+func (sm *ServiceManager) Services() []ServiceInfo {
+	return sm.registry.Info()
+}
+
+// Sessions returns the store holding LLM conversations
+func (sm *ServiceManager) Sessions() *SessionStore {
+	return sm.sessions
+}
+
+// Toolbox returns the services offered to the LLM as tools
+func (sm *ServiceManager) Toolbox() *Toolbox {
+	return sm.tools
+}
+
+// LLM returns the LLM service, which also backs the registry fallback
+func (sm *ServiceManager) LLM() *LLMService {
+	return sm.llm
+}
+
+// Linter returns the formatting and linting service
+func (sm *ServiceManager) Linter() *LinterService {
+	return sm.linter
+}
+
+// OCR returns the text recognition service
+func (sm *ServiceManager) OCR() *OCRService {
+	return sm.ocr
+}
+
+// OCRHistory returns the store of captured text
+func (sm *ServiceManager) OCRHistory() *OCRHistory {
+	return sm.ocrHistory
+}
+
+// Launcher returns the application launcher
+func (sm *ServiceManager) Launcher() *LauncherService {
+	return sm.launcher
+}
+
+// Organizer returns the file organizing service
+func (sm *ServiceManager) Organizer() *OrganizerService {
+	return sm.organizer
+}
+
+// RouteToService routes the intent to the service it was classified as.
+// Cancelling ctx stops the service; the error is then ErrCancelled whatever
+// the service itself reported.
+func (sm *ServiceManager) RouteToService(ctx context.Context, intent Intent) (interface{}, error) {
+	service, ok := sm.registry.Get(intent.ServiceName)
+	if !ok {
+		return nil, fmt.Errorf("unknown service: %s", intent.ServiceName)
+	}
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return nil, ErrCancelled
+	}
 
-	// Default to LLM for everything else
-	return Intent{
-		ServiceName: "llm",
-		Confidence:  0.5,
-		Params:      map[string]string{"query": query},
+	result, err := service.Handle(ctx, intent)
+	if errors.Is(ctx.Err(), context.Canceled) {
+		return result, ErrCancelled
 	}
+	return result, err
 }
 
-// RouteToService routes the query to appropriate service
-func (sm *ServiceManager) RouteToService(intent Intent, query string) (interface{}, error) {
-	switch intent.ServiceName {
-	case "filesearch":
-		return sm.fileSearch.Search(query)
-	case "organizer":
-		mode := intent.Params["mode"]
-		if mode == "" {
-			mode = "category"
+// GetPathSuggestions returns path completions for the input, filtered by the
+// service the input currently classifies as when that service provides a filter
+func (sm *ServiceManager) GetPathSuggestions(input string) (AutoCompleteResult, error) {
+	fs := NewFileSearchService()
+	result, err := fs.GetPathSuggestions(input, false)
+	if err != nil || !result.IsPath {
+		return result, err
+	}
+
+	intent := sm.ClassifyIntent(input)
+	if service, ok := sm.registry.Get(intent.ServiceName); ok {
+		if filter, ok := service.(PathFilter); ok {
+			result.Suggestions = filterSuggestions(result.Suggestions, filter)
 		}
-		return sm.organizer.Organize(query, mode)
-	case "linter":
-		return sm.linter.LintFormat(query)
-	case "ocr":
-		return sm.ocr.ExtractText()
-	case "converter":
-		return sm.converter.Convert(query)
-	case "llm":
-		return sm.llm.Query(query)
-	default:
-		return nil, fmt.Errorf("unknown service: %s", intent.ServiceName)
 	}
+	return result, nil
 }
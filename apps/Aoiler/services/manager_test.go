@@ -0,0 +1,47 @@
+package services
+
+import "testing"
+
+// newTestManager builds the service manager with its config and data kept
+// in temporary directories
+func newTestManager(t *testing.T) *ServiceManager {
+	t.Helper()
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	clearProviderEnv(t)
+	sm := NewServiceManager()
+	t.Cleanup(func() { sm.Close() })
+	return sm
+}
+
+func TestNewServiceManager(t *testing.T) {
+	sm := newTestManager(t)
+
+	want := []string{"filesearch", "organizer", "linter", "ocr", "converter", "calculator", "media", "launcher", "windows", "llm"}
+	infos := sm.Services()
+	if len(infos) != len(want) {
+		t.Fatalf("registered %d services, want %d", len(infos), len(want))
+	}
+	for i, info := range infos {
+		if info.Name != want[i] {
+			t.Errorf("service %d = %s, want %s", i, info.Name, want[i])
+		}
+	}
+	if got := sm.registry.Fallback(); got != "llm" {
+		t.Errorf("fallback = %q, want llm", got)
+	}
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(NewCalculatorService()); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(NewCalculatorService()); err == nil {
+		t.Error("registering calculator twice succeeded")
+	}
+	if err := r.SetFallback("llm"); err == nil {
+		t.Error("SetFallback accepted an unregistered service")
+	}
+}
@@ -0,0 +1,471 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Media controls
+const (
+	MediaVolume     = "volume"
+	MediaMic        = "mic"
+	MediaBrightness = "brightness"
+	MediaPlayer     = "player"
+)
+
+// AudioState is the volume of the default output or input
+type AudioState struct {
+	// Device is the description of the sink or source, when wpctl has one
+	Device string `json:"device,omitempty"`
+	// Volume is in percent
+	Volume int  `json:"volume"`
+	Muted  bool `json:"muted"`
+}
+
+// BrightnessState is the backlight as reported by brightnessctl -m
+type BrightnessState struct {
+	Device  string `json:"device"`
+	Current int    `json:"current"`
+	Max     int    `json:"max"`
+	Percent int    `json:"percent"`
+}
+
+// PlayerState is the current track of an MPRIS player
+type PlayerState struct {
+	Player string `json:"player"`
+	// Status is Playing, Paused or Stopped
+	Status string `json:"status"`
+	Artist string `json:"artist,omitempty"`
+	Title  string `json:"title,omitempty"`
+	Album  string `json:"album,omitempty"`
+	// Position and Length are in seconds
+	Position float64 `json:"position"`
+	Length   float64 `json:"length"`
+}
+
+// MediaResult is the state of whatever a media command changed or asked about
+type MediaResult struct {
+	Query      string           `json:"query"`
+	Control    string           `json:"control"`
+	Action     string           `json:"action"`
+	Audio      *AudioState      `json:"audio,omitempty"`
+	Brightness *BrightnessState `json:"brightness,omitempty"`
+	Player     *PlayerState     `json:"player,omitempty"`
+	Output     string           `json:"output"`
+	Success    bool             `json:"success"`
+}
+
+// mediaCommand is a parsed media command
+type mediaCommand struct {
+	control string
+	// action is set, up, down, mute, unmute, togglemute or status for
+	// volume and brightness, or a playerctl command for the player
+	action string
+	// amount is a percentage; for up and down 0 means the default step
+	amount int
+}
+
+const (
+	volumeStep     = 5
+	brightnessStep = 10
+)
+
+var (
+	mediaFiller = regexp.MustCompile(`^(?:please\s+)?(?:(?:set|turn|put|make)\s+)?(?:the\s+|my\s+)?`)
+
+	audioWords      = `(volume|vol|sound|audio|speakers?|mic|microphone)`
+	brightnessWords = `((?:screen\s+)?brightness|backlight)`
+	amountPart      = `(?:\s+(?:by|to)?\s*(\d{1,3})\s*%?)?`
+
+	levelSetPattern  = regexp.MustCompile(`^(?:` + audioWords + `|` + brightnessWords + `)\s+(?:to\s+|at\s+)?(\d{1,3})\s*%?$`)
+	levelStepPattern = regexp.MustCompile(`^(?:` + audioWords + `|` + brightnessWords + `)\s+(up|down|higher|lower)` + amountPart + `$`)
+	// "turn up the volume" arrives as "up the volume" once the filler is gone
+	stepLevelPattern = regexp.MustCompile(`^(raise|increase|lower|decrease|reduce|up|down)\s+(?:the\s+|my\s+)?(?:` + audioWords + `|` + brightnessWords + `)` + amountPart + `$`)
+	mutePattern      = regexp.MustCompile(`^(mute|unmute|toggle mute(?: on)?)(?:\s+(?:the\s+|my\s+)?` + audioWords + `)?$`)
+	mutedPattern     = regexp.MustCompile(`^` + audioWords + `\s+(off|on|mute|unmute)$`)
+	levelPattern     = regexp.MustCompile(`^(?:what(?:'s| is)\s+(?:the\s+|my\s+)?)?(?:` + audioWords + `|` + brightnessWords + `)(?:\s+level)?$`)
+	playerPattern    = regexp.MustCompile(`^(next|skip|previous|prev|play|pause|resume|stop|play pause|play/pause|toggle playback)(?:\s+(?:the\s+|this\s+)?(?:track|song|music|media|playback))?$`)
+	playingPattern   = regexp.MustCompile(`^(?:what(?:'s| is)\s+(?:playing|this song)|now playing|what song is (?:this|playing)|current (?:track|song))$`)
+)
+
+// Shortcuts that need no pattern
+var mediaPhrases = map[string]mediaCommand{
+	"louder":          {control: MediaVolume, action: "up"},
+	"quieter":         {control: MediaVolume, action: "down"},
+	"brighter":        {control: MediaBrightness, action: "up"},
+	"dimmer":          {control: MediaBrightness, action: "down"},
+	"dim the screen":  {control: MediaBrightness, action: "down"},
+	"dim screen":      {control: MediaBrightness, action: "down"},
+	"silence":         {control: MediaVolume, action: "mute"},
+	"max volume":      {control: MediaVolume, action: "set", amount: 100},
+	"full brightness": {control: MediaBrightness, action: "set", amount: 100},
+}
+
+// parseMediaCommand reads "volume 40", "mute mic", "brightness down 10%",
+// "next track", "what's playing" and similar commands
+func parseMediaCommand(query string) (mediaCommand, bool) {
+	lower := strings.ToLower(strings.TrimSpace(strings.TrimRight(strings.TrimSpace(query), ".!?")))
+	lower = strings.Join(strings.Fields(lower), " ")
+	if cmd, ok := mediaPhrases[lower]; ok {
+		return cmd, true
+	}
+	if playingPattern.MatchString(lower) {
+		return mediaCommand{control: MediaPlayer, action: "status"}, true
+	}
+	if m := playerPattern.FindStringSubmatch(lower); m != nil {
+		return mediaCommand{control: MediaPlayer, action: playerAction(m[1])}, true
+	}
+	if m := mutePattern.FindStringSubmatch(lower); m != nil {
+		action := m[1]
+		if strings.HasPrefix(action, "toggle") {
+			action = "togglemute"
+		}
+		return mediaCommand{control: audioControl(m[2]), action: action}, true
+	}
+
+	lower = mediaFiller.ReplaceAllString(lower, "")
+	if m := mutedPattern.FindStringSubmatch(lower); m != nil {
+		action := map[string]string{"off": "mute", "mute": "mute", "on": "unmute", "unmute": "unmute"}[m[2]]
+		return mediaCommand{control: audioControl(m[1]), action: action}, true
+	}
+	if m := levelSetPattern.FindStringSubmatch(lower); m != nil {
+		amount, _ := strconv.Atoi(m[3])
+		return mediaCommand{control: levelControl(m[1], m[2]), action: "set", amount: min(amount, 100)}, true
+	}
+	if m := levelStepPattern.FindStringSubmatch(lower); m != nil {
+		amount, _ := strconv.Atoi(m[4])
+		return mediaCommand{control: levelControl(m[1], m[2]), action: stepDirection(m[3]), amount: amount}, true
+	}
+	if m := stepLevelPattern.FindStringSubmatch(lower); m != nil {
+		amount, _ := strconv.Atoi(m[4])
+		return mediaCommand{control: levelControl(m[2], m[3]), action: stepDirection(m[1]), amount: amount}, true
+	}
+	if m := levelPattern.FindStringSubmatch(lower); m != nil {
+		return mediaCommand{control: levelControl(m[1], m[2]), action: "status"}, true
+	}
+	return mediaCommand{}, false
+}
+
+func audioControl(word string) string {
+	if strings.HasPrefix(word, "mic") {
+		return MediaMic
+	}
+	return MediaVolume
+}
+
+func levelControl(audioWord, brightnessWord string) string {
+	if brightnessWord != "" {
+		return MediaBrightness
+	}
+	return audioControl(audioWord)
+}
+
+func stepDirection(word string) string {
+	switch word {
+	case "up", "higher", "raise", "increase":
+		return "up"
+	}
+	return "down"
+}
+
+// playerAction maps a spoken command to playerctl
+func playerAction(word string) string {
+	switch word {
+	case "skip":
+		return "next"
+	case "prev":
+		return "previous"
+	case "resume":
+		return "play"
+	case "play pause", "play/pause", "toggle playback":
+		return "play-pause"
+	}
+	return word
+}
+
+// MediaService controls volume through wpctl, brightness through
+// brightnessctl and media players through playerctl
+type MediaService struct{}
+
+func NewMediaService() *MediaService {
+	return &MediaService{}
+}
+
+func (ms *MediaService) Name() string { return "media" }
+func (ms *MediaService) Description() string {
+	return "Control volume, microphone, screen brightness and media players"
+}
+
+// Keywords is empty: "play" or "volume" alone appear in too many other
+// queries, so MatchesQuery recognizes whole commands instead
+func (ms *MediaService) Keywords() []string { return nil }
+
+// MatchesQuery reports whether the whole query is a media command
+func (ms *MediaService) MatchesQuery(query string) bool {
+	_, ok := parseMediaCommand(query)
+	return ok
+}
+
+// HasSideEffects reports whether the command changes a level or the player
+// rather than asking about it
+func (ms *MediaService) HasSideEffects(intent Intent) bool {
+	cmd, ok := parseMediaCommand(intent.Query)
+	return !ok || cmd.action != "status"
+}
+
+func (ms *MediaService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	cmd, ok := parseMediaCommand(intent.Query)
+	if !ok {
+		return nil, fmt.Errorf("not a media command: %q", intent.Query)
+	}
+	result := MediaResult{Query: intent.Query, Control: cmd.control, Action: cmd.action}
+
+	var err error
+	switch cmd.control {
+	case MediaVolume, MediaMic:
+		result.Audio, err = controlAudio(ctx, cmd)
+	case MediaBrightness:
+		result.Brightness, err = controlBrightness(ctx, cmd)
+	case MediaPlayer:
+		result.Player, err = controlPlayer(ctx, cmd)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Output = describeMedia(result)
+	result.Success = true
+	return result, nil
+}
+
+// controlAudio changes the default sink or source and returns its new state
+func controlAudio(ctx context.Context, cmd mediaCommand) (*AudioState, error) {
+	if _, err := exec.LookPath("wpctl"); err != nil {
+		return nil, fmt.Errorf("wpctl is not installed")
+	}
+	device := "@DEFAULT_AUDIO_SINK@"
+	if cmd.control == MediaMic {
+		device = "@DEFAULT_AUDIO_SOURCE@"
+	}
+
+	var args []string
+	switch cmd.action {
+	case "set":
+		args = []string{"set-volume", "-l", "1.0", device, fmt.Sprintf("%d%%", cmd.amount)}
+	case "up", "down":
+		sign := map[string]string{"up": "+", "down": "-"}[cmd.action]
+		args = []string{"set-volume", "-l", "1.0", device, fmt.Sprintf("%d%%%s", firstPositive(cmd.amount, volumeStep), sign)}
+	case "mute":
+		args = []string{"set-mute", device, "1"}
+	case "unmute":
+		args = []string{"set-mute", device, "0"}
+	case "togglemute":
+		args = []string{"set-mute", device, "toggle"}
+	}
+	if args != nil {
+		if output, err := commandContext(ctx, "wpctl", args...).CombinedOutput(); err != nil {
+			return nil, fmt.Errorf("wpctl %s failed: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+		}
+	}
+	// Changing the volume unmutes, as volume keys do
+	if cmd.action == "set" || cmd.action == "up" {
+		commandContext(ctx, "wpctl", "set-mute", device, "0").Run()
+	}
+
+	output, err := commandContext(ctx, "wpctl", "get-volume", device).Output()
+	if err != nil {
+		return nil, fmt.Errorf("wpctl get-volume failed: %w", err)
+	}
+	state, err := parseWpctlVolume(string(output))
+	if err != nil {
+		return nil, err
+	}
+	if inspect, err := commandContext(ctx, "wpctl", "inspect", device).Output(); err == nil {
+		state.Device = wpctlDescription(string(inspect))
+	}
+	return &state, nil
+}
+
+// parseWpctlVolume reads "Volume: 0.40" or "Volume: 0.40 [MUTED]"
+func parseWpctlVolume(output string) (AudioState, error) {
+	fields := strings.Fields(output)
+	if len(fields) < 2 || fields[0] != "Volume:" {
+		return AudioState{}, fmt.Errorf("unexpected wpctl output: %q", strings.TrimSpace(output))
+	}
+	volume, err := strconv.ParseFloat(fields[1], 64)
+	if err != nil {
+		return AudioState{}, fmt.Errorf("unexpected wpctl volume %q: %w", fields[1], err)
+	}
+	return AudioState{
+		Volume: int(volume*100 + 0.5),
+		Muted:  strings.Contains(output, "[MUTED]"),
+	}, nil
+}
+
+// wpctlDescription finds node.description in wpctl inspect output
+func wpctlDescription(output string) string {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), "*"))
+		if value, ok := strings.CutPrefix(line, "node.description = "); ok {
+			return strings.Trim(value, `"`)
+		}
+	}
+	return ""
+}
+
+// controlBrightness changes the backlight and returns its new state
+func controlBrightness(ctx context.Context, cmd mediaCommand) (*BrightnessState, error) {
+	if _, err := exec.LookPath("brightnessctl"); err != nil {
+		return nil, fmt.Errorf("brightnessctl is not installed")
+	}
+
+	// -m prints the state after the change; --min-value keeps the screen
+	// from going fully dark, which turns OLED panels off
+	args := []string{"-m"}
+	switch cmd.action {
+	case "set":
+		args = append(args, "--min-value=1", "set", fmt.Sprintf("%d%%", cmd.amount))
+	case "up":
+		args = append(args, "set", fmt.Sprintf("+%d%%", firstPositive(cmd.amount, brightnessStep)))
+	case "down":
+		args = append(args, "--min-value=1", "set", fmt.Sprintf("%d%%-", firstPositive(cmd.amount, brightnessStep)))
+	}
+	output, err := commandContext(ctx, "brightnessctl", args...).CombinedOutput()
+	if err != nil {
+		return nil, fmt.Errorf("brightnessctl failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	state, err := parseBrightnessctl(string(output))
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// parseBrightnessctl reads the last machine-readable line of brightnessctl:
+// device,class,current,percent,max
+func parseBrightnessctl(output string) (BrightnessState, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	fields := strings.Split(strings.TrimSpace(lines[len(lines)-1]), ",")
+	if len(fields) != 5 {
+		return BrightnessState{}, fmt.Errorf("unexpected brightnessctl output: %q", strings.TrimSpace(output))
+	}
+	current, err1 := strconv.Atoi(fields[2])
+	percent, err2 := strconv.Atoi(strings.TrimSuffix(fields[3], "%"))
+	maximum, err3 := strconv.Atoi(fields[4])
+	if err1 != nil || err2 != nil || err3 != nil {
+		return BrightnessState{}, fmt.Errorf("unexpected brightnessctl output: %q", strings.TrimSpace(output))
+	}
+	return BrightnessState{Device: fields[0], Current: current, Max: maximum, Percent: percent}, nil
+}
+
+// playerFormat asks playerctl for the fields of PlayerState, tab separated
+const playerFormat = "{{playerName}}\t{{status}}\t{{artist}}\t{{title}}\t{{album}}\t{{position}}\t{{mpris:length}}"
+
+// controlPlayer runs a playerctl command and returns the player's new state
+func controlPlayer(ctx context.Context, cmd mediaCommand) (*PlayerState, error) {
+	if _, err := exec.LookPath("playerctl"); err != nil {
+		return nil, fmt.Errorf("playerctl is not installed")
+	}
+
+	before, err := playerStatus(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if cmd.action == "status" {
+		return &before, nil
+	}
+	if output, err := commandContext(ctx, "playerctl", cmd.action).CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("playerctl %s failed: %w: %s", cmd.action, err, strings.TrimSpace(string(output)))
+	}
+
+	// Players take a moment to switch tracks or report the new status
+	after := before
+	for i := 0; i < 10; i++ {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(100 * time.Millisecond):
+		}
+		current, err := playerStatus(ctx)
+		if err != nil {
+			// Some players exit on stop; the command itself succeeded
+			if cmd.action == "stop" {
+				after.Status = "Stopped"
+			}
+			break
+		}
+		after = current
+		if after.Title != before.Title || after.Status != before.Status {
+			break
+		}
+	}
+	return &after, nil
+}
+
+// playerStatus reads the state of the active player
+func playerStatus(ctx context.Context) (PlayerState, error) {
+	output, err := commandContext(ctx, "playerctl", "metadata", "--format", playerFormat).CombinedOutput()
+	if err != nil {
+		if strings.Contains(string(output), "No players found") {
+			return PlayerState{}, fmt.Errorf("no media player is running")
+		}
+		return PlayerState{}, fmt.Errorf("playerctl metadata failed: %w: %s", err, strings.TrimSpace(string(output)))
+	}
+	return parsePlayerMetadata(string(output))
+}
+
+// parsePlayerMetadata reads a line of playerFormat; times are in microseconds
+func parsePlayerMetadata(output string) (PlayerState, error) {
+	fields := strings.Split(strings.TrimRight(output, "\n"), "\t")
+	if len(fields) != 7 {
+		return PlayerState{}, fmt.Errorf("unexpected playerctl output: %q", strings.TrimSpace(output))
+	}
+	position, _ := strconv.ParseFloat(fields[5], 64)
+	length, _ := strconv.ParseFloat(fields[6], 64)
+	return PlayerState{
+		Player:   fields[0],
+		Status:   fields[1],
+		Artist:   fields[2],
+		Title:    fields[3],
+		Album:    fields[4],
+		Position: position / 1e6,
+		Length:   length / 1e6,
+	}, nil
+}
+
+// describeMedia summarizes the new state, e.g. "Volume 40%"
+func describeMedia(result MediaResult) string {
+	switch {
+	case result.Audio != nil:
+		name := "Volume"
+		if result.Control == MediaMic {
+			name = "Microphone"
+		}
+		if result.Audio.Muted {
+			return fmt.Sprintf("%s muted (%d%%)", name, result.Audio.Volume)
+		}
+		return fmt.Sprintf("%s %d%%", name, result.Audio.Volume)
+	case result.Brightness != nil:
+		return fmt.Sprintf("Brightness %d%%", result.Brightness.Percent)
+	case result.Player != nil:
+		track := result.Player.Title
+		if result.Player.Artist != "" {
+			track = result.Player.Artist + " – " + track
+		}
+		return fmt.Sprintf("%s: %s (%s)", result.Player.Status, firstNonEmpty(track, "unknown track"), result.Player.Player)
+	}
+	return ""
+}
+
+func firstPositive(values ...int) int {
+	for _, v := range values {
+		if v > 0 {
+			return v
+		}
+	}
+	return 0
+}
@@ -0,0 +1,56 @@
+package services
+
+import "testing"
+
+func TestParseMediaCommand(t *testing.T) {
+	tests := []struct {
+		query string
+		want  mediaCommand
+	}{
+		{"volume 40", mediaCommand{control: MediaVolume, action: "set", amount: 40}},
+		{"set the volume to 150%", mediaCommand{control: MediaVolume, action: "set", amount: 100}},
+		{"brightness 70%", mediaCommand{control: MediaBrightness, action: "set", amount: 70}},
+		{"volume up", mediaCommand{control: MediaVolume, action: "up"}},
+		{"brightness down 10%", mediaCommand{control: MediaBrightness, action: "down", amount: 10}},
+		{"screen brightness lower by 20", mediaCommand{control: MediaBrightness, action: "down", amount: 20}},
+		{"turn up the volume by 10", mediaCommand{control: MediaVolume, action: "up", amount: 10}},
+		{"decrease my mic", mediaCommand{control: MediaMic, action: "down"}},
+		{"mute", mediaCommand{control: MediaVolume, action: "mute"}},
+		{"mute mic", mediaCommand{control: MediaMic, action: "mute"}},
+		{"unmute the microphone", mediaCommand{control: MediaMic, action: "unmute"}},
+		{"toggle mute", mediaCommand{control: MediaVolume, action: "togglemute"}},
+		{"turn the sound off", mediaCommand{control: MediaVolume, action: "mute"}},
+		{"what's the volume?", mediaCommand{control: MediaVolume, action: "status"}},
+		{"brightness level", mediaCommand{control: MediaBrightness, action: "status"}},
+		{"Louder!", mediaCommand{control: MediaVolume, action: "up"}},
+		{"dim the screen", mediaCommand{control: MediaBrightness, action: "down"}},
+		{"max volume", mediaCommand{control: MediaVolume, action: "set", amount: 100}},
+		{"next track", mediaCommand{control: MediaPlayer, action: "next"}},
+		{"skip this song", mediaCommand{control: MediaPlayer, action: "next"}},
+		{"prev", mediaCommand{control: MediaPlayer, action: "previous"}},
+		{"resume music", mediaCommand{control: MediaPlayer, action: "play"}},
+		{"play/pause", mediaCommand{control: MediaPlayer, action: "play-pause"}},
+		{"what's playing", mediaCommand{control: MediaPlayer, action: "status"}},
+	}
+	for _, tt := range tests {
+		got, ok := parseMediaCommand(tt.query)
+		if !ok || got != tt.want {
+			t.Errorf("parseMediaCommand(%q) = %+v, %v, want %+v", tt.query, got, ok, tt.want)
+		}
+	}
+}
+
+func TestParseMediaCommandRejects(t *testing.T) {
+	// Queries that mention media but are meant for other services
+	for _, query := range []string{
+		"play never gonna give you up",
+		"convert song.flac to mp3",
+		"find audio files",
+		"volume of a sphere with radius 3",
+		"mute firefox",
+	} {
+		if got, ok := parseMediaCommand(query); ok {
+			t.Errorf("parseMediaCommand(%q) = %+v, want no command", query, got)
+		}
+	}
+}
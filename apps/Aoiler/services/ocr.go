@@ -0,0 +1,441 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScreenSource is the OCRResult source of text read from a screen capture
+const ScreenSource = "screen"
+
+// OCROptions control how text is read from an image
+type OCROptions struct {
+	// Language is a tesseract language code, or several joined with "+"
+	Language string `json:"language"`
+	// PSM is the tesseract page segmentation mode; 0 leaves it to tesseract
+	PSM        int  `json:"psm"`
+	Preprocess bool `json:"preprocess"`
+	Clipboard  bool `json:"clipboard"`
+}
+
+// ocrLanguageNames maps the names used in queries to tesseract codes
+var ocrLanguageNames = map[string]string{
+	"english": "eng", "german": "deu", "french": "fra", "spanish": "spa",
+	"italian": "ita", "portuguese": "por", "dutch": "nld", "polish": "pol",
+	"czech": "ces", "swedish": "swe", "finnish": "fin", "danish": "dan",
+	"norwegian": "nor", "greek": "ell", "turkish": "tur", "russian": "rus",
+	"ukrainian": "ukr", "arabic": "ara", "hebrew": "heb", "hindi": "hin",
+	"japanese": "jpn", "korean": "kor", "chinese": "chi_sim", "vietnamese": "vie",
+}
+
+// ocrSegmentations maps query wording to page segmentation modes
+var ocrSegmentations = []struct {
+	psm   int
+	words []string
+}{
+	{7, []string{"single line", "one line"}},
+	{8, []string{"single word", "one word"}},
+	{6, []string{"block", "paragraph", "column"}},
+	{11, []string{"sparse", "scattered"}},
+}
+
+// OCRService reads text from screen captures and image files with tesseract
+type OCRService struct {
+	history *OCRHistory
+
+	mu      sync.RWMutex
+	options OCROptions
+	// keepHistory records every capture in history
+	keepHistory bool
+}
+
+func NewOCRService(history *OCRHistory) *OCRService {
+	cfg := DefaultConfig().Services.OCR
+	return &OCRService{history: history, options: ocrOptions(cfg), keepHistory: cfg.History}
+}
+
+func ocrOptions(cfg OCRConfig) OCROptions {
+	options := OCROptions{
+		Language:   cfg.Language,
+		PSM:        cfg.PSM,
+		Preprocess: cfg.Preprocess,
+		Clipboard:  cfg.Clipboard,
+	}
+	if options.Language == "" {
+		options.Language = "eng"
+	}
+	return options
+}
+
+// ApplyConfig sets the default language, segmentation, preprocessing,
+// clipboard and history options
+func (ocr *OCRService) ApplyConfig(cfg Config) {
+	ocr.mu.Lock()
+	defer ocr.mu.Unlock()
+	ocr.options = ocrOptions(cfg.Services.OCR)
+	ocr.keepHistory = cfg.Services.OCR.History
+}
+
+func (ocr *OCRService) Name() string        { return "ocr" }
+func (ocr *OCRService) Description() string { return "Extract text from screen area" }
+
+func (ocr *OCRService) Keywords() []string {
+	return []string{"ocr", "extract text", "read screen", "capture text", "screenshot text"}
+}
+
+func (ocr *OCRService) Params() map[string]string {
+	return map[string]string{
+		ParamPath:  "image file to read; omit to capture a screen region. Questions about earlier captures search the history instead",
+		"language": `tesseract language code such as "eng", "deu" or "eng+deu"`,
+		"psm":      "tesseract page segmentation mode: 3 automatic, 6 a block of text, 7 a single line, 8 a single word, 11 sparse text",
+	}
+}
+
+func (ocr *OCRService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	if isOCRHistoryQuery(strings.ToLower(intent.Query)) {
+		return ocr.SearchHistory(intent.Query)
+	}
+
+	opts, err := ocr.queryOptions(ctx, intent)
+	if err != nil {
+		return OCRResult{}, err
+	}
+	if path := intent.Params[ParamPath]; path != "" && ocr.AcceptsPath(path) {
+		return ocr.ExtractTextFromFile(ctx, expandHome(path), opts)
+	}
+	return ocr.ExtractText(ctx, opts)
+}
+
+// queryOptions starts from the configured options and applies the language,
+// segmentation mode and clipboard wish of the query
+func (ocr *OCRService) queryOptions(ctx context.Context, intent Intent) (OCROptions, error) {
+	ocr.mu.RLock()
+	opts := ocr.options
+	ocr.mu.RUnlock()
+
+	lowerQuery := strings.ToLower(intent.Query)
+	if language := intent.Params["language"]; language != "" {
+		opts.Language = language
+	} else if language := queryLanguage(lowerQuery); language != "" {
+		opts.Language = language
+	}
+
+	if psm := intent.Params["psm"]; psm != "" {
+		n, err := strconv.Atoi(psm)
+		if err != nil {
+			return opts, fmt.Errorf("invalid page segmentation mode %q", psm)
+		}
+		opts.PSM = n
+	} else if psm, ok := queryPSM(lowerQuery); ok {
+		opts.PSM = psm
+	}
+	if opts.PSM < 0 || opts.PSM > 13 {
+		return opts, fmt.Errorf("page segmentation mode must be between 0 and 13")
+	}
+
+	if containsWord(lowerQuery, "copy") || containsWord(lowerQuery, "clipboard") {
+		opts.Clipboard = true
+	}
+
+	language, err := ocr.resolveLanguage(ctx, opts.Language)
+	if err != nil {
+		return opts, err
+	}
+	opts.Language = language
+	return opts, nil
+}
+
+// queryLanguage returns the tesseract code of a language the query names,
+// as in "ocr this in german" or "extract text with lang deu"
+func queryLanguage(lowerQuery string) string {
+	words := strings.Fields(lowerQuery)
+	for i, word := range words {
+		if code, ok := ocrLanguageNames[word]; ok {
+			return code
+		}
+		if (word == "lang" || word == "language" || word == "-l") && i+1 < len(words) {
+			next := words[i+1]
+			if code, ok := ocrLanguageNames[next]; ok {
+				return code
+			}
+			return next
+		}
+	}
+	return ""
+}
+
+// queryPSM returns the page segmentation mode the query asks for
+func queryPSM(lowerQuery string) (int, bool) {
+	words := strings.Fields(lowerQuery)
+	for i, word := range words {
+		if word == "psm" && i+1 < len(words) {
+			if n, err := strconv.Atoi(words[i+1]); err == nil {
+				return n, true
+			}
+		}
+	}
+	for _, segmentation := range ocrSegmentations {
+		for _, phrase := range segmentation.words {
+			if containsWord(lowerQuery, phrase) {
+				return segmentation.psm, true
+			}
+		}
+	}
+	return 0, false
+}
+
+// Languages returns the languages tesseract has data for. They are not
+// cached, so newly installed language packs show up right away.
+func (ocr *OCRService) Languages(ctx context.Context) ([]string, error) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return nil, fmt.Errorf("tesseract is not installed")
+	}
+	output, err := commandContext(ctx, "tesseract", "--list-langs").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tesseract languages: %w", err)
+	}
+
+	// The first line is "List of available languages in ...:"
+	languages := []string{}
+	for _, line := range strings.Split(string(output), "\n")[1:] {
+		if language := strings.TrimSpace(line); language != "" && language != "osd" {
+			languages = append(languages, language)
+		}
+	}
+	sort.Strings(languages)
+	return languages, nil
+}
+
+// resolveLanguage checks that every part of a language such as "eng+deu"
+// is installed
+func (ocr *OCRService) resolveLanguage(ctx context.Context, language string) (string, error) {
+	installed, err := ocr.Languages(ctx)
+	if err != nil {
+		return "", err
+	}
+	if len(installed) == 0 {
+		return "", fmt.Errorf("no tesseract languages are installed")
+	}
+
+	for _, part := range strings.Split(language, "+") {
+		found := false
+		for _, l := range installed {
+			if l == part {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return "", fmt.Errorf("tesseract language %q is not installed (installed: %s)", part, strings.Join(installed, ", "))
+		}
+	}
+	return language, nil
+}
+
+// AcceptsPath reports whether the file is an image tesseract can read
+func (ocr *OCRService) AcceptsPath(path string) bool {
+	imageExts := map[string]bool{
+		".png": true, ".jpg": true, ".jpeg": true,
+		".bmp": true, ".tiff": true, ".tif": true,
+		".gif": true, ".webp": true,
+	}
+	return imageExts[strings.ToLower(filepath.Ext(path))]
+}
+
+// ExtractText reads the text of a screen region selected with slurp
+func (ocr *OCRService) ExtractText(ctx context.Context, opts OCROptions) (OCRResult, error) {
+	img, err := captureRegion(ctx)
+	if err != nil {
+		return OCRResult{Success: false}, err
+	}
+	return ocr.recognize(ctx, img, ScreenSource, opts)
+}
+
+// ExtractTextFromFile performs OCR on an uploaded image file
+func (ocr *OCRService) ExtractTextFromFile(ctx context.Context, imagePath string, opts OCROptions) (OCRResult, error) {
+	file, err := os.Open(imagePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return OCRResult{Success: false}, fmt.Errorf("image file not found: %s", imagePath)
+		}
+		return OCRResult{Success: false}, fmt.Errorf("failed to open %s: %w", imagePath, err)
+	}
+	img, _, err := image.Decode(file)
+	file.Close()
+	if err != nil {
+		// Go cannot decode every format tesseract reads, such as WebP and
+		// TIFF; those are passed on as they are
+		opts.Preprocess = false
+		return ocr.recognizeFile(ctx, imagePath, imagePath, opts, nil)
+	}
+	return ocr.recognize(ctx, img, imagePath, opts)
+}
+
+// recognize preprocesses the image if enabled and reads it with tesseract
+func (ocr *OCRService) recognize(ctx context.Context, img image.Image, source string, opts OCROptions) (OCRResult, error) {
+	original := img
+	if opts.Preprocess {
+		img = preprocessImage(img)
+	}
+
+	tmp, err := os.CreateTemp("", "aoiler-ocr-*.png")
+	if err != nil {
+		return OCRResult{Success: false}, fmt.Errorf("failed to create OCR image: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	err = png.Encode(tmp, img)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return OCRResult{Success: false}, fmt.Errorf("failed to write OCR image: %w", err)
+	}
+
+	return ocr.recognizeFile(ctx, tmp.Name(), source, opts, original)
+}
+
+// recognizeFile runs tesseract on an image file, copies the text to the
+// clipboard if asked to and records it in the history, with a thumbnail of
+// original when it is set
+func (ocr *OCRService) recognizeFile(ctx context.Context, imagePath, source string, opts OCROptions, original image.Image) (OCRResult, error) {
+	args := []string{imagePath, "stdout", "-l", opts.Language}
+	if opts.PSM != 0 {
+		args = append(args, "--psm", strconv.Itoa(opts.PSM))
+	}
+	var stderr bytes.Buffer
+	cmd := commandContext(ctx, "tesseract", args...)
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return OCRResult{Success: false}, fmt.Errorf("OCR failed: %w: %s", err, message)
+		}
+		return OCRResult{Success: false}, fmt.Errorf("OCR failed: %w", err)
+	}
+
+	result := OCRResult{
+		Text:         strings.TrimSpace(string(output)),
+		Success:      true,
+		Source:       source,
+		Language:     opts.Language,
+		PSM:          opts.PSM,
+		Preprocessed: opts.Preprocess,
+	}
+	if result.Text == "" {
+		return OCRResult{Success: false}, fmt.Errorf("no text detected")
+	}
+
+	if opts.Clipboard {
+		if err := copyToClipboard(ctx, result.Text); err != nil {
+			fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		} else {
+			result.Copied = true
+		}
+	}
+
+	ocr.mu.RLock()
+	keepHistory := ocr.keepHistory
+	ocr.mu.RUnlock()
+	if keepHistory {
+		capture, err := ocr.history.Add(OCRCapture{
+			Text:     result.Text,
+			Source:   source,
+			Language: opts.Language,
+		}, original)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "aoiler: %v\n", err)
+		} else {
+			result.HistoryID = capture.ID
+		}
+	}
+	return result, nil
+}
+
+// SearchHistory answers a question about earlier captures, such as "what
+// did I OCR yesterday about invoices"
+func (ocr *OCRService) SearchHistory(query string) (OCRHistoryResult, error) {
+	q := ParseOCRHistoryQuery(query, time.Now())
+	captures, err := ocr.history.Search(q)
+	if err != nil {
+		return OCRHistoryResult{}, err
+	}
+	return OCRHistoryResult{Query: query, Captures: captures, Filters: q.Filters, Success: true}, nil
+}
+
+// captureRegion lets the user select a screen region with slurp and
+// captures it with grim
+func captureRegion(ctx context.Context) (image.Image, error) {
+	for _, tool := range []string{"slurp", "grim"} {
+		if _, err := exec.LookPath(tool); err != nil {
+			return nil, fmt.Errorf("%s is not installed (needed to capture the screen)", tool)
+		}
+	}
+
+	geometry, err := commandContext(ctx, "slurp").Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		// slurp exits with an error when the selection is cancelled with Escape
+		return nil, fmt.Errorf("screen selection cancelled")
+	}
+
+	var stderr bytes.Buffer
+	cmd := commandContext(ctx, "grim", "-g", strings.TrimSpace(string(geometry)), "-t", "png", "-")
+	cmd.Stderr = &stderr
+	data, err := cmd.Output()
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("screenshot failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	img, err := png.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read screenshot: %w", err)
+	}
+	return img, nil
+}
+
+// copyToClipboard puts text on the Wayland clipboard
+func copyToClipboard(ctx context.Context, text string) error {
+	if _, err := exec.LookPath("wl-copy"); err != nil {
+		return fmt.Errorf("wl-copy is not installed (needed for the clipboard)")
+	}
+	// wl-copy stays in the background to serve the clipboard, so its output
+	// is not captured: a pipe held open by it would make Run wait
+	cmd := commandContext(ctx, "wl-copy")
+	cmd.Stdin = strings.NewReader(text)
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("wl-copy failed: %w", err)
+	}
+	return nil
+}
+
+// GetPathSuggestions for OCR file upload - shows image files
+func (ocr *OCRService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
+	fs := NewFileSearchService()
+	result, err := fs.GetPathSuggestions(input, true)
+
+	if err != nil {
+		return result, err
+	}
+
+	// Filter to only show image files
+	result.Suggestions = filterSuggestions(result.Suggestions, ocr)
+	return result, nil
+}
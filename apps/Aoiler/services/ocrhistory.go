@@ -0,0 +1,352 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// maxOCRHistory is how many captures are kept; pinned ones are never dropped
+	maxOCRHistory = 500
+	// thumbnailWidth and thumbnailHeight bound the size of capture thumbnails
+	thumbnailWidth  = 320
+	thumbnailHeight = 180
+)
+
+// OCRCapture is a piece of text read by OCR
+type OCRCapture struct {
+	ID        string    `json:"id"`
+	Text      string    `json:"text"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Source is the image file read, or "screen" for a capture
+	Source       string `json:"source"`
+	Language     string `json:"language"`
+	Pinned       bool   `json:"pinned"`
+	HasThumbnail bool   `json:"hasThumbnail"`
+}
+
+// OCRHistoryQuery selects captures from the history
+type OCRHistoryQuery struct {
+	// Terms must all appear in the text or the source
+	Terms   []string
+	After   time.Time
+	Before  time.Time
+	Pinned  bool
+	Filters []string
+}
+
+// OCRHistoryResult lists the captures matching a history query
+type OCRHistoryResult struct {
+	Query    string       `json:"query"`
+	Captures []OCRCapture `json:"captures"`
+	Filters  []string     `json:"filters,omitempty"`
+	Success  bool         `json:"success"`
+}
+
+// ocrHistoryWords are what mark a query as a question about past captures
+var ocrHistoryWords = []string{"history", "did i", "have i", "previous", "earlier", "past ocr", "ocr'd", "pinned"}
+
+// ocrHistoryStopWords carry no information about the captures being looked for
+var ocrHistoryStopWords = map[string]bool{
+	"what": true, "did": true, "have": true, "ocr": true, "ocr'd": true, "about": true,
+	"history": true, "text": true, "texts": true, "capture": true, "captures": true,
+	"captured": true, "extract": true, "extracted": true, "read": true, "scan": true,
+	"scanned": true, "previous": true, "earlier": true, "past": true, "pinned": true,
+	"mention": true, "mentioning": true, "containing": true, "on": true, "at": true,
+	"anything": true, "something": true, "everything": true, "stuff": true,
+}
+
+// OCRHistory keeps captured text in ~/.local/share/aoiler/ocr-history, with
+// the captures in one JSON file and their thumbnails next to it
+type OCRHistory struct {
+	mu       sync.Mutex
+	dir      string
+	captures []OCRCapture
+	loaded   bool
+}
+
+// NewOCRHistory creates a history under ~/.local/share/aoiler/ocr-history
+func NewOCRHistory() *OCRHistory {
+	return &OCRHistory{dir: filepath.Join(dataDir(), "ocr-history")}
+}
+
+// Add records a capture, with a thumbnail of img when it is set, and drops
+// the oldest unpinned captures beyond maxOCRHistory
+func (h *OCRHistory) Add(capture OCRCapture, img image.Image) (OCRCapture, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return capture, err
+	}
+
+	capture.ID = NewRequestID()
+	if capture.CreatedAt.IsZero() {
+		capture.CreatedAt = time.Now()
+	}
+	if img != nil {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, thumbnail(img, thumbnailWidth, thumbnailHeight)); err == nil {
+			if err := writeFileAtomic(h.thumbnailPath(capture.ID), buf.Bytes(), 0600); err == nil {
+				capture.HasThumbnail = true
+			}
+		}
+	}
+
+	h.captures = append([]OCRCapture{capture}, h.captures...)
+	for i := len(h.captures) - 1; i >= 0 && len(h.captures) > maxOCRHistory; i-- {
+		if !h.captures[i].Pinned {
+			os.Remove(h.thumbnailPath(h.captures[i].ID))
+			h.captures = append(h.captures[:i], h.captures[i+1:]...)
+		}
+	}
+	return capture, h.save()
+}
+
+// Search returns the captures matching query, pinned ones first and then
+// newest first
+func (h *OCRHistory) Search(query OCRHistoryQuery) ([]OCRCapture, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return nil, err
+	}
+
+	matches := []OCRCapture{}
+	for _, capture := range h.captures {
+		if query.matches(capture) {
+			matches = append(matches, capture)
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].Pinned && !matches[j].Pinned })
+	return matches, nil
+}
+
+// Get returns a capture by ID
+func (h *OCRHistory) Get(id string) (OCRCapture, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return OCRCapture{}, err
+	}
+	i := h.index(id)
+	if i < 0 {
+		return OCRCapture{}, fmt.Errorf("capture not found: %s", id)
+	}
+	return h.captures[i], nil
+}
+
+// Pin keeps a capture at the top of the history and out of the cleanup, or
+// releases it again
+func (h *OCRHistory) Pin(id string, pinned bool) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+	i := h.index(id)
+	if i < 0 {
+		return fmt.Errorf("capture not found: %s", id)
+	}
+	h.captures[i].Pinned = pinned
+	return h.save()
+}
+
+// Delete removes a capture and its thumbnail
+func (h *OCRHistory) Delete(id string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.load(); err != nil {
+		return err
+	}
+	i := h.index(id)
+	if i < 0 {
+		return fmt.Errorf("capture not found: %s", id)
+	}
+	os.Remove(h.thumbnailPath(id))
+	h.captures = append(h.captures[:i], h.captures[i+1:]...)
+	return h.save()
+}
+
+// Copy puts the text of a capture on the clipboard again
+func (h *OCRHistory) Copy(ctx context.Context, id string) error {
+	capture, err := h.Get(id)
+	if err != nil {
+		return err
+	}
+	return copyToClipboard(ctx, capture.Text)
+}
+
+// Thumbnail returns the thumbnail of a capture as a PNG data URL
+func (h *OCRHistory) Thumbnail(id string) (string, error) {
+	capture, err := h.Get(id)
+	if err != nil {
+		return "", err
+	}
+	if !capture.HasThumbnail {
+		return "", fmt.Errorf("capture %s has no thumbnail", id)
+	}
+	data, err := os.ReadFile(h.thumbnailPath(id))
+	if err != nil {
+		return "", fmt.Errorf("failed to read thumbnail: %w", err)
+	}
+	return "data:image/png;base64," + base64.StdEncoding.EncodeToString(data), nil
+}
+
+func (h *OCRHistory) index(id string) int {
+	for i, capture := range h.captures {
+		if capture.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (h *OCRHistory) path() string {
+	return filepath.Join(h.dir, "history.json")
+}
+
+// thumbnailPath returns where a capture's thumbnail is kept. IDs come from
+// the history itself, so they cannot escape the directory.
+func (h *OCRHistory) thumbnailPath(id string) string {
+	return filepath.Join(h.dir, "thumbnails", id+".png")
+}
+
+// load reads the history file the first time it is needed
+func (h *OCRHistory) load() error {
+	if h.loaded {
+		return nil
+	}
+	data, err := os.ReadFile(h.path())
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to read OCR history: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &h.captures); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", h.path(), err)
+		}
+	}
+	h.loaded = true
+	return nil
+}
+
+func (h *OCRHistory) save() error {
+	data, err := json.MarshalIndent(h.captures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode OCR history: %w", err)
+	}
+	if err := writeFileAtomic(h.path(), data, 0600); err != nil {
+		return fmt.Errorf("failed to save OCR history: %w", err)
+	}
+	return nil
+}
+
+// isOCRHistoryQuery reports whether a query asks about earlier captures
+// rather than for a new one
+func isOCRHistoryQuery(lowerQuery string) bool {
+	for _, word := range ocrHistoryWords {
+		if containsWord(lowerQuery, word) {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseOCRHistoryQuery reads a question such as "what did I OCR yesterday
+// about invoices" into search terms and a time range. Relative dates are
+// resolved against now.
+func ParseOCRHistoryQuery(query string, now time.Time) OCRHistoryQuery {
+	lowerQuery := strings.ToLower(query)
+	// Dates are read the same way as in file searches
+	fileQuery := ParseFileQuery(lowerQuery, now)
+
+	q := OCRHistoryQuery{
+		After:  fileQuery.ModifiedAfter,
+		Before: fileQuery.ModifiedBefore,
+		Pinned: containsWord(lowerQuery, "pinned"),
+	}
+	for _, term := range fileQuery.Terms {
+		if !ocrHistoryStopWords[term] {
+			q.Terms = append(q.Terms, term)
+		}
+	}
+
+	if len(q.Terms) > 0 {
+		q.Filters = append(q.Filters, "containing "+strings.Join(q.Terms, ", "))
+	}
+	if !q.After.IsZero() {
+		q.Filters = append(q.Filters, "after "+q.After.Format("2006-01-02 15:04"))
+	}
+	if !q.Before.IsZero() {
+		q.Filters = append(q.Filters, "before "+q.Before.Format("2006-01-02 15:04"))
+	}
+	if q.Pinned {
+		q.Filters = append(q.Filters, "pinned")
+	}
+	return q
+}
+
+func (q OCRHistoryQuery) matches(capture OCRCapture) bool {
+	if q.Pinned && !capture.Pinned {
+		return false
+	}
+	if !q.After.IsZero() && capture.CreatedAt.Before(q.After) {
+		return false
+	}
+	if !q.Before.IsZero() && !capture.CreatedAt.Before(q.Before) {
+		return false
+	}
+	text := strings.ToLower(capture.Text + "\n" + capture.Source)
+	for _, term := range q.Terms {
+		// "invoices" should find "invoice"
+		if !strings.Contains(text, term) && !strings.Contains(text, strings.TrimSuffix(term, "s")) {
+			return false
+		}
+	}
+	return true
+}
+
+// thumbnail scales img down to fit within width x height, averaging the
+// pixels each thumbnail pixel covers
+func thumbnail(img image.Image, width, height int) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w == 0 || h == 0 {
+		return img
+	}
+	scale := min(float64(width)/float64(w), float64(height)/float64(h))
+	if scale >= 1 {
+		return img
+	}
+
+	tw, th := max(1, int(float64(w)*scale)), max(1, int(float64(h)*scale))
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	// Sample at most a few pixels per direction to stay fast on 4K captures
+	const samples = 4
+	for y := range th {
+		for x := range tw {
+			var r, g, b, a, n uint32
+			for sy := range samples {
+				for sx := range samples {
+					px := bounds.Min.X + (x*samples+sx)*w/(tw*samples)
+					py := bounds.Min.Y + (y*samples+sy)*h/(th*samples)
+					pr, pg, pb, pa := img.At(px, py).RGBA()
+					r, g, b, a, n = r+pr, g+pg, b+pb, a+pa, n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{uint16(r / n), uint16(g / n), uint16(b / n), uint16(a / n)})
+		}
+	}
+	return dst
+}
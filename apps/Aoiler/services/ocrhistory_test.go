@@ -0,0 +1,177 @@
+package services
+
+import (
+	"image"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseOCRHistoryQuery(t *testing.T) {
+	now := time.Date(2026, 3, 18, 15, 0, 0, 0, time.Local)
+	yesterday := time.Date(2026, 3, 17, 0, 0, 0, 0, time.Local)
+	today := time.Date(2026, 3, 18, 0, 0, 0, 0, time.Local)
+
+	q := ParseOCRHistoryQuery("what did I OCR yesterday about invoices", now)
+	want := OCRHistoryQuery{
+		Terms:   []string{"invoices"},
+		After:   yesterday,
+		Before:  today,
+		Filters: []string{"containing invoices", "after 2026-03-17 00:00", "before 2026-03-18 00:00"},
+	}
+	if !reflect.DeepEqual(q, want) {
+		t.Errorf("ParseOCRHistoryQuery = %+v, want %+v", q, want)
+	}
+
+	q = ParseOCRHistoryQuery("show pinned captures", now)
+	if !q.Pinned || len(q.Terms) != 0 || !reflect.DeepEqual(q.Filters, []string{"pinned"}) {
+		t.Errorf("ParseOCRHistoryQuery(pinned) = %+v, want only pinned", q)
+	}
+}
+
+func TestIsOCRHistoryQuery(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"what did i ocr yesterday", true},
+		{"ocr history", true},
+		{"show pinned captures", true},
+		{"extract text from screen", false},
+		{"ocr ~/scan.png", false},
+	}
+	for _, tt := range tests {
+		if got := isOCRHistoryQuery(tt.query); got != tt.want {
+			t.Errorf("isOCRHistoryQuery(%q) = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
+
+func TestOCRHistoryQueryMatches(t *testing.T) {
+	at := time.Date(2026, 3, 17, 12, 0, 0, 0, time.Local)
+	capture := OCRCapture{Text: "Invoice #42\nTotal: 30 EUR", Source: "screen", CreatedAt: at}
+	tests := []struct {
+		name  string
+		query OCRHistoryQuery
+		want  bool
+	}{
+		{"plural term", OCRHistoryQuery{Terms: []string{"invoices"}}, true},
+		{"source", OCRHistoryQuery{Terms: []string{"screen", "total"}}, true},
+		{"missing term", OCRHistoryQuery{Terms: []string{"invoice", "receipt"}}, false},
+		{"in range", OCRHistoryQuery{After: at.Add(-time.Hour), Before: at.Add(time.Hour)}, true},
+		{"before is exclusive", OCRHistoryQuery{Before: at}, false},
+		{"too early", OCRHistoryQuery{After: at.Add(time.Minute)}, false},
+		{"not pinned", OCRHistoryQuery{Pinned: true}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.query.matches(capture); got != tt.want {
+			t.Errorf("%s: matches = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOCRHistory(t *testing.T) {
+	dir := t.TempDir()
+	h := &OCRHistory{dir: dir}
+
+	older, err := h.Add(OCRCapture{Text: "meeting notes", Source: "screen", CreatedAt: time.Now().Add(-time.Hour)}, nil)
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	newer, err := h.Add(OCRCapture{Text: "invoice 42", Source: "/tmp/scan.png"}, image.NewRGBA(image.Rect(0, 0, 640, 360)))
+	if err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if older.ID == "" || newer.ID == older.ID || older.HasThumbnail || !newer.HasThumbnail {
+		t.Fatalf("Add = %+v and %+v, want distinct IDs and a thumbnail only for the second", older, newer)
+	}
+	data, err := h.Thumbnail(newer.ID)
+	if err != nil || !strings.HasPrefix(data, "data:image/png;base64,") {
+		t.Errorf("Thumbnail = %.40q, %v; want a PNG data URL", data, err)
+	}
+	if _, err := h.Thumbnail(older.ID); err == nil {
+		t.Error("Thumbnail succeeded for a capture without one")
+	}
+
+	// Newest first, pinned before both
+	if err := h.Pin(older.ID, true); err != nil {
+		t.Fatal(err)
+	}
+	third, _ := h.Add(OCRCapture{Text: "third"}, nil)
+	got, err := h.Search(OCRHistoryQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := captureIDs(got); !reflect.DeepEqual(ids, []string{older.ID, third.ID, newer.ID}) {
+		t.Errorf("Search order = %v, want pinned, then newest first", ids)
+	}
+
+	if err := h.Delete(newer.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(h.thumbnailPath(newer.ID)); !os.IsNotExist(err) {
+		t.Errorf("thumbnail of a deleted capture is still there: %v", err)
+	}
+	if err := h.Delete(newer.ID); err == nil {
+		t.Error("deleting a missing capture succeeded")
+	}
+
+	// A new history reads what was saved
+	reloaded := &OCRHistory{dir: dir}
+	got, err = reloaded.Search(OCRHistoryQuery{Pinned: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := captureIDs(got); !reflect.DeepEqual(ids, []string{older.ID}) {
+		t.Errorf("reloaded pinned captures = %v, want %s", ids, older.ID)
+	}
+}
+
+func TestOCRHistoryCleanup(t *testing.T) {
+	// The oldest capture is pinned, so the one before it goes
+	h := &OCRHistory{dir: t.TempDir(), loaded: true}
+	for i := range maxOCRHistory {
+		h.captures = append(h.captures, OCRCapture{ID: strconv.Itoa(i), Pinned: i == maxOCRHistory-1})
+	}
+	if _, err := h.Add(OCRCapture{Text: "new"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if len(h.captures) != maxOCRHistory {
+		t.Fatalf("history holds %d captures, want %d", len(h.captures), maxOCRHistory)
+	}
+	if h.index(strconv.Itoa(maxOCRHistory-1)) < 0 {
+		t.Error("the pinned capture was dropped")
+	}
+	if h.index(strconv.Itoa(maxOCRHistory-2)) >= 0 {
+		t.Error("the oldest unpinned capture was kept")
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	tests := []struct {
+		w, h int
+		want image.Point
+	}{
+		{1920, 1080, image.Pt(320, 180)},
+		{400, 1000, image.Pt(72, 180)},
+		{100, 50, image.Pt(100, 50)},
+		{0, 0, image.Pt(0, 0)},
+	}
+	for _, tt := range tests {
+		got := thumbnail(image.NewRGBA(image.Rect(0, 0, tt.w, tt.h)), thumbnailWidth, thumbnailHeight)
+		if size := got.Bounds().Size(); size != tt.want {
+			t.Errorf("thumbnail(%dx%d) = %v, want %v", tt.w, tt.h, size, tt.want)
+		}
+	}
+}
+
+func captureIDs(captures []OCRCapture) []string {
+	ids := make([]string, len(captures))
+	for i, capture := range captures {
+		ids[i] = capture.ID
+	}
+	return ids
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+const (
+	// ocrTargetHeight is the size small captures are scaled up towards;
+	// tesseract reads text best when letters are 20-30 pixels tall
+	ocrTargetHeight = 1800
+	// maxOCRScale keeps a tiny capture from growing into a huge image
+	maxOCRScale = 4
+	// maxSkew is the largest rotation, in degrees, deskewing corrects
+	maxSkew = 10.0
+)
+
+// preprocessImage prepares an image for tesseract: it is converted to
+// grayscale, scaled up when small, thresholded to black text on white and
+// straightened
+func preprocessImage(img image.Image) *image.Gray {
+	gray := toGray(img)
+	gray = upscale(gray)
+	binarize(gray)
+	if angle := skewAngle(gray); math.Abs(angle) >= 0.25 {
+		gray = rotate(gray, -angle)
+		binarize(gray)
+	}
+	return gray
+}
+
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := range bounds.Dy() {
+		for x := range bounds.Dx() {
+			gray.Set(x, y, color.GrayModel.Convert(img.At(bounds.Min.X+x, bounds.Min.Y+y)))
+		}
+	}
+	return gray
+}
+
+// upscale scales small images up with bilinear interpolation
+func upscale(src *image.Gray) *image.Gray {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	scale := min(maxOCRScale, ocrTargetHeight/max(h, 1))
+	if scale < 2 || w == 0 {
+		return src
+	}
+
+	dst := image.NewGray(image.Rect(0, 0, w*scale, h*scale))
+	for y := range h * scale {
+		sy := (float64(y)+0.5)/float64(scale) - 0.5
+		for x := range w * scale {
+			sx := (float64(x)+0.5)/float64(scale) - 0.5
+			dst.Pix[y*dst.Stride+x] = sampleBilinear(src, sx, sy, 255)
+		}
+	}
+	return dst
+}
+
+// binarize thresholds the image in place with Otsu's method. Light text on
+// a dark background, as in dark themes, is inverted.
+func binarize(img *image.Gray) {
+	var histogram [256]int
+	for _, p := range img.Pix {
+		histogram[p]++
+	}
+	threshold := otsuThreshold(histogram, len(img.Pix))
+
+	dark := 0
+	for _, p := range img.Pix {
+		if p <= threshold {
+			dark++
+		}
+	}
+	invert := dark > len(img.Pix)/2
+
+	for i, p := range img.Pix {
+		if (p <= threshold) != invert {
+			img.Pix[i] = 0
+		} else {
+			img.Pix[i] = 255
+		}
+	}
+}
+
+// otsuThreshold returns the gray level that best separates the histogram
+// into two classes
+func otsuThreshold(histogram [256]int, total int) uint8 {
+	var sum float64
+	for i, count := range histogram {
+		sum += float64(i * count)
+	}
+
+	var sumBelow, best float64
+	var weightBelow int
+	threshold := uint8(127)
+	for i, count := range histogram {
+		weightBelow += count
+		if weightBelow == 0 {
+			continue
+		}
+		weightAbove := total - weightBelow
+		if weightAbove == 0 {
+			break
+		}
+		sumBelow += float64(i * count)
+		meanBelow := sumBelow / float64(weightBelow)
+		meanAbove := (sum - sumBelow) / float64(weightAbove)
+		between := float64(weightBelow) * float64(weightAbove) * (meanBelow - meanAbove) * (meanBelow - meanAbove)
+		if between > best {
+			best, threshold = between, uint8(i)
+		}
+	}
+	return threshold
+}
+
+// skewAngle estimates how many degrees the text lines of a binarized image
+// are rotated. Lines are straightest where the row profile of the dark
+// pixels is most uneven, so a coarse and then a fine search look for the
+// angle with the largest variance.
+func skewAngle(img *image.Gray) float64 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	var points [][2]float64
+	for y := range h {
+		for x := range w {
+			if img.Pix[y*img.Stride+x] == 0 {
+				points = append(points, [2]float64{float64(x), float64(y)})
+			}
+		}
+	}
+	if len(points) < 100 {
+		return 0
+	}
+	// A sample is enough to find the angle and keeps large images fast
+	if step := len(points) / 50000; step > 1 {
+		sampled := points[:0]
+		for i := 0; i < len(points); i += step {
+			sampled = append(sampled, points[i])
+		}
+		points = sampled
+	}
+
+	// Every angle spreads the same points over the rows, so the sum of
+	// squares grows with the variance
+	rows := make([]int, 2*(w+h)+1)
+	score := func(angle float64) float64 {
+		sin, cos := math.Sincos(angle * math.Pi / 180)
+		clear(rows)
+		for _, p := range points {
+			rows[w+h+int(math.Round(p[1]*cos-p[0]*sin))]++
+		}
+		var sumSq float64
+		for _, n := range rows {
+			sumSq += float64(n) * float64(n)
+		}
+		return sumSq
+	}
+
+	best, bestScore := 0.0, score(0)
+	search := func(from, to, step float64) {
+		for angle := from; angle <= to+step/2; angle += step {
+			if s := score(angle); s > bestScore {
+				best, bestScore = angle, s
+			}
+		}
+	}
+	search(-maxSkew, maxSkew, 1)
+	search(best-1, best+1, 0.1)
+	return best
+}
+
+// rotate turns the image by degrees around its center, filling the corners
+// with white
+func rotate(src *image.Gray, degrees float64) *image.Gray {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	sin, cos := math.Sincos(degrees * math.Pi / 180)
+	cx, cy := float64(w)/2, float64(h)/2
+
+	dst := image.NewGray(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			// Map each output pixel back to where it comes from
+			dx, dy := float64(x)-cx, float64(y)-cy
+			sx := dx*cos + dy*sin + cx
+			sy := -dx*sin + dy*cos + cy
+			dst.Pix[y*dst.Stride+x] = sampleBilinear(src, sx, sy, 255)
+		}
+	}
+	return dst
+}
+
+// sampleBilinear returns the interpolated value at (x, y), or background
+// outside the image
+func sampleBilinear(img *image.Gray, x, y float64, background uint8) uint8 {
+	w, h := img.Bounds().Dx(), img.Bounds().Dy()
+	if x < -0.5 || y < -0.5 || x > float64(w)-0.5 || y > float64(h)-0.5 {
+		return background
+	}
+	x = math.Max(0, math.Min(x, float64(w-1)))
+	y = math.Max(0, math.Min(y, float64(h-1)))
+
+	x0, y0 := int(x), int(y)
+	x1, y1 := min(x0+1, w-1), min(y0+1, h-1)
+	fx, fy := x-float64(x0), y-float64(y0)
+
+	at := func(x, y int) float64 { return float64(img.Pix[y*img.Stride+x]) }
+	top := at(x0, y0)*(1-fx) + at(x1, y0)*fx
+	bottom := at(x0, y1)*(1-fx) + at(x1, y1)*fx
+	return uint8(math.Round(top*(1-fy) + bottom*fy))
+}
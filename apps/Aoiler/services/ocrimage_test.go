@@ -0,0 +1,163 @@
+package services
+
+import (
+	"image"
+	"image/color"
+	"math"
+	"testing"
+)
+
+// grayImage creates a w×h image filled with background
+func grayImage(w, h int, background uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for i := range img.Pix {
+		img.Pix[i] = background
+	}
+	return img
+}
+
+// textLines draws dashed lines, like lines of text, turned clockwise by
+// degrees around the middle
+func textLines(w, h int, degrees float64) *image.Gray {
+	img := grayImage(w, h, 255)
+	slope := math.Tan(degrees * math.Pi / 180)
+	for top := 100; top < h-100; top += 40 {
+		for x := 50; x < w-50; x++ {
+			if x%15 >= 10 {
+				continue
+			}
+			for t := range 4 {
+				y := top + t + int(math.Round(float64(x-w/2)*slope))
+				img.SetGray(x, y, color.Gray{Y: 0})
+			}
+		}
+	}
+	return img
+}
+
+func TestOtsuThreshold(t *testing.T) {
+	var histogram [256]int
+	histogram[40] = 300
+	histogram[45] = 100
+	histogram[200] = 500
+	histogram[210] = 100
+	got := otsuThreshold(histogram, 1000)
+	if got < 45 || got >= 200 {
+		t.Errorf("otsuThreshold = %d, want between the two peaks", got)
+	}
+
+	// A flat image has nothing to separate
+	var flat [256]int
+	flat[128] = 50
+	if got := otsuThreshold(flat, 50); got != 127 {
+		t.Errorf("otsuThreshold(flat) = %d, want the default 127", got)
+	}
+}
+
+func TestBinarize(t *testing.T) {
+	tests := []struct {
+		name             string
+		background, text uint8
+	}{
+		{"light theme", 230, 30},
+		{"dark theme", 25, 210},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			img := grayImage(10, 10, tt.background)
+			for x := 2; x < 8; x++ {
+				img.Pix[5*img.Stride+x] = tt.text
+			}
+			binarize(img)
+			if got := img.GrayAt(0, 0).Y; got != 255 {
+				t.Errorf("background = %d, want white", got)
+			}
+			if got := img.GrayAt(4, 5).Y; got != 0 {
+				t.Errorf("text = %d, want black", got)
+			}
+		})
+	}
+}
+
+func TestUpscale(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 2, 1))
+	src.Pix[0], src.Pix[1] = 0, 255
+
+	dst := upscale(src)
+	if got := dst.Bounds().Size(); got != image.Pt(8, 4) {
+		t.Fatalf("upscale size = %v, want 8x4", got)
+	}
+	// Edges keep the source values and the middle is interpolated
+	want := []uint8{0, 0, 32, 96, 159, 223, 255, 255}
+	for x, w := range want {
+		if got := dst.GrayAt(x, 2).Y; got != w {
+			t.Errorf("pixel %d = %d, want %d", x, got, w)
+		}
+	}
+
+	// Images already tall enough are left alone
+	tall := grayImage(10, ocrTargetHeight, 255)
+	if got := upscale(tall); got != tall {
+		t.Errorf("upscale resized a %d pixel tall image", ocrTargetHeight)
+	}
+}
+
+func TestPreprocessImageSizes(t *testing.T) {
+	tests := []struct {
+		w, h int
+		want image.Point
+	}{
+		{0, 0, image.Pt(0, 0)},
+		{0, 5, image.Pt(0, 5)},
+		{1, 1, image.Pt(maxOCRScale, maxOCRScale)},
+	}
+	for _, tt := range tests {
+		got := preprocessImage(grayImage(tt.w, tt.h, 200))
+		if size := got.Bounds().Size(); size != tt.want {
+			t.Errorf("preprocessImage(%dx%d) size = %v, want %v", tt.w, tt.h, size, tt.want)
+		}
+	}
+}
+
+func TestPreprocessImageDarkTheme(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	for y := range 10 {
+		for x := range 20 {
+			c := color.RGBA{R: 30, G: 30, B: 40, A: 255}
+			if y >= 4 && y < 6 && x >= 2 && x < 18 {
+				c = color.RGBA{R: 220, G: 220, B: 220, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+
+	got := preprocessImage(img)
+	scale := got.Bounds().Dx() / 20
+	if got.GrayAt(0, 0).Y != 255 {
+		t.Error("dark background was not turned white")
+	}
+	if got.GrayAt(10*scale, 5*scale).Y != 0 {
+		t.Error("light text was not turned black")
+	}
+}
+
+func TestSkewAngle(t *testing.T) {
+	for _, angle := range []float64{0, 3, -4.5} {
+		img := textLines(600, 1000, angle)
+		if got := skewAngle(img); math.Abs(got-angle) > 0.15 {
+			t.Errorf("skewAngle(%v°) = %.2f", angle, got)
+		}
+	}
+
+	// Too few dark pixels to tell
+	if got := skewAngle(grayImage(50, 50, 255)); got != 0 {
+		t.Errorf("skewAngle(blank) = %v, want 0", got)
+	}
+}
+
+func TestPreprocessImageDeskews(t *testing.T) {
+	got := preprocessImage(textLines(600, 1000, 3))
+	if angle := skewAngle(got); math.Abs(angle) > 0.25 {
+		t.Errorf("skew after preprocessing = %.2f°, want straight lines", angle)
+	}
+}
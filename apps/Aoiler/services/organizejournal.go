@@ -0,0 +1,389 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// planLifetime is how long a dry run can be executed
+const planLifetime = time.Hour
+
+// organizeJournal records an executed plan so it can be undone. On disk it
+// is a JSON lines log: a header with Root and Executed, then one
+// journalEntry per folder created or file moved, appended as it happens.
+type organizeJournal struct {
+	Root  string
+	Moves []OrganizeMove
+	// Created lists the folders the plan made, parents first
+	Created  []string
+	Executed time.Time
+}
+
+// journalEntry is one line of a journal after the header
+type journalEntry struct {
+	Created string        `json:"created,omitempty"`
+	Move    *OrganizeMove `json:"move,omitempty"`
+}
+
+// journalHeader is the first line of a journal
+type journalHeader struct {
+	Root     string    `json:"root"`
+	Executed time.Time `json:"executed"`
+}
+
+func organizeJournalDir() string {
+	return filepath.Join(dataDir(), "organize-journal")
+}
+
+// Execute carries out a plan returned by Plan. Files that changed since the
+// plan was made are left alone. The journal is created before the first
+// move and each move is appended to it right after it happens, so a run
+// that is cancelled or killed partway can still be undone. A cancelled run
+// returns what it did along with the error.
+func (o *OrganizerService) Execute(ctx context.Context, planID string) (OrganizerResult, error) {
+	o.mu.Lock()
+	plan, ok := o.plans[planID]
+	delete(o.plans, planID)
+	o.mu.Unlock()
+	if !ok || time.Since(plan.created) > planLifetime {
+		return OrganizerResult{}, fmt.Errorf("no organize plan to execute; ask for a new plan")
+	}
+
+	result := OrganizerResult{Path: plan.root, Success: true, Executed: true}
+	journal, err := createOrganizeJournal(plan.root, time.Now())
+	if err != nil {
+		return result, fmt.Errorf("nothing was moved: %w", err)
+	}
+	result.JournalID = journal.id
+
+	var moves []OrganizeMove
+	var failures []string
+	var journalErr error
+	for _, move := range plan.moves {
+		if ctx.Err() != nil || journalErr != nil {
+			break
+		}
+		if _, err := os.Lstat(move.From); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: no longer there", filepath.Base(move.From)))
+			continue
+		}
+		if _, err := os.Lstat(move.To); err == nil {
+			failures = append(failures, fmt.Sprintf("%s: %s already exists", filepath.Base(move.From), move.To))
+			continue
+		}
+
+		created, err := mkdirAllTracked(filepath.Dir(move.To))
+		for _, dir := range created {
+			if journalErr == nil {
+				journalErr = journal.append(journalEntry{Created: dir})
+			}
+		}
+		if err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", filepath.Base(move.From), err))
+			continue
+		}
+		if journalErr != nil {
+			// Moving files that could not be undone is worse than stopping
+			break
+		}
+		if err := os.Rename(move.From, move.To); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", filepath.Base(move.From), err))
+			continue
+		}
+		moves = append(moves, move)
+		journalErr = journal.append(journalEntry{Move: &move})
+	}
+	if err := journal.close(len(moves) > 0); err != nil && journalErr == nil {
+		journalErr = err
+	}
+	if len(moves) == 0 {
+		result.JournalID = ""
+	}
+
+	result.Moves = moves
+	result.Failed = failures
+	result.Success = len(failures) == 0 && journalErr == nil && ctx.Err() == nil
+	result.Output = fmt.Sprintf("Moved %d files", len(moves))
+	if len(failures) > 0 {
+		result.Output += fmt.Sprintf(", %d could not be moved", len(failures))
+	}
+
+	if journalErr != nil {
+		return result, fmt.Errorf("stopped after %d files, the last may not be recorded for undo: %w", len(moves), journalErr)
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// Undo moves the files of the last executed plan back and removes the
+// folders it created, if they are empty again
+func (o *OrganizerService) Undo(ctx context.Context) (OrganizerResult, error) {
+	path, journal, err := latestOrganizeJournal()
+	if err != nil {
+		return OrganizerResult{}, err
+	}
+
+	result := OrganizerResult{Path: journal.Root, Success: true, Undone: true}
+	var failures []string
+	var restored, remaining []OrganizeMove
+
+	for i := len(journal.Moves) - 1; i >= 0; i-- {
+		move := journal.Moves[i]
+		if ctx.Err() != nil {
+			for ; i >= 0; i-- {
+				remaining = append(remaining, journal.Moves[i])
+			}
+			break
+		}
+		if _, err := os.Lstat(move.From); err == nil {
+			failures = append(failures, fmt.Sprintf("%s: a file is back in its place", filepath.Base(move.From)))
+			remaining = append(remaining, move)
+			continue
+		}
+		if err := os.Rename(move.To, move.From); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", filepath.Base(move.From), err))
+			remaining = append(remaining, move)
+			continue
+		}
+		restored = append(restored, OrganizeMove{From: move.To, To: move.From, Reason: "undo"})
+	}
+
+	// Children were created after their parents; folders that still hold
+	// files are not removed
+	for i := len(journal.Created) - 1; i >= 0; i-- {
+		os.Remove(journal.Created[i])
+	}
+
+	result.Moves = restored
+	result.Failed = failures
+	result.Success = len(failures) == 0 && ctx.Err() == nil
+	result.Output = fmt.Sprintf("Restored %d files", len(restored))
+	if len(failures) > 0 {
+		result.Output += fmt.Sprintf(", %d could not be restored", len(failures))
+	}
+
+	if len(remaining) > 0 {
+		// Keep what could not be restored so undo can be tried again.
+		// Moves are undone newest first, so remaining is in reverse.
+		for i, j := 0, len(remaining)-1; i < j; i, j = i+1, j-1 {
+			remaining[i], remaining[j] = remaining[j], remaining[i]
+		}
+		journal.Moves = remaining
+		if err := writeOrganizeJournal(path, journal); err != nil {
+			return result, err
+		}
+	} else {
+		os.Remove(path)
+	}
+	if ctx.Err() != nil {
+		return result, ctx.Err()
+	}
+	return result, nil
+}
+
+// addPlan stores a plan and forgets expired ones
+func (o *OrganizerService) addPlan(plan *organizePlan) string {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for id, p := range o.plans {
+		if time.Since(p.created) > planLifetime {
+			delete(o.plans, id)
+		}
+	}
+	id := NewRequestID()
+	o.plans[id] = plan
+	return id
+}
+
+// latestPlan returns the ID of the newest plan
+func (o *OrganizerService) latestPlan() string {
+	o.mu.RLock()
+	defer o.mu.RUnlock()
+
+	var latestID string
+	var latest time.Time
+	for id, p := range o.plans {
+		if p.created.After(latest) {
+			latestID, latest = id, p.created
+		}
+	}
+	return latestID
+}
+
+// mkdirAllTracked creates dir and its missing parents and returns the
+// folders it created, parents first
+func mkdirAllTracked(dir string) ([]string, error) {
+	var missing []string
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Lstat(d); err == nil {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+
+	var created []string
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Mkdir(missing[i], 0755); err != nil && !os.IsExist(err) {
+			return created, err
+		}
+		created = append(created, missing[i])
+	}
+	return created, nil
+}
+
+// journalLog is a journal being written by Execute
+type journalLog struct {
+	id   string
+	path string
+	file *os.File
+}
+
+// createOrganizeJournal starts a journal with its header
+func createOrganizeJournal(root string, executed time.Time) (*journalLog, error) {
+	if err := os.MkdirAll(organizeJournalDir(), 0700); err != nil {
+		return nil, fmt.Errorf("failed to create organize journal: %w", err)
+	}
+	// Sortable IDs make the newest journal the last one
+	id := fmt.Sprintf("%s-%s", executed.Format("20060102T150405.000"), NewRequestID()[:6])
+	path := filepath.Join(organizeJournalDir(), id+".jsonl")
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create organize journal: %w", err)
+	}
+
+	log := &journalLog{id: id, path: path, file: file}
+	if err := log.writeLine(journalHeader{Root: root, Executed: executed}); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	// The header must be on disk before anything moves
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(path)
+		return nil, fmt.Errorf("failed to write organize journal: %w", err)
+	}
+	return log, nil
+}
+
+// append records a folder or move. Each line is written with one call, so
+// a killed process leaves at most the line being written incomplete.
+func (j *journalLog) append(entry journalEntry) error {
+	return j.writeLine(entry)
+}
+
+func (j *journalLog) writeLine(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to encode organize journal: %w", err)
+	}
+	if _, err := j.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write organize journal: %w", err)
+	}
+	return nil
+}
+
+// close flushes the journal, or removes it when there is nothing to undo
+func (j *journalLog) close(keep bool) error {
+	syncErr := j.file.Sync()
+	closeErr := j.file.Close()
+	if !keep {
+		// Folders created without a move are left for the user; they are empty
+		os.Remove(j.path)
+		return nil
+	}
+	if err := errors.Join(syncErr, closeErr); err != nil {
+		return fmt.Errorf("failed to write organize journal: %w", err)
+	}
+	return nil
+}
+
+// writeOrganizeJournal replaces the journal at path with journal
+func writeOrganizeJournal(path string, journal organizeJournal) error {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	if err := encoder.Encode(journalHeader{Root: journal.Root, Executed: journal.Executed}); err != nil {
+		return fmt.Errorf("failed to encode organize journal: %w", err)
+	}
+	for _, dir := range journal.Created {
+		encoder.Encode(journalEntry{Created: dir})
+	}
+	for i := range journal.Moves {
+		encoder.Encode(journalEntry{Move: &journal.Moves[i]})
+	}
+	if err := writeFileAtomic(path, b.Bytes(), 0600); err != nil {
+		return fmt.Errorf("failed to write organize journal: %w", err)
+	}
+	return nil
+}
+
+// readOrganizeJournal parses a journal. An incomplete last line, left by a
+// process killed while writing it, is ignored.
+func readOrganizeJournal(path string) (organizeJournal, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return organizeJournal{}, fmt.Errorf("failed to read organize journal: %w", err)
+	}
+	lines := strings.Split(strings.TrimRight(string(data), "\n"), "\n")
+
+	var header journalHeader
+	if err := json.Unmarshal([]byte(lines[0]), &header); err != nil {
+		return organizeJournal{}, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	journal := organizeJournal{Root: header.Root, Executed: header.Executed}
+	for i, line := range lines[1:] {
+		var entry journalEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			if i == len(lines)-2 {
+				break
+			}
+			return organizeJournal{}, fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		if entry.Created != "" {
+			journal.Created = append(journal.Created, entry.Created)
+		}
+		if entry.Move != nil {
+			journal.Moves = append(journal.Moves, *entry.Move)
+		}
+	}
+	return journal, nil
+}
+
+// latestOrganizeJournal returns the most recent journal and its path
+func latestOrganizeJournal() (string, organizeJournal, error) {
+	entries, err := os.ReadDir(organizeJournalDir())
+	if err != nil && !os.IsNotExist(err) {
+		return "", organizeJournal{}, fmt.Errorf("failed to read organize journal: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if strings.HasSuffix(entry.Name(), ".jsonl") {
+			names = append(names, entry.Name())
+		}
+	}
+	if len(names) == 0 {
+		return "", organizeJournal{}, fmt.Errorf("nothing to undo")
+	}
+	sort.Strings(names)
+
+	path := filepath.Join(organizeJournalDir(), names[len(names)-1])
+	journal, err := readOrganizeJournal(path)
+	if err != nil {
+		return "", organizeJournal{}, err
+	}
+	return path, journal, nil
+}
@@ -0,0 +1,520 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Organizer modes
+const (
+	OrganizeByCategory = "category"
+	OrganizeByDate     = "date"
+	OrganizeBySize     = "size"
+	OrganizeByFilename = "filename"
+)
+
+// OrganizeRule sends the files it matches to a folder. Rules are tried in
+// order before the mode; the conditions that are set must all hold.
+type OrganizeRule struct {
+	// Match is a regular expression matched against the file name
+	Match string `toml:"match,omitempty" json:"match,omitempty"`
+	// Extensions limits the rule to these extensions, without the dot
+	Extensions []string `toml:"extensions,omitempty" json:"extensions,omitempty"`
+	// MinSize and MaxSize bound the file size, e.g. "100MB"
+	MinSize string `toml:"min_size,omitempty" json:"minSize,omitempty"`
+	MaxSize string `toml:"max_size,omitempty" json:"maxSize,omitempty"`
+	// Folder is relative to the organized folder. {category}, {year},
+	// {month}, {size} and {ext} are filled in from the file.
+	Folder string `toml:"folder" json:"folder"`
+}
+
+// OrganizeMove is one file move of an organize plan
+type OrganizeMove struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Reason names the rule or mode that chose the folder
+	Reason string `json:"reason"`
+}
+
+// organizeCategories are the folders the category mode sorts files into
+var organizeCategories = []struct {
+	folder     string
+	extensions []string
+}{
+	{"Images", []string{"png", "jpg", "jpeg", "gif", "webp", "bmp", "svg", "heic", "tiff", "ico"}},
+	{"Videos", []string{"mp4", "mkv", "webm", "avi", "mov", "flv", "wmv", "m4v"}},
+	{"Audio", []string{"mp3", "flac", "wav", "ogg", "m4a", "opus", "aac"}},
+	{"Documents", []string{"pdf", "doc", "docx", "odt", "txt", "md", "rtf", "epub", "xls", "xlsx", "ods", "csv", "ppt", "pptx", "odp"}},
+	{"Archives", []string{"zip", "tar", "gz", "xz", "zst", "7z", "rar", "bz2", "tgz", "iso"}},
+	{"Code", []string{"py", "go", "rs", "js", "ts", "c", "cpp", "h", "java", "sh", "lua", "json", "toml", "yaml", "yml", "html", "css"}},
+	{"Installers", []string{"deb", "rpm", "appimage", "flatpakref", "exe", "msi"}},
+	{"Fonts", []string{"ttf", "otf", "woff", "woff2"}},
+}
+
+// organizeSizes are the folders the size mode sorts files into, by upper bound
+var organizeSizes = []struct {
+	folder string
+	below  int64
+}{
+	{"Small", 1 << 20},
+	{"Medium", 100 << 20},
+	{"Large", 1 << 30},
+	{"Huge", 1<<63 - 1},
+}
+
+// unfinishedSuffixes mark downloads that are still being written
+var unfinishedSuffixes = []string{".part", ".crdownload", ".download", ".tmp"}
+
+// OrganizerService sorts the files of a folder into subfolders. It plans
+// the moves first; nothing is moved until the plan is executed, and every
+// executed plan can be undone.
+type OrganizerService struct {
+	mu          sync.RWMutex
+	defaultMode string
+	rules       []OrganizeRule
+	// plans are dry runs waiting to be executed, by ID
+	plans map[string]*organizePlan
+}
+
+type organizePlan struct {
+	root    string
+	moves   []OrganizeMove
+	created time.Time
+}
+
+func NewOrganizerService() *OrganizerService {
+	return &OrganizerService{
+		defaultMode: DefaultConfig().Services.Organizer.DefaultMode,
+		plans:       make(map[string]*organizePlan),
+	}
+}
+
+// ApplyConfig sets the default mode and the rules
+func (o *OrganizerService) ApplyConfig(cfg Config) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.defaultMode = cfg.Services.Organizer.DefaultMode
+	o.rules = cfg.Services.Organizer.Rules
+}
+
+func (o *OrganizerService) Name() string { return "organizer" }
+func (o *OrganizerService) Description() string {
+	return "Organize the files of a folder by type, date, size or name"
+}
+
+func (o *OrganizerService) Keywords() []string {
+	return []string{"organize", "organise", "clean", "sort", "tidy"}
+}
+
+func (o *OrganizerService) Params() map[string]string {
+	return map[string]string{
+		ParamPath: "directory to organize",
+		ParamMode: `"category" to group by file type, "date" by year and month, "size" by size, "filename" by name, ` +
+			`"execute" to carry out the last plan or "undo" to reverse the last organize`,
+		"pattern": "regular expression for the names of the files to move",
+		"folder":  "folder the files matching pattern go to",
+	}
+}
+
+// HasSideEffects reports whether the intent moves files rather than planning
+func (o *OrganizerService) HasSideEffects(intent Intent) bool {
+	mode := intent.Params[ParamMode]
+	if mode == "" {
+		mode = organizeMode(intent.Query)
+	}
+	return mode == "execute" || mode == "undo"
+}
+
+func (o *OrganizerService) Handle(ctx context.Context, intent Intent) (interface{}, error) {
+	mode := intent.Params[ParamMode]
+	if mode == "" {
+		mode = organizeMode(intent.Query)
+	}
+
+	switch mode {
+	case "undo":
+		return o.Undo(ctx)
+	case "execute":
+		return o.Execute(ctx, o.latestPlan())
+	}
+
+	if mode == "" {
+		o.mu.RLock()
+		mode = o.defaultMode
+		o.mu.RUnlock()
+	}
+	if mode == "" {
+		mode = OrganizeByCategory
+	}
+
+	o.mu.RLock()
+	rules := append([]OrganizeRule(nil), o.rules...)
+	o.mu.RUnlock()
+
+	// "move files matching invoice into Invoices" only moves those files
+	pattern, folder := intent.Params["pattern"], intent.Params["folder"]
+	if pattern == "" {
+		pattern, folder = organizePattern(intent.Query)
+	}
+	if pattern != "" {
+		if folder == "" {
+			return OrganizerResult{}, fmt.Errorf("no folder given for files matching %s", pattern)
+		}
+		rules = []OrganizeRule{{Match: pattern, Folder: folder}}
+		mode = ""
+	}
+
+	return o.Plan(ctx, intent.Params[ParamPath], mode, rules)
+}
+
+// organizeMode picks the mode from the wording of the query, or returns an
+// empty string when the query does not say
+func organizeMode(query string) string {
+	lowerQuery := strings.ToLower(query)
+	modes := []struct {
+		mode  string
+		words []string
+		// whole requires whole words: "organize restored photos" is not an undo
+		whole bool
+	}{
+		{"undo", []string{"undo", "revert", "restore"}, true},
+		{"execute", []string{"confirm", "execute", "apply", "go ahead", "do it"}, true},
+		{OrganizeBySize, []string{"size", "big", "large"}, false},
+		{OrganizeByDate, []string{"date", "month", "year", "when"}, false},
+		{OrganizeByCategory, []string{"category", "type", "kind", "extension"}, false},
+		{OrganizeByFilename, []string{"filename", "name"}, false},
+	}
+	for _, m := range modes {
+		for _, word := range m.words {
+			if m.whole && containsWholeWord(lowerQuery, word) || !m.whole && containsWord(lowerQuery, word) {
+				return m.mode
+			}
+		}
+	}
+	return ""
+}
+
+// organizePattern reads "files matching <regex> into <folder>" from a query
+func organizePattern(query string) (string, string) {
+	_, rest, ok := strings.Cut(query, "matching ")
+	if !ok {
+		return "", ""
+	}
+	pattern, folder, _ := strings.Cut(rest, " into ")
+	return firstArgument(pattern), firstArgument(folder)
+}
+
+// firstArgument returns the quoted string at the start of text, or its first word
+func firstArgument(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return ""
+	}
+	if quote := text[0]; quote == '\'' || quote == '"' {
+		if end := strings.IndexByte(text[1:], quote); end >= 0 {
+			return text[1 : end+1]
+		}
+		return text[1:]
+	}
+	return strings.Fields(text)[0]
+}
+
+// Plan works out where each file in path goes without moving anything. The
+// returned PlanID executes the plan.
+func (o *OrganizerService) Plan(ctx context.Context, path, mode string, rules []OrganizeRule) (OrganizerResult, error) {
+	if path == "" {
+		path = "."
+	}
+	root, err := filepath.Abs(expandHome(path))
+	if err != nil {
+		return OrganizerResult{}, err
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return OrganizerResult{}, fmt.Errorf("folder not found: %s", path)
+	}
+	if !info.IsDir() {
+		return OrganizerResult{}, fmt.Errorf("not a folder: %s", path)
+	}
+
+	compiled, err := compileOrganizeRules(rules)
+	if err != nil {
+		return OrganizerResult{}, err
+	}
+
+	entries, err := os.ReadDir(root)
+	if err != nil {
+		return OrganizerResult{}, fmt.Errorf("failed to read %s: %w", root, err)
+	}
+
+	var files []os.FileInfo
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return OrganizerResult{}, ctx.Err()
+		}
+		if !entry.Type().IsRegular() || strings.HasPrefix(entry.Name(), ".") || isUnfinished(entry.Name()) {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			files = append(files, info)
+		}
+	}
+
+	prefixes := filenameGroups(files)
+	reserved := make(map[string]bool)
+	result := OrganizerResult{Path: root, Mode: mode, Success: true}
+
+	for _, file := range files {
+		folder, reason := "", ""
+		for _, rule := range compiled {
+			if rule.matches(file) {
+				folder, reason = rule.Folder, "rule: "+rule.describe()
+				break
+			}
+		}
+		if folder == "" {
+			folder, reason = modeFolder(mode, file, prefixes)
+		}
+		if folder == "" {
+			result.Skipped++
+			continue
+		}
+
+		target := filepath.Join(root, expandOrganizeFolder(folder, file), file.Name())
+		if filepath.Dir(target) == root {
+			result.Skipped++
+			continue
+		}
+		target = reserveTarget(target, reserved)
+		result.Moves = append(result.Moves, OrganizeMove{
+			From:   filepath.Join(root, file.Name()),
+			To:     target,
+			Reason: reason,
+		})
+	}
+
+	sort.Slice(result.Moves, func(i, j int) bool { return result.Moves[i].To < result.Moves[j].To })
+	result.Output = fmt.Sprintf("%d files to move, %d left in place", len(result.Moves), result.Skipped)
+	if len(result.Moves) > 0 {
+		result.PlanID = o.addPlan(&organizePlan{root: root, moves: result.Moves, created: time.Now()})
+	}
+	return result, nil
+}
+
+// modeFolder returns the folder the mode puts a file in, or "" to leave it
+func modeFolder(mode string, file os.FileInfo, prefixes map[string]string) (string, string) {
+	switch mode {
+	case OrganizeByCategory:
+		if category := fileCategory(file.Name()); category != "" {
+			return "{category}", "category: " + category
+		}
+	case OrganizeByDate:
+		return "{year}/{month}", "modified " + file.ModTime().Format("January 2006")
+	case OrganizeBySize:
+		return "{size}", "size: " + humanSize(file.Size())
+	case OrganizeByFilename:
+		if prefix := prefixes[file.Name()]; prefix != "" {
+			return prefix, "name starts with " + prefix
+		}
+	}
+	return "", ""
+}
+
+// fileCategory returns the category folder of a file name, or ""
+func fileCategory(name string) string {
+	ext := strings.TrimPrefix(strings.ToLower(filepath.Ext(name)), ".")
+	for _, category := range organizeCategories {
+		for _, e := range category.extensions {
+			if e == ext {
+				return category.folder
+			}
+		}
+	}
+	return ""
+}
+
+// filenameGroups maps file names to the first word they share with at least
+// one other file, which the filename mode uses as their folder
+func filenameGroups(files []os.FileInfo) map[string]string {
+	firstWord := func(name string) string {
+		stem := strings.TrimSuffix(name, filepath.Ext(name))
+		word := strings.FieldsFunc(stem, func(r rune) bool {
+			return r == ' ' || r == '_' || r == '-' || r == '.' || r == '(' || r == ')'
+		})
+		if len(word) == 0 || len(word[0]) < 3 || isDigits(word[0]) {
+			return ""
+		}
+		return word[0]
+	}
+
+	counts := make(map[string]int)
+	for _, file := range files {
+		if word := strings.ToLower(firstWord(file.Name())); word != "" {
+			counts[word]++
+		}
+	}
+	groups := make(map[string]string)
+	for _, file := range files {
+		word := firstWord(file.Name())
+		if word != "" && counts[strings.ToLower(word)] > 1 {
+			groups[file.Name()] = word
+		}
+	}
+	return groups
+}
+
+// expandOrganizeFolder fills in the placeholders of a rule folder
+func expandOrganizeFolder(folder string, file os.FileInfo) string {
+	size := organizeSizes[len(organizeSizes)-1].folder
+	for _, s := range organizeSizes {
+		if file.Size() < s.below {
+			size = s.folder
+			break
+		}
+	}
+	category := fileCategory(file.Name())
+	if category == "" {
+		category = "Other"
+	}
+	return strings.NewReplacer(
+		"{category}", category,
+		"{year}", file.ModTime().Format("2006"),
+		"{month}", file.ModTime().Format("01"),
+		"{size}", size,
+		"{ext}", strings.TrimPrefix(strings.ToLower(filepath.Ext(file.Name())), "."),
+	).Replace(folder)
+}
+
+// reserveTarget returns target, numbered when it exists or another move of
+// the plan already goes there
+func reserveTarget(target string, reserved map[string]bool) string {
+	candidate := target
+	ext := filepath.Ext(target)
+	for i := 1; ; i++ {
+		if _, err := os.Lstat(candidate); os.IsNotExist(err) && !reserved[candidate] {
+			reserved[candidate] = true
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s-%d%s", strings.TrimSuffix(target, ext), i, ext)
+	}
+}
+
+func isUnfinished(name string) bool {
+	lowerName := strings.ToLower(name)
+	for _, suffix := range unfinishedSuffixes {
+		if strings.HasSuffix(lowerName, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// compiledRule is an OrganizeRule ready to match files
+type compiledRule struct {
+	OrganizeRule
+	match   *regexp.Regexp
+	minSize int64
+	maxSize int64
+}
+
+func compileOrganizeRules(rules []OrganizeRule) ([]compiledRule, error) {
+	compiled := make([]compiledRule, 0, len(rules))
+	for _, rule := range rules {
+		c := compiledRule{OrganizeRule: rule}
+		c.Extensions = make([]string, len(rule.Extensions))
+		for i, ext := range rule.Extensions {
+			c.Extensions[i] = strings.TrimPrefix(strings.ToLower(ext), ".")
+		}
+		if err := validateOrganizeFolder(rule.Folder); err != nil {
+			return nil, err
+		}
+		if rule.Match != "" {
+			re, err := regexp.Compile(rule.Match)
+			if err != nil {
+				return nil, fmt.Errorf("invalid organize pattern %q: %w", rule.Match, err)
+			}
+			c.match = re
+		}
+		for _, bound := range []struct {
+			text string
+			size *int64
+		}{{rule.MinSize, &c.minSize}, {rule.MaxSize, &c.maxSize}} {
+			if strings.TrimSpace(bound.text) == "" {
+				continue
+			}
+			size, used := parseByteSize(strings.Fields(strings.ToLower(bound.text)))
+			if used == 0 {
+				return nil, fmt.Errorf("invalid organize size %q", bound.text)
+			}
+			*bound.size = size
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
+
+// validateOrganizeFolder keeps rule folders inside the organized folder
+func validateOrganizeFolder(folder string) error {
+	if strings.TrimSpace(folder) == "" {
+		return fmt.Errorf("organize rule without a folder")
+	}
+	if filepath.IsAbs(folder) || strings.HasPrefix(folder, "~") {
+		return fmt.Errorf("organize folder %q must be relative to the organized folder", folder)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(folder), "/") {
+		if part == ".." {
+			return fmt.Errorf("organize folder %q must stay inside the organized folder", folder)
+		}
+	}
+	return nil
+}
+
+func (r compiledRule) matches(file os.FileInfo) bool {
+	if r.match != nil && !r.match.MatchString(file.Name()) {
+		return false
+	}
+	if len(r.Extensions) > 0 && !hasExtension(file.Name(), r.Extensions) {
+		return false
+	}
+	if r.minSize > 0 && file.Size() < r.minSize {
+		return false
+	}
+	if r.maxSize > 0 && file.Size() >= r.maxSize {
+		return false
+	}
+	return true
+}
+
+// describe summarises the conditions of a rule for the plan
+func (r compiledRule) describe() string {
+	var parts []string
+	if r.Match != "" {
+		parts = append(parts, "matches "+r.Match)
+	}
+	if len(r.Extensions) > 0 {
+		parts = append(parts, strings.Join(r.Extensions, ", "))
+	}
+	if r.MinSize != "" {
+		parts = append(parts, "at least "+r.MinSize)
+	}
+	if r.MaxSize != "" {
+		parts = append(parts, "under "+r.MaxSize)
+	}
+	if len(parts) == 0 {
+		return r.Folder
+	}
+	return strings.Join(parts, ", ")
+}
+
+// GetPathSuggestions for organizer - always shows path suggestions
+func (o *OrganizerService) GetPathSuggestions(input string) (AutoCompleteResult, error) {
+	fs := NewFileSearchService()
+	return fs.GetPathSuggestions(input, true)
+}
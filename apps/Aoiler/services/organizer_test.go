@@ -0,0 +1,142 @@
+package services
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOrganizeMode(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{"undo last organize", "undo"},
+		{"restore the files I organized", "undo"},
+		{"organize restored photos", ""},
+		{"organize ~/Downloads by size", OrganizeBySize},
+		{"go ahead and organize", "execute"},
+		{"organize the applications folder", ""},
+		{"organize executed scripts by type", OrganizeByCategory},
+		{"organize by date", OrganizeByDate},
+	}
+	for _, tt := range tests {
+		if got := organizeMode(tt.query); got != tt.want {
+			t.Errorf("organizeMode(%q) = %q, want %q", tt.query, got, tt.want)
+		}
+	}
+}
+
+// organizeFixture creates files in a temporary root and a plan moving
+// each into a subfolder named after it
+func organizeFixture(t *testing.T, o *OrganizerService, names ...string) (string, string) {
+	t.Helper()
+	t.Setenv("XDG_DATA_HOME", t.TempDir())
+	root := t.TempDir()
+
+	plan := &organizePlan{root: root, created: time.Now()}
+	for _, name := range names {
+		from := filepath.Join(root, name)
+		if err := os.WriteFile(from, []byte(name), 0644); err != nil {
+			t.Fatal(err)
+		}
+		to := filepath.Join(root, "sorted", strings.TrimSuffix(name, filepath.Ext(name)), name)
+		plan.moves = append(plan.moves, OrganizeMove{From: from, To: to, Reason: "test"})
+	}
+	return root, o.addPlan(plan)
+}
+
+func TestOrganizeExecuteUndo(t *testing.T) {
+	o := NewOrganizerService()
+	root, planID := organizeFixture(t, o, "a.txt", "b.txt", "c.txt")
+
+	result, err := o.Execute(context.Background(), planID)
+	if err != nil {
+		t.Fatalf("Execute: %v", err)
+	}
+	if len(result.Moves) != 3 || result.JournalID == "" || !result.Success {
+		t.Fatalf("Execute = %+v, want 3 moves and a journal", result)
+	}
+
+	result, err = o.Undo(context.Background())
+	if err != nil {
+		t.Fatalf("Undo: %v", err)
+	}
+	if len(result.Moves) != 3 {
+		t.Errorf("Undo restored %d files, want 3", len(result.Moves))
+	}
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(root, name)); err != nil {
+			t.Errorf("%s not restored: %v", name, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "sorted")); !os.IsNotExist(err) {
+		t.Errorf("created folders were not removed: %v", err)
+	}
+	if _, err := o.Undo(context.Background()); err == nil {
+		t.Error("second Undo succeeded, want nothing to undo")
+	}
+}
+
+func TestOrganizeExecuteCancelled(t *testing.T) {
+	o := NewOrganizerService()
+	root, planID := organizeFixture(t, o, "a.txt", "b.txt")
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	result, err := o.Execute(ctx, planID)
+	if err != context.Canceled {
+		t.Fatalf("Execute error = %v, want context.Canceled", err)
+	}
+	if !result.Executed || result.Path != root || len(result.Moves) != 0 || result.JournalID != "" {
+		t.Errorf("Execute = %+v, want a partial result without moves", result)
+	}
+}
+
+func TestOrganizeJournalIncremental(t *testing.T) {
+	o := NewOrganizerService()
+	root, planID := organizeFixture(t, o, "a.txt", "b.txt")
+	if _, err := o.Execute(context.Background(), planID); err != nil {
+		t.Fatal(err)
+	}
+	path, _, err := latestOrganizeJournal()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A process killed mid-write leaves half a line at the end
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"move":{"from":"`)
+	f.Close()
+
+	journal, err := readOrganizeJournal(path)
+	if err != nil {
+		t.Fatalf("readOrganizeJournal: %v", err)
+	}
+	if journal.Root != root || len(journal.Moves) != 2 || len(journal.Created) != 3 {
+		t.Errorf("journal = %+v, want 2 moves and 3 folders under %s", journal, root)
+	}
+
+	// A file back in its place is kept in the journal for the next undo
+	os.WriteFile(filepath.Join(root, "a.txt"), nil, 0644)
+	result, err := o.Undo(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Moves) != 1 || len(result.Failed) != 1 {
+		t.Fatalf("Undo = %+v, want 1 restored and 1 failed", result)
+	}
+	journal, err = readOrganizeJournal(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(journal.Moves) != 1 || journal.Moves[0].From != filepath.Join(root, "a.txt") {
+		t.Errorf("remaining moves = %+v, want only a.txt", journal.Moves)
+	}
+}
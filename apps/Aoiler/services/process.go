@@ -0,0 +1,37 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// ErrCancelled is returned by RouteToService when the query was cancelled
+var ErrCancelled = errors.New("cancelled")
+
+// killGracePeriod is how long a cancelled process group gets to exit after
+// SIGTERM before it is killed
+const killGracePeriod = 3 * time.Second
+
+// commandContext is exec.CommandContext for external tools. The command runs
+// in its own process group so cancelling ctx also stops the children it
+// spawned (slurp under the OCR script, ffmpeg helpers), not just the command.
+func commandContext(ctx context.Context, name string, args ...string) *exec.Cmd {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		pgid := -cmd.Process.Pid
+		err := syscall.Kill(pgid, syscall.SIGTERM)
+		time.AfterFunc(killGracePeriod, func() {
+			// The group outlives its leader while children that ignored
+			// SIGTERM are running; ESRCH means they are all gone
+			syscall.Kill(pgid, syscall.SIGKILL)
+		})
+		return err
+	}
+	// Stop waiting for output if a child that ignored SIGTERM keeps the pipe open
+	cmd.WaitDelay = killGracePeriod + time.Second
+	return cmd
+}
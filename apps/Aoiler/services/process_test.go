@@ -0,0 +1,87 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// fakeCommand puts a shell script called name first on PATH
+func fakeCommand(t *testing.T, name, script string) {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"+script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", dir+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestCommandContextKillsIgnoredTerm(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := commandContext(ctx, "sh", "-c", `trap "" TERM; while :; do sleep 0.1; done`)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(100 * time.Millisecond)
+
+	start := time.Now()
+	cancel()
+	cmd.Wait()
+	if elapsed := time.Since(start); elapsed < killGracePeriod || elapsed > killGracePeriod+2*time.Second {
+		t.Errorf("command stopped after %s, want about %s", elapsed, killGracePeriod)
+	}
+}
+
+func TestCommandContextKillsOrphanedChildren(t *testing.T) {
+	// The leader exits on SIGTERM; the child it started ignores it
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := commandContext(ctx, "sh", "-c", `
+(trap "" TERM; while :; do sleep 0.1; done) >/dev/null 2>&1 &
+echo $!
+trap "exit 0" TERM
+wait`)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	var child int
+	if _, err := fmt.Fscan(stdout, &child); err != nil {
+		t.Fatalf("reading child pid: %v", err)
+	}
+
+	cancel()
+	cmd.Wait()
+	if !processRunning(child) {
+		t.Fatal("child stopped on SIGTERM, so the test proves nothing")
+	}
+
+	deadline := time.Now().Add(killGracePeriod + 2*time.Second)
+	for processRunning(child) {
+		if time.Now().After(deadline) {
+			syscall.Kill(child, syscall.SIGKILL)
+			t.Fatal("child of an exited leader was not killed")
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether pid exists and is not a zombie waiting to
+// be reaped
+func processRunning(pid int) bool {
+	data, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// The state follows the command name, which is in parentheses
+	fields := strings.Fields(string(data[bytes.LastIndexByte(data, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
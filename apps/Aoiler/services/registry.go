@@ -0,0 +1,132 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// Service is implemented by everything Aoiler can route a query to
+type Service interface {
+	// Name is the unique identifier used for routing, e.g. "filesearch"
+	Name() string
+	// Description is a short human readable summary shown in the UI
+	Description() string
+	// Keywords are matched against the lowercased query during classification.
+	// Services without keywords are only reachable as the fallback or through
+	// QueryMatcher.
+	Keywords() []string
+	// Handle executes the classified intent
+	Handle(ctx context.Context, intent Intent) (interface{}, error)
+}
+
+// PathFilter is implemented by services that want to filter path
+// autocompletion, e.g. to only show media files for the converter.
+// Directories are always kept so the user can navigate.
+type PathFilter interface {
+	AcceptsPath(path string) bool
+}
+
+// ParamDescriber is implemented by services that take structured parameters.
+// Params maps each parameter name (see ParamPath and friends) to a short
+// description; the LLM classifier is asked to fill exactly these keys.
+type ParamDescriber interface {
+	Params() map[string]string
+}
+
+// QueryMatcher is implemented by services that recognize queries by their
+// shape rather than by keywords, e.g. the calculator for "15% of 240". A
+// service whose MatchesQuery reports true wins over keyword matches.
+type QueryMatcher interface {
+	MatchesQuery(query string) bool
+}
+
+// ServiceInfo describes a registered service
+type ServiceInfo struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Keywords    []string `json:"keywords"`
+}
+
+// Registry holds services in registration order. Order matters: when
+// several services share a keyword, the one registered first wins.
+type Registry struct {
+	mu       sync.RWMutex
+	services []Service
+	byName   map[string]Service
+	fallback string
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		byName: make(map[string]Service),
+	}
+}
+
+// Register adds a service to the registry
+func (r *Registry) Register(service Service) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	name := service.Name()
+	if name == "" {
+		return fmt.Errorf("service name cannot be empty")
+	}
+	if _, exists := r.byName[name]; exists {
+		return fmt.Errorf("service already registered: %s", name)
+	}
+
+	r.services = append(r.services, service)
+	r.byName[name] = service
+	return nil
+}
+
+// SetFallback sets the service used when no keyword matches
+func (r *Registry) SetFallback(name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.byName[name]; !exists {
+		return fmt.Errorf("unknown service: %s", name)
+	}
+	r.fallback = name
+	return nil
+}
+
+// Fallback returns the fallback service name
+func (r *Registry) Fallback() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.fallback
+}
+
+// Get looks up a service by name
+func (r *Registry) Get(name string) (Service, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	service, ok := r.byName[name]
+	return service, ok
+}
+
+// Services returns all registered services in registration order
+func (r *Registry) Services() []Service {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	services := make([]Service, len(r.services))
+	copy(services, r.services)
+	return services
+}
+
+// Info returns a description of every registered service
+func (r *Registry) Info() []ServiceInfo {
+	var infos []ServiceInfo
+	for _, service := range r.Services() {
+		infos = append(infos, ServiceInfo{
+			Name:        service.Name(),
+			Description: service.Description(),
+			Keywords:    service.Keywords(),
+		})
+	}
+	return infos
+}
@@ -0,0 +1,241 @@
+package services
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Chat roles stored in a session
+const (
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// ChatMessage is a single turn of a conversation
+type ChatMessage struct {
+	Role      string    `json:"role"`
+	Content   string    `json:"content"`
+	Provider  string    `json:"provider,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// ChatSession is a conversation whose history is replayed to the provider
+type ChatSession struct {
+	ID        string        `json:"id"`
+	Title     string        `json:"title"`
+	CreatedAt time.Time     `json:"createdAt"`
+	UpdatedAt time.Time     `json:"updatedAt"`
+	Messages  []ChatMessage `json:"messages"`
+}
+
+// SessionSummary is the lightweight listing form of a session
+type SessionSummary struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	UpdatedAt    time.Time `json:"updatedAt"`
+	MessageCount int       `json:"messageCount"`
+}
+
+// SessionStore persists chat sessions as one JSON file per session
+type SessionStore struct {
+	mu  sync.Mutex
+	dir string
+}
+
+// NewSessionStore creates a store under ~/.local/share/aoiler/sessions
+func NewSessionStore() *SessionStore {
+	return &SessionStore{dir: filepath.Join(dataDir(), "sessions")}
+}
+
+// NewSession starts an empty session titled after the first message
+func (s *SessionStore) NewSession(firstMessage string) *ChatSession {
+	now := time.Now()
+	return &ChatSession{
+		ID:        NewRequestID(),
+		Title:     sessionTitle(firstMessage),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+// Load reads a session from disk
+func (s *SessionStore) Load(id string) (*ChatSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.load(id)
+}
+
+func (s *SessionStore) load(id string) (*ChatSession, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("session not found: %s", id)
+		}
+		return nil, fmt.Errorf("failed to read session: %w", err)
+	}
+
+	var session ChatSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return nil, fmt.Errorf("failed to parse session %s: %w", id, err)
+	}
+	return &session, nil
+}
+
+// Save writes a session to disk
+func (s *SessionStore) Save(session *ChatSession) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.save(session)
+}
+
+func (s *SessionStore) save(session *ChatSession) error {
+	path, err := s.path(session.ID)
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(session, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode session: %w", err)
+	}
+	if err := writeFileAtomic(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save session: %w", err)
+	}
+	return nil
+}
+
+// List returns all sessions, most recently updated first
+func (s *SessionStore) List() ([]SessionSummary, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []SessionSummary{}, nil
+		}
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+
+	summaries := []SessionSummary{}
+	for _, entry := range entries {
+		if entry.IsDir() || filepath.Ext(entry.Name()) != ".json" {
+			continue
+		}
+
+		session, err := s.load(strings.TrimSuffix(entry.Name(), ".json"))
+		if err != nil {
+			// Skip unreadable files rather than hiding every other session
+			continue
+		}
+
+		summaries = append(summaries, SessionSummary{
+			ID:           session.ID,
+			Title:        session.Title,
+			UpdatedAt:    session.UpdatedAt,
+			MessageCount: len(session.Messages),
+		})
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].UpdatedAt.After(summaries[j].UpdatedAt)
+	})
+	return summaries, nil
+}
+
+// Rename changes the title of a session
+func (s *SessionStore) Rename(id, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" {
+		return fmt.Errorf("title cannot be empty")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, err := s.load(id)
+	if err != nil {
+		return err
+	}
+	session.Title = title
+	return s.save(session)
+}
+
+// Delete removes a session from disk
+func (s *SessionStore) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("session not found: %s", id)
+		}
+		return fmt.Errorf("failed to delete session: %w", err)
+	}
+	return nil
+}
+
+// ExportMarkdown renders a session as a Markdown document
+func (s *SessionStore) ExportMarkdown(id string) (string, error) {
+	session, err := s.Load(id)
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n", session.Title)
+	fmt.Fprintf(&b, "_Exported from Aoiler on %s_\n", time.Now().Format("2006-01-02 15:04"))
+
+	for _, msg := range session.Messages {
+		heading := "You"
+		if msg.Role == RoleAssistant {
+			heading = "Assistant"
+			if msg.Provider != "" {
+				heading += " (" + msg.Provider + ")"
+			}
+		}
+		fmt.Fprintf(&b, "\n## %s\n\n", heading)
+		fmt.Fprintf(&b, "_%s_\n\n", msg.Timestamp.Format("2006-01-02 15:04"))
+		b.WriteString(strings.TrimSpace(msg.Content))
+		b.WriteString("\n")
+	}
+
+	return b.String(), nil
+}
+
+// path returns the file of a session, rejecting IDs that would escape the store
+func (s *SessionStore) path(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return "", fmt.Errorf("invalid session id: %q", id)
+	}
+	return filepath.Join(s.dir, id+".json"), nil
+}
+
+// sessionTitle derives a title from the first message of a conversation
+func sessionTitle(message string) string {
+	title := strings.Join(strings.Fields(message), " ")
+	if title == "" {
+		return "New conversation"
+	}
+
+	const maxLen = 60
+	if runes := []rune(title); len(runes) > maxLen {
+		title = strings.TrimSpace(string(runes[:maxLen])) + "…"
+	}
+	return title
+}
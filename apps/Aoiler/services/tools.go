@@ -0,0 +1,268 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Event types emitted while the LLM uses tools
+const (
+	// EventTool reports a ToolCallRecord each time a tool call changes status
+	EventTool = "tool"
+	// EventConfirm asks the user to allow a ToolConfirmation
+	EventConfirm = "confirm"
+)
+
+// Tool call statuses
+const (
+	ToolWaiting  = "waiting"
+	ToolRunning  = "running"
+	ToolDone     = "done"
+	ToolDeclined = "declined"
+	ToolFailed   = "failed"
+)
+
+const (
+	// toolConfirmTimeout is how long a tool call waits for the user before
+	// it is declined
+	toolConfirmTimeout = 2 * time.Minute
+	// maxToolOutput bounds the result handed back to the model
+	maxToolOutput = 8000
+)
+
+// SideEffecter is implemented by services that can change something beyond
+// their answer: files, windows, running programs or the audio and screen.
+// Tool calls for which HasSideEffects reports true need the user's consent.
+type SideEffecter interface {
+	HasSideEffects(intent Intent) bool
+}
+
+// Tool describes a service to an LLM that supports tool calling
+type Tool struct {
+	Name        string
+	Description string
+	// Params are the parameters besides the query, as from ParamDescriber
+	Params map[string]string
+}
+
+// ToolCall is a request from the model to run a tool
+type ToolCall struct {
+	ID        string
+	Name      string
+	Arguments map[string]interface{}
+}
+
+// ToolCallRecord is a tool call as it runs, shown in the UI
+type ToolCallRecord struct {
+	ID     string            `json:"id"`
+	Name   string            `json:"name"`
+	Query  string            `json:"query"`
+	Params map[string]string `json:"params,omitempty"`
+	Status string            `json:"status"`
+	Output string            `json:"output,omitempty"`
+	Error  string            `json:"error,omitempty"`
+}
+
+// ToolConfirmation asks whether a tool call with side effects may run.
+// Answer it with Toolbox.Confirm.
+type ToolConfirmation struct {
+	ID     string            `json:"id"`
+	Tool   string            `json:"tool"`
+	Query  string            `json:"query"`
+	Params map[string]string `json:"params,omitempty"`
+}
+
+// Toolbox runs the registered services on behalf of the LLM
+type Toolbox struct {
+	registry *Registry
+	mu       sync.Mutex
+	// pending are the confirmations waiting for an answer, by ID
+	pending map[string]chan bool
+}
+
+// NewToolbox creates a toolbox offering the services in registry
+func NewToolbox(registry *Registry) *Toolbox {
+	return &Toolbox{
+		registry: registry,
+		pending:  make(map[string]chan bool),
+	}
+}
+
+// Tools describes every service except the fallback, which is the LLM itself
+func (tb *Toolbox) Tools() []Tool {
+	var tools []Tool
+	for _, service := range tb.registry.Services() {
+		if service.Name() == tb.registry.Fallback() {
+			continue
+		}
+		tool := Tool{Name: service.Name(), Description: service.Description()}
+		if describer, ok := service.(ParamDescriber); ok {
+			tool.Params = describer.Params()
+		}
+		tools = append(tools, tool)
+	}
+	return tools
+}
+
+// Run executes a tool call. Calls with side effects are only run once the
+// user allows them; without anyone to ask, they are declined.
+func (tb *Toolbox) Run(ctx context.Context, call ToolCall) ToolCallRecord {
+	record := ToolCallRecord{ID: call.ID, Name: call.Name, Params: make(map[string]string)}
+	for key, value := range call.Arguments {
+		if value == nil {
+			continue
+		}
+		if key == "query" {
+			record.Query = fmt.Sprint(value)
+		} else {
+			record.Params[key] = fmt.Sprint(value)
+		}
+	}
+
+	service, ok := tb.registry.Get(call.Name)
+	if !ok || call.Name == tb.registry.Fallback() {
+		record.Status = ToolFailed
+		record.Error = fmt.Sprintf("unknown tool: %s", call.Name)
+		Emit(ctx, EventTool, record)
+		return record
+	}
+
+	intent := Intent{
+		ServiceName: call.Name,
+		Query:       record.Query,
+		Confidence:  1,
+		Params:      record.Params,
+	}
+	if effecter, ok := service.(SideEffecter); ok && effecter.HasSideEffects(intent) {
+		record.Status = ToolWaiting
+		Emit(ctx, EventTool, record)
+		if !tb.confirm(ctx, record) {
+			record.Status = ToolDeclined
+			Emit(ctx, EventTool, record)
+			return record
+		}
+	}
+
+	record.Status = ToolRunning
+	Emit(ctx, EventTool, record)
+
+	result, err := service.Handle(ctx, intent)
+	if err != nil {
+		record.Status = ToolFailed
+		record.Error = err.Error()
+		Emit(ctx, EventTool, record)
+		return record
+	}
+	output, err := json.Marshal(result)
+	if err != nil {
+		record.Status = ToolFailed
+		record.Error = fmt.Sprintf("failed to encode result: %v", err)
+		Emit(ctx, EventTool, record)
+		return record
+	}
+	record.Output = string(output)
+	if len(record.Output) > maxToolOutput {
+		record.Output = record.Output[:maxToolOutput] + "... (truncated)"
+	}
+	record.Status = ToolDone
+	Emit(ctx, EventTool, record)
+	return record
+}
+
+// Confirm answers a ToolConfirmation
+func (tb *Toolbox) Confirm(id string, approved bool) error {
+	tb.mu.Lock()
+	answer, ok := tb.pending[id]
+	delete(tb.pending, id)
+	tb.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("no tool call waiting for confirmation: %s", id)
+	}
+	answer <- approved
+	return nil
+}
+
+// confirm asks the user whether the call in record may run and waits for
+// the answer
+func (tb *Toolbox) confirm(ctx context.Context, record ToolCallRecord) bool {
+	if !hasEventSink(ctx) {
+		return false
+	}
+
+	id := NewRequestID()
+	answer := make(chan bool, 1)
+	tb.mu.Lock()
+	tb.pending[id] = answer
+	tb.mu.Unlock()
+	defer func() {
+		tb.mu.Lock()
+		delete(tb.pending, id)
+		tb.mu.Unlock()
+	}()
+
+	Emit(ctx, EventConfirm, ToolConfirmation{
+		ID:     id,
+		Tool:   record.Name,
+		Query:  record.Query,
+		Params: record.Params,
+	})
+
+	timer := time.NewTimer(toolConfirmTimeout)
+	defer timer.Stop()
+	select {
+	case approved := <-answer:
+		return approved
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return false
+	}
+}
+
+// content is what the model is told about a finished tool call
+func (r ToolCallRecord) content() string {
+	switch r.Status {
+	case ToolDeclined:
+		return "The user declined to run this tool."
+	case ToolFailed:
+		return "error: " + r.Error
+	}
+	return r.Output
+}
+
+// schema returns the JSON schema of the tool's arguments. Gemini spells
+// the types in upper case.
+func (t Tool) schema(upperTypes bool) map[string]interface{} {
+	objectType, stringType := "object", "string"
+	if upperTypes {
+		objectType, stringType = "OBJECT", "STRING"
+	}
+
+	properties := map[string]interface{}{
+		"query": map[string]interface{}{
+			"type":        stringType,
+			"description": "the request for this tool in plain words",
+		},
+	}
+	names := make([]string, 0, len(t.Params))
+	for name := range t.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		properties[name] = map[string]interface{}{
+			"type":        stringType,
+			"description": t.Params[name],
+		}
+	}
+
+	return map[string]interface{}{
+		"type":       objectType,
+		"properties": properties,
+		"required":   []string{"query"},
+	}
+}
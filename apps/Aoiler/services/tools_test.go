@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"testing"
+)
+
+func TestToolboxRunNeedsConfirmation(t *testing.T) {
+	registry := NewRegistry()
+	for _, service := range []Service{NewCalculatorService(), NewMediaService(), NewWindowService(), NewLauncherService()} {
+		if err := registry.Register(service); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tb := NewToolbox(registry)
+
+	tests := []struct {
+		tool  string
+		query string
+	}{
+		{"media", "volume 40"},
+		{"media", "next track"},
+		{"media", "mute mic"},
+		{"windows", "close firefox"},
+		{"windows", "move kitty to workspace 3"},
+		{"launcher", "launch firefox"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.tool+" "+tt.query, func(t *testing.T) {
+			call := ToolCall{ID: "call", Name: tt.tool, Arguments: map[string]interface{}{"query": tt.query}}
+
+			// Without anyone to ask, the call is declined
+			if record := tb.Run(context.Background(), call); record.Status != ToolDeclined {
+				t.Errorf("Run without a sink = %s (%s), want declined", record.Status, record.Error)
+			}
+
+			// With a sink, the user is asked and says no
+			var asked bool
+			ctx := WithRequest(context.Background(), "req", func(event Event) {
+				if event.Type != EventConfirm {
+					return
+				}
+				asked = true
+				if err := tb.Confirm(event.Data.(ToolConfirmation).ID, false); err != nil {
+					t.Error(err)
+				}
+			})
+			if record := tb.Run(ctx, call); record.Status != ToolDeclined {
+				t.Errorf("Run = %s (%s), want declined", record.Status, record.Error)
+			}
+			if !asked {
+				t.Error("Run did not ask for confirmation")
+			}
+		})
+	}
+
+	// Calls without side effects run straight away
+	call := ToolCall{ID: "call", Name: "calculator", Arguments: map[string]interface{}{"query": "2 + 2"}}
+	if record := tb.Run(context.Background(), call); record.Status != ToolDone {
+		t.Errorf("calculator Run = %s (%s), want done", record.Status, record.Error)
+	}
+}